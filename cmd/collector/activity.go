@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// activityDay is the granularity of player_daily_activity
+const activityDay = 24 * time.Hour
+
+// runActivityRollup keeps player_daily_activity current. On start it rebuilds
+// from the last day built (or backfill ago when the table is empty) through
+// today; then, every night at refreshAt past midnight UTC, yesterday and today.
+// Older days are never rebuilt: their raw frontend rows may be gone.
+func runActivityRollup(ctx context.Context, r storage.ActivityRollup, refreshAt, backfill time.Duration) {
+	today := time.Now().UTC().Truncate(activityDay)
+	from := today.Add(-backfill).Truncate(activityDay)
+	if latest, err := r.LatestActivityDay(ctx); err != nil {
+		slog.Error("failed to read player activity", "error", err)
+	} else if !latest.IsZero() {
+		from = latest
+	}
+	refreshActivity(ctx, r, from, today)
+
+	for {
+		next := time.Now().UTC().Truncate(activityDay).Add(refreshAt)
+		if !next.After(time.Now()) {
+			next = next.Add(activityDay)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		today := time.Now().UTC().Truncate(activityDay)
+		refreshActivity(ctx, r, today.Add(-activityDay), today)
+	}
+}
+
+// refreshActivity rebuilds the days from through to, inclusive
+func refreshActivity(ctx context.Context, r storage.ActivityRollup, from, to time.Time) {
+	for d := from; !d.After(to); d = d.Add(activityDay) {
+		start := time.Now()
+		players, err := r.RefreshPlayerActivity(ctx, d)
+		if err != nil {
+			slog.Error("player activity refresh failed", "day", d.Format(time.DateOnly), "error", err)
+			continue
+		}
+		slog.Info("player activity refreshed", "day", d.Format(time.DateOnly), "players", players, "duration", time.Since(start))
+	}
+}
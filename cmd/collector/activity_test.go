@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeRollup records the days refreshed and stops the rollup once today is
+type fakeRollup struct {
+	latest    time.Time
+	latestErr error
+	failOn    time.Time
+	refreshed []time.Time
+	stop      context.CancelFunc
+}
+
+func (f *fakeRollup) RefreshPlayerActivity(ctx context.Context, day time.Time) (int64, error) {
+	f.refreshed = append(f.refreshed, day)
+	if day.Equal(time.Now().UTC().Truncate(activityDay)) {
+		f.stop()
+	}
+	if day.Equal(f.failOn) {
+		return 0, errors.New("statement timeout")
+	}
+	return 1, nil
+}
+
+func (f *fakeRollup) LatestActivityDay(ctx context.Context) (time.Time, error) {
+	return f.latest, f.latestErr
+}
+
+func TestRunActivityRollupCatchUp(t *testing.T) {
+	today := time.Now().UTC().Truncate(activityDay)
+	days := func(from time.Time) []time.Time {
+		var out []time.Time
+		for d := from; !d.After(today); d = d.Add(activityDay) {
+			out = append(out, d)
+		}
+		return out
+	}
+	tests := []struct {
+		name string
+		r    fakeRollup
+		want []time.Time
+	}{
+		{"empty table fills the backfill", fakeRollup{}, days(today.AddDate(0, 0, -3))},
+		{"resumes at the last day built", fakeRollup{latest: today.AddDate(0, 0, -1)}, days(today.AddDate(0, 0, -1))},
+		{"up to date rebuilds today", fakeRollup{latest: today}, days(today)},
+		{"unreadable table fills the backfill", fakeRollup{latest: today, latestErr: errors.New("connection refused")}, days(today.AddDate(0, 0, -3))},
+		{"a failed day does not stop the others", fakeRollup{failOn: today.AddDate(0, 0, -2)}, days(today.AddDate(0, 0, -3))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			r := tt.r
+			r.stop = cancel
+
+			done := make(chan struct{})
+			go func() {
+				runActivityRollup(ctx, &r, time.Hour, 3*activityDay)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("rollup did not stop after catching up")
+			}
+			if !slices.EqualFunc(r.refreshed, tt.want, time.Time.Equal) {
+				t.Errorf("refreshed %v, want %v", r.refreshed, tt.want)
+			}
+		})
+	}
+}
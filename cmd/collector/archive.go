@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/archive"
+	"github.com/mcbile/product-pulse/internal/config"
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+const archiveUsage = `usage: collector archive run|query [flags]
+
+  run    archive all closed chunks now (needs DATABASE_URL)
+  query  print archived rows of -table between -from and -to as NDJSON
+
+The archive location comes from ARCHIVE_TARGET (a directory or s3://bucket/prefix).
+
+Flags:
+`
+
+// runArchive implements `collector archive`
+func runArchive(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("archive", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), archiveUsage)
+		fs.PrintDefaults()
+	}
+	table := fs.String("table", "", "hypertable to read (query only)")
+	from := fs.String("from", "", "start of range, RFC3339 or YYYY-MM-DD (query only)")
+	to := fs.String("to", "", "end of range, exclusive; defaults to now (query only)")
+	target := fs.String("target", cfg.ArchiveTarget, "archive location, overrides ARCHIVE_TARGET")
+
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *target == "" {
+		fmt.Fprintln(os.Stderr, "archive: ARCHIVE_TARGET or -target is required")
+		return 2
+	}
+	cfg.ArchiveTarget = *target
+
+	store, err := openArchive(cfg)
+	if err != nil {
+		slog.Error("failed to open archive", "error", err)
+		return 1
+	}
+
+	ctx := context.Background()
+
+	switch action {
+	case "run":
+		db, err := storage.NewPostgres(postgresOptions(cfg))
+		if err != nil {
+			slog.Error("failed to connect to database", "error", err)
+			return 1
+		}
+		defer db.Close()
+
+		n, err := archive.New(db, store, cfg.ArchiveGrace).RunOnce(ctx)
+		if err != nil {
+			slog.Error("archive run failed", "error", err, "archived", n)
+			return 1
+		}
+		slog.Info("archive run complete", "chunks", n)
+
+	case "query":
+		if *table == "" || *from == "" {
+			fmt.Fprintln(os.Stderr, "archive query: -table and -from are required")
+			return 2
+		}
+		start, err := parseArchiveTime(*from)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "archive query: -from: %v\n", err)
+			return 2
+		}
+		end := time.Now()
+		if *to != "" {
+			if end, err = parseArchiveTime(*to); err != nil {
+				fmt.Fprintf(os.Stderr, "archive query: -to: %v\n", err)
+				return 2
+			}
+		}
+
+		out := bufio.NewWriter(os.Stdout)
+		defer out.Flush()
+		enc := json.NewEncoder(out)
+
+		rows := 0
+		err = archive.Query(ctx, store, *table, start, end, func(row map[string]any) error {
+			rows++
+			return enc.Encode(row)
+		})
+		if err != nil {
+			slog.Error("archive query failed", "error", err, "rows", rows)
+			return 1
+		}
+		slog.Info("archive query complete", "table", *table, "rows", rows)
+
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	return 0
+}
+
+// openArchive opens the archive store configured by ARCHIVE_TARGET
+func openArchive(cfg *config.Config) (archive.Store, error) {
+	return archive.Open(cfg.ArchiveTarget, archive.S3Config{
+		Endpoint:  cfg.ArchiveS3Endpoint,
+		AccessKey: cfg.ArchiveS3AccessKey,
+		SecretKey: cfg.ArchiveS3SecretKey,
+		Region:    cfg.ArchiveS3Region,
+		UseSSL:    cfg.ArchiveS3UseSSL,
+	})
+}
+
+func parseArchiveTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
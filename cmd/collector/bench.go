@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/config"
+	"github.com/mcbile/product-pulse/internal/model"
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+const benchUsage = `usage: collector bench -database URL [flags]
+
+Compares INSERT and COPY write throughput for every metrics table.
+Run it against a scratch database: synthetic rows are timestamped
+on 2000-01-01 so dashboards ignore them, and are deleted again when
+the run ends. Rows are generated before timing starts, so only the
+writes are measured. The same cases run as Go benchmarks with
+PULSE_BENCH_DATABASE=URL go test -bench Write ./cmd/collector
+
+Flags:
+`
+
+// benchEpoch keeps synthetic rows far outside any dashboard range
+var benchEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// benchCase writes one table's pre-generated rows with INSERT or COPY
+type benchCase struct {
+	table  string
+	insert func(ctx context.Context) error
+	copy   func(ctx context.Context) error
+}
+
+// benchCases generates n rows per table up front, so row construction and
+// UUID generation are not timed. Every run writes the same rows again.
+func benchCases(db *storage.Postgres, n int) []benchCase {
+	frontend, api, psp, game, ws := benchFrontend(n), benchAPI(n), benchPSP(n), benchGame(n), benchWS(n)
+	return []benchCase{
+		{"frontend_metrics",
+			func(ctx context.Context) error { return db.InsertFrontendMetrics(ctx, frontend) },
+			func(ctx context.Context) error { return db.CopyFrontendMetrics(ctx, frontend) }},
+		{"api_metrics",
+			func(ctx context.Context) error { return db.InsertAPIMetrics(ctx, api) },
+			func(ctx context.Context) error { return db.CopyAPIMetrics(ctx, api) }},
+		{"psp_metrics",
+			func(ctx context.Context) error { return db.InsertPSPMetrics(ctx, psp) },
+			func(ctx context.Context) error { return db.CopyPSPMetrics(ctx, psp) }},
+		{"game_metrics",
+			func(ctx context.Context) error { return db.InsertGameMetrics(ctx, game) },
+			func(ctx context.Context) error { return db.CopyGameMetrics(ctx, game) }},
+		{"websocket_metrics",
+			func(ctx context.Context) error { return db.InsertWebSocketMetrics(ctx, ws) },
+			func(ctx context.Context) error { return db.CopyWebSocketMetrics(ctx, ws) }},
+	}
+}
+
+// openBenchDB connects to the scratch database only, never to DATABASE_URL
+func openBenchDB(cfg *config.Config, databaseURL string) (*storage.Postgres, error) {
+	opts := postgresOptions(cfg)
+	opts.Writer.URL = databaseURL
+	opts.Reader.URL = ""
+	opts.Writer.StatementTimeout = 0
+	return storage.NewPostgres(opts)
+}
+
+// cleanBench deletes every synthetic row, including those of interrupted runs,
+// so the archiver and imports never see them
+func cleanBench(ctx context.Context, db *storage.Postgres, cases []benchCase) error {
+	for _, c := range cases {
+		n, err := db.DeleteRange(ctx, c.table, benchEpoch, benchEpoch.Add(24*time.Hour))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			slog.Debug("bench rows deleted", "table", c.table, "rows", n)
+		}
+	}
+	return nil
+}
+
+// runBench implements `collector bench`
+func runBench(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), benchUsage)
+		fs.PrintDefaults()
+	}
+	databaseURL := fs.String("database", "", "database to write synthetic rows to (required, never defaults to DATABASE_URL)")
+	rows := fs.Int("rows", 5000, "rows per batch")
+	runs := fs.Int("runs", 5, "batches per table and method")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *databaseURL == "" || *rows <= 0 || *runs <= 0 {
+		fs.Usage()
+		return 2
+	}
+
+	db, err := openBenchDB(cfg, *databaseURL)
+	if err != nil {
+		slog.Error("failed to connect to database", "error", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	n := *rows
+	cases := benchCases(db, n)
+	if err := cleanBench(ctx, db, cases); err != nil {
+		slog.Error("failed to delete earlier bench rows", "error", err)
+		return 1
+	}
+	defer func() {
+		if err := cleanBench(ctx, db, cases); err != nil {
+			slog.Error("failed to delete bench rows; delete rows of 2000-01-01 by hand", "error", err)
+		}
+	}()
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "table\tinsert rows/s\tcopy rows/s\tspeedup\t")
+
+	for _, c := range cases {
+		insertRate, err := measure(ctx, c.insert, n, *runs)
+		if err != nil {
+			slog.Error("insert benchmark failed", "table", c.table, "error", err)
+			return 1
+		}
+		copyRate, err := measure(ctx, c.copy, n, *runs)
+		if err != nil {
+			slog.Error("copy benchmark failed", "table", c.table, "error", err)
+			return 1
+		}
+		fmt.Fprintf(tw, "%s\t%.0f\t%.0f\t%.1fx\t\n", c.table, insertRate, copyRate, copyRate/insertRate)
+	}
+
+	tw.Flush()
+	return 0
+}
+
+// measure runs write `runs` times and returns rows per second
+func measure(ctx context.Context, write func(ctx context.Context) error, rows, runs int) (float64, error) {
+	var total time.Duration
+	for i := 0; i < runs; i++ {
+		start := time.Now()
+		if err := write(ctx); err != nil {
+			return 0, err
+		}
+		total += time.Since(start)
+	}
+	return float64(rows*runs) / total.Seconds(), nil
+}
+
+func benchUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+func benchTime(i int) time.Time {
+	return benchEpoch.Add(time.Duration(i) * time.Millisecond)
+}
+
+func benchFrontend(n int) []model.EnrichedEvent {
+	out := make([]model.EnrichedEvent, n)
+	lcp := 1234.5
+	for i := range out {
+		out[i] = model.EnrichedEvent{FrontendEvent: model.FrontendEvent{
+			Time: benchTime(i), SessionID: benchUUID(), DeviceType: "desktop", Browser: "bench",
+			EventType: "web_vital", PagePath: "/bench", LCP: &lcp,
+		}}
+	}
+	return out
+}
+
+func benchAPI(n int) []model.APIMetric {
+	out := make([]model.APIMetric, n)
+	for i := range out {
+		out[i] = model.APIMetric{
+			Time: benchTime(i), ServiceName: "bench", Endpoint: "/bench", Method: "GET",
+			DurationMS: float64(i % 500), StatusCode: 200,
+		}
+	}
+	return out
+}
+
+func benchPSP(n int) []model.PSPMetric {
+	out := make([]model.PSPMetric, n)
+	amount, currency := 10.0, "EUR"
+	for i := range out {
+		out[i] = model.PSPMetric{
+			Time: benchTime(i), PSPName: "bench", Operation: "deposit",
+			DurationMS: float64(i % 2000), Success: i%10 != 0, Amount: &amount, Currency: &currency,
+		}
+	}
+	return out
+}
+
+func benchGame(n int) []model.GameMetric {
+	out := make([]model.GameMetric, n)
+	for i := range out {
+		load := float64(i % 3000)
+		out[i] = model.GameMetric{
+			Time: benchTime(i), Provider: "bench", LoadTimeMS: &load, LaunchSuccess: true,
+		}
+	}
+	return out
+}
+
+func benchWS(n int) []model.WebSocketMetric {
+	out := make([]model.WebSocketMetric, n)
+	for i := range out {
+		out[i] = model.WebSocketMetric{
+			Time: benchTime(i), ConnectionID: benchUUID(), EventType: "connect",
+		}
+	}
+	return out
+}
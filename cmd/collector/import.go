@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mcbile/product-pulse/internal/config"
+	"github.com/mcbile/product-pulse/internal/importer"
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+const importUsage = `usage: collector import -mapping FILE [flags] SOURCE
+
+Imports historical metrics from a CSV, JSON (array) or NDJSON file.
+
+Flags:
+`
+
+// runImport implements `collector import`
+func runImport(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), importUsage)
+		fs.PrintDefaults()
+	}
+
+	mappingPath := fs.String("mapping", "", "mapping file (JSON) describing target table and columns")
+	format := fs.String("format", "", "source format: csv, json or ndjson (default: from file extension)")
+	dryRun := fs.Bool("dry-run", false, "validate rows without writing")
+	offset := fs.Int64("offset", 0, "skip the first N source records (resume point)")
+	batchSize := fs.Int("batch", 5000, "rows per COPY batch")
+	progress := fs.Int64("progress", 10000, "log progress every N records (0 disables)")
+	noRefresh := fs.Bool("no-refresh", false, "skip refreshing continuous aggregates")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *mappingPath == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	source := fs.Arg(0)
+
+	mapping, err := importer.LoadMapping(*mappingPath)
+	if err != nil {
+		slog.Error("invalid mapping", "error", err)
+		return 1
+	}
+
+	if *format == "" {
+		if *format, err = importer.DetectFormat(source); err != nil {
+			slog.Error("unknown source format", "error", err)
+			return 1
+		}
+	}
+
+	f, err := os.Open(source)
+	if err != nil {
+		slog.Error("failed to open source", "error", err)
+		return 1
+	}
+	defer f.Close()
+
+	reader, err := importer.NewRecordReader(f, *format)
+	if err != nil {
+		slog.Error("failed to read source", "error", err)
+		return 1
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var writer importer.Writer
+	if !*dryRun {
+		db, err := storage.NewPostgres(postgresOptions(cfg))
+		if err != nil {
+			slog.Error("failed to connect to database", "error", err)
+			return 1
+		}
+		defer db.Close()
+		writer = db
+	}
+
+	slog.Info("import started",
+		"source", source,
+		"format", *format,
+		"target", mapping.Target,
+		"dry_run", *dryRun,
+		"offset", *offset,
+	)
+
+	res, err := importer.Run(ctx, reader, mapping, writer, importer.Options{
+		DryRun:        *dryRun,
+		Offset:        *offset,
+		BatchSize:     *batchSize,
+		ProgressEvery: *progress,
+		Refresh:       !*noRefresh,
+	})
+
+	if res == nil {
+		slog.Error("import failed", "error", err)
+		return 1
+	}
+	json.NewEncoder(os.Stdout).Encode(res)
+	if err != nil {
+		slog.Error("import failed", "error", err, "resume_offset", res.Offset)
+		return 1
+	}
+
+	slog.Info("import complete",
+		"imported", res.Imported,
+		"rejected", res.Rejected,
+		"skipped", res.Skipped,
+	)
+	return 0
+}
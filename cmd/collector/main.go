@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/mcbile/product-pulse/internal/archive"
 	"github.com/mcbile/product-pulse/internal/collector"
 	"github.com/mcbile/product-pulse/internal/config"
 	"github.com/mcbile/product-pulse/internal/handler"
@@ -30,14 +32,45 @@ func main() {
 	}))
 	slog.SetDefault(logger)
 
-	// Connect to database
-	db, err := storage.NewPostgres(cfg.DatabaseURL)
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			os.Exit(runImport(cfg, os.Args[2:]))
+		case "migrate":
+			os.Exit(runMigrate(cfg, os.Args[2:]))
+		case "bench":
+			os.Exit(runBench(cfg, os.Args[2:]))
+		case "archive":
+			os.Exit(runArchive(cfg, os.Args[2:]))
+		case "serve":
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q (commands: serve, import, migrate, bench, archive)\n", os.Args[1])
+			os.Exit(2)
+		}
+	}
+
+	// Open storage backend
+	db, err := openStore(cfg)
 	if err != nil {
-		slog.Error("failed to connect to database", "error", err)
+		slog.Error("failed to open storage", "storage", cfg.Storage, "error", err)
 		os.Exit(1)
 	}
 	defer db.Close()
 
+	// Refuse to serve against an outdated schema
+	if cfg.SchemaCheck {
+		if checker, ok := db.(interface{ CheckSchema(context.Context) error }); ok {
+			checkCtx, checkCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := checker.CheckSchema(checkCtx)
+			checkCancel()
+			if err != nil {
+				slog.Error("schema check failed, run `collector migrate up`", "error", err)
+				os.Exit(1)
+			}
+		}
+	}
+
 	// Create batch collector
 	batchCollector := collector.NewBatchCollector(collector.BatchConfig{
 		BatchSize:     cfg.BatchSize,
@@ -50,6 +83,26 @@ func main() {
 	defer cancel()
 	batchCollector.Start(ctx)
 
+	// Daily player activity for retention cohorts
+	if r, ok := db.(storage.ActivityRollup); ok {
+		go runActivityRollup(ctx, r, cfg.ActivityRefreshAt, cfg.ActivityBackfill)
+	}
+
+	// Archive closed chunks to Parquet before retention drops them
+	if cfg.ArchiveTarget != "" {
+		src, ok := db.(storage.ArchiveSource)
+		store, err := openArchive(cfg)
+		switch {
+		case !ok:
+			slog.Warn("archiving requires postgres storage, disabled")
+		case err != nil:
+			slog.Error("failed to open archive", "error", err)
+			os.Exit(1)
+		default:
+			go archive.New(src, store, cfg.ArchiveGrace).Run(ctx, cfg.ArchiveInterval)
+		}
+	}
+
 	// Setup HTTP handlers
 	mux := http.NewServeMux()
 
@@ -61,7 +114,9 @@ func main() {
 	mux.HandleFunc("GET /health", healthHandler.Handle)
 	mux.HandleFunc("GET /ready", healthHandler.HandleReady)
 
-	metricsHandler := handler.NewMetricsHandler(batchCollector)
+	pools, _ := db.(handler.PoolStatsProvider)
+	queryCache := handler.NewQueryCache(cfg.DashboardCacheTTL, cfg.DashboardQueryTimeout)
+	metricsHandler := handler.NewMetricsHandler(batchCollector, pools, queryCache)
 	mux.HandleFunc("GET /metrics", metricsHandler.Handle)
 
 	// Go client collect endpoints (API, PSP, Game, WebSocket)
@@ -78,26 +133,84 @@ func main() {
 	mux.HandleFunc("POST /collect/ws", wsCollectHandler.Handle)
 
 	// Dashboard API endpoints
-	dashboardHandler := handler.NewDashboardHandler(db, cfg.AllowedOrigins)
+	authHandler := handler.NewAuthHandler(cfg.AllowedOrigins)
+	exporter := handler.NewExporter(db)
+	dashboardHandler := handler.NewDashboardHandler(db, queryCache, exporter, cfg.AllowedOrigins)
+
+	// Metrics endpoints also export with ?format=csv|xlsx|ndjson, which requires a user
+	exportable := func(next http.HandlerFunc) http.HandlerFunc {
+		return handler.TokenFromQuery(authHandler.RequireAuthForExport(next))
+	}
 
 	// Overview
-	mux.HandleFunc("GET /api/metrics/overview", dashboardHandler.HandleOverview)
+	mux.HandleFunc("GET /api/metrics/overview", exportable(dashboardHandler.HandleOverview))
 
 	// API Performance
-	mux.HandleFunc("GET /api/metrics/api", dashboardHandler.HandleAPIPerformance)
-	mux.HandleFunc("GET /api/metrics/api/timeseries", dashboardHandler.HandleAPITimeSeries)
+	mux.HandleFunc("GET /api/metrics/api", exportable(dashboardHandler.HandleAPIPerformance))
+	mux.HandleFunc("GET /api/metrics/api/timeseries", exportable(dashboardHandler.HandleAPITimeSeries))
 
 	// PSP Health
-	mux.HandleFunc("GET /api/metrics/psp", dashboardHandler.HandlePSPHealth)
-	mux.HandleFunc("GET /api/metrics/psp/timeseries", dashboardHandler.HandlePSPTimeSeries)
+	mux.HandleFunc("GET /api/metrics/psp", exportable(dashboardHandler.HandlePSPHealth))
+	mux.HandleFunc("GET /api/metrics/psp/timeseries", exportable(dashboardHandler.HandlePSPTimeSeries))
 
 	// Web Vitals
-	mux.HandleFunc("GET /api/metrics/vitals", dashboardHandler.HandleWebVitals)
-	mux.HandleFunc("GET /api/metrics/vitals/timeseries", dashboardHandler.HandleWebVitalsTimeSeries)
+	mux.HandleFunc("GET /api/metrics/vitals", exportable(dashboardHandler.HandleWebVitals))
+	mux.HandleFunc("GET /api/metrics/vitals/timeseries", exportable(dashboardHandler.HandleWebVitalsTimeSeries))
 
 	// Games
-	mux.HandleFunc("GET /api/metrics/games", dashboardHandler.HandleGameHealth)
-	mux.HandleFunc("GET /api/metrics/games/timeseries", dashboardHandler.HandleGameTimeSeries)
+	mux.HandleFunc("GET /api/metrics/games", exportable(dashboardHandler.HandleGameHealth))
+	mux.HandleFunc("GET /api/metrics/games/timeseries", exportable(dashboardHandler.HandleGameTimeSeries))
+
+	// WebSocket connections
+	mux.HandleFunc("GET /api/metrics/ws", exportable(dashboardHandler.HandleWebSocketHealth))
+	mux.HandleFunc("GET /api/metrics/ws/timeseries", exportable(dashboardHandler.HandleWebSocketTimeSeries))
+
+	// Custom metrics (Pulse.track)
+	mux.HandleFunc("GET /api/metrics/custom", exportable(dashboardHandler.HandleCustomMetrics))
+	mux.HandleFunc("GET /api/metrics/custom/timeseries", exportable(dashboardHandler.HandleCustomMetricsTimeSeries))
+	mux.HandleFunc("GET /api/metrics/custom/catalog", exportable(dashboardHandler.HandleCustomMetricCatalog))
+
+	// Leaderboards with trends against the previous period
+	mux.HandleFunc("GET /api/metrics/top/endpoints", exportable(dashboardHandler.HandleTopEndpoints))
+	mux.HandleFunc("GET /api/metrics/top/psp", exportable(dashboardHandler.HandleTopPSPs))
+	mux.HandleFunc("GET /api/metrics/top/games", exportable(dashboardHandler.HandleTopGames))
+
+	// Error groups by fingerprint; messages may carry player data, so reads
+	// need a session as well as exports
+	mux.HandleFunc("GET /api/errors", handler.TokenFromQuery(authHandler.RequireAuth(dashboardHandler.HandleErrors)))
+
+	// Percentiles over any range and filter
+	mux.HandleFunc("GET /api/metrics/percentiles", exportable(dashboardHandler.HandlePercentiles))
+
+	// Raw event explorer
+	eventsHandler := handler.NewEventsHandler(db, cfg.EventsQueryTimeout, cfg.AllowedOrigins)
+	mux.HandleFunc("GET /api/events/{table}", authHandler.RequireAuth(eventsHandler.Handle))
+	mux.HandleFunc("GET /api/players/{player_id}/timeline", authHandler.RequireAuth(eventsHandler.HandleTimeline))
+
+	// Ad-hoc queries over the metric model
+	queryHandler := handler.NewQueryHandler(db, cfg.QueryTimeout, cfg.AllowedOrigins)
+	mux.HandleFunc("GET /api/query/model", queryHandler.HandleModel)
+	mux.HandleFunc("POST /api/query", authHandler.RequireAuth(queryHandler.Handle))
+
+	// Conversion funnels
+	mux.HandleFunc("GET /api/funnels", authHandler.RequireAuth(dashboardHandler.HandleListFunnels))
+	mux.HandleFunc("GET /api/funnels/{id}", authHandler.RequireAuth(dashboardHandler.HandleGetFunnel))
+	mux.HandleFunc("POST /api/funnels", authHandler.RequireAuth(dashboardHandler.HandleSaveFunnel))
+	mux.HandleFunc("PUT /api/funnels/{id}", authHandler.RequireAuth(dashboardHandler.HandleSaveFunnel))
+	mux.HandleFunc("DELETE /api/funnels/{id}", authHandler.RequireAuth(dashboardHandler.HandleDeleteFunnel))
+	mux.HandleFunc("GET /api/funnels/{id}/report", handler.TokenFromQuery(authHandler.RequireAuth(dashboardHandler.HandleFunnelReport)))
+
+	// Retention and deposit cohorts
+	mux.HandleFunc("GET /api/cohorts", exportable(dashboardHandler.HandleCohorts))
+
+	// Deployment annotations and release comparison
+	mux.HandleFunc("GET /api/deployments", dashboardHandler.HandleListDeployments)
+	mux.HandleFunc("POST /api/deployments", authHandler.RequireAuth(dashboardHandler.HandleRecordDeployment))
+	mux.HandleFunc("GET /api/releases/{release}/compare", exportable(dashboardHandler.HandleCompareReleases))
+
+	// Raw events export
+	mux.HandleFunc("GET /api/export/events/{table}", handler.TokenFromQuery(authHandler.RequireAuth(dashboardHandler.HandleExportEvents)))
+	mux.HandleFunc("GET /api/admin/export-audit", authHandler.RequireSuperAdmin(dashboardHandler.HandleExportAudit))
 
 	// Alerts
 	mux.HandleFunc("GET /api/alerts", dashboardHandler.HandleAlerts)
@@ -107,13 +220,31 @@ func main() {
 	mux.HandleFunc("OPTIONS /api/", dashboardHandler.HandleCORS)
 
 	// Authentication endpoints
-	authHandler := handler.NewAuthHandler(cfg.AllowedOrigins)
 	mux.HandleFunc("POST /api/auth/login", authHandler.HandleLogin)
 	mux.HandleFunc("POST /api/auth/google", authHandler.HandleGoogleLogin)
 	mux.HandleFunc("POST /api/auth/logout", authHandler.HandleLogout)
 	mux.HandleFunc("GET /api/auth/verify", authHandler.HandleVerify)
 	mux.HandleFunc("OPTIONS /api/auth/", authHandler.HandleCORS)
 
+	// Live updates over SSE (replaces dashboard polling)
+	broadcaster := newBroadcaster(db, batchCollector, cfg.StreamInterval)
+	go broadcaster.Run(ctx)
+	if listener, ok := db.(storage.AlertListener); ok {
+		go listenAlerts(ctx, listener, broadcaster)
+	}
+	streamHandler := handler.NewStreamHandler(broadcaster, cfg.StreamHeartbeat, cfg.AllowedOrigins)
+	mux.HandleFunc("GET /api/stream", handler.TokenFromQuery(authHandler.RequireAuth(streamHandler.Handle)))
+
+	// Retention / compression management (Postgres only)
+	if policies, ok := db.(storage.Policies); ok {
+		adminHandler := handler.NewAdminHandler(policies, cfg.AllowedOrigins)
+		mux.HandleFunc("GET /api/admin/hypertables", authHandler.RequireAuth(adminHandler.HandleListHypertables))
+		mux.HandleFunc("GET /api/admin/hypertables/{name}/chunks", authHandler.RequireAuth(adminHandler.HandleChunks))
+		mux.HandleFunc("PUT /api/admin/hypertables/{name}/retention", authHandler.RequireSuperAdmin(adminHandler.HandleSetRetention))
+		mux.HandleFunc("PUT /api/admin/hypertables/{name}/compression", authHandler.RequireSuperAdmin(adminHandler.HandleSetCompression))
+		mux.HandleFunc("GET /api/admin/policy-audit", authHandler.RequireSuperAdmin(adminHandler.HandlePolicyAudit))
+	}
+
 	// Setup middleware chain
 	rateLimiter := middleware.NewRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst, cfg.RateLimitEnabled)
 	bodySizeLimiter := middleware.NewBodySizeLimiter(cfg.MaxBodySize)
@@ -133,6 +264,8 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
+	// Open streams never finish on their own
+	server.RegisterOnShutdown(broadcaster.Close)
 
 	// Graceful shutdown
 	done := make(chan os.Signal, 1)
@@ -164,6 +297,38 @@ func main() {
 	slog.Info("shutdown complete")
 }
 
+// openStore creates the storage backend selected by STORAGE
+func openStore(cfg *config.Config) (storage.Store, error) {
+	switch cfg.Storage {
+	case "memory":
+		slog.Warn("using in-memory storage, data is not persisted", "retention", cfg.MemoryRetention)
+		return storage.NewMemory(cfg.MemoryRetention), nil
+	case "postgres", "":
+		return storage.NewPostgres(postgresOptions(cfg))
+	}
+	return nil, fmt.Errorf("unknown storage %q (expected postgres or memory)", cfg.Storage)
+}
+
+// postgresOptions builds writer/reader pool settings from config
+func postgresOptions(cfg *config.Config) storage.Options {
+	return storage.Options{
+		Writer: storage.PoolConfig{
+			URL:              cfg.DatabaseURL,
+			MaxConns:         int32(cfg.DBWriteMaxConns),
+			MinConns:         int32(cfg.DBWriteMinConns),
+			StatementTimeout: cfg.DBWriteStatementTimeout,
+			ApplicationName:  cfg.DBApplicationName + "/writer",
+		},
+		Reader: storage.PoolConfig{
+			URL:              cfg.DatabaseReadURL,
+			MaxConns:         int32(cfg.DBReadMaxConns),
+			MinConns:         int32(cfg.DBReadMinConns),
+			StatementTimeout: cfg.DBReadStatementTimeout,
+			ApplicationName:  cfg.DBApplicationName + "/reader",
+		},
+	}
+}
+
 func loggingMiddleware(next http.Handler, logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -192,3 +357,8 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.status = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap lets http.ResponseController reach Flush and deadlines (SSE)
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/config"
+)
+
+func TestPostgresOptions(t *testing.T) {
+	cfg := &config.Config{
+		DatabaseURL:             "postgres://primary/pulse",
+		DBApplicationName:       "pulse-collector",
+		DBWriteMaxConns:         20,
+		DBWriteMinConns:         5,
+		DBWriteStatementTimeout: 30 * time.Second,
+		DBReadMaxConns:          10,
+		DBReadMinConns:          2,
+		DBReadStatementTimeout:  15 * time.Second,
+	}
+	opts := postgresOptions(cfg)
+
+	w, r := opts.Writer, opts.Reader
+	if w.URL != cfg.DatabaseURL || w.MaxConns != 20 || w.MinConns != 5 || w.StatementTimeout != 30*time.Second {
+		t.Errorf("writer = %+v", w)
+	}
+	// No replica configured: NewPostgres falls back to the writer URL
+	if r.URL != "" || r.MaxConns != 10 || r.MinConns != 2 || r.StatementTimeout != 15*time.Second {
+		t.Errorf("reader = %+v", r)
+	}
+	if w.ApplicationName != "pulse-collector/writer" || r.ApplicationName != "pulse-collector/reader" {
+		t.Errorf("application names = %q, %q", w.ApplicationName, r.ApplicationName)
+	}
+
+	cfg.DatabaseReadURL = "postgres://replica/pulse"
+	if got := postgresOptions(cfg).Reader.URL; got != cfg.DatabaseReadURL {
+		t.Errorf("reader URL = %q, want the replica", got)
+	}
+}
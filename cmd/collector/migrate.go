@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/config"
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+const migrateUsage = `usage: collector migrate up|down|status [flags]
+
+  up      apply all pending migrations
+  down    roll back the latest migrations (-steps, default 1)
+  status  list migrations and when they were applied
+
+Flags:
+`
+
+// runMigrate implements `collector migrate`
+func runMigrate(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+	steps := fs.Int("steps", 1, "number of migrations to roll back (down only)")
+
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	db, err := storage.NewPostgres(postgresOptions(cfg))
+	if err != nil {
+		slog.Error("failed to connect to database", "error", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	switch action {
+	case "up":
+		applied, err := db.MigrateUp(ctx)
+		for _, v := range applied {
+			slog.Info("migration applied", "version", v)
+		}
+		if err != nil {
+			slog.Error("migrate up failed", "error", err)
+			return 1
+		}
+		slog.Info("schema up to date", "applied", len(applied))
+
+	case "down":
+		rolledBack, err := db.MigrateDown(ctx, *steps)
+		for _, v := range rolledBack {
+			slog.Info("migration rolled back", "version", v)
+		}
+		if err != nil {
+			slog.Error("migrate down failed", "error", err)
+			return 1
+		}
+
+	case "status":
+		status, err := db.MigrationStatus(ctx)
+		if err != nil {
+			slog.Error("migrate status failed", "error", err)
+			return 1
+		}
+		pending := 0
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			} else {
+				pending++
+			}
+			fmt.Fprintf(os.Stdout, "%04d  %-40s  %s\n", s.Version, s.Name, applied)
+		}
+		if pending > 0 {
+			return 3
+		}
+
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	return 0
+}
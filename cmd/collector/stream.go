@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/collector"
+	"github.com/mcbile/product-pulse/internal/storage"
+	"github.com/mcbile/product-pulse/internal/stream"
+)
+
+// streamWindow is the range live topics summarize
+const streamWindow = time.Hour
+
+// newBroadcaster registers the live dashboard topics
+func newBroadcaster(db storage.Store, c *collector.BatchCollector, interval time.Duration) *stream.Broadcaster {
+	b := stream.NewBroadcaster(interval)
+	window := func() storage.Query { return storage.Query{Start: time.Now().Add(-streamWindow)} }
+
+	b.Register("overview", func(ctx context.Context) (any, error) {
+		return db.GetOverviewMetrics(ctx, window())
+	})
+	b.Register("api", func(ctx context.Context) (any, error) {
+		return db.GetAPIPerformance(ctx, window())
+	})
+	b.Register("psp", func(ctx context.Context) (any, error) {
+		return db.GetPSPHealth(ctx, window())
+	})
+	b.Register("alerts", func(ctx context.Context) (any, error) {
+		unresolved := false
+		return db.GetAlerts(ctx, storage.Query{}, &unresolved)
+	})
+	b.Register("collector", func(ctx context.Context) (any, error) {
+		return c.GetStats(), nil
+	})
+	return b
+}
+
+// listenAlerts pushes the alerts topic as soon as an alert changes, retrying
+// the listener until ctx is done
+func listenAlerts(ctx context.Context, l storage.AlertListener, b *stream.Broadcaster) {
+	for {
+		err := l.ListenAlerts(ctx, func() { b.Refresh("alerts") })
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("alert listener stopped, retrying", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
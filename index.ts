@@ -7,13 +7,16 @@
  *
  *   Pulse.init({
  *     endpoint: 'https://pulse.product.com/collect',
- *     siteId: 'product-prod'
+ *     siteId: 'product-prod',
+ *     release: '2024.06.1'
  *   })
  */
 
 export interface PulseConfig {
   endpoint: string
   siteId: string
+  /** Release or build tag attached to every event (default: none) */
+  release?: string
   /** Batch size before flush (default: 10) */
   batchSize?: number
   /** Flush interval in ms (default: 5000) */
@@ -47,6 +50,7 @@ interface MetricEvent {
   // Custom
   metric_name?: string
   metric_value?: number
+  release?: string
   metadata?: Record<string, unknown>
 }
 
@@ -131,6 +135,7 @@ class PulseSDK {
     this.config = {
       endpoint: config.endpoint,
       siteId: config.siteId,
+      release: config.release ?? '',
       batchSize: config.batchSize ?? 10,
       flushInterval: config.flushInterval ?? 5000,
       debug: config.debug ?? false,
@@ -238,6 +243,7 @@ class PulseSDK {
       country: null, // Resolved server-side via IP
       event_type: eventType,
       page_path: window.location.pathname,
+      release: this.config.release || undefined,
       ...data,
     }
 
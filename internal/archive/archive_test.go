@@ -0,0 +1,265 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+var day0 = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+var testColumns = []storage.ArchiveColumn{
+	{Name: "time", Kind: storage.KindTimestamp},
+	{Name: "service_name", Kind: storage.KindString},
+	{Name: "status_code", Kind: storage.KindInt32},
+	{Name: "request_count", Kind: storage.KindInt64},
+	{Name: "duration_ms", Kind: storage.KindDouble},
+	{Name: "success", Kind: storage.KindBool},
+	{Name: "player_id", Kind: storage.KindString},
+}
+
+// fakeSource is an ArchiveSource with an in-memory manifest: a chunk is
+// pending until it is marked archived
+type fakeSource struct {
+	chunks   []storage.ArchiveChunk
+	rows     map[string][][]any // by chunk name
+	manifest map[string][]string
+	markErr  error
+	scans    int
+}
+
+func newFakeSource() *fakeSource {
+	apiRow := func(t time.Time, service string, status int32, player any) []any {
+		return []any{t, service, status, int64(3), 12.5, status < 400, player}
+	}
+	return &fakeSource{
+		chunks: []storage.ArchiveChunk{
+			// Spans midnight, so it is split into two daily files
+			{Hypertable: "api_metrics", Name: "_hyper_1_1_chunk", TimeColumn: "time", RangeStart: day0.Add(12 * time.Hour), RangeEnd: day0.Add(36 * time.Hour)},
+			{Hypertable: "api_metrics", Name: "_hyper_1_2_chunk", TimeColumn: "time", RangeStart: day0.Add(36 * time.Hour), RangeEnd: day0.Add(60 * time.Hour)},
+		},
+		rows: map[string][][]any{
+			"_hyper_1_1_chunk": {
+				apiRow(day0.Add(13*time.Hour), "wallet", 200, "6f1c2b3a-0000-4000-8000-000000000001"),
+				apiRow(day0.Add(23*time.Hour+59*time.Minute), `games "live"`, 500, nil),
+				apiRow(day0.Add(25*time.Hour), "wallet", 404, nil),
+			},
+			"_hyper_1_2_chunk": {
+				apiRow(day0.Add(40*time.Hour), "auth", 200, nil),
+			},
+		},
+		manifest: make(map[string][]string),
+	}
+}
+
+func (f *fakeSource) PendingArchiveChunks(ctx context.Context, closedBefore time.Time) ([]storage.ArchiveChunk, error) {
+	var pending []storage.ArchiveChunk
+	for _, c := range f.chunks {
+		if _, done := f.manifest[c.Name]; !done && c.RangeEnd.Before(closedBefore) {
+			pending = append(pending, c)
+		}
+	}
+	return pending, nil
+}
+
+func (f *fakeSource) ArchiveColumns(ctx context.Context, hypertable string) ([]storage.ArchiveColumn, error) {
+	return testColumns, nil
+}
+
+func (f *fakeSource) ScanArchiveChunk(ctx context.Context, chunk storage.ArchiveChunk, columns []storage.ArchiveColumn, fn func(values []any) error) error {
+	f.scans++
+	for _, row := range f.rows[chunk.Name] {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeSource) MarkChunkArchived(ctx context.Context, chunk storage.ArchiveChunk, rows int64, keys []string) error {
+	if f.markErr != nil {
+		return f.markErr
+	}
+	if int(rows) != len(f.rows[chunk.Name]) {
+		return fmt.Errorf("%s: %d rows archived, chunk has %d", chunk.Name, rows, len(f.rows[chunk.Name]))
+	}
+	f.manifest[chunk.Name] = keys
+	return nil
+}
+
+// readAll reads archived rows back as they were scanned, in time order
+func readAll(t *testing.T, store Store, from, to time.Time) [][]any {
+	t.Helper()
+	var rows [][]any
+	err := Query(context.Background(), store, "api_metrics", from, to, func(row map[string]any) error {
+		if len(row) != len(testColumns) {
+			t.Errorf("row has columns %v, want %d", row, len(testColumns))
+		}
+		values := make([]any, len(testColumns))
+		for i, c := range testColumns {
+			values[i] = row[c.Name]
+		}
+		rows = append(rows, values)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(rows, func(a, b []any) int { return a[0].(time.Time).Compare(b[0].(time.Time)) })
+	return rows
+}
+
+// testArchiver archives src to store and checks the files and the round trip
+func testArchiver(t *testing.T, store Store) {
+	ctx := context.Background()
+	src := newFakeSource()
+	a := New(src, store, time.Hour)
+
+	n, err := a.RunOnce(ctx)
+	if err != nil || n != 2 {
+		t.Fatalf("RunOnce = %d, %v; want 2 chunks", n, err)
+	}
+	wantKeys := map[string][]string{
+		"_hyper_1_1_chunk": {"api_metrics/day=2024-05-01/_hyper_1_1_chunk.parquet", "api_metrics/day=2024-05-02/_hyper_1_1_chunk.parquet"},
+		"_hyper_1_2_chunk": {"api_metrics/day=2024-05-02/_hyper_1_2_chunk.parquet"},
+	}
+	if !reflect.DeepEqual(src.manifest, wantKeys) {
+		t.Errorf("manifest = %v, want %v", src.manifest, wantKeys)
+	}
+	keys, err := store.List(ctx, "api_metrics/day=2024-05-02/")
+	if want := []string{wantKeys["_hyper_1_1_chunk"][1], wantKeys["_hyper_1_2_chunk"][0]}; err != nil || !slices.Equal(keys, want) {
+		t.Errorf("List(day=2024-05-02) = %v, %v; want %v", keys, err, want)
+	}
+
+	var want [][]any
+	for _, name := range []string{"_hyper_1_1_chunk", "_hyper_1_2_chunk"} {
+		want = append(want, src.rows[name]...)
+	}
+	if got := readAll(t, store, day0, day0.Add(72*time.Hour)); !reflect.DeepEqual(got, want) {
+		t.Errorf("archived rows =\n%v\nwant\n%v", got, want)
+	}
+	// The range is half-open and crosses files and days
+	if got := readAll(t, store, day0.Add(23*time.Hour+59*time.Minute), day0.Add(40*time.Hour)); !reflect.DeepEqual(got, want[1:3]) {
+		t.Errorf("rows in range = %v, want %v", got, want[1:3])
+	}
+
+	// Archived chunks are not exported again
+	scans := src.scans
+	if n, err := a.RunOnce(ctx); err != nil || n != 0 || src.scans != scans {
+		t.Errorf("rerun archived %d chunks (%v), scanned %d more", n, err, src.scans-scans)
+	}
+}
+
+func TestArchiverDir(t *testing.T) {
+	store := &Dir{Root: t.TempDir()}
+	testArchiver(t, store)
+
+	// No temp files are left behind, in the store or the system temp dir
+	err := filepath.WalkDir(store.Root, func(p string, e os.DirEntry, err error) error {
+		if err == nil && !e.IsDir() && !strings.HasSuffix(p, ".parquet") {
+			t.Errorf("stray file %s", p)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiverRetriesUnrecordedChunks(t *testing.T) {
+	ctx := context.Background()
+	store := &Dir{Root: t.TempDir()}
+	src := newFakeSource()
+	src.markErr = errors.New("connection reset")
+	a := New(src, store, time.Hour)
+
+	// The file is written but the manifest is not, so the chunk stays pending
+	if n, err := a.RunOnce(ctx); err == nil || n != 0 {
+		t.Fatalf("RunOnce = %d, %v; want the manifest error", n, err)
+	}
+	src.markErr = nil
+	if n, err := a.RunOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("retry = %d, %v; want 2 chunks", n, err)
+	}
+	// The rerun replaced the files instead of adding rows
+	if got := readAll(t, store, day0, day0.Add(72*time.Hour)); len(got) != 4 {
+		t.Errorf("archive holds %d rows after the retry, want 4", len(got))
+	}
+}
+
+func TestArchiverGrace(t *testing.T) {
+	src := newFakeSource()
+	src.chunks[1].RangeEnd = time.Now().Add(-time.Minute)
+	n, err := New(src, &Dir{Root: t.TempDir()}, time.Hour).RunOnce(context.Background())
+	if err != nil || n != 1 || len(src.manifest) != 1 {
+		t.Errorf("RunOnce = %d, %v, manifest %v; want only the chunk closed over an hour ago", n, err, src.manifest)
+	}
+}
+
+func TestWriteChunkErrors(t *testing.T) {
+	ctx := context.Background()
+	store := &Dir{Root: t.TempDir()}
+	src := newFakeSource()
+
+	chunk := src.chunks[0]
+	chunk.TimeColumn = "bucket"
+	if _, _, err := writeChunk(ctx, src, store, chunk); err == nil || !strings.Contains(err.Error(), `time column "bucket"`) {
+		t.Errorf("missing time column: err = %v", err)
+	}
+
+	src.rows["_hyper_1_1_chunk"][1][0] = "2024-05-01"
+	if _, _, err := writeChunk(ctx, src, store, src.chunks[0]); err == nil {
+		t.Error("row without a time was archived")
+	}
+	// The file of the day being written is dropped
+	keys, err := store.List(ctx, "api_metrics/")
+	if err != nil || len(keys) != 0 {
+		t.Errorf("files after a failed chunk = %v, %v", keys, err)
+	}
+}
+
+func TestDirList(t *testing.T) {
+	ctx := context.Background()
+	if keys, err := (&Dir{Root: filepath.Join(t.TempDir(), "missing")}).List(ctx, ""); err != nil || len(keys) != 0 {
+		t.Errorf("missing root: %v, %v", keys, err)
+	}
+
+	d := &Dir{Root: t.TempDir()}
+	for _, key := range []string{"psp_metrics/day=2024-05-01/b.parquet", "psp_metrics/day=2024-05-01/a.parquet", "psp_metrics/day=2024-05-02/a.parquet", "api_metrics/day=2024-05-01/a.parquet"} {
+		if err := d.Put(ctx, key, strings.NewReader(key), int64(len(key))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(d.Root, "psp_metrics", "day=2024-05-01", ".upload-123"), nil, 0o644)
+
+	keys, err := d.List(ctx, "psp_metrics/day=2024-05-01/")
+	if err != nil || !slices.Equal(keys, []string{"psp_metrics/day=2024-05-01/a.parquet", "psp_metrics/day=2024-05-01/b.parquet"}) {
+		t.Errorf("List = %v, %v", keys, err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	store, err := Open("s3://pulse-archive/prod/eu", S3Config{Endpoint: "localhost:9000", Region: "us-east-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, ok := store.(*S3)
+	if !ok || s.bucket != "pulse-archive" || s.objectName("api_metrics/x.parquet") != "prod/eu/api_metrics/x.parquet" {
+		t.Errorf("s3 target = %+v", store)
+	}
+	for target, root := range map[string]string{"./archive": "./archive", "file:///var/pulse": "/var/pulse"} {
+		store, err := Open(target, S3Config{})
+		if d, ok := store.(*Dir); err != nil || !ok || d.Root != root {
+			t.Errorf("Open(%q) = %+v, %v; want dir %s", target, store, err, root)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package archive exports closed hypertable chunks to Parquet files, partitioned
+// by table and UTC day, so data survives retention policies.
+package archive
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// Archiver copies closed chunks to a Store and records them in archive_manifest
+type Archiver struct {
+	src   storage.ArchiveSource
+	store Store
+	grace time.Duration // wait this long after a chunk closes for late rows
+}
+
+// New creates an archiver
+func New(src storage.ArchiveSource, store Store, grace time.Duration) *Archiver {
+	return &Archiver{src: src, store: store, grace: grace}
+}
+
+// RunOnce archives every pending chunk and returns how many were archived
+func (a *Archiver) RunOnce(ctx context.Context) (int, error) {
+	chunks, err := a.src.PendingArchiveChunks(ctx, time.Now().Add(-a.grace))
+	if err != nil {
+		return 0, err
+	}
+
+	for i, chunk := range chunks {
+		start := time.Now()
+		rows, keys, err := writeChunk(ctx, a.src, a.store, chunk)
+		if err != nil {
+			return i, fmt.Errorf("archive %s/%s: %w", chunk.Hypertable, chunk.Name, err)
+		}
+		if err := a.src.MarkChunkArchived(ctx, chunk, rows, keys); err != nil {
+			return i, err
+		}
+		slog.Info("chunk archived",
+			"table", chunk.Hypertable,
+			"chunk", chunk.Name,
+			"range_start", chunk.RangeStart,
+			"rows", rows,
+			"files", len(keys),
+			"duration", time.Since(start),
+		)
+	}
+
+	return len(chunks), nil
+}
+
+// Run archives pending chunks every interval until ctx is cancelled
+func (a *Archiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := a.RunOnce(ctx); err != nil {
+			slog.Error("archive run failed", "error", err, "archived", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Query streams archived rows of a table with time in [from, to), day by day
+func Query(ctx context.Context, store Store, table string, from, to time.Time, fn func(row map[string]any) error) error {
+	for day := from.UTC().Truncate(24 * time.Hour); day.Before(to); day = day.Add(24 * time.Hour) {
+		keys, err := store.List(ctx, dayPrefix(table, day))
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			obj, err := store.Open(ctx, key)
+			if err != nil {
+				return fmt.Errorf("open %s: %w", key, err)
+			}
+			err = readFile(obj, from, to, fn)
+			obj.Close()
+			if err != nil {
+				return fmt.Errorf("read %s: %w", key, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// timeColumnKey is the Parquet key/value metadata entry naming the time column
+const timeColumnKey = "pulse.time_column"
+
+// ObjectKey returns the key of the file holding a chunk's rows for one UTC day
+func ObjectKey(table string, day time.Time, chunk string) string {
+	return fmt.Sprintf("%s/day=%s/%s.parquet", table, day.UTC().Format(time.DateOnly), chunk)
+}
+
+// dayPrefix returns the key prefix of all files of a table for one UTC day
+func dayPrefix(table string, day time.Time) string {
+	return fmt.Sprintf("%s/day=%s/", table, day.UTC().Format(time.DateOnly))
+}
+
+// parquetSchema builds a schema with one optional column per table column and
+// returns the Parquet column index of each table column
+func parquetSchema(table string, columns []storage.ArchiveColumn) (*parquet.Schema, []int) {
+	group := make(parquet.Group, len(columns))
+	for _, c := range columns {
+		var node parquet.Node
+		switch c.Kind {
+		case storage.KindTimestamp:
+			node = parquet.Timestamp(parquet.Microsecond)
+		case storage.KindInt32:
+			node = parquet.Int(32)
+		case storage.KindInt64:
+			node = parquet.Int(64)
+		case storage.KindDouble:
+			node = parquet.Leaf(parquet.DoubleType)
+		case storage.KindBool:
+			node = parquet.Leaf(parquet.BooleanType)
+		default:
+			node = parquet.String()
+		}
+		group[c.Name] = parquet.Optional(node)
+	}
+	schema := parquet.NewSchema(table, group)
+
+	// Group fields are ordered by name, not by table order
+	index := make([]int, len(columns))
+	for i, c := range columns {
+		leaf, _ := schema.Lookup(c.Name)
+		index[i] = leaf.ColumnIndex
+	}
+	return schema, index
+}
+
+// parquetValue converts a scanned value to a Parquet value at column idx
+func parquetValue(v any, idx int) parquet.Value {
+	var pv parquet.Value
+	switch x := v.(type) {
+	case nil:
+		return parquet.NullValue().Level(0, 0, idx)
+	case time.Time:
+		pv = parquet.Int64Value(x.UnixMicro())
+	case int32:
+		pv = parquet.Int32Value(x)
+	case int64:
+		pv = parquet.Int64Value(x)
+	case float64:
+		pv = parquet.DoubleValue(x)
+	case bool:
+		pv = parquet.BooleanValue(x)
+	case string:
+		pv = parquet.ByteArrayValue([]byte(x))
+	default:
+		pv = parquet.ByteArrayValue([]byte(fmt.Sprint(x)))
+	}
+	return pv.Level(0, 1, idx)
+}
+
+// dayFile is the Parquet file being written for one UTC day
+type dayFile struct {
+	day  time.Time
+	file *os.File
+	w    *parquet.Writer
+	rows int64
+}
+
+// writeChunk exports a chunk as one Parquet file per UTC day and returns the
+// number of rows and the keys written
+func writeChunk(ctx context.Context, src storage.ArchiveSource, store Store, chunk storage.ArchiveChunk) (int64, []string, error) {
+	columns, err := src.ArchiveColumns(ctx, chunk.Hypertable)
+	if err != nil {
+		return 0, nil, err
+	}
+	schema, index := parquetSchema(chunk.Hypertable, columns)
+
+	timeIdx := -1
+	for i, c := range columns {
+		if c.Name == chunk.TimeColumn {
+			timeIdx = i
+		}
+	}
+	if timeIdx < 0 {
+		return 0, nil, fmt.Errorf("time column %q not found in %s", chunk.TimeColumn, chunk.Hypertable)
+	}
+
+	var (
+		current *dayFile
+		keys    []string
+		total   int64
+	)
+
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+		defer func() {
+			current.file.Close()
+			os.Remove(current.file.Name())
+			current = nil
+		}()
+
+		if err := current.w.Close(); err != nil {
+			return fmt.Errorf("close parquet writer: %w", err)
+		}
+		size, err := current.file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if _, err := current.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		key := ObjectKey(chunk.Hypertable, current.day, chunk.Name)
+		if err := store.Put(ctx, key, current.file, size); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		return nil
+	}
+
+	row := make(parquet.Row, len(columns))
+	err = src.ScanArchiveChunk(ctx, chunk, columns, func(values []any) error {
+		t, ok := values[timeIdx].(time.Time)
+		if !ok {
+			return fmt.Errorf("unexpected time value %T", values[timeIdx])
+		}
+		day := t.UTC().Truncate(24 * time.Hour)
+
+		if current == nil || !current.day.Equal(day) {
+			if err := finish(); err != nil {
+				return err
+			}
+			f, err := os.CreateTemp("", "pulse-archive-*.parquet")
+			if err != nil {
+				return fmt.Errorf("create temp file: %w", err)
+			}
+			w := parquet.NewWriter(f, schema, parquet.Compression(&parquet.Zstd))
+			w.SetKeyValueMetadata(timeColumnKey, chunk.TimeColumn)
+			current = &dayFile{day: day, file: f, w: w}
+		}
+
+		for i, v := range values {
+			row[index[i]] = parquetValue(v, index[i])
+		}
+		if _, err := current.w.WriteRows([]parquet.Row{row}); err != nil {
+			return fmt.Errorf("write row: %w", err)
+		}
+		current.rows++
+		total++
+		return nil
+	})
+	if err == nil {
+		err = finish()
+	} else if current != nil {
+		current.file.Close()
+		os.Remove(current.file.Name())
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return total, keys, nil
+}
+
+// readFile streams the rows of one archived file whose time column falls in [from, to)
+func readFile(obj Object, from, to time.Time, fn func(row map[string]any) error) error {
+	f, err := parquet.OpenFile(obj, obj.Size())
+	if err != nil {
+		return fmt.Errorf("open parquet file: %w", err)
+	}
+	timeColumn, _ := f.Lookup(timeColumnKey)
+
+	schema := f.Schema()
+	paths := schema.Columns()
+	timestamps := make([]bool, len(paths))
+	for i, p := range paths {
+		leaf, _ := schema.Lookup(p...)
+		if lt := leaf.Node.Type().LogicalType(); lt != nil && lt.Timestamp != nil {
+			timestamps[i] = true
+		}
+	}
+
+	reader := parquet.NewReader(f)
+	defer reader.Close()
+
+	rows := make([]parquet.Row, 256)
+	for {
+		n, err := reader.ReadRows(rows)
+		for _, r := range rows[:n] {
+			record := make(map[string]any, len(paths))
+			for _, v := range r {
+				col := v.Column()
+				record[paths[col][0]] = goValue(v, timestamps[col])
+			}
+
+			if t, ok := record[timeColumn].(time.Time); ok && (t.Before(from) || !t.Before(to)) {
+				continue
+			}
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read rows: %w", err)
+		}
+	}
+}
+
+func goValue(v parquet.Value, timestamp bool) any {
+	if v.IsNull() {
+		return nil
+	}
+	switch v.Kind() {
+	case parquet.Boolean:
+		return v.Boolean()
+	case parquet.Int32:
+		return v.Int32()
+	case parquet.Int64:
+		if timestamp {
+			return time.UnixMicro(v.Int64()).UTC()
+		}
+		return v.Int64()
+	case parquet.Double:
+		return v.Double()
+	case parquet.ByteArray:
+		return string(v.ByteArray())
+	default:
+		return v.String()
+	}
+}
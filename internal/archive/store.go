@@ -0,0 +1,212 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Store is an object store holding archived Parquet files. Keys use forward slashes.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Open(ctx context.Context, key string) (Object, error)
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Object is an archived file opened for random access
+type Object interface {
+	io.ReaderAt
+	io.Closer
+	Size() int64
+}
+
+// S3Config holds credentials for S3-compatible targets (AWS S3, MinIO)
+type S3Config struct {
+	Endpoint  string // host[:port]
+	AccessKey string
+	SecretKey string
+	Region    string
+	UseSSL    bool
+}
+
+// Open returns the store for target: "s3://bucket/prefix" or a local directory
+// (optionally as "file:///path")
+func Open(target string, s3 S3Config) (Store, error) {
+	if strings.HasPrefix(target, "s3://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("parse archive target: %w", err)
+		}
+		return newS3(u.Host, strings.Trim(u.Path, "/"), s3)
+	}
+	return &Dir{Root: strings.TrimPrefix(target, "file://")}, nil
+}
+
+// ============================================
+// LOCAL DIRECTORY
+// ============================================
+
+// Dir stores objects as files below Root
+type Dir struct {
+	Root string
+}
+
+func (d *Dir) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	dst := filepath.Join(d.Root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	// Write to a temp file and rename so readers never see partial files
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write %s: %w", key, err)
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (d *Dir) Open(ctx context.Context, key string) (Object, error) {
+	f, err := os.Open(filepath.Join(d.Root, filepath.FromSlash(key)))
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileObject{File: f, size: info.Size()}, nil
+}
+
+func (d *Dir) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(d.Root, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(d.Root, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
+
+type fileObject struct {
+	*os.File
+	size int64
+}
+
+func (f *fileObject) Size() int64 { return f.size }
+
+// ============================================
+// S3 / MINIO
+// ============================================
+
+// S3 stores objects in a bucket below an optional prefix
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func newS3(bucket, prefix string, cfg S3Config) (*S3, error) {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create s3 client: %w", err)
+	}
+	return &S3{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+func (s *S3) objectName(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return s.prefix + "/" + key
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, s.objectName(key), r, size, minio.PutObjectOptions{
+		ContentType: "application/vnd.apache.parquet",
+	})
+	if err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (Object, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, s.objectName(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, fmt.Errorf("stat %s: %w", key, err)
+	}
+	return &s3Object{Object: obj, size: info.Size}, nil
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.objectName(prefix),
+		Recursive: true,
+	}) {
+		if info.Err != nil {
+			return nil, fmt.Errorf("list %s: %w", prefix, info.Err)
+		}
+		key := info.Key
+		if s.prefix != "" {
+			key = strings.TrimPrefix(key, s.prefix+"/")
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+type s3Object struct {
+	*minio.Object
+	size int64
+}
+
+func (o *s3Object) Size() int64 { return o.size }
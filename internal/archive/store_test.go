@@ -0,0 +1,139 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 serves the path-style S3 calls the store makes: PUT, GET (with
+// ranges) and HEAD of objects and ListObjectsV2 of a bucket
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte // by bucket/key
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodPut && key != "":
+		body, err := readS3Body(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[bucket+"/"+key] = body
+		w.Header().Set("ETag", `"etag"`)
+
+	case (r.Method == http.MethodGet || r.Method == http.MethodHead) && key != "":
+		body, ok := f.objects[bucket+"/"+key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		http.ServeContent(w, r, key, time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC), bytes.NewReader(body))
+
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		type content struct {
+			Key          string
+			Size         int64
+			LastModified string
+			ETag         string
+		}
+		res := struct {
+			XMLName     xml.Name `xml:"ListBucketResult"`
+			Name        string
+			Prefix      string
+			KeyCount    int
+			IsTruncated bool
+			Contents    []content
+		}{Name: bucket, Prefix: r.URL.Query().Get("prefix")}
+		for k, body := range f.objects {
+			if name, ok := strings.CutPrefix(k, bucket+"/"); ok && strings.HasPrefix(name, res.Prefix) {
+				res.Contents = append(res.Contents, content{Key: name, Size: int64(len(body)), LastModified: "2024-05-03T00:00:00.000Z", ETag: `"etag"`})
+			}
+		}
+		slices.SortFunc(res.Contents, func(a, b content) int { return strings.Compare(a.Key, b.Key) })
+		res.KeyCount = len(res.Contents)
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(res)
+
+	default:
+		http.Error(w, "unexpected "+r.Method+" "+r.URL.String(), http.StatusNotImplemented)
+	}
+}
+
+// readS3Body returns an uploaded body, decoding aws-chunked streaming uploads
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var body []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return body, nil
+		}
+		chunk := make([]byte, n+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		body = append(body, chunk[:n]...)
+	}
+}
+
+func TestArchiverS3(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store, err := Open("s3://pulse-archive/prod", S3Config{
+		Endpoint:  strings.TrimPrefix(srv.URL, "http://"),
+		AccessKey: "pulse",
+		SecretKey: "secret",
+		Region:    "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testArchiver(t, store)
+
+	// Objects live below the prefix; keys handed out are relative to it
+	var names []string
+	for k := range fake.objects {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	want := []string{
+		"pulse-archive/prod/api_metrics/day=2024-05-01/_hyper_1_1_chunk.parquet",
+		"pulse-archive/prod/api_metrics/day=2024-05-02/_hyper_1_1_chunk.parquet",
+		"pulse-archive/prod/api_metrics/day=2024-05-02/_hyper_1_2_chunk.parquet",
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("objects = %v, want %v", names, want)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/mcbile/product-pulse/internal/model"
-	"github.com/mcbile/product-pulse/internal/storage"
 )
 
 type BatchConfig struct {
@@ -17,6 +16,7 @@ type BatchConfig struct {
 	Workers       int
 }
 
+// Storage is the subset of storage.Writer the batch collector flushes to
 type Storage interface {
 	InsertFrontendMetrics(ctx context.Context, events []model.EnrichedEvent) error
 	CopyFrontendMetrics(ctx context.Context, events []model.EnrichedEvent) error
@@ -24,7 +24,7 @@ type Storage interface {
 
 type BatchCollector struct {
 	config  BatchConfig
-	storage *storage.Postgres
+	storage Storage
 
 	// Event queue
 	eventCh chan model.EnrichedEvent
@@ -46,7 +46,7 @@ type Stats struct {
 	TotalBatchSize   atomic.Int64
 }
 
-func NewBatchCollector(config BatchConfig, storage *storage.Postgres) *BatchCollector {
+func NewBatchCollector(config BatchConfig, storage Storage) *BatchCollector {
 	return &BatchCollector{
 		config:   config,
 		storage:  storage,
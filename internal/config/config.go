@@ -10,6 +10,8 @@ import (
 type Config struct {
 	Port           string
 	DatabaseURL    string
+	Storage        string // "postgres" or "memory"
+	SchemaCheck    bool   // Refuse to start if migrations are pending
 	BatchSize      int
 	FlushInterval  time.Duration
 	Workers        int
@@ -23,12 +25,58 @@ type Config struct {
 
 	// Body size limit
 	MaxBodySize int64 // Max request body size in bytes
+
+	// Database pools: writes (collect paths) and reads (dashboard) are separate
+	DatabaseReadURL         string        // Optional read replica for dashboard queries
+	DBApplicationName       string        // application_name reported to Postgres
+	DBWriteMaxConns         int           // Writer pool size
+	DBWriteMinConns         int           // Writer pool idle minimum
+	DBWriteStatementTimeout time.Duration // Writer statement_timeout (0 = server default)
+	DBReadMaxConns          int           // Reader pool size
+	DBReadMinConns          int           // Reader pool idle minimum
+	DBReadStatementTimeout  time.Duration // Reader statement_timeout (0 = server default)
+
+	// In-memory storage: raw rows older than this are discarded
+	MemoryRetention time.Duration
+
+	// Dashboard responses are cached for their bucket size, capped at this (0 = no caching)
+	DashboardCacheTTL time.Duration
+
+	// Dashboard queries run detached from the requests waiting for them and
+	// are cancelled after this
+	DashboardQueryTimeout time.Duration
+
+	// Raw event explorer (/api/events): each page read is cancelled after this
+	EventsQueryTimeout time.Duration
+
+	// Ad-hoc metric queries (/api/query): each query is cancelled after this
+	QueryTimeout time.Duration
+
+	// Live dashboard stream (/api/stream)
+	StreamInterval  time.Duration // How often topics are recomputed
+	StreamHeartbeat time.Duration // Comment sent on idle streams to keep proxies open
+
+	// Nightly player_daily_activity rebuild for retention cohorts
+	ActivityRefreshAt time.Duration // Time after midnight UTC the previous day is rebuilt
+	ActivityBackfill  time.Duration // How far back an empty table is filled on start
+
+	// Parquet archive of closed chunks (disabled when ArchiveTarget is empty)
+	ArchiveTarget      string        // Local directory or s3://bucket/prefix
+	ArchiveInterval    time.Duration // How often to look for closed chunks
+	ArchiveGrace       time.Duration // Wait after a chunk closes for late rows
+	ArchiveS3Endpoint  string        // host[:port], e.g. minio:9000
+	ArchiveS3AccessKey string
+	ArchiveS3SecretKey string
+	ArchiveS3Region    string
+	ArchiveS3UseSSL    bool
 }
 
 func Load() *Config {
 	return &Config{
 		Port:           getEnv("PORT", "8080"),
 		DatabaseURL:    getEnv("DATABASE_URL", "postgres://localhost:5432/pulse?sslmode=disable"),
+		Storage:        getEnv("STORAGE", "postgres"),
+		SchemaCheck:    getEnvBool("SCHEMA_CHECK", false),
 		BatchSize:      getEnvInt("BATCH_SIZE", 100),
 		FlushInterval:  getEnvDuration("FLUSH_INTERVAL", 5*time.Second),
 		Workers:        getEnvInt("WORKERS", 4),
@@ -42,6 +90,40 @@ func Load() *Config {
 
 		// Body size limit: 1MB default
 		MaxBodySize: getEnvInt64("MAX_BODY_SIZE", 1<<20),
+
+		// Pools: writer keeps the original 20/5 sizing, reader is capped separately
+		DatabaseReadURL:         getEnv("DATABASE_READ_URL", ""),
+		DBApplicationName:       getEnv("DB_APPLICATION_NAME", "pulse-collector"),
+		DBWriteMaxConns:         getEnvInt("DB_WRITE_MAX_CONNS", 20),
+		DBWriteMinConns:         getEnvInt("DB_WRITE_MIN_CONNS", 5),
+		DBWriteStatementTimeout: getEnvDuration("DB_WRITE_STATEMENT_TIMEOUT", 30*time.Second),
+		DBReadMaxConns:          getEnvInt("DB_READ_MAX_CONNS", 10),
+		DBReadMinConns:          getEnvInt("DB_READ_MIN_CONNS", 2),
+		DBReadStatementTimeout:  getEnvDuration("DB_READ_STATEMENT_TIMEOUT", 15*time.Second),
+
+		MemoryRetention: getEnvDuration("MEMORY_RETENTION", 24*time.Hour),
+
+		DashboardCacheTTL:     getEnvDuration("DASHBOARD_CACHE_TTL", 5*time.Minute),
+		DashboardQueryTimeout: getEnvDuration("DASHBOARD_QUERY_TIMEOUT", 30*time.Second),
+
+		EventsQueryTimeout: getEnvDuration("EVENTS_QUERY_TIMEOUT", 5*time.Second),
+
+		QueryTimeout: getEnvDuration("QUERY_TIMEOUT", 10*time.Second),
+
+		StreamInterval:  getEnvDuration("STREAM_INTERVAL", 5*time.Second),
+		StreamHeartbeat: getEnvDuration("STREAM_HEARTBEAT", 15*time.Second),
+
+		ActivityRefreshAt: getEnvDuration("ACTIVITY_REFRESH_AT", 30*time.Minute),
+		ActivityBackfill:  getEnvDuration("ACTIVITY_BACKFILL", 7*24*time.Hour),
+
+		ArchiveTarget:      getEnv("ARCHIVE_TARGET", ""),
+		ArchiveInterval:    getEnvDuration("ARCHIVE_INTERVAL", time.Hour),
+		ArchiveGrace:       getEnvDuration("ARCHIVE_GRACE", time.Hour),
+		ArchiveS3Endpoint:  getEnv("ARCHIVE_S3_ENDPOINT", ""),
+		ArchiveS3AccessKey: getEnv("ARCHIVE_S3_ACCESS_KEY", ""),
+		ArchiveS3SecretKey: getEnv("ARCHIVE_S3_SECRET_KEY", ""),
+		ArchiveS3Region:    getEnv("ARCHIVE_S3_REGION", ""),
+		ArchiveS3UseSSL:    getEnvBool("ARCHIVE_S3_USE_SSL", true),
 	}
 }
 
@@ -0,0 +1,95 @@
+// Package fingerprint groups error messages that differ only in per-occurrence
+// values such as IDs, amounts, timestamps and addresses.
+//
+// Normalize turns "payment 8f14e45f-ceea-467f-a0e6-0a2a3b4c5d6e declined:
+// balance 12.50 < 30.00" into "payment <uuid> declined: balance <n>.<n> < <n>.<n>",
+// and Of hashes that together with the error source and code, so every
+// occurrence of the same failure shares one fingerprint.
+package fingerprint
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxPattern bounds the normalized message; the tail of long messages is
+// usually a stack trace or payload dump
+const maxPattern = 512
+
+var (
+	uuidPattern  = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	emailPattern = regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`)
+	hexPattern   = regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`)
+	wordPattern  = regexp.MustCompile(`[\p{L}\p{N}]+`)
+	digitRun     = regexp.MustCompile(`\p{N}+`)
+	spaces       = regexp.MustCompile(`\s+`)
+)
+
+// Normalize replaces the variable parts of an error message with placeholders:
+// UUIDs become <uuid>, e-mail addresses <email>, hex values and random-looking
+// tokens <hex> or <id>, and numbers <n>. Short codes such as E42 or HTTP2 keep
+// their digits, so they still tell errors apart; a word starting with digits
+// is a number with a unit (30s, 500ms, 3DS) and only loses the digits.
+func Normalize(message string) string {
+	s := uuidPattern.ReplaceAllString(message, "<uuid>")
+	s = emailPattern.ReplaceAllString(s, "<email>")
+	s = hexPattern.ReplaceAllString(s, "<hex>")
+	s = wordPattern.ReplaceAllStringFunc(s, normalizeWord)
+	s = strings.TrimSpace(spaces.ReplaceAllString(s, " "))
+
+	if len(s) > maxPattern {
+		cut := maxPattern
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut]
+	}
+	return s
+}
+
+// normalizeWord handles one run of letters and digits
+func normalizeWord(w string) string {
+	digits, letters := 0, 0
+	hexOnly := true
+	for _, r := range w {
+		switch {
+		case unicode.IsDigit(r):
+			digits++
+		case unicode.IsLetter(r):
+			letters++
+			if !strings.ContainsRune("abcdefABCDEF", r) {
+				hexOnly = false
+			}
+		}
+	}
+	switch {
+	case digits == 0:
+		return w
+	case letters == 0:
+		return "<n>"
+	case hexOnly && len(w) >= 8:
+		return "<hex>"
+	case digits >= 5 || len(w) >= 16:
+		return "<id>"
+	case unicode.IsDigit([]rune(w)[0]):
+		// 30s, 500ms: a number with a unit
+		return digitRun.ReplaceAllString(w, "<n>")
+	}
+	return w
+}
+
+// Of returns the fingerprint of an error: 16 hex characters identifying its
+// source (api, psp, game), its code or type and its normalized message
+func Of(source, code, message string) string {
+	h := sha1.New()
+	h.Write([]byte(source))
+	h.Write([]byte{0})
+	h.Write([]byte(strings.TrimSpace(code)))
+	h.Write([]byte{0})
+	h.Write([]byte(Normalize(message)))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
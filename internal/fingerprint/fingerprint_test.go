@@ -0,0 +1,57 @@
+package fingerprint
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		message, want string
+	}{
+		{"payment 8f14e45f-ceea-467f-a0e6-0a2a3b4c5d6e declined: balance 12.50 < 30.00", "payment <uuid> declined: balance <n>.<n> < <n>.<n>"},
+		{"user jane.doe+test@mail.example.com not found", "user <email> not found"},
+		{"segfault at 0xDEADBEEF", "segfault at <hex>"},
+		{"tx deadbeef12 failed", "tx <hex> failed"},
+		{"order ORD123456 missing", "order <id> missing"},
+		{"session abcxyz1abcxyzabcx expired", "session <id> expired"},
+		{"timeout after 30s (limit 500ms)", "timeout after <n>s (limit <n>ms)"},
+		{"3DS challenge failed", "<n>DS challenge failed"},
+		{"E42: HTTP2 stream reset", "E42: HTTP2 stream reset"},
+		{"  retry   3\tof\n5  ", "retry <n> of <n>"},
+		{"no digits at all", "no digits at all"},
+		{"заказ 123 не найден", "заказ <n> не найден"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.message); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeTruncates(t *testing.T) {
+	got := Normalize(strings.Repeat("é", maxPattern))
+	if len(got) > maxPattern || !utf8.ValidString(got) {
+		t.Errorf("got %d bytes, valid UTF-8 %v; want at most %d bytes of valid UTF-8", len(got), utf8.ValidString(got), maxPattern)
+	}
+}
+
+func TestOf(t *testing.T) {
+	a := Of("psp", "card_declined", "payment 8f14e45f-ceea-467f-a0e6-0a2a3b4c5d6e declined: balance 12.50")
+	if len(a) != 16 {
+		t.Errorf("fingerprint %q has %d characters, want 16", a, len(a))
+	}
+	if b := Of("psp", " card_declined ", "payment 0a2a3b4c-ceea-467f-a0e6-8f14e45f5d6e declined: balance 99.99"); b != a {
+		t.Errorf("occurrences differing in values: %s != %s", b, a)
+	}
+	for _, other := range []string{
+		Of("api", "card_declined", "payment 8f14e45f-ceea-467f-a0e6-0a2a3b4c5d6e declined: balance 12.50"),
+		Of("psp", "insufficient_funds", "payment 8f14e45f-ceea-467f-a0e6-0a2a3b4c5d6e declined: balance 12.50"),
+		Of("psp", "card_declined", "payment 8f14e45f-ceea-467f-a0e6-0a2a3b4c5d6e refunded: balance 12.50"),
+	} {
+		if other == a {
+			t.Errorf("different errors share fingerprint %s", a)
+		}
+	}
+}
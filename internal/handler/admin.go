@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// AdminHandler exposes hypertable retention and compression management
+type AdminHandler struct {
+	db             storage.Policies
+	allowedOrigins map[string]bool
+	allowAll       bool
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(db storage.Policies, origins []string) *AdminHandler {
+	h := &AdminHandler{
+		db:             db,
+		allowedOrigins: make(map[string]bool),
+	}
+	for _, o := range origins {
+		if o == "*" {
+			h.allowAll = true
+			break
+		}
+		h.allowedOrigins[o] = true
+	}
+	return h
+}
+
+func (h *AdminHandler) setCORS(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if h.allowAll {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else if h.allowedOrigins[origin] {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// writeStorageError maps storage sentinel errors to HTTP status codes
+func writeStorageError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrInvalidArgument):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, storage.ErrTimeout):
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+	default:
+		slog.Error(msg, "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+// HandleListHypertables returns every hypertable with sizes, compression ratio and policies
+// GET /api/admin/hypertables
+func (h *AdminHandler) HandleListHypertables(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	tables, err := h.db.ListHypertables(r.Context())
+	if err != nil {
+		writeStorageError(w, "failed to list hypertables", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tables)
+}
+
+// HandleChunks returns the chunks of one hypertable
+// GET /api/admin/hypertables/{name}/chunks
+func (h *AdminHandler) HandleChunks(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	chunks, err := h.db.GetHypertableChunks(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeStorageError(w, "failed to get chunks", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(chunks)
+}
+
+// policyRequest is the body of a policy change; a null interval removes the policy
+type policyRequest struct {
+	Interval *string `json:"interval"`
+}
+
+// HandleSetRetention replaces the retention policy of a hypertable
+// PUT /api/admin/hypertables/{name}/retention {"interval": "180 days"}
+func (h *AdminHandler) HandleSetRetention(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	var req policyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	name := r.PathValue("name")
+	actor := r.Header.Get("X-User-Email")
+	if err := h.db.SetRetentionPolicy(r.Context(), name, req.Interval, actor); err != nil {
+		writeStorageError(w, "failed to set retention policy", err)
+		return
+	}
+
+	slog.Info("retention policy changed", "hypertable", name, "interval", req.Interval, "actor", actor)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// HandleSetCompression replaces the compression policy of a hypertable
+// PUT /api/admin/hypertables/{name}/compression {"interval": "7 days"}
+func (h *AdminHandler) HandleSetCompression(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	var req policyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	name := r.PathValue("name")
+	actor := r.Header.Get("X-User-Email")
+	if err := h.db.SetCompressionPolicy(r.Context(), name, req.Interval, actor); err != nil {
+		writeStorageError(w, "failed to set compression policy", err)
+		return
+	}
+
+	slog.Info("compression policy changed", "hypertable", name, "interval", req.Interval, "actor", actor)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// HandlePolicyAudit returns recent policy changes
+// GET /api/admin/policy-audit?limit=100
+func (h *AdminHandler) HandlePolicyAudit(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	limit := 100
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	rows, err := h.db.GetPolicyAudit(r.Context(), limit)
+	if err != nil {
+		writeStorageError(w, "failed to get policy audit", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rows)
+}
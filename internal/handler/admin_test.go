@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// fakePolicies records policy changes and fails with err when set
+type fakePolicies struct {
+	err        error
+	hypertable string
+	interval   *string
+	actor      string
+	limit      int
+}
+
+func (f *fakePolicies) ListHypertables(context.Context) ([]storage.HypertableInfo, error) {
+	return nil, f.err
+}
+
+func (f *fakePolicies) GetHypertableChunks(context.Context, string) ([]storage.ChunkInfo, error) {
+	return nil, f.err
+}
+
+func (f *fakePolicies) SetRetentionPolicy(_ context.Context, hypertable string, dropAfter *string, actor string) error {
+	f.hypertable, f.interval, f.actor = hypertable, dropAfter, actor
+	return f.err
+}
+
+func (f *fakePolicies) SetCompressionPolicy(_ context.Context, hypertable string, compressAfter *string, actor string) error {
+	f.hypertable, f.interval, f.actor = hypertable, compressAfter, actor
+	return f.err
+}
+
+func (f *fakePolicies) GetPolicyAudit(_ context.Context, limit int) ([]storage.PolicyAuditRow, error) {
+	f.limit = limit
+	return []storage.PolicyAuditRow{}, f.err
+}
+
+func putPolicy(h http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("PUT", "/api/admin/hypertables/api_metrics/retention", strings.NewReader(body))
+	r.SetPathValue("name", "api_metrics")
+	r.Header.Set("X-User-Email", "ops@example.com")
+	rec := httptest.NewRecorder()
+	h(rec, r)
+	return rec
+}
+
+func TestAdminSetPolicy(t *testing.T) {
+	db := &fakePolicies{}
+	h := NewAdminHandler(db, nil)
+
+	for name, set := range map[string]http.HandlerFunc{"retention": h.HandleSetRetention, "compression": h.HandleSetCompression} {
+		t.Run(name, func(t *testing.T) {
+			*db = fakePolicies{}
+			rec := putPolicy(set, `{"interval": "180 days"}`)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			if db.hypertable != "api_metrics" || db.interval == nil || *db.interval != "180 days" || db.actor != "ops@example.com" {
+				t.Errorf("set %q to %v by %q", db.hypertable, db.interval, db.actor)
+			}
+
+			// null removes the policy
+			rec = putPolicy(set, `{"interval": null}`)
+			if rec.Code != http.StatusOK || db.interval != nil {
+				t.Errorf("null interval: status %d, interval %v", rec.Code, db.interval)
+			}
+
+			if rec := putPolicy(set, `{"interval": 7}`); rec.Code != http.StatusBadRequest {
+				t.Errorf("non-string interval: status %d", rec.Code)
+			}
+			if rec := putPolicy(set, `not json`); rec.Code != http.StatusBadRequest {
+				t.Errorf("invalid body: status %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestAdminErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+		body string
+	}{
+		{fmt.Errorf("%w: retention must be at least 1 day", storage.ErrInvalidArgument), http.StatusBadRequest, "at least 1 day"},
+		{fmt.Errorf("%w: hypertable %q", storage.ErrNotFound, "nope"), http.StatusNotFound, "nope"},
+		{errors.New("connection reset"), http.StatusInternalServerError, "internal error"},
+	}
+	for _, tt := range tests {
+		h := NewAdminHandler(&fakePolicies{err: tt.err}, nil)
+		rec := putPolicy(h.HandleSetRetention, `{"interval": "1 hour"}`)
+		if rec.Code != tt.code || !strings.Contains(rec.Body.String(), tt.body) {
+			t.Errorf("%v: status %d %q, want %d %q", tt.err, rec.Code, rec.Body, tt.code, tt.body)
+		}
+	}
+}
+
+func TestAdminPolicyAuditLimit(t *testing.T) {
+	tests := []struct {
+		query string
+		code  int
+		limit int
+	}{
+		{"", http.StatusOK, 100},
+		{"limit=5", http.StatusOK, 5},
+		{"limit=1000", http.StatusOK, 1000},
+		{"limit=0", http.StatusBadRequest, 0},
+		{"limit=1001", http.StatusBadRequest, 0},
+		{"limit=ten", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		db := &fakePolicies{}
+		rec := httptest.NewRecorder()
+		NewAdminHandler(db, nil).HandlePolicyAudit(rec, httptest.NewRequest("GET", "/api/admin/policy-audit?"+tt.query, nil))
+		if rec.Code != tt.code || db.limit != tt.limit {
+			t.Errorf("%q: status %d limit %d, want %d limit %d", tt.query, rec.Code, db.limit, tt.code, tt.limit)
+		}
+	}
+}
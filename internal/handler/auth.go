@@ -352,6 +352,19 @@ func (h *AuthHandler) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
 	})
 }
 
+// RequireSuperAdmin middleware - requires super_admin role
+func (h *AuthHandler) RequireSuperAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return h.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		role := r.Header.Get("X-User-Role")
+		if role != "super_admin" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "super admin access required"})
+			return
+		}
+		next(w, r)
+	})
+}
+
 // HandleGoogleLogin handles POST /api/auth/google - authenticate via Google OAuth
 func (h *AuthHandler) HandleGoogleLogin(w http.ResponseWriter, r *http.Request) {
 	h.setCORS(w, r)
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// maxCacheEntries bounds memory; new results are not cached past it until
+// expired entries are swept
+const maxCacheEntries = 10000
+
+// QueryCache caches encoded dashboard responses and coalesces identical
+// in-flight queries into one
+type QueryCache struct {
+	maxTTL  time.Duration
+	timeout time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	group   singleflight.Group
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	coalesced atomic.Int64
+}
+
+type cacheEntry struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// CacheStats is reported on /metrics
+type CacheStats struct {
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	Coalesced int64   `json:"coalesced"`
+	Entries   int     `json:"entries"`
+	HitRate   float64 `json:"hit_rate"`
+}
+
+// NewQueryCache creates a cache whose TTLs are capped at maxTTL; 0 disables
+// storing results but identical concurrent queries are still coalesced. Each
+// query is cancelled after timeout (0 = no limit).
+func NewQueryCache(maxTTL, timeout time.Duration) *QueryCache {
+	return &QueryCache{
+		maxTTL:  maxTTL,
+		timeout: timeout,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// TTL caps a bucket-aligned TTL at the configured maximum
+func (c *QueryCache) TTL(bucket time.Duration) time.Duration {
+	if bucket > c.maxTTL {
+		return c.maxTTL
+	}
+	return bucket
+}
+
+// Do returns the cached response for key, or runs fn once for all concurrent
+// callers and caches its JSON encoding for ttl
+func (c *QueryCache) Do(ctx context.Context, key string, ttl time.Duration, fn func(context.Context) (any, error)) (cacheEntry, error) {
+	if e, ok := c.get(key); ok {
+		c.hits.Add(1)
+		return e, nil
+	}
+
+	ran := false
+	v, err, _ := c.group.Do(key, func() (any, error) {
+		ran = true
+		// Another caller may have filled the entry while we waited for the group
+		if e, ok := c.get(key); ok {
+			return e, nil
+		}
+		// The query is shared, so one client going away must not cancel it;
+		// it gets its own time limit instead
+		ctx := context.WithoutCancel(ctx)
+		if c.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+		}
+		res, err := fn(ctx)
+		if errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, storage.ErrTimeout) {
+			err = fmt.Errorf("%w: narrow the range or filters", storage.ErrTimeout)
+		}
+		if err != nil {
+			return cacheEntry{}, err
+		}
+		body, err := json.Marshal(res)
+		if err != nil {
+			return cacheEntry{}, fmt.Errorf("encode response: %w", err)
+		}
+		sum := sha256.Sum256(body)
+		e := cacheEntry{
+			body:    append(body, '\n'),
+			etag:    `"` + hex.EncodeToString(sum[:8]) + `"`,
+			expires: time.Now().Add(ttl),
+		}
+		if ttl > 0 {
+			c.set(key, e)
+		}
+		return e, nil
+	})
+	if ran {
+		c.misses.Add(1)
+	} else {
+		c.coalesced.Add(1)
+	}
+	if err != nil {
+		return cacheEntry{}, err
+	}
+	return v.(cacheEntry), nil
+}
+
+func (c *QueryCache) get(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+func (c *QueryCache) set(key string, e cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCacheEntries {
+		now := time.Now()
+		for k, old := range c.entries {
+			if now.After(old.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			return
+		}
+	}
+	c.entries[key] = e
+}
+
+// Stats returns hit, miss and coalescing counters
+func (c *QueryCache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	s := CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Coalesced: c.coalesced.Load(),
+		Entries:   entries,
+	}
+	if total := s.Hits + s.Misses + s.Coalesced; total > 0 {
+		s.HitRate = float64(s.Hits+s.Coalesced) / float64(total)
+	}
+	return s
+}
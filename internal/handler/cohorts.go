@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// defaultCohortSpan is the range of first-seen days when start is not given
+const defaultCohortSpan = 12 * 7 * 24 * time.Hour
+
+// HandleCohorts returns retention or deposit cohort matrices by week, read from
+// player_daily_activity
+// GET /api/cohorts?kind=retention&segment=country&weeks=8&start=now-90d
+// kind: retention (default), deposit; segment: country, device, utm_source, utm_medium, utm_campaign, ref_code
+func (h *DashboardHandler) HandleCohorts(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	params := r.URL.Query()
+	opts := storage.CohortOptions{
+		Kind:    params.Get("kind"),
+		Segment: params.Get("segment"),
+	}
+	if v := params.Get("weeks"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > storage.MaxCohortWeeks {
+			http.Error(w, fmt.Sprintf("weeks must be between 1 and %d", storage.MaxCohortWeeks), http.StatusBadRequest)
+			return
+		}
+		opts.Weeks = n
+	}
+	key := url.Values{
+		"kind":    {opts.Kind},
+		"segment": {opts.Segment},
+		"weeks":   {strconv.Itoa(opts.Weeks)},
+	}
+
+	h.serveCachedSpan(w, r, defaultCohortSpan, "cohorts", "frontend", key, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetCohorts(ctx, q, opts)
+	})
+}
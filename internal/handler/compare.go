@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// comparison is a dashboard result next to the same result over an earlier
+// period of equal length
+type comparison struct {
+	Current       any       `json:"current"`
+	Baseline      any       `json:"baseline"` // original timestamps; add offset to overlay
+	Offset        string    `json:"offset"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	BaselineStart time.Time `json:"baseline_start"`
+	BaselineEnd   time.Time `json:"baseline_end"`
+	Deltas        []delta   `json:"deltas"`
+}
+
+// delta compares the period totals of one dimension combination, e.g. one
+// service and endpoint
+type delta struct {
+	Dimensions map[string]string      `json:"dimensions"`
+	Metrics    map[string]metricDelta `json:"metrics"`
+}
+
+// metricDelta is the change of one metric. Values are null when the group is
+// missing from a period; change_pct is null when the baseline is zero.
+type metricDelta struct {
+	Current   *float64 `json:"current"`
+	Baseline  *float64 `json:"baseline"`
+	Change    *float64 `json:"change"`
+	ChangePct *float64 `json:"change_pct"`
+}
+
+// parseCompare reads compare=<duration>|custom (with compare_start) and
+// returns how far back the baseline lies, or 0 without compare
+//
+//	compare=1d                 yesterday, same hours
+//	compare=7d                 same hours last week
+//	compare=custom&compare_start=2024-01-01T00:00:00Z
+func parseCompare(r *http.Request, q storage.Query) (time.Duration, error) {
+	v := r.URL.Query().Get("compare")
+	if v == "" {
+		return 0, nil
+	}
+	if v == "custom" {
+		cs := r.URL.Query().Get("compare_start")
+		if cs == "" {
+			return 0, fmt.Errorf("compare=custom requires compare_start")
+		}
+		baseline, err := parseTimeParam(cs, time.Now())
+		if err != nil {
+			return 0, fmt.Errorf("invalid compare_start: %w", err)
+		}
+		// Relative times are each read against their own "now"
+		offset := q.Start.Sub(baseline).Round(time.Second)
+		if offset <= 0 {
+			return 0, fmt.Errorf("compare_start must be before start")
+		}
+		return offset, nil
+	}
+	offset, err := parseDurationParam(v)
+	if err != nil || offset <= 0 {
+		return 0, fmt.Errorf("invalid compare %q: use 1d, 7d, another positive duration or custom", v)
+	}
+	return offset, nil
+}
+
+// compare runs fn over q and over q shifted back by offset, plus both as
+// period totals (Query.Whole) from which the deltas are computed. All four
+// read the same aggregates as the plain endpoint; the ranges reported are
+// those read from source.
+func compare(ctx context.Context, source string, q storage.Query, offset time.Duration, fn func(ctx context.Context, q storage.Query) (any, error)) (*comparison, error) {
+	if q.End.IsZero() {
+		q.End = time.Now()
+	}
+	baseline := q
+	baseline.Start, baseline.End = q.Start.Add(-offset), q.End.Add(-offset)
+	whole, baselineWhole := q, baseline
+	whole.Whole, baselineWhole.Whole = true, true
+
+	queries := []storage.Query{q, baseline, whole, baselineWhole}
+	results := make([]any, len(queries))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, query := range queries {
+		g.Go(func() error {
+			res, err := fn(gctx, query)
+			results[i] = res
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	c := &comparison{
+		Current:  results[0],
+		Baseline: results[1],
+		Offset:   offset.String(),
+		Deltas:   deltas(results[2], results[3]),
+	}
+	c.Start, c.End = storage.ReadRange(source, q)
+	c.BaselineStart, c.BaselineEnd = storage.ReadRange(source, baseline)
+	return c, nil
+}
+
+// deltas pairs the rows of two period-total results by their string columns
+// (the dimensions) and compares every numeric column
+func deltas(current, baseline any) []delta {
+	columns, curRows := tabulate(current)
+	_, baseRows := tabulate(baseline)
+
+	// Dimensions are the string columns; timestamps only mark the period
+	isDim := make([]bool, len(columns))
+	isMetric := make([]bool, len(columns))
+	for _, row := range append(curRows, baseRows...) {
+		for i, v := range row {
+			switch v.(type) {
+			case string:
+				isDim[i] = true
+			case int, int32, int64, float32, float64:
+				isMetric[i] = true
+			}
+		}
+	}
+
+	type group struct {
+		dims          map[string]string
+		current, base []any
+	}
+	var order []string
+	groups := make(map[string]*group)
+	add := func(row []any, baseline bool) {
+		dims := make(map[string]string)
+		var key []string
+		for i, v := range row {
+			if isDim[i] {
+				s, _ := v.(string)
+				dims[columns[i]] = s
+				key = append(key, s)
+			}
+		}
+		k := strings.Join(key, "\x00")
+		g, ok := groups[k]
+		if !ok {
+			g = &group{dims: dims}
+			groups[k] = g
+			order = append(order, k)
+		}
+		if baseline {
+			g.base = row
+		} else {
+			g.current = row
+		}
+	}
+	for _, row := range curRows {
+		add(row, false)
+	}
+	for _, row := range baseRows {
+		add(row, true)
+	}
+
+	result := make([]delta, 0, len(order))
+	for _, k := range order {
+		g := groups[k]
+		d := delta{Dimensions: g.dims, Metrics: make(map[string]metricDelta)}
+		for i, name := range columns {
+			if !isMetric[i] {
+				continue
+			}
+			var m metricDelta
+			if g.current != nil {
+				m.Current = toFloat(g.current[i])
+			}
+			if g.base != nil {
+				m.Baseline = toFloat(g.base[i])
+			}
+			if m.Current != nil && m.Baseline != nil {
+				change := *m.Current - *m.Baseline
+				m.Change = &change
+				if *m.Baseline != 0 {
+					pct := change / math.Abs(*m.Baseline) * 100
+					m.ChangePct = &pct
+				}
+			}
+			d.Metrics[name] = m
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+// toFloat converts a numeric cell, nil for anything else or NaN
+func toFloat(v any) *float64 {
+	var f float64
+	switch x := v.(type) {
+	case int:
+		f = float64(x)
+	case int32:
+		f = float64(x)
+	case int64:
+		f = float64(x)
+	case float32:
+		f = float64(x)
+	case float64:
+		f = x
+	default:
+		return nil
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	return &f
+}
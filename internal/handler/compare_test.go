@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// pspTotal is a period-total row shaped like a dashboard result
+type pspTotal struct {
+	Bucket   time.Time `json:"bucket"`
+	PSP      string    `json:"psp_name"`
+	Count    int64     `json:"total_count"`
+	Rate     float64   `json:"success_rate"`
+	Amount   *float64  `json:"amount"`
+	Currency string    `json:"currency"`
+}
+
+func deltaString(m metricDelta) string {
+	f := func(v *float64) string {
+		if v == nil {
+			return "null"
+		}
+		return fmt.Sprintf("%g", *v)
+	}
+	return fmt.Sprintf("%s→%s %s %s%%", f(m.Baseline), f(m.Current), f(m.Change), f(m.ChangePct))
+}
+
+func TestDeltas(t *testing.T) {
+	now := time.Date(2024, 6, 8, 0, 0, 0, 0, time.UTC)
+	week := now.AddDate(0, 0, -7)
+	current := []pspTotal{
+		{Bucket: now, PSP: "PIX", Currency: "BRL", Count: 150, Rate: 90, Amount: ptr(300.0)},
+		{Bucket: now, PSP: "Stripe", Currency: "EUR", Count: 10, Rate: 100},
+		{Bucket: now, PSP: "Skrill", Currency: "EUR", Count: 5, Rate: math.NaN()},
+	}
+	baseline := []pspTotal{
+		{Bucket: week, PSP: "Stripe", Currency: "EUR", Count: 0, Rate: 0},
+		{Bucket: week, PSP: "PIX", Currency: "BRL", Count: 100, Rate: 95, Amount: ptr(-200.0)},
+		{Bucket: week, PSP: "Paysafe", Currency: "EUR", Count: 7, Rate: 50},
+	}
+
+	got := deltas(current, baseline)
+	// Groups in current order, then those only in the baseline; timestamps
+	// are not dimensions, so the periods pair up
+	want := []struct {
+		dims    string
+		metrics map[string]string
+	}{
+		{"BRL PIX", map[string]string{
+			"total_count":  "100→150 50 50%",
+			"success_rate": "95→90 -5 -5.263157894736842%",
+			"amount":       "-200→300 500 250%",
+		}},
+		{"EUR Stripe", map[string]string{
+			"total_count":  "0→10 10 null%",
+			"success_rate": "0→100 100 null%",
+			"amount":       "null→null null null%",
+		}},
+		{"EUR Skrill", map[string]string{
+			"total_count":  "null→5 null null%",
+			"success_rate": "null→null null null%",
+			"amount":       "null→null null null%",
+		}},
+		{"EUR Paysafe", map[string]string{
+			"total_count":  "7→null null null%",
+			"success_rate": "50→null null null%",
+			"amount":       "null→null null null%",
+		}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d deltas, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		d := got[i]
+		if dims := d.Dimensions["currency"] + " " + d.Dimensions["psp_name"]; dims != w.dims || len(d.Dimensions) != 2 {
+			t.Errorf("delta %d dimensions = %v, want %s", i, d.Dimensions, w.dims)
+		}
+		if len(d.Metrics) != len(w.metrics) {
+			t.Errorf("%s metrics = %v, want %v", w.dims, d.Metrics, w.metrics)
+		}
+		for name, wm := range w.metrics {
+			if gm := deltaString(d.Metrics[name]); gm != wm {
+				t.Errorf("%s %s = %s, want %s", w.dims, name, gm, wm)
+			}
+		}
+	}
+}
+
+func TestDeltasSingleResult(t *testing.T) {
+	type total struct {
+		Requests int64   `json:"requests"`
+		P95      float64 `json:"p95"`
+	}
+	got := deltas(&total{Requests: 120, P95: 80}, &total{Requests: 100, P95: 100})
+	if len(got) != 1 || len(got[0].Dimensions) != 0 {
+		t.Fatalf("deltas = %+v, want one group without dimensions", got)
+	}
+	if r, p := deltaString(got[0].Metrics["requests"]), deltaString(got[0].Metrics["p95"]); r != "100→120 20 20%" || p != "100→80 -20 -20%" {
+		t.Errorf("requests %s, p95 %s", r, p)
+	}
+
+	if got := deltas([]pspTotal{}, []pspTotal{}); len(got) != 0 {
+		t.Errorf("empty periods: %+v", got)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	start := time.Date(2024, 6, 7, 10, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	var mu sync.Mutex
+	var seen []storage.Query
+	fn := func(ctx context.Context, q storage.Query) (any, error) {
+		mu.Lock()
+		seen = append(seen, q)
+		mu.Unlock()
+		n := int64(10)
+		if q.Start.Before(start) {
+			n = 8
+		}
+		return []pspTotal{{Bucket: q.Start, PSP: "PIX", Count: n, Rate: 50}}, nil
+	}
+
+	c, err := compare(context.Background(), "", storage.Query{Start: start, End: end, Step: time.Minute}, 24*time.Hour, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Offset != "24h0m0s" || !c.BaselineStart.Equal(start.Add(-24*time.Hour)) || !c.BaselineEnd.Equal(end.Add(-24*time.Hour)) {
+		t.Errorf("comparison range = %s %s–%s", c.Offset, c.BaselineStart, c.BaselineEnd)
+	}
+	if len(seen) != 4 {
+		t.Fatalf("ran %d queries, want 4", len(seen))
+	}
+	var plain, whole int
+	for _, q := range seen {
+		if q.Whole {
+			whole++
+		} else {
+			plain++
+		}
+		if q.End.Sub(q.Start) != 2*time.Hour || q.Step != time.Minute {
+			t.Errorf("query %s–%s step %s, want the same length and step", q.Start, q.End, q.Step)
+		}
+	}
+	if plain != 2 || whole != 2 {
+		t.Errorf("ran %d plain and %d whole queries, want 2 each", plain, whole)
+	}
+	if len(c.Deltas) != 1 || deltaString(c.Deltas[0].Metrics["total_count"]) != "8→10 2 25%" {
+		t.Errorf("deltas = %+v", c.Deltas)
+	}
+
+	// Ranges are reported as read: two days from 10:07:30 read hourly PSP
+	// buckets from 10:00 to 11:00
+	day := 24 * time.Hour
+	c, err = compare(context.Background(), "psp", storage.Query{Start: start.Add(450 * time.Second), End: start.Add(2*day + 450*time.Second)}, 7*day, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Start.Equal(start) || !c.End.Equal(start.Add(2*day+time.Hour)) ||
+		!c.BaselineStart.Equal(start.Add(-7*day)) || !c.BaselineEnd.Equal(start.Add(-5*day+time.Hour)) {
+		t.Errorf("reported %s–%s, baseline %s–%s; want whole hours", c.Start, c.End, c.BaselineStart, c.BaselineEnd)
+	}
+
+	// An open end is pinned so both periods have the same length
+	c, err = compare(context.Background(), "", storage.Query{Start: time.Now().Add(-time.Hour)}, time.Hour, fn)
+	if err != nil || c.End.IsZero() || c.BaselineEnd != c.End.Add(-time.Hour) {
+		t.Errorf("open end: %+v, %v", c, err)
+	}
+
+	failing := func(ctx context.Context, q storage.Query) (any, error) {
+		if q.Whole {
+			return nil, storage.ErrTimeout
+		}
+		return []pspTotal{}, nil
+	}
+	if _, err := compare(context.Background(), "", storage.Query{Start: start, End: end}, time.Hour, failing); !errors.Is(err, storage.ErrTimeout) {
+		t.Errorf("err = %v, want the query's error", err)
+	}
+}
+
+func TestParseCompare(t *testing.T) {
+	start := time.Now().Add(-2 * time.Hour)
+	q := storage.Query{Start: start}
+	tests := []struct {
+		query   string
+		want    time.Duration
+		invalid bool
+	}{
+		{"", 0, false},
+		{"compare=1d", 24 * time.Hour, false},
+		{"compare=7d", 7 * 24 * time.Hour, false},
+		{"compare=2w", 14 * 24 * time.Hour, false},
+		{"compare=90m", 90 * time.Minute, false},
+		{"compare=custom&compare_start=" + start.Add(-72*time.Hour).UTC().Format(time.RFC3339Nano), 72 * time.Hour, false},
+		{"compare=custom&compare_start=now-26h", 24 * time.Hour, false},
+		{"compare=custom", 0, true},
+		{"compare=custom&compare_start=" + start.Add(time.Hour).UTC().Format(time.RFC3339), 0, true},
+		{"compare=custom&compare_start=yesterday", 0, true},
+		{"compare=0d", 0, true},
+		{"compare=-1d", 0, true},
+		{"compare=week", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := parseCompare(httptest.NewRequest("GET", "/api/metrics/psp?"+tt.query, nil), q)
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("parseCompare = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parseCompare = %s, %v; want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// defaultCatalogSpan is the range custom metric names are listed from when start is not given
+const defaultCatalogSpan = 30 * 24 * time.Hour
+
+// HandleCustomMetrics returns count, mean and p50/p95/p99 of custom metrics
+// (Pulse.track) per bucket, device and page
+// GET /api/metrics/custom?metric_name=deposit_flow&device_type=mobile&meta.step=confirm&start=now-24h
+func (h *DashboardHandler) HandleCustomMetrics(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	opts := storage.CustomMetricOptions{Metadata: metadataParams(r.URL.Query())}
+	h.serveCached(w, r, "custom metrics", "custom", metadataKey(opts.Metadata, nil), func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetCustomMetrics(ctx, q, opts)
+	})
+}
+
+// HandleCustomMetricsTimeSeries returns one statistic of a custom metric over time
+// GET /api/metrics/custom/timeseries?metric_name=deposit_flow&stat=p95&meta.psp=pix&start=now-7d
+// stat: avg (default), count, p50, p95, p99; metric_name is required
+func (h *DashboardHandler) HandleCustomMetricsTimeSeries(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	params := r.URL.Query()
+	stat := params.Get("stat")
+	opts := storage.CustomMetricOptions{Metadata: metadataParams(params)}
+	key := metadataKey(opts.Metadata, url.Values{"stat": {stat}})
+	h.serveCached(w, r, "custom metrics timeseries", "custom", key, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetCustomMetricsTimeSeries(ctx, stat, q, opts)
+	})
+}
+
+// HandleCustomMetricCatalog lists the custom metric names seen in the range
+// with their sample count, mean, page and device counts, most samples first
+// GET /api/metrics/custom/catalog?start=now-30d
+func (h *DashboardHandler) HandleCustomMetricCatalog(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	h.serveCachedSpan(w, r, defaultCatalogSpan, "custom metric catalog", "custom", nil, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetCustomMetricCatalog(ctx, q)
+	})
+}
+
+// metadataKey adds the meta.<path> filters to a cache key
+func metadataKey(metadata map[string]string, params url.Values) url.Values {
+	key := make(url.Values, len(params)+len(metadata))
+	for k, v := range params {
+		key[k] = v
+	}
+	for path, v := range metadata {
+		key.Set("meta."+path, v)
+	}
+	return key
+}
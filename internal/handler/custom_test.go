@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/model"
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// customHandler serves custom metrics from 2024-05-01 10:00-10:10: deposit_flow
+// samples tagged with the flow step, PSP and attempt, and one untagged
+// game_load sample
+func customHandler(t *testing.T) *DashboardHandler {
+	t.Helper()
+	at := time.Date(2024, 5, 1, 10, 1, 0, 0, time.UTC)
+	sample := func(name string, value float64, device, metadata string) model.EnrichedEvent {
+		e := model.EnrichedEvent{FrontendEvent: model.FrontendEvent{
+			Time: at, SessionID: "s1", DeviceType: device, EventType: "custom", PagePath: "/cashier",
+			MetricName: &name, MetricValue: &value,
+		}}
+		if metadata != "" {
+			e.Metadata = json.RawMessage(metadata)
+		}
+		return e
+	}
+
+	db := storage.NewMemory(0)
+	err := db.InsertFrontendMetrics(context.Background(), []model.EnrichedEvent{
+		sample("deposit_flow", 100, "mobile", `{"step": "start", "psp": {"name": "pix"}, "attempt": 1}`),
+		sample("deposit_flow", 200, "mobile", `{"step": "confirm", "psp": {"name": "pix"}, "attempt": 1}`),
+		sample("deposit_flow", 400, "desktop", `{"step": "confirm", "psp": {"name": "pix"}, "attempt": 2}`),
+		sample("deposit_flow", 800, "desktop", `{"step": "confirm", "psp": {"name": "stripe"}, "attempt": 1}`),
+		sample("game_load", 50, "mobile", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewDashboardHandler(db, NewQueryCache(time.Minute, 0), NewExporter(storage.NewMemory(0)), nil)
+}
+
+const customWindow = "start=2024-05-01T10:00:00Z&end=2024-05-01T10:10:00Z&step=5m"
+
+func TestCustomMetricsTags(t *testing.T) {
+	h := customHandler(t)
+	tests := []struct {
+		query string
+		count int64   // deposit_flow samples
+		avg   float64 // of those samples
+		other bool    // game_load is listed
+	}{
+		{"", 4, 375, true},
+		{"metric_name=deposit_flow", 4, 375, false},
+		{"meta.step=confirm", 3, 1400.0 / 3, false},
+		{"meta.step=confirm&meta.psp.name=pix", 2, 300, false},
+		// Numbers compare by their JSON text
+		{"meta.attempt=2", 1, 400, false},
+		{"meta.step=confirm&device_type=mobile", 1, 200, false},
+		{"meta.step=refund", 0, 0, false},
+		{"meta.psp=pix", 0, 0, false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.HandleCustomMetrics(w, httptest.NewRequest(http.MethodGet, "/api/metrics/custom?"+tt.query+"&"+customWindow, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%q: status = %d: %s", tt.query, w.Code, w.Body)
+			continue
+		}
+		var rows []storage.CustomMetricRow
+		if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil {
+			t.Fatal(err)
+		}
+		var count int64
+		var sum float64
+		var other bool
+		for _, r := range rows {
+			if r.MetricName != "deposit_flow" {
+				other = true
+				continue
+			}
+			count += r.SampleCount
+			sum += r.Avg * float64(r.SampleCount)
+		}
+		avg := 0.0
+		if count > 0 {
+			avg = sum / float64(count)
+		}
+		if count != tt.count || avg != tt.avg || other != tt.other {
+			t.Errorf("%q: %d samples, avg %g, game_load %t; want %d, %g, %t", tt.query, count, avg, other, tt.count, tt.avg, tt.other)
+		}
+	}
+}
+
+func TestCustomMetricsTimeSeriesTags(t *testing.T) {
+	h := customHandler(t)
+	tests := []struct {
+		query string
+		want  float64 // value of the 10:00 bucket
+	}{
+		{"metric_name=deposit_flow&stat=count", 4},
+		// Cached separately from the untagged query
+		{"metric_name=deposit_flow&stat=count&meta.step=confirm", 3},
+		{"metric_name=deposit_flow&stat=count&meta.step=start", 1},
+		{"metric_name=deposit_flow&meta.psp.name=pix", 700.0 / 3},
+		{"metric_name=deposit_flow&stat=p50&meta.step=confirm", 400},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.HandleCustomMetricsTimeSeries(w, httptest.NewRequest(http.MethodGet, "/api/metrics/custom/timeseries?"+tt.query+"&"+customWindow, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%q: status = %d: %s", tt.query, w.Code, w.Body)
+			continue
+		}
+		var points []storage.TimeSeriesPoint
+		if err := json.Unmarshal(w.Body.Bytes(), &points); err != nil {
+			t.Fatal(err)
+		}
+		if len(points) != 1 || points[0].Value != tt.want {
+			t.Errorf("%q: points = %+v, want one of %g", tt.query, points, tt.want)
+		}
+	}
+
+	for _, query := range []string{
+		"stat=count&meta.step=confirm",
+		"metric_name=deposit_flow&stat=p90",
+		"metric_name=deposit_flow&meta.psp..name=pix",
+		"metric_name=deposit_flow&meta.a=1&meta.b=1&meta.c=1&meta.d=1&meta.e=1&meta.f=1",
+	} {
+		w := httptest.NewRecorder()
+		h.HandleCustomMetricsTimeSeries(w, httptest.NewRequest(http.MethodGet, "/api/metrics/custom/timeseries?"+query+"&"+customWindow, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestCustomMetricCatalog(t *testing.T) {
+	h := customHandler(t)
+	w := httptest.NewRecorder()
+	// The catalog lists every name, tag filters do not apply
+	h.HandleCustomMetricCatalog(w, httptest.NewRequest(http.MethodGet, "/api/metrics/custom/catalog?meta.step=confirm&"+customWindow, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var catalog []storage.CustomMetricInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &catalog); err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog) != 2 {
+		t.Fatalf("catalog = %+v", catalog)
+	}
+	if c := catalog[0]; c.MetricName != "deposit_flow" || c.SampleCount != 4 || c.Avg != 375 || c.Pages != 1 || c.Devices != 2 {
+		t.Errorf("deposit_flow = %+v", c)
+	}
+	if c := catalog[1]; c.MetricName != "game_load" || c.SampleCount != 1 {
+		t.Errorf("game_load = %+v", c)
+	}
+}
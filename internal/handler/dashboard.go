@@ -1,9 +1,15 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mcbile/product-pulse/internal/storage"
@@ -11,15 +17,19 @@ import (
 
 // DashboardHandler handles dashboard API endpoints
 type DashboardHandler struct {
-	db             *storage.Postgres
+	db             storage.Dashboard
+	cache          *QueryCache
+	exports        *Exporter
 	allowedOrigins map[string]bool
 	allowAll       bool
 }
 
 // NewDashboardHandler creates a new dashboard handler
-func NewDashboardHandler(db *storage.Postgres, origins []string) *DashboardHandler {
+func NewDashboardHandler(db storage.Dashboard, cache *QueryCache, exports *Exporter, origins []string) *DashboardHandler {
 	h := &DashboardHandler{
 		db:             db,
+		cache:          cache,
+		exports:        exports,
 		allowedOrigins: make(map[string]bool),
 	}
 	for _, o := range origins {
@@ -39,18 +49,106 @@ func (h *DashboardHandler) setCORS(w http.ResponseWriter, r *http.Request) {
 	} else if h.allowedOrigins[origin] {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 	}
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, Content-Disposition")
 	w.Header().Set("Content-Type", "application/json")
 }
 
-func (h *DashboardHandler) parseStartTime(r *http.Request) time.Time {
-	startStr := r.URL.Query().Get("start")
-	if startStr != "" {
-		if t, err := time.Parse(time.RFC3339, startStr); err == nil {
-			return t
+// serveCached answers a dashboard query from the cache. A relative range start
+// is rounded down to the cache TTL (see cacheRange) so clients asking for "the
+// last hour" a few seconds apart share an entry; the key is the endpoint plus
+// the normalized query and params. Exports (format=csv|xlsx|ndjson) bypass the cache.
+func (h *DashboardHandler) serveCached(w http.ResponseWriter, r *http.Request, what, source string, params url.Values, fn func(ctx context.Context, q storage.Query) (any, error)) {
+	h.serveCachedSpan(w, r, time.Hour, what, source, params, fn)
+}
+
+// serveCachedSpan is serveCached for queries whose range defaults to span
+func (h *DashboardHandler) serveCachedSpan(w http.ResponseWriter, r *http.Request, span time.Duration, what, source string, params url.Values, fn func(ctx context.Context, q storage.Query) (any, error)) {
+	q, err := parseQuery(r, span)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format, err := exportFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := parseCompare(r, q)
+	if err == nil && offset > 0 && format != "" {
+		err = fmt.Errorf("compare is not available for exports")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format != "" {
+		h.exports.exportResult(w, r, format, q, fn)
+		return
+	}
+	if offset > 0 {
+		params = cloneValues(params)
+		params.Set("compare", offset.String())
+		query := fn
+		fn = func(ctx context.Context, q storage.Query) (any, error) {
+			return compare(ctx, source, q, offset, query)
+		}
+	}
+	ttl := h.cache.TTL(storage.BucketSize(source, q))
+	q = cacheRange(q, startIsRelative(r.URL.Query()), ttl)
+	if ttl > 0 {
+		// Entries expire when the next bucket starts, as the newest one fills up
+		ttl = time.Until(time.Now().Truncate(ttl).Add(ttl))
+	}
+
+	entry, err := h.cache.Do(r.Context(), r.URL.Path+"?"+queryKey(q, params), ttl, func(ctx context.Context) (any, error) {
+		return fn(ctx, q)
+	})
+	if err != nil {
+		writeStorageError(w, "failed to get "+what, err)
+		return
+	}
+
+	w.Header().Set("ETag", entry.etag)
+	if maxAge := int(time.Until(entry.expires).Seconds()); maxAge > 0 {
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(maxAge))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), entry.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(entry.body)
+}
+
+// cacheRange returns the query to run and key the cache by. A start that moves
+// with the clock is aligned to ttl, so requests within one bucket share an
+// entry and the entry holds what its key says; explicit starts are kept.
+func cacheRange(q storage.Query, relative bool, ttl time.Duration) storage.Query {
+	if ttl > 0 && relative {
+		q.Start = q.Start.Truncate(ttl)
+	}
+	return q
+}
+
+// cloneValues copies params so callers' literals are not modified
+func cloneValues(params url.Values) url.Values {
+	c := make(url.Values, len(params)+1)
+	for k, v := range params {
+		c[k] = v
+	}
+	return c
+}
+
+// etagMatches reports whether an If-None-Match header lists etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
 		}
 	}
-	// Default: last 1 hour
-	return time.Now().Add(-time.Hour)
+	return false
 }
 
 // HandleOverview returns aggregated overview metrics
@@ -58,17 +156,9 @@ func (h *DashboardHandler) parseStartTime(r *http.Request) time.Time {
 func (h *DashboardHandler) HandleOverview(w http.ResponseWriter, r *http.Request) {
 	h.setCORS(w, r)
 
-	start := h.parseStartTime(r)
-	ctx := r.Context()
-
-	metrics, err := h.db.GetOverviewMetrics(ctx, start)
-	if err != nil {
-		slog.Error("failed to get overview metrics", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-
-	json.NewEncoder(w).Encode(metrics)
+	h.serveCached(w, r, "overview metrics", "api", nil, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetOverviewMetrics(ctx, q)
+	})
 }
 
 // HandleAPIPerformance returns API performance metrics
@@ -76,41 +166,19 @@ func (h *DashboardHandler) HandleOverview(w http.ResponseWriter, r *http.Request
 func (h *DashboardHandler) HandleAPIPerformance(w http.ResponseWriter, r *http.Request) {
 	h.setCORS(w, r)
 
-	start := h.parseStartTime(r)
-	ctx := r.Context()
-
-	metrics, err := h.db.GetAPIPerformance(ctx, start)
-	if err != nil {
-		slog.Error("failed to get API performance", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-
-	json.NewEncoder(w).Encode(metrics)
+	h.serveCached(w, r, "API performance", "api", nil, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetAPIPerformance(ctx, q)
+	})
 }
 
-// HandleAPITimeSeries returns API latency time series for a service
-// GET /api/metrics/api/timeseries?service=auth&start=2024-01-15T10:00:00Z
+// HandleAPITimeSeries returns mean API latency over time
+// GET /api/metrics/api/timeseries?service=auth&start=now-24h&step=1h
 func (h *DashboardHandler) HandleAPITimeSeries(w http.ResponseWriter, r *http.Request) {
 	h.setCORS(w, r)
 
-	service := r.URL.Query().Get("service")
-	if service == "" {
-		http.Error(w, "service parameter required", http.StatusBadRequest)
-		return
-	}
-
-	start := h.parseStartTime(r)
-	ctx := r.Context()
-
-	series, err := h.db.GetAPITimeSeries(ctx, service, start)
-	if err != nil {
-		slog.Error("failed to get API timeseries", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-
-	json.NewEncoder(w).Encode(series)
+	h.serveCached(w, r, "API timeseries", "api", nil, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetAPITimeSeries(ctx, q)
+	})
 }
 
 // HandlePSPHealth returns PSP health metrics
@@ -118,63 +186,35 @@ func (h *DashboardHandler) HandleAPITimeSeries(w http.ResponseWriter, r *http.Re
 func (h *DashboardHandler) HandlePSPHealth(w http.ResponseWriter, r *http.Request) {
 	h.setCORS(w, r)
 
-	start := h.parseStartTime(r)
-	ctx := r.Context()
-
-	metrics, err := h.db.GetPSPHealth(ctx, start)
-	if err != nil {
-		slog.Error("failed to get PSP health", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-
-	json.NewEncoder(w).Encode(metrics)
+	h.serveCached(w, r, "PSP health", "psp", nil, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetPSPHealth(ctx, q)
+	})
 }
 
-// HandlePSPTimeSeries returns PSP success rate time series
-// GET /api/metrics/psp/timeseries?psp=PIX&start=2024-01-15T10:00:00Z
+// HandlePSPTimeSeries returns PSP success rate over time
+// GET /api/metrics/psp/timeseries?psp=PIX&start=now-24h&step=1h
 func (h *DashboardHandler) HandlePSPTimeSeries(w http.ResponseWriter, r *http.Request) {
 	h.setCORS(w, r)
 
-	psp := r.URL.Query().Get("psp")
-	if psp == "" {
-		http.Error(w, "psp parameter required", http.StatusBadRequest)
-		return
-	}
-
-	start := h.parseStartTime(r)
-	ctx := r.Context()
-
-	series, err := h.db.GetPSPTimeSeries(ctx, psp, start)
-	if err != nil {
-		slog.Error("failed to get PSP timeseries", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-
-	json.NewEncoder(w).Encode(series)
+	h.serveCached(w, r, "PSP timeseries", "psp", nil, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetPSPTimeSeries(ctx, q)
+	})
 }
 
-// HandleWebVitals returns Web Vitals metrics
+// HandleWebVitals returns Web Vitals percentiles, rating bands and % good per
+// page and device
 // GET /api/metrics/vitals?start=2024-01-15T10:00:00Z
 func (h *DashboardHandler) HandleWebVitals(w http.ResponseWriter, r *http.Request) {
 	h.setCORS(w, r)
 
-	start := h.parseStartTime(r)
-	ctx := r.Context()
-
-	metrics, err := h.db.GetWebVitals(ctx, start)
-	if err != nil {
-		slog.Error("failed to get Web Vitals", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-
-	json.NewEncoder(w).Encode(metrics)
+	h.serveCached(w, r, "Web Vitals", "vitals", nil, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetWebVitals(ctx, q)
+	})
 }
 
 // HandleWebVitalsTimeSeries returns Web Vitals time series for a metric
-// GET /api/metrics/vitals/timeseries?metric=lcp&start=2024-01-15T10:00:00Z
+// GET /api/metrics/vitals/timeseries?metric=lcp&stat=p75&start=2024-01-15T10:00:00Z
+// metric: lcp, fid, cls, inp, ttfb, fcp; stat: mean (default), p50, p75, p90, p99, good (% good)
 func (h *DashboardHandler) HandleWebVitalsTimeSeries(w http.ResponseWriter, r *http.Request) {
 	h.setCORS(w, r)
 
@@ -182,18 +222,12 @@ func (h *DashboardHandler) HandleWebVitalsTimeSeries(w http.ResponseWriter, r *h
 	if metric == "" {
 		metric = "lcp"
 	}
+	stat := r.URL.Query().Get("stat")
 
-	start := h.parseStartTime(r)
-	ctx := r.Context()
-
-	series, err := h.db.GetWebVitalsTimeSeries(ctx, metric, start)
-	if err != nil {
-		slog.Error("failed to get Vitals timeseries", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
-
-	json.NewEncoder(w).Encode(series)
+	params := url.Values{"metric": {metric}, "stat": {stat}}
+	h.serveCached(w, r, "Vitals timeseries", "vitals", params, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetWebVitalsTimeSeries(ctx, metric, stat, q)
+	})
 }
 
 // HandleGameHealth returns game provider health metrics
@@ -201,48 +235,77 @@ func (h *DashboardHandler) HandleWebVitalsTimeSeries(w http.ResponseWriter, r *h
 func (h *DashboardHandler) HandleGameHealth(w http.ResponseWriter, r *http.Request) {
 	h.setCORS(w, r)
 
-	start := h.parseStartTime(r)
-	ctx := r.Context()
+	h.serveCached(w, r, "game health", "game", nil, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetGameHealth(ctx, q)
+	})
+}
 
-	metrics, err := h.db.GetGameHealth(ctx, start)
-	if err != nil {
-		slog.Error("failed to get game health", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
-	}
+// HandleGameTimeSeries returns game launch success rate over time
+// GET /api/metrics/games/timeseries?provider=Pragmatic&start=now-24h&step=1h
+func (h *DashboardHandler) HandleGameTimeSeries(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
 
-	json.NewEncoder(w).Encode(metrics)
+	h.serveCached(w, r, "game timeseries", "game", nil, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetGameTimeSeries(ctx, q)
+	})
 }
 
-// HandleGameTimeSeries returns game provider success rate time series
-// GET /api/metrics/games/timeseries?provider=Pragmatic&start=2024-01-15T10:00:00Z
-func (h *DashboardHandler) HandleGameTimeSeries(w http.ResponseWriter, r *http.Request) {
+// HandleWebSocketHealth returns WebSocket connection health by endpoint and device
+// GET /api/metrics/ws?start=2024-01-15T10:00:00Z
+func (h *DashboardHandler) HandleWebSocketHealth(w http.ResponseWriter, r *http.Request) {
 	h.setCORS(w, r)
 
-	provider := r.URL.Query().Get("provider")
-	if provider == "" {
-		http.Error(w, "provider parameter required", http.StatusBadRequest)
-		return
+	h.serveCached(w, r, "WebSocket health", "ws", nil, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetWebSocketHealth(ctx, q)
+	})
+}
+
+// HandleWebSocketTimeSeries returns a WebSocket metric over time
+// GET /api/metrics/ws/timeseries?metric=concurrent&endpoint=/live&start=now-6h&step=5m
+// metric: connects, disconnects, errors, latency, concurrent (default)
+func (h *DashboardHandler) HandleWebSocketTimeSeries(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = "concurrent"
 	}
 
-	start := h.parseStartTime(r)
-	ctx := r.Context()
+	params := url.Values{"metric": {metric}}
+	h.serveCached(w, r, "WebSocket timeseries", "ws", params, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetWebSocketTimeSeries(ctx, metric, q)
+	})
+}
 
-	series, err := h.db.GetGameTimeSeries(ctx, provider, start)
-	if err != nil {
-		slog.Error("failed to get game timeseries", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+// HandlePercentiles returns latency percentiles merged over the range and filters
+// GET /api/metrics/percentiles?source=api&service=auth&endpoint=/login&start=now-7d
+// source: api, psp, game, ws, lcp, fid, cls, inp, ttfb, fcp, custom
+func (h *DashboardHandler) HandlePercentiles(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	source := r.URL.Query().Get("source")
+	if source == "" {
+		http.Error(w, "source parameter required", http.StatusBadRequest)
 		return
 	}
 
-	json.NewEncoder(w).Encode(series)
+	params := url.Values{"source": {source}}
+	h.serveCached(w, r, "percentiles", source, params, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetPercentiles(ctx, source, q)
+	})
 }
 
-// HandleAlerts returns alert events
-// GET /api/alerts?resolved=false
+// HandleAlerts returns alert events, optionally limited to a time range
+// GET /api/alerts?resolved=false&start=now-7d
 func (h *DashboardHandler) HandleAlerts(w http.ResponseWriter, r *http.Request) {
 	h.setCORS(w, r)
 
+	q, err := parseQuery(r, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var resolved *bool
 	if resolvedStr := r.URL.Query().Get("resolved"); resolvedStr != "" {
 		b := resolvedStr == "true"
@@ -251,7 +314,11 @@ func (h *DashboardHandler) HandleAlerts(w http.ResponseWriter, r *http.Request)
 
 	ctx := r.Context()
 
-	alerts, err := h.db.GetAlerts(ctx, resolved)
+	alerts, err := h.db.GetAlerts(ctx, q, resolved)
+	if errors.Is(err, storage.ErrInvalidArgument) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		slog.Error("failed to get alerts", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
@@ -302,8 +369,8 @@ func (h *DashboardHandler) HandleCORS(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 	}
 
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-None-Match")
 	w.Header().Set("Access-Control-Max-Age", "86400")
 	w.WriteHeader(http.StatusNoContent)
 }
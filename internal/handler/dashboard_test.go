@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/model"
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+func TestCacheRange(t *testing.T) {
+	start := time.Date(2024, 6, 1, 10, 7, 30, 0, time.UTC)
+	end := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	aligned := time.Date(2024, 6, 1, 10, 5, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		start, end string
+		q          storage.Query
+		ttl        time.Duration
+		want       time.Time
+	}{
+		{"relative, open end", "now-2h", "", storage.Query{Start: start}, 5 * time.Minute, aligned},
+		{"default, now", "", "now", storage.Query{Start: start}, 5 * time.Minute, aligned},
+		{"relative, explicit end", "now-2h", "2024-06-01T12:00:00Z", storage.Query{Start: start, End: end}, 5 * time.Minute, aligned},
+		{"explicit, open end", "2024-06-01T10:07:30Z", "", storage.Query{Start: start}, 5 * time.Minute, start},
+		{"explicit range", "2024-06-01T10:07:30Z", "2024-06-01T12:00:00Z", storage.Query{Start: start, End: end}, 5 * time.Minute, start},
+		{"caching disabled", "now-2h", "", storage.Query{Start: start}, 0, start},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := url.Values{}
+			if tt.start != "" {
+				params.Set("start", tt.start)
+			}
+			if tt.end != "" {
+				params.Set("end", tt.end)
+			}
+			got := cacheRange(tt.q, startIsRelative(params), tt.ttl)
+			if !got.Start.Equal(tt.want) {
+				t.Errorf("start = %s, want %s", got.Start, tt.want)
+			}
+			if !got.End.Equal(tt.q.End) {
+				t.Errorf("end = %s, want %s", got.End, tt.q.End)
+			}
+		})
+	}
+}
+
+func TestQueryCacheTimeout(t *testing.T) {
+	c := NewQueryCache(time.Minute, 20*time.Millisecond)
+	// The caller going away does not cancel the shared query, its own limit does
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.Do(ctx, "slow", time.Minute, func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			t.Errorf("query ended by %v, want its deadline", ctx.Err())
+		}
+		return nil, ctx.Err()
+	})
+	if !errors.Is(err, storage.ErrTimeout) {
+		t.Errorf("err = %v, want ErrTimeout", err)
+	}
+	if c.Stats().Entries != 0 {
+		t.Error("timed out query was cached")
+	}
+
+	e, err := c.Do(context.Background(), "fast", time.Minute, func(ctx context.Context) (any, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("query has no deadline")
+		}
+		return map[string]int{"n": 1}, nil
+	})
+	if err != nil || string(e.body) != "{\"n\":1}\n" {
+		t.Errorf("Do = %q, %v", e.body, err)
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	const etag = `"4f53cda18c2baa0c"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"4f53cda18c2baa0c"`, true},
+		{`W/"4f53cda18c2baa0c"`, true},
+		{`"0000000000000000", "4f53cda18c2baa0c"`, true},
+		{` "0000000000000000" ,W/"4f53cda18c2baa0c" `, true},
+		{`*`, true},
+		{``, false},
+		{`"0000000000000000"`, false},
+		{`4f53cda18c2baa0c`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+// wsMemory holds WebSocket events around 10:00-10:20 on 2024-05-01: one
+// connection still open from before the range, two connects and an error at
+// 10:01, a disconnect and a reconnect at 10:06 and a /chat connect at 10:12
+func wsMemory(t *testing.T) *storage.Memory {
+	t.Helper()
+	at := func(min int) time.Time { return time.Date(2024, 5, 1, 10, min, 0, 0, time.UTC) }
+	event := func(tm time.Time, kind, endpoint string) model.WebSocketMetric {
+		return model.WebSocketMetric{Time: tm, ConnectionID: "c", EventType: kind, Endpoint: &endpoint, DeviceType: ptr("mobile")}
+	}
+	latency := func(m model.WebSocketMetric, ms float64) model.WebSocketMetric {
+		m.LatencyMS = &ms
+		return m
+	}
+	closed := event(at(6), "disconnect", "/live")
+	closed.CloseCode = ptr(1000)
+
+	db := storage.NewMemory(0)
+	err := db.InsertWebSocketMetrics(context.Background(), []model.WebSocketMetric{
+		// Before the one hour lookback: ignored
+		event(at(0).Add(-2*time.Hour), "connect", "/live"),
+		// Within the lookback: one connection left open
+		event(at(0).Add(-30*time.Minute), "connect", "/live"),
+		event(at(0).Add(-29*time.Minute), "connect", "/live"),
+		event(at(0).Add(-20*time.Minute), "disconnect", "/live"),
+		latency(event(at(1), "connect", "/live"), 100),
+		latency(event(at(1), "connect", "/live"), 300),
+		event(at(1), "error", "/live"),
+		closed,
+		event(at(6), "reconnect", "/live"),
+		event(at(12), "connect", "/chat"),
+		// After the range
+		event(at(25), "connect", "/live"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestWebSocketHealth(t *testing.T) {
+	h := NewDashboardHandler(wsMemory(t), NewQueryCache(time.Minute, 0), NewExporter(storage.NewMemory(0)), nil)
+	w := httptest.NewRecorder()
+	h.HandleWebSocketHealth(w, httptest.NewRequest(http.MethodGet, "/api/metrics/ws?start=2024-05-01T10:00:00Z&end=2024-05-01T10:20:00Z&step=5m&endpoint=/live", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var rows []storage.WebSocketHealthRow
+	if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(rows, func(a, b storage.WebSocketHealthRow) int { return a.Bucket.Compare(b.Bucket) })
+	if len(rows) != 2 {
+		t.Fatalf("rows = %+v, want the 10:00 and 10:05 buckets of /live", rows)
+	}
+	first, second := rows[0], rows[1]
+	if first.Endpoint != "/live" || first.DeviceType != "mobile" || first.Connects != 2 || first.Errors != 1 ||
+		first.LatencySamples != 2 || first.AvgLatencyMS != 200 {
+		t.Errorf("10:00 = %+v", first)
+	}
+	if second.Disconnects != 1 || second.Reconnects != 1 || second.CloseCodes.Normal != 1 || second.Connects != 0 {
+		t.Errorf("10:05 = %+v", second)
+	}
+}
+
+func TestWebSocketTimeSeries(t *testing.T) {
+	h := NewDashboardHandler(wsMemory(t), NewQueryCache(time.Minute, 0), NewExporter(storage.NewMemory(0)), nil)
+	const window = "&start=2024-05-01T10:00:00Z&end=2024-05-01T10:20:00Z&step=5m"
+	tests := []struct {
+		query string
+		want  []float64 // values at 10:00, 10:05, 10:10; NaN = no point
+	}{
+		// One connection carried in from before start, +2 at 10:01,
+		// -1 +1 at 10:06 and +1 on /chat at 10:12
+		{"", []float64{3, 3, 4}},
+		{"metric=concurrent", []float64{3, 3, 4}},
+		{"metric=concurrent&endpoint=/live", []float64{3, 3, math.NaN()}},
+		{"metric=connects", []float64{2, 0, 1}},
+		{"metric=disconnects", []float64{0, 1, 0}},
+		{"metric=errors&endpoint=/live", []float64{1, 0, math.NaN()}},
+		{"metric=latency&endpoint=/live", []float64{200, 0, math.NaN()}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.HandleWebSocketTimeSeries(w, httptest.NewRequest(http.MethodGet, "/api/metrics/ws/timeseries?"+tt.query+window, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%q: status = %d: %s", tt.query, w.Code, w.Body)
+			continue
+		}
+		var points []storage.TimeSeriesPoint
+		if err := json.Unmarshal(w.Body.Bytes(), &points); err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[int]float64)
+		for _, p := range points {
+			got[p.Time.Minute()] = p.Value
+		}
+		for i, want := range tt.want {
+			v, ok := got[5*i]
+			if math.IsNaN(want) {
+				if ok {
+					t.Errorf("%q: unexpected point at 10:%02d = %g", tt.query, 5*i, v)
+				}
+			} else if !ok || v != want {
+				t.Errorf("%q: 10:%02d = %g (present %t), want %g", tt.query, 5*i, v, ok, want)
+			}
+		}
+		if len(points) > len(tt.want) {
+			t.Errorf("%q: points = %+v", tt.query, points)
+		}
+	}
+
+	for _, query := range []string{"metric=sessions", "metric=concurrent&compare=previous"} {
+		w := httptest.NewRecorder()
+		h.HandleWebSocketTimeSeries(w, httptest.NewRequest(http.MethodGet, "/api/metrics/ws/timeseries?"+query+window, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want 400", query, w.Code)
+		}
+	}
+}
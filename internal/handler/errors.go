@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// maxErrorLimit bounds the groups returned by /api/errors
+const maxErrorLimit = 200
+
+// HandleErrors groups API, PSP and game failures by fingerprint for triage
+// GET /api/errors?source=psp,game&order_by=count&limit=50&start=now-24h&psp=PIX
+// source: api, psp, game (default: all the filters apply to); order_by: count (default), players, last_seen
+func (h *DashboardHandler) HandleErrors(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	params := r.URL.Query()
+	opts := storage.ErrorOptions{
+		Fingerprint: params.Get("fingerprint"),
+		OrderBy:     params.Get("order_by"),
+	}
+	if v := params.Get("source"); v != "" {
+		opts.Sources = strings.Split(v, ",")
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxErrorLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxErrorLimit), http.StatusBadRequest)
+			return
+		}
+		opts.Limit = n
+	}
+	key := url.Values{
+		"source":      {params.Get("source")},
+		"fingerprint": {opts.Fingerprint},
+		"order_by":    {opts.OrderBy},
+		"limit":       {strconv.Itoa(opts.Limit)},
+	}
+
+	h.serveCached(w, r, "error groups", "api", key, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetErrorGroups(ctx, q, opts)
+	})
+}
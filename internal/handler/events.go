@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// defaultTimelineLimit is the number of timeline entries returned without a limit
+const defaultTimelineLimit = 500
+
+// EventsHandler serves raw events for investigating single requests,
+// transactions and sessions
+type EventsHandler struct {
+	db             storage.Dashboard
+	timeout        time.Duration
+	allowedOrigins map[string]bool
+	allowAll       bool
+}
+
+// NewEventsHandler creates the /api/events handler; every read is cut off after timeout
+func NewEventsHandler(db storage.Dashboard, timeout time.Duration, origins []string) *EventsHandler {
+	h := &EventsHandler{
+		db:             db,
+		timeout:        timeout,
+		allowedOrigins: make(map[string]bool),
+	}
+	for _, o := range origins {
+		if o == "*" {
+			h.allowAll = true
+			break
+		}
+		h.allowedOrigins[o] = true
+	}
+	return h
+}
+
+func (h *EventsHandler) setCORS(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if h.allowAll {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else if h.allowedOrigins[origin] {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// Handle returns one page of raw events of a table, newest first
+// GET /api/events/psp?start=now-24h&psp=PIX&player_id=<uuid>&meta.bonus.code=WELCOME
+//
+//	&columns=time,psp_name,error_message&limit=100&order=desc&cursor=<next_cursor>
+//
+// table: frontend, api, psp, game, ws
+func (h *EventsHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	q, err := parseQuery(r, time.Hour)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	eq, err := parseEventQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	eq.Timeout = h.timeout
+
+	ctx := r.Context()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	page, err := h.db.GetEvents(ctx, r.PathValue("table"), q, eq)
+	if err != nil {
+		writeStorageError(w, "failed to get events", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(page)
+}
+
+// metadataParams reads the meta.<path>=<value> filters, nil when there are none
+func metadataParams(params url.Values) map[string]string {
+	var metadata map[string]string
+	for k, vs := range params {
+		if path, ok := strings.CutPrefix(k, "meta."); ok && len(vs) > 0 {
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+			metadata[path] = vs[0]
+		}
+	}
+	return metadata
+}
+
+// parseEventQuery reads the ID lookups, meta.<path> filters, columns, limit,
+// order and cursor
+func parseEventQuery(r *http.Request) (storage.EventQuery, error) {
+	params := r.URL.Query()
+	eq := storage.EventQuery{Cursor: params.Get("cursor")}
+
+	for _, name := range storage.EventLookups {
+		if v := params.Get(name); v != "" {
+			if eq.Lookups == nil {
+				eq.Lookups = make(map[string]string)
+			}
+			eq.Lookups[name] = v
+		}
+	}
+	eq.Metadata = metadataParams(params)
+	if v := params.Get("columns"); v != "" {
+		eq.Columns = strings.Split(v, ",")
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > storage.MaxEventLimit {
+			return eq, fmt.Errorf("limit must be between 1 and %d", storage.MaxEventLimit)
+		}
+		eq.Limit = n
+	}
+	switch params.Get("order") {
+	case "", "desc":
+	case "asc":
+		eq.Ascending = true
+	default:
+		return eq, fmt.Errorf("order must be asc or desc")
+	}
+	return eq, nil
+}
+
+// HandleTimeline merges everything one player did into a single stream, oldest first
+// GET /api/players/{player_id}/timeline?start=2024-05-01T21:00:00Z&end=2024-05-01T21:30:00Z&limit=500&cursor=...
+func (h *EventsHandler) HandleTimeline(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	q, err := parseQuery(r, 24*time.Hour)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := storage.TimelineOptions{Limit: defaultTimelineLimit, Cursor: r.URL.Query().Get("cursor"), Timeout: h.timeout}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > storage.MaxEventLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", storage.MaxEventLimit), http.StatusBadRequest)
+			return
+		}
+		opts.Limit = n
+	}
+
+	ctx := r.Context()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	timeline, err := h.db.GetPlayerTimeline(ctx, r.PathValue("player_id"), q, opts)
+	if err != nil {
+		writeStorageError(w, "failed to get player timeline", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(timeline)
+}
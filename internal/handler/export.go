@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// exportFormats are the download formats accepted as ?format= next to the default JSON
+var exportFormats = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"xlsx":   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"ndjson": "application/x-ndjson",
+}
+
+// exportFormat returns the requested export format, or "" for plain JSON
+func exportFormat(r *http.Request) (string, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" || format == "json" {
+		return "", nil
+	}
+	if _, ok := exportFormats[format]; !ok {
+		return "", fmt.Errorf("invalid format %q: use json, csv, xlsx or ndjson", format)
+	}
+	return format, nil
+}
+
+// Exporter streams dashboard data as CSV, XLSX or NDJSON downloads and records
+// every export in the audit trail
+type Exporter struct {
+	audit storage.ExportAudit
+}
+
+// NewExporter creates an exporter auditing to audit
+func NewExporter(audit storage.ExportAudit) *Exporter {
+	return &Exporter{audit: audit}
+}
+
+// exportWriter counts what reaches the client and remembers whether the
+// response has started, after which errors can no longer change the status
+type exportWriter struct {
+	w       io.Writer
+	bytes   int64
+	started bool
+}
+
+func (ew *exportWriter) Write(p []byte) (int, error) {
+	ew.started = true
+	n, err := ew.w.Write(p)
+	ew.bytes += int64(n)
+	return n, err
+}
+
+// Export writes the rows produced by scan as a download named after name and
+// the query range. Nothing is sent before scan yields its first row, so errors
+// up to then still get a proper status; a failure mid-stream aborts the
+// connection so a truncated file is never mistaken for a complete one.
+func (e *Exporter) Export(w http.ResponseWriter, r *http.Request, format, name string, q storage.Query, columns []string, scan func(row func(values []any) error) error) {
+	start := time.Now()
+
+	// Large exports outlive the server WriteTimeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	ew := &exportWriter{w: w}
+	var table tableWriter
+	rows := int64(0)
+	open := func() error {
+		w.Header().Set("Content-Type", exportFormats[format])
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": exportFilename(name, q, format)}))
+		w.Header().Set("Cache-Control", "no-store")
+		var err error
+		table, err = newTableWriter(format, ew, columns)
+		return err
+	}
+
+	err := scan(func(values []any) error {
+		if table == nil {
+			if err := open(); err != nil {
+				return err
+			}
+		}
+		rows++
+		return table.WriteRow(values)
+	})
+	if err == nil && table == nil {
+		err = open()
+	}
+	if err == nil {
+		err = table.Close()
+	}
+
+	e.record(r, format, rows, ew.bytes, time.Since(start), err)
+
+	if err == nil {
+		return
+	}
+	if !ew.started {
+		w.Header().Del("Content-Disposition")
+		writeStorageError(w, "failed to export "+name, err)
+		return
+	}
+	slog.Error("export failed mid-stream", "export", name, "rows", rows, "error", err)
+	panic(http.ErrAbortHandler)
+}
+
+// record appends the export to the audit trail; the client may be gone already
+func (e *Exporter) record(r *http.Request, format string, rows, bytes int64, took time.Duration, exportErr error) {
+	params := r.URL.Query()
+	params.Del("access_token")
+
+	row := storage.ExportAuditRow{
+		Time:       time.Now(),
+		Actor:      r.Header.Get("X-User-Email"),
+		Resource:   r.URL.Path,
+		Format:     format,
+		Params:     params.Encode(),
+		Rows:       rows,
+		Bytes:      bytes,
+		DurationMS: float64(took.Microseconds()) / 1000,
+	}
+	if exportErr != nil {
+		msg := exportErr.Error()
+		row.Error = &msg
+	}
+
+	slog.Info("data exported", "actor", row.Actor, "resource", row.Resource, "format", format,
+		"rows", rows, "bytes", bytes, "duration_ms", row.DurationMS, "error", exportErr)
+	if err := e.audit.RecordExport(context.WithoutCancel(r.Context()), row); err != nil {
+		slog.Error("failed to record export", "error", err)
+	}
+}
+
+// exportFilename is pulse-<name>-<start>-<end>.<ext> in UTC
+func exportFilename(name string, q storage.Query, ext string) string {
+	end := q.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	const layout = "20060102T1504Z"
+	return fmt.Sprintf("pulse-%s-%s-%s.%s", name, q.Start.UTC().Format(layout), end.UTC().Format(layout), ext)
+}
+
+// exportName derives an export name from a dashboard path, e.g.
+// /api/metrics/psp/timeseries → psp-timeseries
+func exportName(path string) string {
+	name := strings.TrimPrefix(path, "/api/metrics/")
+	return strings.ReplaceAll(strings.Trim(name, "/"), "/", "-")
+}
+
+// maxResultExportRows caps exports of dashboard results. Those are computed in
+// memory before they are written, unlike raw events, which stream from the
+// database through /api/export/events
+const maxResultExportRows = 100_000
+
+// exportResult writes a computed dashboard result as an export
+func (e *Exporter) exportResult(w http.ResponseWriter, r *http.Request, format string, q storage.Query, fn func(ctx context.Context, q storage.Query) (any, error)) {
+	name := exportName(r.URL.Path)
+	var columns []string
+	var rows [][]any
+	res, err := fn(r.Context(), q)
+	if err == nil {
+		columns, rows = tabulate(res)
+		if len(rows) > maxResultExportRows {
+			err = fmt.Errorf("%w: result has %d rows, exports hold at most %d; narrow the range or filters, or export raw events",
+				storage.ErrInvalidArgument, len(rows), maxResultExportRows)
+			rows = nil
+		}
+	}
+	e.Export(w, r, format, name, q, columns, func(row func(values []any) error) error {
+		if err != nil {
+			return err
+		}
+		for _, values := range rows {
+			if err := row(values); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RequireAuthForExport leaves dashboard reads open as before but sends exports
+// (format=csv|xlsx|ndjson) through RequireAuth, so each one has a user
+func (h *AuthHandler) RequireAuthForExport(next http.HandlerFunc) http.HandlerFunc {
+	requireAuth := h.RequireAuth(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := exportFormats[r.URL.Query().Get("format")]; ok {
+			requireAuth(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// HandleExportEvents streams raw events of one table
+// GET /api/export/events/{table}?format=csv&start=now-7d&psp=PIX
+// table: frontend, api, psp, game, ws
+func (h *DashboardHandler) HandleExportEvents(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	format, err := exportFormat(r)
+	if err == nil && format == "" {
+		err = errors.New("format parameter required: csv, xlsx or ndjson")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q, err := parseQuery(r, time.Hour)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	table := r.PathValue("table")
+	columns, err := storage.EventColumns(table)
+	if err != nil {
+		writeStorageError(w, "failed to export events", err)
+		return
+	}
+
+	h.exports.Export(w, r, format, table+"-events", q, columns, func(row func(values []any) error) error {
+		return h.db.ScanEvents(r.Context(), table, q, row)
+	})
+}
+
+// HandleExportAudit returns recent exports, optionally of one user
+// GET /api/admin/export-audit?actor=finance@example.com&limit=100
+func (h *DashboardHandler) HandleExportAudit(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	limit := 100
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	rows, err := h.exports.audit.GetExportAudit(r.Context(), r.URL.Query().Get("actor"), limit)
+	if err != nil {
+		writeStorageError(w, "failed to get export audit", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rows)
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+func TestExportResultCap(t *testing.T) {
+	type point struct {
+		Value float64 `json:"value"`
+	}
+	e := NewExporter(storage.NewMemory(0))
+	q := storage.Query{Start: time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC), End: time.Date(2024, 6, 1, 11, 0, 0, 0, time.UTC)}
+	export := func(n int) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/metrics/psp/timeseries?format=csv", nil)
+		w := httptest.NewRecorder()
+		e.exportResult(w, r, "csv", q, func(ctx context.Context, q storage.Query) (any, error) {
+			return make([]point, n), nil
+		})
+		return w
+	}
+
+	w := export(maxResultExportRows)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export at the cap: status %d: %s", w.Code, w.Body)
+	}
+	if lines := strings.Count(w.Body.String(), "\n"); lines != maxResultExportRows+1 {
+		t.Errorf("export at the cap has %d lines, want %d", lines, maxResultExportRows+1)
+	}
+	if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, "pulse-psp-timeseries-20240601T1000Z-20240601T1100Z.csv") {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+
+	w = export(maxResultExportRows + 1)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("export over the cap: status %d, want 400", w.Code)
+	}
+	if w.Header().Get("Content-Disposition") != "" {
+		t.Error("rejected export is still served as an attachment")
+	}
+}
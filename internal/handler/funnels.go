@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// HandleListFunnels returns every stored funnel definition
+// GET /api/funnels
+func (h *DashboardHandler) HandleListFunnels(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	funnels, err := h.db.ListFunnels(r.Context())
+	if err != nil {
+		writeStorageError(w, "failed to list funnels", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(funnels)
+}
+
+// HandleGetFunnel returns one funnel definition
+// GET /api/funnels/{id}
+func (h *DashboardHandler) HandleGetFunnel(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	id, ok := funnelID(w, r)
+	if !ok {
+		return
+	}
+	f, err := h.db.GetFunnel(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, "failed to get funnel", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(f)
+}
+
+// HandleSaveFunnel creates (POST /api/funnels) or replaces (PUT /api/funnels/{id})
+// a funnel definition
+//
+//	{"name": "Deposit", "window_seconds": 1800, "steps": [
+//	  {"name": "Click", "event_type": "interaction", "metric_name": "deposit_button_click"},
+//	  {"name": "Deposit", "source": "psp", "operation": "deposit", "success": true}]}
+func (h *DashboardHandler) HandleSaveFunnel(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	var f storage.Funnel
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	f.ID = 0
+	if r.PathValue("id") != "" {
+		id, ok := funnelID(w, r)
+		if !ok {
+			return
+		}
+		f.ID = id
+	}
+	f.CreatedBy = r.Header.Get("X-User-Email")
+
+	status := http.StatusOK
+	if f.ID == 0 {
+		status = http.StatusCreated
+	}
+	if err := h.db.SaveFunnel(r.Context(), &f); err != nil {
+		writeStorageError(w, "failed to save funnel", err)
+		return
+	}
+
+	slog.Info("funnel saved", "id", f.ID, "name", f.Name, "actor", r.Header.Get("X-User-Email"))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(f)
+}
+
+// HandleDeleteFunnel removes a funnel definition
+// DELETE /api/funnels/{id}
+func (h *DashboardHandler) HandleDeleteFunnel(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	id, ok := funnelID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.db.DeleteFunnel(r.Context(), id); err != nil {
+		writeStorageError(w, "failed to delete funnel", err)
+		return
+	}
+
+	slog.Info("funnel deleted", "id", id, "actor", r.Header.Get("X-User-Email"))
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// HandleFunnelReport computes per-step counts, conversion and drop-off of a
+// stored funnel. Step 1 must happen in the range; later steps follow within
+// the funnel's window.
+// GET /api/funnels/{id}/report?by=player&breakdown=country&start=now-7d
+// by: session (default), player; breakdown: device, country, psp
+func (h *DashboardHandler) HandleFunnelReport(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	id, ok := funnelID(w, r)
+	if !ok {
+		return
+	}
+	f, err := h.db.GetFunnel(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, "failed to get funnel", err)
+		return
+	}
+
+	params := r.URL.Query()
+	opts := storage.FunnelOptions{
+		By:        params.Get("by"),
+		Breakdown: params.Get("breakdown"),
+	}
+	// An edited funnel must not be served from the cache
+	key := url.Values{
+		"by":        {opts.By},
+		"breakdown": {opts.Breakdown},
+		"version":   {f.UpdatedAt.Format(time.RFC3339Nano)},
+	}
+
+	h.serveCached(w, r, "funnel report", "psp", key, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetFunnelReport(ctx, *f, q, opts)
+	})
+}
+
+// funnelID parses the {id} path value, answering 400 when it is invalid
+func funnelID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid funnel id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"net"
@@ -144,11 +145,16 @@ func resolveCountry(ip string) string {
 // HEALTH HANDLER
 // ============================================
 
+// Pinger checks backend connectivity
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
 type HealthHandler struct {
-	db *storage.Postgres
+	db Pinger
 }
 
-func NewHealthHandler(db *storage.Postgres) *HealthHandler {
+func NewHealthHandler(db Pinger) *HealthHandler {
 	return &HealthHandler{db: db}
 }
 
@@ -175,19 +181,55 @@ func (h *HealthHandler) HandleReady(w http.ResponseWriter, r *http.Request) {
 // METRICS HANDLER
 // ============================================
 
+// PoolStatsProvider exposes database pool statistics (Postgres only)
+type PoolStatsProvider interface {
+	PoolStats() map[string]storage.PoolStats
+}
+
 type MetricsHandler struct {
 	collector *collector.BatchCollector
+	pools     PoolStatsProvider
+	cache     *QueryCache
 }
 
-func NewMetricsHandler(c *collector.BatchCollector) *MetricsHandler {
-	return &MetricsHandler{collector: c}
+// NewMetricsHandler creates the /metrics handler; pools and cache may be nil
+func NewMetricsHandler(c *collector.BatchCollector, pools PoolStatsProvider, cache *QueryCache) *MetricsHandler {
+	return &MetricsHandler{collector: c, pools: pools, cache: cache}
 }
 
 func (h *MetricsHandler) Handle(w http.ResponseWriter, r *http.Request) {
-	stats := h.collector.GetStats()
+	resp := struct {
+		model.CollectorStats
+		Pools map[string]storage.PoolStats `json:"pools,omitempty"`
+		Cache *CacheStats                  `json:"dashboard_cache,omitempty"`
+	}{
+		CollectorStats: h.collector.GetStats(),
+	}
+	if h.pools != nil {
+		resp.Pools = h.pools.PoolStats()
+	}
+	if h.cache != nil {
+		stats := h.cache.Stats()
+		resp.Cache = &stats
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(stats)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeMetrics writes a batch with COPY, falling back to INSERT if COPY fails
+func writeMetrics[T any](ctx context.Context, kind string, batch []T, copyFn, insertFn func(context.Context, []T) error) error {
+	err := copyFn(ctx, batch)
+	if err == nil {
+		return nil
+	}
+
+	slog.Warn("copy failed, falling back to insert",
+		"kind", kind,
+		"batch_size", len(batch),
+		"error", err,
+	)
+	return insertFn(ctx, batch)
 }
 
 // ============================================
@@ -195,12 +237,12 @@ func (h *MetricsHandler) Handle(w http.ResponseWriter, r *http.Request) {
 // ============================================
 
 type APICollectHandler struct {
-	db             *storage.Postgres
+	db             storage.Writer
 	allowedOrigins map[string]bool
 	allowAll       bool
 }
 
-func NewAPICollectHandler(db *storage.Postgres, origins []string) *APICollectHandler {
+func NewAPICollectHandler(db storage.Writer, origins []string) *APICollectHandler {
 	h := &APICollectHandler{
 		db:             db,
 		allowedOrigins: make(map[string]bool),
@@ -241,7 +283,7 @@ func (h *APICollectHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	if err := h.db.InsertAPIMetrics(ctx, batch.Metrics); err != nil {
+	if err := writeMetrics(ctx, "api", batch.Metrics, h.db.CopyAPIMetrics, h.db.InsertAPIMetrics); err != nil {
 		slog.Error("failed to insert API metrics", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -265,12 +307,12 @@ func (h *APICollectHandler) setCORS(w http.ResponseWriter, r *http.Request) {
 // ============================================
 
 type PSPCollectHandler struct {
-	db             *storage.Postgres
+	db             storage.Writer
 	allowedOrigins map[string]bool
 	allowAll       bool
 }
 
-func NewPSPCollectHandler(db *storage.Postgres, origins []string) *PSPCollectHandler {
+func NewPSPCollectHandler(db storage.Writer, origins []string) *PSPCollectHandler {
 	h := &PSPCollectHandler{
 		db:             db,
 		allowedOrigins: make(map[string]bool),
@@ -311,7 +353,7 @@ func (h *PSPCollectHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	if err := h.db.InsertPSPMetrics(ctx, batch.Metrics); err != nil {
+	if err := writeMetrics(ctx, "psp", batch.Metrics, h.db.CopyPSPMetrics, h.db.InsertPSPMetrics); err != nil {
 		slog.Error("failed to insert PSP metrics", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -335,12 +377,12 @@ func (h *PSPCollectHandler) setCORS(w http.ResponseWriter, r *http.Request) {
 // ============================================
 
 type GameCollectHandler struct {
-	db             *storage.Postgres
+	db             storage.Writer
 	allowedOrigins map[string]bool
 	allowAll       bool
 }
 
-func NewGameCollectHandler(db *storage.Postgres, origins []string) *GameCollectHandler {
+func NewGameCollectHandler(db storage.Writer, origins []string) *GameCollectHandler {
 	h := &GameCollectHandler{
 		db:             db,
 		allowedOrigins: make(map[string]bool),
@@ -381,7 +423,7 @@ func (h *GameCollectHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	if err := h.db.InsertGameMetrics(ctx, batch.Metrics); err != nil {
+	if err := writeMetrics(ctx, "game", batch.Metrics, h.db.CopyGameMetrics, h.db.InsertGameMetrics); err != nil {
 		slog.Error("failed to insert game metrics", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -405,12 +447,12 @@ func (h *GameCollectHandler) setCORS(w http.ResponseWriter, r *http.Request) {
 // ============================================
 
 type WSCollectHandler struct {
-	db             *storage.Postgres
+	db             storage.Writer
 	allowedOrigins map[string]bool
 	allowAll       bool
 }
 
-func NewWSCollectHandler(db *storage.Postgres, origins []string) *WSCollectHandler {
+func NewWSCollectHandler(db storage.Writer, origins []string) *WSCollectHandler {
 	h := &WSCollectHandler{
 		db:             db,
 		allowedOrigins: make(map[string]bool),
@@ -451,7 +493,7 @@ func (h *WSCollectHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	if err := h.db.InsertWebSocketMetrics(ctx, batch.Metrics); err != nil {
+	if err := writeMetrics(ctx, "ws", batch.Metrics, h.db.CopyWebSocketMetrics, h.db.InsertWebSocketMetrics); err != nil {
 		slog.Error("failed to insert WebSocket metrics", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/collector"
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+type fakePools map[string]storage.PoolStats
+
+func (f fakePools) PoolStats() map[string]storage.PoolStats { return f }
+
+func getMetrics(t *testing.T, h *MetricsHandler) map[string]json.RawMessage {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.Handle(rec, httptest.NewRequest("GET", "/metrics", nil))
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return body
+}
+
+func TestMetricsPools(t *testing.T) {
+	db := storage.NewMemory(0)
+	c := collector.NewBatchCollector(collector.BatchConfig{BatchSize: 10, FlushInterval: time.Second, Workers: 1}, db)
+
+	// The in-memory store has no pools, so the section is left out
+	if _, ok := any(db).(PoolStatsProvider); ok {
+		t.Fatal("Memory reports pool stats")
+	}
+	body := getMetrics(t, NewMetricsHandler(c, nil, nil))
+	if _, ok := body["pools"]; ok {
+		t.Errorf("pools reported without a provider: %s", body["pools"])
+	}
+	if _, ok := body["dashboard_cache"]; ok {
+		t.Errorf("cache reported without a cache: %s", body["dashboard_cache"])
+	}
+	if _, ok := body["events_received"]; !ok {
+		t.Errorf("collector stats missing: %v", body)
+	}
+
+	pools := fakePools{
+		"writer": {TotalConns: 5, IdleConns: 3, AcquiredConns: 2, MaxConns: 20, AcquireCount: 40, AvgAcquireTimeMS: 0.5},
+		"reader": {TotalConns: 10, AcquiredConns: 10, MaxConns: 10, EmptyAcquireCount: 7, CanceledAcquireCount: 1},
+	}
+	body = getMetrics(t, NewMetricsHandler(c, pools, NewQueryCache(time.Minute, 0)))
+	var got map[string]storage.PoolStats
+	if err := json.Unmarshal(body["pools"], &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["writer"] != pools["writer"] || got["reader"] != pools["reader"] {
+		t.Errorf("pools = %+v, want %+v", got, pools)
+	}
+	if _, ok := body["dashboard_cache"]; !ok {
+		t.Error("cache stats missing")
+	}
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// parseQuery reads the range, step and dimension filters shared by dashboard
+// endpoints:
+//
+//	start, end  RFC 3339, "now" or "now-<duration>" (e.g. now-24h, now-7d)
+//	step        bucket width, e.g. 5m, 1h, 1d
+//	service, endpoint, method, psp, operation, currency, provider,
+//	game_type, device_type, country, page_path   exact-match filters
+//
+// Without start the range is the last defaultSpan, or unbounded when
+// defaultSpan is zero. An absent end (or "now") leaves Query.End zero.
+func parseQuery(r *http.Request, defaultSpan time.Duration) (storage.Query, error) {
+	params := r.URL.Query()
+	now := time.Now()
+	var q storage.Query
+
+	if v := params.Get("end"); v != "" && v != "now" {
+		end, err := parseTimeParam(v, now)
+		if err != nil {
+			return q, fmt.Errorf("invalid end: %w", err)
+		}
+		q.End = end
+	}
+
+	if v := params.Get("start"); v != "" {
+		start, err := parseTimeParam(v, now)
+		if err != nil {
+			return q, fmt.Errorf("invalid start: %w", err)
+		}
+		q.Start = start
+	} else if defaultSpan > 0 {
+		end := q.End
+		if end.IsZero() {
+			end = now
+		}
+		q.Start = end.Add(-defaultSpan)
+	}
+
+	if !q.End.IsZero() && !q.Start.Before(q.End) {
+		return q, fmt.Errorf("start must be before end")
+	}
+	if q.End.IsZero() && q.Start.After(now) {
+		return q, fmt.Errorf("start is in the future")
+	}
+
+	if v := params.Get("step"); v != "" {
+		step, err := parseDurationParam(v)
+		if err != nil || step <= 0 {
+			return q, fmt.Errorf("invalid step %q: use a positive duration such as 5m, 1h or 1d", v)
+		}
+		q.Step = step
+	}
+
+	for _, dim := range storage.Dimensions {
+		if v := params.Get(dim); v != "" {
+			if q.Filters == nil {
+				q.Filters = make(map[string]string)
+			}
+			q.Filters[dim] = v
+		}
+	}
+
+	return q, nil
+}
+
+// startIsRelative reports whether the start parameter moves with the clock:
+// absent (a default span back from the end), "now" or "now-<duration>"
+func startIsRelative(params url.Values) bool {
+	v := params.Get("start")
+	return v == "" || v == "now" || strings.HasPrefix(v, "now-")
+}
+
+// parseTimeParam parses RFC 3339, "now" or "now-<duration>"
+func parseTimeParam(v string, now time.Time) (time.Time, error) {
+	if v == "now" {
+		return now, nil
+	}
+	if rel, ok := strings.CutPrefix(v, "now-"); ok {
+		d, err := parseDurationParam(rel)
+		if err != nil || d <= 0 {
+			return time.Time{}, fmt.Errorf("%q: bad relative duration", v)
+		}
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q: use RFC 3339, now or now-24h", v)
+	}
+	return t, nil
+}
+
+// parseDurationParam is time.ParseDuration plus whole days (d) and weeks (w)
+func parseDurationParam(v string) (time.Duration, error) {
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(v, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(v, "w"):
+		unit = 7 * 24 * time.Hour
+	default:
+		return time.ParseDuration(v)
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return 0, fmt.Errorf("duration %q out of range", v)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// queryKey normalizes q and endpoint-specific params into a cache key suffix
+func queryKey(q storage.Query, params url.Values) string {
+	key := url.Values{"start": {q.Start.UTC().Format(time.RFC3339)}}
+	if !q.End.IsZero() {
+		key.Set("end", q.End.UTC().Format(time.RFC3339))
+	}
+	if q.Step > 0 {
+		key.Set("step", q.Step.String())
+	}
+	for dim, v := range q.Filters {
+		key.Set(dim, v)
+	}
+	for k, vs := range params {
+		if len(vs) > 0 && vs[0] != "" {
+			key[k] = vs
+		}
+	}
+	return key.Encode()
+}
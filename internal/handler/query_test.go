@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+func TestParseDurationParam(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		v       string
+		want    time.Duration
+		invalid bool
+	}{
+		{v: "5m", want: 5 * time.Minute},
+		{v: "1h30m", want: 90 * time.Minute},
+		{v: "1d", want: day},
+		{v: "7d", want: 7 * day},
+		{v: "2w", want: 14 * day},
+		{v: "0d", want: 0},
+		{v: "-1d", want: -day},
+		{v: "1.5d", invalid: true},
+		{v: "d", invalid: true},
+		{v: "w", invalid: true},
+		{v: "1dw", invalid: true},
+		{v: "1y", invalid: true},
+		{v: "", invalid: true},
+		{v: "999999999w", invalid: true},
+		{v: "9223372036854775807d", invalid: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDurationParam(tt.v)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("parseDurationParam(%q) = %s, want an error", tt.v, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseDurationParam(%q) = %s, %v; want %s", tt.v, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseTimeParam(t *testing.T) {
+	now := time.Date(2024, 6, 8, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		v       string
+		want    time.Time
+		invalid bool
+	}{
+		{v: "now", want: now},
+		{v: "now-24h", want: now.Add(-24 * time.Hour)},
+		{v: "now-7d", want: now.AddDate(0, 0, -7)},
+		{v: "now-1w", want: now.AddDate(0, 0, -7)},
+		{v: "2024-06-01T10:00:00+02:00", want: time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)},
+		{v: "now-", invalid: true},
+		{v: "now-0d", invalid: true},
+		{v: "now--1d", invalid: true},
+		{v: "now+1h", invalid: true},
+		{v: "2024-06-01", invalid: true},
+		{v: "yesterday", invalid: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeParam(tt.v, now)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("parseTimeParam(%q) = %s, want an error", tt.v, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseTimeParam(%q) = %s, %v; want %s", tt.v, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	parse := func(query string) (storage.Query, time.Time, error) {
+		before := time.Now()
+		q, err := parseQuery(httptest.NewRequest(http.MethodGet, "/api/metrics/api?"+query, nil), time.Hour)
+		return q, before, err
+	}
+	// near reports whether got is want give or take the time the call took
+	near := func(got, want time.Time) bool { return got.Sub(want).Abs() < time.Second }
+
+	q, now, err := parse("")
+	if err != nil || !near(q.Start, now.Add(-time.Hour)) || !q.End.IsZero() || q.Step != 0 || q.Filters != nil {
+		t.Errorf("defaults = %+v, %v; want the last hour, open end", q, err)
+	}
+
+	q, now, err = parse("start=now-7d&end=now&step=1d")
+	if err != nil || !near(q.Start, now.AddDate(0, 0, -7)) || !q.End.IsZero() || q.Step != 24*time.Hour {
+		t.Errorf("now-7d = %+v, %v; want 7 days back with 1d steps", q, err)
+	}
+
+	q, _, err = parse("end=2024-06-01T12:00:00Z&step=2w")
+	if err != nil || !q.Start.Equal(time.Date(2024, 6, 1, 11, 0, 0, 0, time.UTC)) || q.Step != 14*24*time.Hour {
+		t.Errorf("default span before an explicit end = %+v, %v", q, err)
+	}
+
+	q, _, err = parse("service=wallet&psp=PIX&country=&password=x&service_name=y")
+	if err != nil || len(q.Filters) != 2 || q.Filters["service"] != "wallet" || q.Filters["psp"] != "PIX" {
+		t.Errorf("filters = %v, %v; want only the non-empty known dimensions", q.Filters, err)
+	}
+
+	for _, query := range []string{
+		"start=2024-06-01T12:00:00Z&end=2024-06-01T12:00:00Z",
+		"start=2024-06-01T13:00:00Z&end=2024-06-01T12:00:00Z",
+		"start=now-1h&end=now-2h",
+		"start=2999-01-01T00:00:00Z",
+		"start=now-",
+		"start=last-week",
+		"end=tomorrow",
+		"step=0m",
+		"step=-5m",
+		"step=1.5d",
+		"step=often",
+	} {
+		if q, _, err := parse(query); err == nil {
+			t.Errorf("parseQuery(%s) = %+v, want an error", query, q)
+		}
+	}
+}
+
+func TestDashboardRejectsForeignFilters(t *testing.T) {
+	h := NewDashboardHandler(storage.NewMemory(0), NewQueryCache(time.Minute, 0), NewExporter(storage.NewMemory(0)), nil)
+	for _, tt := range []struct {
+		path string
+		code int
+	}{
+		{"/api/metrics/api?service=wallet", http.StatusOK},
+		// psp is a dimension, but not one of API metrics
+		{"/api/metrics/api?psp=PIX", http.StatusBadRequest},
+		{"/api/metrics/api?start=now-1h&end=now-2h", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		h.HandleAPIPerformance(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("GET %s = %d %s, want %d", tt.path, w.Code, strings.TrimSpace(w.Body.String()), tt.code)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+const (
+	// defaultDeploymentSpan is the range of deployments listed when start is not given
+	defaultDeploymentSpan = 30 * 24 * time.Hour
+	// defaultReleaseSpan is the range both releases are read over when start is not given
+	defaultReleaseSpan = 7 * 24 * time.Hour
+)
+
+// HandleRecordDeployment stores a deployment annotation; deployed_at defaults to now
+// POST /api/deployments
+//
+//	{"release": "2024.06.1", "service": "backend", "environment": "production", "description": "New cashier"}
+func (h *DashboardHandler) HandleRecordDeployment(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	var d storage.Deployment
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	d.ID = 0
+	d.CreatedBy = r.Header.Get("X-User-Email")
+
+	if err := h.db.RecordDeployment(r.Context(), &d); err != nil {
+		writeStorageError(w, "failed to record deployment", err)
+		return
+	}
+
+	slog.Info("deployment recorded", "id", d.ID, "release", d.Release, "service", d.Service, "actor", d.CreatedBy)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(d)
+}
+
+// HandleListDeployments returns deployment annotations, newest first
+// GET /api/deployments?start=now-30d&release=2024.06.1&service=backend&environment=production&limit=100
+func (h *DashboardHandler) HandleListDeployments(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	q, err := parseQuery(r, defaultDeploymentSpan)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := r.URL.Query()
+	opts := storage.DeploymentOptions{Environment: params.Get("environment")}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > storage.MaxDeploymentLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", storage.MaxDeploymentLimit), http.StatusBadRequest)
+			return
+		}
+		opts.Limit = n
+	}
+
+	deployments, err := h.db.ListDeployments(r.Context(), q, opts)
+	if err != nil {
+		writeStorageError(w, "failed to list deployments", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(deployments)
+}
+
+// HandleCompareReleases compares a release's Web Vitals, API/PSP/game latency
+// and error rates with a baseline release and flags significant regressions.
+// Both releases are read from raw rows over the same range.
+// GET /api/releases/{release}/compare?baseline=2024.05.3&environment=production&start=now-7d
+// baseline defaults to the release deployed before this one
+func (h *DashboardHandler) HandleCompareReleases(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	release := r.PathValue("release")
+	params := r.URL.Query()
+	opts := storage.ReleaseOptions{
+		Baseline:    params.Get("baseline"),
+		Environment: params.Get("environment"),
+	}
+	key := url.Values{
+		"release":     {release},
+		"baseline":    {opts.Baseline},
+		"environment": {opts.Environment},
+	}
+
+	h.serveCachedSpan(w, r, defaultReleaseSpan, "release comparison", "api", key, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.CompareReleases(ctx, release, q, opts)
+	})
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// defaultMetricQuerySpan is the range of an ad-hoc query without a start
+const defaultMetricQuerySpan = 24 * time.Hour
+
+// QueryHandler serves ad-hoc queries over the metric model, so a new chart
+// needs no new storage method or route
+type QueryHandler struct {
+	db             storage.Dashboard
+	timeout        time.Duration
+	allowedOrigins map[string]bool
+	allowAll       bool
+}
+
+// NewQueryHandler creates the /api/query handler; every query is cut off after timeout
+func NewQueryHandler(db storage.Dashboard, timeout time.Duration, origins []string) *QueryHandler {
+	h := &QueryHandler{
+		db:             db,
+		timeout:        timeout,
+		allowedOrigins: make(map[string]bool),
+	}
+	for _, o := range origins {
+		if o == "*" {
+			h.allowAll = true
+			break
+		}
+		h.allowedOrigins[o] = true
+	}
+	return h
+}
+
+func (h *QueryHandler) setCORS(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if h.allowAll {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else if h.allowedOrigins[origin] {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// metricQueryRequest is the body of POST /api/query
+type metricQueryRequest struct {
+	Measures   []string          `json:"measures"`
+	Dimensions []string          `json:"dimensions"`
+	Filters    map[string]string `json:"filters"`
+	TimeRange  struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+	} `json:"time_range"`
+	Granularity string `json:"granularity"` // duration, "all" for period totals, empty for automatic
+	Limit       int    `json:"limit"`
+}
+
+// query converts the request to a storage query, like parseQuery does for
+// URL parameters
+func (req metricQueryRequest) query(now time.Time) (storage.Query, error) {
+	var q storage.Query
+	if v := req.TimeRange.End; v != "" && v != "now" {
+		end, err := parseTimeParam(v, now)
+		if err != nil {
+			return q, fmt.Errorf("invalid time_range.end: %w", err)
+		}
+		q.End = end
+	}
+	end := q.End
+	if end.IsZero() {
+		end = now
+	}
+	q.Start = end.Add(-defaultMetricQuerySpan)
+	if v := req.TimeRange.Start; v != "" {
+		start, err := parseTimeParam(v, now)
+		if err != nil {
+			return q, fmt.Errorf("invalid time_range.start: %w", err)
+		}
+		q.Start = start
+	}
+	if !q.Start.Before(end) {
+		return q, fmt.Errorf("time_range.start must be before end")
+	}
+
+	switch v := req.Granularity; v {
+	case "":
+	case "all":
+		q.Whole = true
+	default:
+		step, err := parseDurationParam(v)
+		if err != nil || step <= 0 {
+			return q, fmt.Errorf("invalid granularity %q: use a positive duration such as 5m, 1h or 1d, or all", v)
+		}
+		q.Step = step
+	}
+
+	for dim, v := range req.Filters {
+		if v == "" {
+			continue
+		}
+		if q.Filters == nil {
+			q.Filters = make(map[string]string)
+		}
+		q.Filters[dim] = v
+	}
+	return q, nil
+}
+
+// Handle runs one ad-hoc query: measures of one cube, grouped by dimensions,
+// per bucket of the granularity. Only measures and dimensions declared by the
+// metric model are accepted; values are bound as parameters.
+// POST /api/query
+//
+//	{"measures": ["api.requests", "api.p95_duration_ms"], "dimensions": ["service"],
+//	 "filters": {"release": "2024.06.1"}, "time_range": {"start": "now-24h", "end": "now"},
+//	 "granularity": "1h", "limit": 1000}
+func (h *QueryHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	var req metricQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	q, err := req.query(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mq := storage.MetricQuery{
+		Measures:   req.Measures,
+		Dimensions: req.Dimensions,
+		Limit:      req.Limit,
+		Timeout:    h.timeout,
+	}
+
+	ctx := r.Context()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	result, err := h.db.QueryMetrics(ctx, q, mq)
+	if err != nil {
+		writeStorageError(w, "failed to run metric query", err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandleModel lists the cubes with their measures and dimensions
+// GET /api/query/model
+func (h *QueryHandler) HandleModel(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+	json.NewEncoder(w).Encode(storage.MetricModel())
+}
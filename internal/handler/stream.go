@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/stream"
+)
+
+// StreamHandler serves live dashboard updates over Server-Sent Events
+type StreamHandler struct {
+	broadcaster    *stream.Broadcaster
+	heartbeat      time.Duration
+	allowedOrigins map[string]bool
+	allowAll       bool
+}
+
+// NewStreamHandler creates the /api/stream handler
+func NewStreamHandler(b *stream.Broadcaster, heartbeat time.Duration, origins []string) *StreamHandler {
+	h := &StreamHandler{
+		broadcaster:    b,
+		heartbeat:      heartbeat,
+		allowedOrigins: make(map[string]bool),
+	}
+	for _, o := range origins {
+		if o == "*" {
+			h.allowAll = true
+			break
+		}
+		h.allowedOrigins[o] = true
+	}
+	return h
+}
+
+func (h *StreamHandler) setCORS(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if h.allowAll {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else if h.allowedOrigins[origin] {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+}
+
+// Handle streams topic events until the client disconnects
+// GET /api/stream?topics=overview,alerts
+//
+// Each topic starts with a snapshot (event: <topic>) followed by JSON merge
+// patches (event: <topic>.patch). Reconnecting with Last-Event-ID resumes
+// where the client left off.
+func (h *StreamHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	available := h.broadcaster.Topics()
+	topics := available
+	if v := r.URL.Query().Get("topics"); v != "" {
+		topics = nil
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if !slices.Contains(available, t) {
+				http.Error(w, fmt.Sprintf("unknown topic %q, available: %s", t, strings.Join(available, ", ")), http.StatusBadRequest)
+				return
+			}
+			topics = append(topics, t)
+		}
+	}
+
+	// EventSource sends Last-Event-ID on reconnect; the query form lets a
+	// fresh page resume a stream it persisted
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+
+	// The server WriteTimeout would cut the stream
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := h.broadcaster.Subscribe(topics, lastID)
+	defer h.broadcaster.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	rc.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case ev, ok := <-sub.C:
+			if !ok {
+				// Dropped as too slow or shutting down; the client reconnects
+				return
+			}
+			name := ev.Topic
+			if ev.Patch {
+				name += ".patch"
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", h.broadcaster.EventID(ev), name, ev.Data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// TokenFromQuery lets EventSource clients and download links, which cannot set
+// headers, pass the session token as ?access_token=. Use only in front of
+// RequireAuth on the stream and export routes.
+func TokenFromQuery(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tableWriter encodes rows of one export; the header is written on creation
+type tableWriter interface {
+	WriteRow(values []any) error
+	Close() error
+}
+
+func newTableWriter(format string, w io.Writer, columns []string) (tableWriter, error) {
+	switch format {
+	case "csv":
+		return newCSVTable(w, columns)
+	case "ndjson":
+		return &ndjsonTable{w: bufio.NewWriter(w), columns: columns}, nil
+	case "xlsx":
+		return newXLSXTable(w, columns)
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// ============================================
+// CSV
+// ============================================
+
+type csvTable struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVTable(w io.Writer, columns []string) (*csvTable, error) {
+	t := &csvTable{w: csv.NewWriter(w), record: make([]string, len(columns))}
+	return t, t.w.Write(columns)
+}
+
+func (t *csvTable) WriteRow(values []any) error {
+	for i, v := range values {
+		s := formatCell(v)
+		// Spreadsheets evaluate cells starting with these as formulas
+		if _, ok := v.(string); ok && s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+			s = "'" + s
+		}
+		t.record[i] = s
+	}
+	return t.w.Write(t.record)
+}
+
+func (t *csvTable) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// formatCell renders a value for text formats; times are RFC 3339 in UTC
+func formatCell(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case time.Time:
+		return x.UTC().Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'f', -1, 32)
+	case bool:
+		return strconv.FormatBool(x)
+	}
+	return fmt.Sprint(v)
+}
+
+// ============================================
+// NDJSON
+// ============================================
+
+type ndjsonTable struct {
+	w       *bufio.Writer
+	columns []string
+}
+
+func (t *ndjsonTable) WriteRow(values []any) error {
+	t.w.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			t.w.WriteByte(',')
+		}
+		name, _ := json.Marshal(t.columns[i])
+		t.w.Write(name)
+		t.w.WriteByte(':')
+		if f, ok := v.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			v = nil
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", t.columns[i], err)
+		}
+		t.w.Write(value)
+	}
+	t.w.WriteString("}\n")
+	// Hand full buffers to the response so the export streams
+	if t.w.Buffered() > 32<<10 {
+		return t.w.Flush()
+	}
+	return nil
+}
+
+func (t *ndjsonTable) Close() error {
+	return t.w.Flush()
+}
+
+// ============================================
+// XLSX
+// ============================================
+
+// maxXLSXRows is the sheet row limit of Excel, header included
+const maxXLSXRows = 1 << 20
+
+// xlsxStatic are the workbook parts around the single sheet. Style 1 formats
+// timestamps as dates.
+var xlsxStatic = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="export" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`},
+	{"xl/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts><fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts><fills count="1"><fill><patternFill patternType="none"/></fill></fills><borders count="1"><border/></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs></styleSheet>`},
+}
+
+// xlsxTable writes a one-sheet workbook. The sheet is the last zip entry and
+// is streamed row by row; strings are inline so no shared string table is
+// built in memory.
+type xlsxTable struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+func newXLSXTable(w io.Writer, columns []string) (*xlsxTable, error) {
+	z := zip.NewWriter(w)
+	for _, part := range xlsxStatic {
+		f, err := z.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+	f, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	t := &xlsxTable{zip: z, sheet: bufio.NewWriter(f)}
+	t.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]any, len(columns))
+	for i, c := range columns {
+		header[i] = c
+	}
+	return t, t.WriteRow(header)
+}
+
+func (t *xlsxTable) WriteRow(values []any) error {
+	if t.rows >= maxXLSXRows {
+		return fmt.Errorf("xlsx is limited to %d rows, use csv or ndjson", maxXLSXRows-1)
+	}
+	t.rows++
+	t.sheet.WriteString("<row>")
+	for _, v := range values {
+		t.writeCell(v)
+	}
+	t.sheet.WriteString("</row>")
+	if t.sheet.Buffered() > 32<<10 {
+		return t.sheet.Flush()
+	}
+	return nil
+}
+
+func (t *xlsxTable) writeCell(v any) {
+	switch x := v.(type) {
+	case nil:
+		t.sheet.WriteString("<c/>")
+	case bool:
+		b := "0"
+		if x {
+			b = "1"
+		}
+		t.sheet.WriteString(`<c t="b"><v>` + b + `</v></c>`)
+	case time.Time:
+		t.sheet.WriteString(`<c s="1"><v>` + strconv.FormatFloat(excelSerial(x), 'f', -1, 64) + `</v></c>`)
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			t.sheet.WriteString("<c/>")
+			return
+		}
+		t.sheet.WriteString(`<c><v>` + strconv.FormatFloat(x, 'f', -1, 64) + `</v></c>`)
+	case float32, int, int32, int64:
+		t.sheet.WriteString(`<c><v>` + formatCell(x) + `</v></c>`)
+	default:
+		t.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+		xml.EscapeText(t.sheet, []byte(formatCell(x)))
+		t.sheet.WriteString(`</t></is></c>`)
+	}
+}
+
+func (t *xlsxTable) Close() error {
+	t.sheet.WriteString("</sheetData></worksheet>")
+	if err := t.sheet.Flush(); err != nil {
+		return err
+	}
+	return t.zip.Close()
+}
+
+// excelEpoch is day zero of Excel's 1900 date system
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// excelSerial converts t to fractional days since the Excel epoch, in UTC
+func excelSerial(t time.Time) float64 {
+	return t.UTC().Sub(excelEpoch).Hours() / 24
+}
+
+// ============================================
+// RESULT FLATTENING
+// ============================================
+
+// tabulate flattens a dashboard result, a struct or a slice of structs, into
+// columns named after the JSON fields. Nested structs become parent_field
+// columns and pointers are dereferenced.
+func tabulate(v any) ([]string, [][]any) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+
+	var elem reflect.Type
+	var items []reflect.Value
+	if rv.Kind() == reflect.Slice {
+		elem = rv.Type().Elem()
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, rv.Index(i))
+		}
+	} else {
+		elem = rv.Type()
+		items = []reflect.Value{rv}
+	}
+	for elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+
+	columns := flattenColumns(elem, "")
+	rows := make([][]any, len(items))
+	for i, item := range items {
+		rows[i] = flattenValues(item, nil)
+	}
+	return columns, rows
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonName returns the JSON field name, or "" for skipped fields
+func jsonName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	}
+	return name
+}
+
+func flattenColumns(t reflect.Type, prefix string) []string {
+	if t.Kind() != reflect.Struct || t == timeType {
+		if prefix == "" {
+			return []string{"value"}
+		}
+		return []string{prefix}
+	}
+	var columns []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonName(f)
+		if name == "" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		columns = append(columns, flattenColumns(ft, name)...)
+	}
+	return columns
+}
+
+func flattenValues(v reflect.Value, out []any) []any {
+	t := v.Type()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		if v.IsNil() {
+			// Keep the row aligned with its columns
+			return append(out, make([]any, len(flattenColumns(t, "x")))...)
+		}
+		v = v.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return append(out, v.Interface())
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if jsonName(t.Field(i)) == "" {
+			continue
+		}
+		out = flattenValues(v.Field(i), out)
+	}
+	return out
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var tableTime = time.Date(2024, 6, 1, 12, 0, 0, 0, time.FixedZone("BRT", -3*3600))
+
+func writeTable(t *testing.T, format string, columns []string, rows ...[]any) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	table, err := newTableWriter(format, &buf, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := table.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := table.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSVTable(t *testing.T) {
+	out := writeTable(t, "csv", []string{"name", "value", "time", "ok", "note"},
+		[]any{"=SUM(A1)", -1.5, tableTime, true, nil},
+		[]any{"a,\"b\"\nc", 2.0, nil, false, "@home"},
+	)
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"name", "value", "time", "ok", "note"},
+		// Only strings are escaped as formulas; negative numbers stay numbers
+		{"'=SUM(A1)", "-1.5", "2024-06-01T15:00:00Z", "true", ""},
+		{"a,\"b\"\nc", "2", "", "false", "'@home"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("csv = %q, want %q", records, want)
+	}
+}
+
+func TestNDJSONTable(t *testing.T) {
+	out := writeTable(t, "ndjson", []string{"name", "p95", "time"},
+		[]any{"a\"b", math.NaN(), tableTime},
+		[]any{"c", 1.25, nil},
+		[]any{"d", math.Inf(1), nil},
+	)
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	want := []string{
+		`{"name":"a\"b","p95":null,"time":"2024-06-01T12:00:00-03:00"}`,
+		`{"name":"c","p95":1.25,"time":null}`,
+		`{"name":"d","p95":null,"time":null}`,
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("ndjson =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	for _, line := range lines {
+		if !json.Valid([]byte(line)) {
+			t.Errorf("invalid JSON line %s", line)
+		}
+	}
+}
+
+// xlsxCell is a cell of the sheet as written by xlsxTable
+type xlsxCell struct {
+	Type   string `xml:"t,attr"`
+	Style  string `xml:"s,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+func TestXLSXTable(t *testing.T) {
+	out := writeTable(t, "xlsx", []string{"name", "value", "time", "ok"},
+		[]any{`<b>&"x"</b>`, 2.5, tableTime, true},
+		[]any{"  spaced  ", math.NaN(), nil, int64(7)},
+	)
+
+	z, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range z.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name] = body
+	}
+	for _, part := range xlsxStatic {
+		if string(parts[part.name]) != part.body {
+			t.Errorf("part %s missing or changed", part.name)
+		}
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Cells []xlsxCell `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatalf("sheet is not valid XML: %v", err)
+	}
+	inline := func(s string) xlsxCell { return xlsxCell{Type: "inlineStr", Inline: s} }
+	want := [][]xlsxCell{
+		{inline("name"), inline("value"), inline("time"), inline("ok")},
+		{inline(`<b>&"x"</b>`), {Value: "2.5"}, {Style: "1", Value: "45444.625"}, {Type: "b", Value: "1"}},
+		{inline("  spaced  "), {}, {}, {Value: "7"}},
+	}
+	if len(sheet.Rows) != len(want) {
+		t.Fatalf("sheet has %d rows, want %d", len(sheet.Rows), len(want))
+	}
+	for i, row := range sheet.Rows {
+		if !reflect.DeepEqual(row.Cells, want[i]) {
+			t.Errorf("row %d = %+v, want %+v", i, row.Cells, want[i])
+		}
+	}
+}
+
+func TestXLSXTableRowLimit(t *testing.T) {
+	table, err := newXLSXTable(io.Discard, []string{"value"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The header is row 1
+	table.rows = maxXLSXRows - 1
+	if err := table.WriteRow([]any{1.0}); err != nil {
+		t.Fatalf("last row: %v", err)
+	}
+	if err := table.WriteRow([]any{2.0}); err == nil {
+		t.Error("row past the sheet limit was accepted")
+	}
+}
+
+func TestExcelSerial(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want float64
+	}{
+		{time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC), 61},
+		{time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), 45444},
+		{tableTime, 45444.625},
+	}
+	for _, tt := range tests {
+		if got := excelSerial(tt.t); got != tt.want {
+			t.Errorf("excelSerial(%s) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestTabulate(t *testing.T) {
+	type inner struct {
+		P50 float64 `json:"p50"`
+		P95 float64 `json:"p95"`
+	}
+	type row struct {
+		Bucket  time.Time `json:"bucket"`
+		Name    string    `json:"name"`
+		Count   *int64    `json:"count,omitempty"`
+		Latency *inner    `json:"latency"`
+		Skipped string    `json:"-"`
+		hidden  string
+	}
+	n := int64(3)
+	columns, rows := tabulate([]row{
+		{Bucket: tableTime, Name: "a", Count: &n, Latency: &inner{1, 2}},
+		{Name: "b", Skipped: "x", hidden: "y"},
+	})
+	wantColumns := []string{"bucket", "name", "count", "latency_p50", "latency_p95"}
+	if !reflect.DeepEqual(columns, wantColumns) {
+		t.Errorf("columns = %v, want %v", columns, wantColumns)
+	}
+	wantRows := [][]any{
+		{tableTime, "a", int64(3), 1.0, 2.0},
+		{time.Time{}, "b", nil, nil, nil},
+	}
+	if !reflect.DeepEqual(rows, wantRows) {
+		t.Errorf("rows = %v, want %v", rows, wantRows)
+	}
+
+	columns, rows = tabulate(&inner{P50: 4})
+	if !reflect.DeepEqual(columns, []string{"p50", "p95"}) || !reflect.DeepEqual(rows, [][]any{{4.0, 0.0}}) {
+		t.Errorf("struct: columns %v, rows %v", columns, rows)
+	}
+	if columns, rows = tabulate((*inner)(nil)); columns != nil || rows != nil {
+		t.Errorf("nil pointer: columns %v, rows %v", columns, rows)
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/mcbile/product-pulse/internal/storage"
+)
+
+// Leaderboard defaults
+const (
+	defaultTopLimit  = 10
+	maxTopLimit      = 100
+	defaultMinVolume = 10
+)
+
+// parseTopOptions reads order_by, limit and min_volume and returns them with
+// the params that belong in the cache key
+func parseTopOptions(r *http.Request) (storage.TopOptions, url.Values, error) {
+	params := r.URL.Query()
+	opts := storage.TopOptions{
+		OrderBy:   params.Get("order_by"),
+		Limit:     defaultTopLimit,
+		MinVolume: defaultMinVolume,
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxTopLimit {
+			return opts, nil, fmt.Errorf("limit must be between 1 and %d", maxTopLimit)
+		}
+		opts.Limit = n
+	}
+	if v := params.Get("min_volume"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return opts, nil, fmt.Errorf("min_volume must be a non-negative integer")
+		}
+		opts.MinVolume = n
+	}
+	key := url.Values{
+		"order_by":   {opts.OrderBy},
+		"limit":      {strconv.Itoa(opts.Limit)},
+		"min_volume": {strconv.FormatInt(opts.MinVolume, 10)},
+	}
+	return opts, key, nil
+}
+
+// HandleTopEndpoints ranks endpoints over the range with trends against the previous period
+// GET /api/metrics/top/endpoints?order_by=p95&limit=10&min_volume=10&start=now-24h
+// order_by: p95 (default), error_rate, requests, total_time
+func (h *DashboardHandler) HandleTopEndpoints(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	opts, params, err := parseTopOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.serveCached(w, r, "top endpoints", "api", params, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetTopEndpoints(ctx, q, opts)
+	})
+}
+
+// HandleTopPSPs ranks PSP and operation pairs
+// GET /api/metrics/top/psp?order_by=failure_rate&min_volume=50&start=now-7d
+// order_by: failure_rate (default), failures, volume, p95
+func (h *DashboardHandler) HandleTopPSPs(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	opts, params, err := parseTopOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.serveCached(w, r, "top PSPs", "psp", params, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetTopPSPs(ctx, q, opts)
+	})
+}
+
+// HandleTopGames ranks game providers or single games
+// GET /api/metrics/top/games?by=game&order_by=failure_rate&provider=Pragmatic
+// by: provider (default), game; order_by: failure_rate (default), failures, launches, p95_load
+func (h *DashboardHandler) HandleTopGames(w http.ResponseWriter, r *http.Request) {
+	h.setCORS(w, r)
+
+	opts, params, err := parseTopOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "provider"
+	}
+	params.Set("by", by)
+
+	h.serveCached(w, r, "top games", "game", params, func(ctx context.Context, q storage.Query) (any, error) {
+		return h.db.GetTopGames(ctx, by, q, opts)
+	})
+}
@@ -0,0 +1,234 @@
+// Package importer loads historical metrics from CSV, JSON and NDJSON files
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+// Writer is the subset of storage used by the importer
+type Writer interface {
+	CopyFrontendMetrics(ctx context.Context, events []model.EnrichedEvent) error
+	CopyAPIMetrics(ctx context.Context, metrics []model.APIMetric) error
+	CopyPSPMetrics(ctx context.Context, metrics []model.PSPMetric) error
+	CopyGameMetrics(ctx context.Context, metrics []model.GameMetric) error
+	CopyWebSocketMetrics(ctx context.Context, metrics []model.WebSocketMetric) error
+	RefreshAggregates(ctx context.Context, table string, start, end time.Time) error
+}
+
+// Options control an import run
+type Options struct {
+	DryRun        bool  // Validate only, write nothing
+	Offset        int64 // Skip this many source records (resume point)
+	BatchSize     int   // Rows per COPY
+	ProgressEvery int64 // Log progress every N records (0 = off)
+	Refresh       bool  // Refresh affected continuous aggregates when done
+}
+
+// Result summarizes an import run
+type Result struct {
+	Read     int64     `json:"read"`     // Records read, including skipped ones
+	Skipped  int64     `json:"skipped"`  // Records skipped because of Offset
+	Imported int64     `json:"imported"` // Rows written (or validated in dry-run)
+	Rejected int64     `json:"rejected"` // Rows failing validation
+	Offset   int64     `json:"offset"`   // Resume offset: all records before it are done
+	MinTime  time.Time `json:"min_time"`
+	MaxTime  time.Time `json:"max_time"`
+}
+
+// Run streams records from rr, validates them against the mapping and writes them in batches
+func Run(ctx context.Context, rr RecordReader, m *Mapping, w Writer, opts Options) (*Result, error) {
+	t, ok := targets[m.Target]
+	if !ok {
+		return nil, fmt.Errorf("unknown target %q", m.Target)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 5000
+	}
+
+	index := fieldIndex(t.newRecord())
+	res := &Result{Offset: opts.Offset}
+	batch := make([]any, 0, opts.BatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			res.Offset = res.Read
+			return nil
+		}
+		if !opts.DryRun {
+			if err := t.write(ctx, w, batch); err != nil {
+				return fmt.Errorf("write batch at offset %d: %w", res.Offset, err)
+			}
+		}
+		for _, rec := range batch {
+			ts := t.timeOf(rec)
+			if res.MinTime.IsZero() || ts.Before(res.MinTime) {
+				res.MinTime = ts
+			}
+			if ts.After(res.MaxTime) {
+				res.MaxTime = ts
+			}
+		}
+		res.Imported += int64(len(batch))
+		res.Offset = res.Read
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+
+		src, err := rr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		res.Read++
+
+		if res.Read <= opts.Offset {
+			res.Skipped++
+			continue
+		}
+
+		var rec any
+		if err == nil {
+			rec, err = m.convert(t, index, src)
+		}
+		if err != nil {
+			var recErr *RecordError
+			var rowErr *rowError
+			if !errors.As(err, &recErr) && !errors.As(err, &rowErr) {
+				return res, fmt.Errorf("read record %d: %w", res.Read, err)
+			}
+			res.Rejected++
+			slog.Warn("row rejected", "record", res.Read, "error", err)
+		} else {
+			batch = append(batch, rec)
+			if len(batch) >= opts.BatchSize {
+				if err := flush(); err != nil {
+					return res, err
+				}
+			}
+		}
+
+		if opts.ProgressEvery > 0 && res.Read%opts.ProgressEvery == 0 {
+			slog.Info("import progress",
+				"read", res.Read,
+				"imported", res.Imported,
+				"rejected", res.Rejected,
+				"offset", res.Offset,
+			)
+		}
+	}
+
+	if err := flush(); err != nil {
+		return res, err
+	}
+
+	if opts.Refresh && !opts.DryRun && res.Imported > 0 {
+		if err := w.RefreshAggregates(ctx, m.Target, res.MinTime, res.MaxTime); err != nil {
+			return res, fmt.Errorf("refresh aggregates: %w", err)
+		}
+	}
+
+	return res, nil
+}
+
+// rowError reports a record that failed validation
+type rowError struct {
+	field string
+	err   error
+}
+
+func (e *rowError) Error() string {
+	if e.field == "" {
+		return e.err.Error()
+	}
+	return e.field + ": " + e.err.Error()
+}
+
+// convert maps one source record onto a validated model struct
+func (m *Mapping) convert(t target, index map[string][]int, src map[string]any) (any, error) {
+	rec := t.newRecord()
+	v := reflect.ValueOf(rec).Elem()
+	present := make(map[string]bool, len(index))
+
+	for name, idx := range index {
+		var raw any
+		if col, ok := m.Columns[name]; ok {
+			raw = src[col]
+		}
+		if isEmpty(raw) {
+			def, ok := m.Defaults[name]
+			if !ok {
+				continue
+			}
+			raw = def
+		}
+
+		if err := m.setField(v.FieldByIndex(idx), raw); err != nil {
+			return nil, &rowError{field: name, err: err}
+		}
+		present[name] = true
+	}
+
+	for _, name := range t.required {
+		if !present[name] {
+			return nil, &rowError{field: name, err: errors.New("required")}
+		}
+	}
+
+	for _, name := range t.uuids {
+		if s := stringValue(v.FieldByIndex(index[name])); s != "" && !isUUID(s) {
+			return nil, &rowError{field: name, err: fmt.Errorf("invalid uuid %q", s)}
+		}
+	}
+
+	for name, idx := range index {
+		if !strings.HasSuffix(name, "_ms") {
+			continue
+		}
+		f := v.FieldByIndex(idx)
+		if f.Kind() == reflect.Pointer {
+			if f.IsNil() {
+				continue
+			}
+			f = f.Elem()
+		}
+		if f.Kind() == reflect.Float64 && f.Float() < 0 {
+			return nil, &rowError{field: name, err: errors.New("negative duration")}
+		}
+	}
+
+	return rec, nil
+}
+
+func isEmpty(raw any) bool {
+	if raw == nil {
+		return true
+	}
+	s, ok := raw.(string)
+	return ok && strings.TrimSpace(s) == ""
+}
+
+func stringValue(f reflect.Value) string {
+	if f.Kind() == reflect.Pointer {
+		if f.IsNil() {
+			return ""
+		}
+		f = f.Elem()
+	}
+	if f.Kind() != reflect.String {
+		return ""
+	}
+	return f.String()
+}
@@ -0,0 +1,62 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+// recorder is a Writer keeping what the importer writes
+type recorder struct {
+	frontend []model.EnrichedEvent
+}
+
+func (r *recorder) CopyFrontendMetrics(ctx context.Context, events []model.EnrichedEvent) error {
+	r.frontend = append(r.frontend, events...)
+	return nil
+}
+
+func (r *recorder) CopyAPIMetrics(context.Context, []model.APIMetric) error             { return nil }
+func (r *recorder) CopyPSPMetrics(context.Context, []model.PSPMetric) error             { return nil }
+func (r *recorder) CopyGameMetrics(context.Context, []model.GameMetric) error           { return nil }
+func (r *recorder) CopyWebSocketMetrics(context.Context, []model.WebSocketMetric) error { return nil }
+func (r *recorder) RefreshAggregates(context.Context, string, time.Time, time.Time) error {
+	return nil
+}
+
+func TestRunFrontendCountry(t *testing.T) {
+	ts := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	csv := "ts,session,type,geo\n" +
+		ts.Format(time.RFC3339) + ",6f1c1a52-3f2e-4b8e-9f61-0d1e2a3b4c5d,page_view,BR\n" +
+		ts.Format(time.RFC3339) + ",6f1c1a52-3f2e-4b8e-9f61-0d1e2a3b4c5d,page_view,\n"
+	m := &Mapping{
+		Target:  "frontend_metrics",
+		Columns: map[string]string{"time": "ts", "session_id": "session", "event_type": "type", "country": "geo"},
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("validate mapping: %v", err)
+	}
+	rr, err := NewRecordReader(strings.NewReader(csv), "csv")
+	if err != nil {
+		t.Fatalf("new reader: %v", err)
+	}
+
+	w := &recorder{}
+	res, err := Run(context.Background(), rr, m, w, Options{})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if res.Imported != 2 || res.Rejected != 0 {
+		t.Fatalf("imported %d, rejected %d; want 2, 0", res.Imported, res.Rejected)
+	}
+	if len(w.frontend) != 2 {
+		t.Fatalf("wrote %d events, want 2", len(w.frontend))
+	}
+	// frontend_metrics.country is written from the enriched field
+	if w.frontend[0].Country != "BR" || w.frontend[1].Country != "" {
+		t.Errorf("countries = [%q %q], want [BR ]", w.frontend[0].Country, w.frontend[1].Country)
+	}
+}
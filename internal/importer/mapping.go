@@ -0,0 +1,104 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Mapping describes how source columns map onto a model type
+//
+// Example mapping file for a PSP provider report:
+//
+//	{
+//	  "target": "psp_metrics",
+//	  "columns": {
+//	    "time": "created_at",
+//	    "psp_name": "provider",
+//	    "operation": "type",
+//	    "duration_ms": "latency_ms",
+//	    "success": "status",
+//	    "amount": "amount",
+//	    "currency": "currency"
+//	  },
+//	  "defaults": {"currency": "EUR"},
+//	  "time_format": "2006-01-02 15:04:05",
+//	  "true_values": ["approved", "ok"]
+//	}
+type Mapping struct {
+	// Target table: frontend_metrics, api_metrics, psp_metrics, game_metrics or websocket_metrics
+	Target string `json:"target"`
+
+	// Columns maps model field (JSON name) -> source column
+	Columns map[string]string `json:"columns"`
+
+	// Defaults are applied when the source column is missing or empty
+	Defaults map[string]string `json:"defaults"`
+
+	// TimeFormat is a Go layout, "unix" or "unix_ms". Default: RFC3339
+	TimeFormat string `json:"time_format"`
+
+	// TrueValues are extra (case-insensitive) spellings treated as true for bool fields
+	TrueValues []string `json:"true_values"`
+}
+
+// LoadMapping reads and validates a mapping file
+func LoadMapping(path string) (*Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read mapping: %w", err)
+	}
+
+	var m Mapping
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse mapping: %w", err)
+	}
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// Validate checks that the mapping references a known target and known fields
+func (m *Mapping) Validate() error {
+	t, ok := targets[m.Target]
+	if !ok {
+		return fmt.Errorf("unknown target %q", m.Target)
+	}
+
+	fields := fieldIndex(t.newRecord())
+	for name := range m.Columns {
+		if _, ok := fields[name]; !ok {
+			return fmt.Errorf("unknown field %q for target %s", name, m.Target)
+		}
+	}
+	for name := range m.Defaults {
+		if _, ok := fields[name]; !ok {
+			return fmt.Errorf("unknown default field %q for target %s", name, m.Target)
+		}
+	}
+
+	for _, name := range t.required {
+		if _, mapped := m.Columns[name]; mapped {
+			continue
+		}
+		if _, hasDefault := m.Defaults[name]; hasDefault {
+			continue
+		}
+		return fmt.Errorf("required field %q is not mapped", name)
+	}
+
+	return nil
+}
+
+func (m *Mapping) isTrue(s string) bool {
+	for _, v := range m.TrueValues {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
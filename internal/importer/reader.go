@@ -0,0 +1,165 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Source formats
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+// RecordReader yields source records one at a time, returning io.EOF when done.
+// A *RecordError means only the current record is unreadable and reading can continue.
+type RecordReader interface {
+	Next() (map[string]any, error)
+}
+
+// RecordError reports a malformed record that can be skipped
+type RecordError struct {
+	Err error
+}
+
+func (e *RecordError) Error() string { return e.Err.Error() }
+func (e *RecordError) Unwrap() error { return e.Err }
+
+// DetectFormat infers the source format from a file extension
+func DetectFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".json":
+		return FormatJSON, nil
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON, nil
+	}
+	return "", fmt.Errorf("cannot detect format of %s, use -format", path)
+}
+
+// NewRecordReader creates a streaming reader for the given format
+func NewRecordReader(r io.Reader, format string) (RecordReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatJSON:
+		return newJSONReader(r)
+	case FormatNDJSON:
+		return newNDJSONReader(r), nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// ============================================
+// CSV
+// ============================================
+
+type csvReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+
+	return &csvReader{r: cr, header: header}, nil
+}
+
+func (c *csvReader) Next() (map[string]any, error) {
+	row, err := c.r.Read()
+	if err != nil {
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return nil, &RecordError{Err: err}
+		}
+		return nil, err
+	}
+
+	rec := make(map[string]any, len(c.header))
+	for i, col := range c.header {
+		if i < len(row) {
+			rec[col] = row[i]
+		}
+	}
+	return rec, nil
+}
+
+// ============================================
+// JSON (top-level array)
+// ============================================
+
+type jsonReader struct {
+	dec *json.Decoder
+}
+
+func newJSONReader(r io.Reader) (*jsonReader, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("read json: %w", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("json source must be an array of objects")
+	}
+	return &jsonReader{dec: dec}, nil
+}
+
+func (j *jsonReader) Next() (map[string]any, error) {
+	if !j.dec.More() {
+		return nil, io.EOF
+	}
+	var rec map[string]any
+	if err := j.dec.Decode(&rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// ============================================
+// NDJSON
+// ============================================
+
+type ndjsonReader struct {
+	sc *bufio.Scanner
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16<<20)
+	return &ndjsonReader{sc: sc}
+}
+
+func (n *ndjsonReader) Next() (map[string]any, error) {
+	for n.sc.Scan() {
+		line := strings.TrimSpace(n.sc.Text())
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return nil, &RecordError{Err: err}
+		}
+		return rec, nil
+	}
+	if err := n.sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
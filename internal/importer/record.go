@@ -0,0 +1,271 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+// target describes one importable table
+type target struct {
+	newRecord func() any // pointer to a model struct
+	required  []string   // fields that must be non-empty
+	uuids     []string   // fields stored as UUID in the schema
+	timeOf    func(rec any) time.Time
+	write     func(ctx context.Context, w Writer, recs []any) error
+}
+
+var targets = map[string]target{
+	"frontend_metrics": {
+		newRecord: func() any { return &model.FrontendEvent{} },
+		required:  []string{"time", "session_id", "event_type"},
+		uuids:     []string{"session_id", "player_id"},
+		timeOf:    func(rec any) time.Time { return rec.(*model.FrontendEvent).Time },
+		write: func(ctx context.Context, w Writer, recs []any) error {
+			events := make([]model.EnrichedEvent, len(recs))
+			for i, r := range recs {
+				e := model.EnrichedEvent{FrontendEvent: *r.(*model.FrontendEvent)}
+				// frontend_metrics.country is written from the enriched field,
+				// which the collector resolves from the client IP
+				if e.FrontendEvent.Country != nil {
+					e.Country = *e.FrontendEvent.Country
+				}
+				events[i] = e
+			}
+			return w.CopyFrontendMetrics(ctx, events)
+		},
+	},
+	"api_metrics": {
+		newRecord: func() any { return &model.APIMetric{} },
+		required:  []string{"time", "service_name", "endpoint", "method", "duration_ms", "status_code"},
+		uuids:     []string{"player_id", "request_id"},
+		timeOf:    func(rec any) time.Time { return rec.(*model.APIMetric).Time },
+		write: func(ctx context.Context, w Writer, recs []any) error {
+			return w.CopyAPIMetrics(ctx, collect[model.APIMetric](recs))
+		},
+	},
+	"psp_metrics": {
+		newRecord: func() any { return &model.PSPMetric{} },
+		required:  []string{"time", "psp_name", "operation", "duration_ms", "success"},
+		uuids:     []string{"player_id", "transaction_id"},
+		timeOf:    func(rec any) time.Time { return rec.(*model.PSPMetric).Time },
+		write: func(ctx context.Context, w Writer, recs []any) error {
+			return w.CopyPSPMetrics(ctx, collect[model.PSPMetric](recs))
+		},
+	},
+	"game_metrics": {
+		newRecord: func() any { return &model.GameMetric{} },
+		required:  []string{"time", "provider", "launch_success"},
+		uuids:     []string{"player_id", "session_id"},
+		timeOf:    func(rec any) time.Time { return rec.(*model.GameMetric).Time },
+		write: func(ctx context.Context, w Writer, recs []any) error {
+			return w.CopyGameMetrics(ctx, collect[model.GameMetric](recs))
+		},
+	},
+	"websocket_metrics": {
+		newRecord: func() any { return &model.WebSocketMetric{} },
+		required:  []string{"time", "connection_id", "event_type"},
+		uuids:     []string{"connection_id", "player_id"},
+		timeOf:    func(rec any) time.Time { return rec.(*model.WebSocketMetric).Time },
+		write: func(ctx context.Context, w Writer, recs []any) error {
+			return w.CopyWebSocketMetrics(ctx, collect[model.WebSocketMetric](recs))
+		},
+	},
+}
+
+func collect[T any](recs []any) []T {
+	out := make([]T, len(recs))
+	for i, r := range recs {
+		out[i] = *r.(*T)
+	}
+	return out
+}
+
+// fieldIndex maps JSON field names of a model struct to their field index
+func fieldIndex(rec any) map[string][]int {
+	t := reflect.TypeOf(rec).Elem()
+	index := make(map[string][]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		index[name] = f.Index
+	}
+	return index
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// setField coerces a source value (string from CSV, any JSON value otherwise) into a model field
+func (m *Mapping) setField(field reflect.Value, raw any) error {
+	if raw == nil {
+		return nil
+	}
+	if s, ok := raw.(string); ok && strings.TrimSpace(s) == "" {
+		return nil
+	}
+
+	ft := field.Type()
+	if ft.Kind() == reflect.Pointer {
+		v := reflect.New(ft.Elem())
+		if err := m.setField(v.Elem(), raw); err != nil {
+			return err
+		}
+		field.Set(v)
+		return nil
+	}
+
+	switch {
+	case ft == timeType:
+		t, err := m.parseTime(raw)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+
+	case ft == rawType:
+		if s, ok := raw.(string); ok {
+			if !json.Valid([]byte(s)) {
+				return fmt.Errorf("invalid JSON")
+			}
+			field.SetBytes([]byte(s))
+			return nil
+		}
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBytes(b)
+		return nil
+	}
+
+	switch ft.Kind() {
+	case reflect.String:
+		field.SetString(strings.TrimSpace(fmt.Sprint(raw)))
+
+	case reflect.Float64:
+		f, err := toFloat(raw)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+
+	case reflect.Int:
+		f, err := toFloat(raw)
+		if err != nil {
+			return err
+		}
+		if f != float64(int64(f)) {
+			return fmt.Errorf("not an integer: %v", raw)
+		}
+		field.SetInt(int64(f))
+
+	case reflect.Bool:
+		b, err := m.toBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+
+	default:
+		return fmt.Errorf("unsupported field type %s", ft)
+	}
+
+	return nil
+}
+
+func (m *Mapping) parseTime(raw any) (time.Time, error) {
+	switch m.TimeFormat {
+	case "unix", "unix_ms":
+		f, err := toFloat(raw)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if m.TimeFormat == "unix_ms" {
+			return time.UnixMilli(int64(f)).UTC(), nil
+		}
+		return time.Unix(int64(f), 0).UTC(), nil
+	}
+
+	s, ok := raw.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("expected time string, got %T", raw)
+	}
+
+	layout := m.TimeFormat
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	t, err := time.Parse(layout, strings.TrimSpace(s))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+func (m *Mapping) toBool(raw any) (bool, error) {
+	switch v := raw.(type) {
+	case bool:
+		return v, nil
+	case float64:
+		return v != 0, nil
+	case string:
+		s := strings.TrimSpace(v)
+		if m.isTrue(s) {
+			return true, nil
+		}
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+		if len(m.TrueValues) > 0 {
+			// Anything that is not an explicit true value counts as false
+			return false, nil
+		}
+		return false, fmt.Errorf("invalid bool %q", s)
+	}
+	return false, fmt.Errorf("invalid bool %v", raw)
+}
+
+func toFloat(raw any) (float64, error) {
+	switch v := raw.(type) {
+	case float64:
+		return v, nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+	return 0, fmt.Errorf("not a number: %v", raw)
+}
+
+// isUUID checks the hex forms of a UUID accepted by Postgres
+func isUUID(s string) bool {
+	s = strings.Trim(s, "{}")
+	if len(s) == 36 {
+		if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+			return false
+		}
+		s = strings.ReplaceAll(s, "-", "")
+	}
+	if len(s) != 32 {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -34,6 +34,7 @@ type FrontendEvent struct {
 	MetricValue *float64 `json:"metric_value"`
 
 	// Context
+	Release  *string         `json:"release"`
 	Metadata json.RawMessage `json:"metadata"`
 }
 
@@ -59,6 +60,7 @@ type APIMetric struct {
 	ErrorMessage *string         `json:"error_message"`
 	RequestSize  *int            `json:"request_size"`
 	ResponseSize *int            `json:"response_size"`
+	Release      *string         `json:"release"`
 	Metadata     json.RawMessage `json:"metadata"`
 }
 
@@ -76,6 +78,7 @@ type PSPMetric struct {
 	ErrorCode       *string         `json:"error_code"`
 	ErrorMessage    *string         `json:"error_message"`
 	PSPResponseCode *string         `json:"psp_response_code"`
+	Release         *string         `json:"release"`
 	Metadata        json.RawMessage `json:"metadata"`
 }
 
@@ -92,6 +95,7 @@ type GameMetric struct {
 	DeviceType    *string         `json:"device_type"`
 	ErrorType     *string         `json:"error_type"`
 	ErrorMessage  *string         `json:"error_message"`
+	Release       *string         `json:"release"`
 	Metadata      json.RawMessage `json:"metadata"`
 }
 
@@ -108,6 +112,7 @@ type WebSocketMetric struct {
 	CloseReason      *string         `json:"close_reason"`
 	Endpoint         *string         `json:"endpoint"`
 	DeviceType       *string         `json:"device_type"`
+	Release          *string         `json:"release"`
 	Metadata         json.RawMessage `json:"metadata"`
 }
 
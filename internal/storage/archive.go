@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ArchiveChunk is a closed hypertable chunk waiting to be archived
+type ArchiveChunk struct {
+	Hypertable string
+	Name       string
+	TimeColumn string
+	RangeStart time.Time
+	RangeEnd   time.Time
+}
+
+// Archive column kinds; every Postgres type maps to one of them
+const (
+	KindTimestamp = "timestamp"
+	KindInt32     = "int32"
+	KindInt64     = "int64"
+	KindDouble    = "double"
+	KindBool      = "bool"
+	KindString    = "string"
+)
+
+// ArchiveColumn is a hypertable column and the kind its values are scanned as
+type ArchiveColumn struct {
+	Name string
+	Kind string
+}
+
+// ArchiveSource reads closed chunks for the Parquet archiver (Postgres only)
+type ArchiveSource interface {
+	PendingArchiveChunks(ctx context.Context, closedBefore time.Time) ([]ArchiveChunk, error)
+	ArchiveColumns(ctx context.Context, hypertable string) ([]ArchiveColumn, error)
+	ScanArchiveChunk(ctx context.Context, chunk ArchiveChunk, columns []ArchiveColumn, fn func(values []any) error) error
+	MarkChunkArchived(ctx context.Context, chunk ArchiveChunk, rows int64, keys []string) error
+}
+
+var _ ArchiveSource = (*Postgres)(nil)
+
+// PendingArchiveChunks lists chunks that ended before closedBefore and are not archived yet,
+// oldest first
+func (p *Postgres) PendingArchiveChunks(ctx context.Context, closedBefore time.Time) ([]ArchiveChunk, error) {
+	rows, err := p.reader.Query(ctx, `
+		SELECT c.hypertable_name, c.chunk_name, d.column_name, c.range_start, c.range_end
+		FROM timescaledb_information.chunks c
+		JOIN timescaledb_information.dimensions d
+		  ON d.hypertable_schema = c.hypertable_schema
+		 AND d.hypertable_name = c.hypertable_name
+		 AND d.dimension_number = 1
+		WHERE c.hypertable_schema = 'public'
+		  AND c.range_end <= $1
+		  AND NOT EXISTS (
+			SELECT 1 FROM archive_manifest m
+			WHERE m.hypertable = c.hypertable_name AND m.chunk_name = c.chunk_name
+		  )
+		ORDER BY c.range_start, c.hypertable_name
+	`, closedBefore)
+	if err != nil {
+		return nil, fmt.Errorf("query chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var result []ArchiveChunk
+	for rows.Next() {
+		var c ArchiveChunk
+		if err := rows.Scan(&c.Hypertable, &c.Name, &c.TimeColumn, &c.RangeStart, &c.RangeEnd); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		result = append(result, c)
+	}
+
+	return result, rows.Err()
+}
+
+// ArchiveColumns returns the columns of a hypertable in table order
+func (p *Postgres) ArchiveColumns(ctx context.Context, hypertable string) ([]ArchiveColumn, error) {
+	rows, err := p.reader.Query(ctx, `
+		SELECT column_name, data_type
+		FROM information_schema.columns
+		WHERE table_schema = 'public' AND table_name = $1
+		ORDER BY ordinal_position
+	`, hypertable)
+	if err != nil {
+		return nil, fmt.Errorf("query columns: %w", err)
+	}
+	defer rows.Close()
+
+	var result []ArchiveColumn
+	for rows.Next() {
+		var name, dataType string
+		if err := rows.Scan(&name, &dataType); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		result = append(result, ArchiveColumn{Name: name, Kind: archiveKind(dataType)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%w: table %q", ErrNotFound, hypertable)
+	}
+
+	return result, nil
+}
+
+// ScanArchiveChunk streams the rows of a chunk in time order. Values are cast so
+// that each matches its column kind: time.Time, int32, int64, float64, bool or string.
+func (p *Postgres) ScanArchiveChunk(ctx context.Context, chunk ArchiveChunk, columns []ArchiveColumn, fn func(values []any) error) error {
+	exprs := make([]string, len(columns))
+	for i, c := range columns {
+		exprs[i] = pgx.Identifier{c.Name}.Sanitize() + archiveCast[c.Kind]
+	}
+	timeCol := pgx.Identifier{chunk.TimeColumn}.Sanitize()
+
+	// Query through the hypertable so compressed chunks are decompressed transparently
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s >= $1 AND %s < $2 ORDER BY %s`,
+		strings.Join(exprs, ", "), pgx.Identifier{"public", chunk.Hypertable}.Sanitize(),
+		timeCol, timeCol, timeCol)
+
+	return p.withoutStatementTimeout(ctx, func(conn *pgxpool.Conn) error {
+		rows, err := conn.Query(ctx, query, chunk.RangeStart, chunk.RangeEnd)
+		if err != nil {
+			return fmt.Errorf("query %s: %w", chunk.Name, err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			values, err := rows.Values()
+			if err != nil {
+				return fmt.Errorf("scan row: %w", err)
+			}
+			if err := fn(values); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+}
+
+// MarkChunkArchived records a chunk and the objects it was written to
+func (p *Postgres) MarkChunkArchived(ctx context.Context, chunk ArchiveChunk, rows int64, keys []string) error {
+	_, err := p.writer.Exec(ctx, `
+		INSERT INTO archive_manifest (hypertable, chunk_name, range_start, range_end, row_count, object_keys)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (hypertable, chunk_name) DO UPDATE
+		SET row_count = EXCLUDED.row_count, object_keys = EXCLUDED.object_keys, archived_at = NOW()
+	`, chunk.Hypertable, chunk.Name, chunk.RangeStart, chunk.RangeEnd, rows, keys)
+	if err != nil {
+		return fmt.Errorf("insert archive_manifest: %w", err)
+	}
+	return nil
+}
+
+// archiveCast converts a column to the Go type of its kind
+var archiveCast = map[string]string{
+	KindTimestamp: "",
+	KindInt32:     "::int4",
+	KindInt64:     "::int8",
+	KindDouble:    "::float8",
+	KindBool:      "",
+	KindString:    "::text",
+}
+
+func archiveKind(dataType string) string {
+	switch dataType {
+	case "timestamp with time zone", "timestamp without time zone":
+		return KindTimestamp
+	case "smallint", "integer":
+		return KindInt32
+	case "bigint":
+		return KindInt64
+	case "real", "double precision", "numeric":
+		return KindDouble
+	case "boolean":
+		return KindBool
+	default:
+		return KindString
+	}
+}
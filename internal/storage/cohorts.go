@@ -0,0 +1,579 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PlayerDay is one row of player_daily_activity: what a player did on one
+// UTC day, with the first attributes seen that day
+type PlayerDay struct {
+	Day          time.Time `json:"day"`
+	PlayerID     string    `json:"player_id"`
+	Sessions     int64     `json:"sessions"`
+	Events       int64     `json:"events"`       // frontend events
+	Transactions int64     `json:"transactions"` // PSP operations of any kind and outcome
+	Deposits     int64     `json:"deposits"`     // successful deposits
+	Country      string    `json:"country"`
+	DeviceType   string    `json:"device_type"`
+	UTMSource    string    `json:"utm_source"`
+	UTMMedium    string    `json:"utm_medium"`
+	UTMCampaign  string    `json:"utm_campaign"`
+	RefCode      string    `json:"ref_code"`
+}
+
+// CohortSegments maps the segment parameter to its player_daily_activity column.
+// A player's segment is the first value seen for them before the range ends.
+var CohortSegments = map[string]string{
+	"country":      "country",
+	"device":       "device_type",
+	"utm_source":   "utm_source",
+	"utm_medium":   "utm_medium",
+	"utm_campaign": "utm_campaign",
+	"ref_code":     "ref_code",
+}
+
+// acquisitionKeys are the frontend metadata keys copied into the activity rows
+var acquisitionKeys = []string{"utm_source", "utm_medium", "utm_campaign", "ref_code"}
+
+// Cohort limits
+const (
+	defaultCohortWeeks = 8
+	MaxCohortWeeks     = 26
+	// maxCohortSegments is how many segments are reported; smaller ones are
+	// merged into "other"
+	maxCohortSegments = 20
+)
+
+// cohortDays are the single-day retention columns
+var cohortDays = []int{1, 7, 30}
+
+// CohortOptions selects the cohort matrix
+type CohortOptions struct {
+	Kind    string // retention (default): by first seen; deposit: by first deposit
+	Segment string // a key of CohortSegments, or empty
+	Weeks   int    // columns of the weekly matrix
+}
+
+// CohortReport is a cohort matrix: one row per first-seen (or first deposit)
+// week and segment
+type CohortReport struct {
+	Kind    string    `json:"kind"`
+	Segment string    `json:"segment,omitempty"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	AsOf    time.Time `json:"as_of"` // days before this are complete
+	Cohorts []Cohort  `json:"cohorts"`
+}
+
+// Cohort is one row of the matrix. Rates are percentages of the players whose
+// period has fully elapsed, null while none has. For retention, Dn is the
+// share active on day n after their first day and week k the share active in
+// days 7k to 7k+6. For deposits, both are the share that made a second
+// deposit by then.
+type Cohort struct {
+	Week    time.Time  `json:"week"` // Monday
+	Segment string     `json:"segment,omitempty"`
+	Players int64      `json:"players"`
+	D1      *float64   `json:"d1"`
+	D7      *float64   `json:"d7"`
+	D30     *float64   `json:"d30"`
+	Weeks   []*float64 `json:"weeks"`
+}
+
+// cohortPlayer is one player of a cohort: the day they entered it and, by
+// days since then, their activity (deposits for deposit cohorts)
+type cohortPlayer struct {
+	start   time.Time
+	segment string
+	days    map[int]int64
+}
+
+// cohortOptions validates opts, filling in defaults
+func cohortOptions(opts *CohortOptions) error {
+	switch opts.Kind {
+	case "":
+		opts.Kind = "retention"
+	case "retention", "deposit":
+	default:
+		return fmt.Errorf("%w: kind must be retention or deposit", ErrInvalidArgument)
+	}
+	if _, ok := CohortSegments[opts.Segment]; opts.Segment != "" && !ok {
+		return fmt.Errorf("%w: segment must be one of country, device, utm_source, utm_medium, utm_campaign, ref_code", ErrInvalidArgument)
+	}
+	if opts.Weeks == 0 {
+		opts.Weeks = defaultCohortWeeks
+	}
+	if opts.Weeks < 1 || opts.Weeks > MaxCohortWeeks {
+		return fmt.Errorf("%w: weeks must be between 1 and %d", ErrInvalidArgument, MaxCohortWeeks)
+	}
+	return nil
+}
+
+// cohortRange turns a query range into the first and last (exclusive) UTC day
+func cohortRange(q Query) (time.Time, time.Time, error) {
+	from, to := utcDay(q.Start), utcDay(q.end().Add(24*time.Hour-time.Nanosecond))
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("%w: start must be before end", ErrInvalidArgument)
+	}
+	return from, to, nil
+}
+
+// maxCohortOffset is the last day after the start a cohort report reads
+func maxCohortOffset(opts CohortOptions) int {
+	return max(cohortDays[len(cohortDays)-1], 7*opts.Weeks)
+}
+
+func utcDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// weekOf returns the Monday of t's week
+func weekOf(t time.Time) time.Time {
+	return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+}
+
+// computeCohorts groups players into week and segment cohorts and rates them
+func computeCohorts(opts CohortOptions, from, to time.Time, players []cohortPlayer) *CohortReport {
+	today := utcDay(time.Now())
+	report := &CohortReport{Kind: opts.Kind, Segment: opts.Segment, Start: from, End: to, AsOf: today, Cohorts: []Cohort{}}
+
+	if opts.Segment != "" {
+		mergeSmallSegments(players)
+	}
+
+	type key struct {
+		week    time.Time
+		segment string
+	}
+	type tally struct {
+		players         int64
+		dayHit, dayOf   []int64
+		weekHit, weekOf []int64
+	}
+	tallies := make(map[key]*tally)
+	for _, p := range players {
+		k := key{weekOf(p.start), p.segment}
+		t := tallies[k]
+		if t == nil {
+			t = &tally{
+				dayHit: make([]int64, len(cohortDays)), dayOf: make([]int64, len(cohortDays)),
+				weekHit: make([]int64, opts.Weeks), weekOf: make([]int64, opts.Weeks),
+			}
+			tallies[k] = t
+		}
+		t.players++
+
+		// Day of the second deposit, or -1
+		second := -1
+		if opts.Kind == "deposit" {
+			offsets := make([]int, 0, len(p.days))
+			for d := range p.days {
+				offsets = append(offsets, d)
+			}
+			sort.Ints(offsets)
+			if p.days[0] >= 2 {
+				second = 0
+			} else if len(offsets) > 1 {
+				second = offsets[1]
+			}
+		}
+		// hit reports whether the player counts for the days [lo, hi]
+		hit := func(lo, hi int) bool {
+			if opts.Kind == "deposit" {
+				return second >= 0 && second <= hi
+			}
+			for d := lo; d <= hi; d++ {
+				if p.days[d] > 0 {
+					return true
+				}
+			}
+			return false
+		}
+		elapsed := func(last int) bool { return p.start.AddDate(0, 0, last).Before(today) }
+
+		for i, n := range cohortDays {
+			if elapsed(n) {
+				t.dayOf[i]++
+				if hit(n, n) {
+					t.dayHit[i]++
+				}
+			}
+		}
+		for w := 0; w < opts.Weeks; w++ {
+			if elapsed(7*w + 6) {
+				t.weekOf[w]++
+				if hit(7*w, 7*w+6) {
+					t.weekHit[w]++
+				}
+			}
+		}
+	}
+
+	rate := func(hit, of int64) *float64 {
+		if of == 0 {
+			return nil
+		}
+		r := percentOf(hit, of)
+		return &r
+	}
+	for k, t := range tallies {
+		c := Cohort{Week: k.week, Segment: k.segment, Players: t.players, Weeks: make([]*float64, opts.Weeks)}
+		c.D1, c.D7, c.D30 = rate(t.dayHit[0], t.dayOf[0]), rate(t.dayHit[1], t.dayOf[1]), rate(t.dayHit[2], t.dayOf[2])
+		for w := range c.Weeks {
+			c.Weeks[w] = rate(t.weekHit[w], t.weekOf[w])
+		}
+		report.Cohorts = append(report.Cohorts, c)
+	}
+	sort.Slice(report.Cohorts, func(i, j int) bool {
+		a, b := report.Cohorts[i], report.Cohorts[j]
+		if !a.Week.Equal(b.Week) {
+			return a.Week.Before(b.Week)
+		}
+		if a.Players != b.Players {
+			return a.Players > b.Players
+		}
+		return a.Segment < b.Segment
+	})
+	return report
+}
+
+// mergeSmallSegments keeps the largest segments and renames the rest "other";
+// players without a value are "unknown"
+func mergeSmallSegments(players []cohortPlayer) {
+	sizes := make(map[string]int)
+	for i := range players {
+		if players[i].segment == "" {
+			players[i].segment = "unknown"
+		}
+		sizes[players[i].segment]++
+	}
+	if len(sizes) <= maxCohortSegments {
+		return
+	}
+	segments := make([]string, 0, len(sizes))
+	for s := range sizes {
+		segments = append(segments, s)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if sizes[segments[i]] != sizes[segments[j]] {
+			return sizes[segments[i]] > sizes[segments[j]]
+		}
+		return segments[i] < segments[j]
+	})
+	keep := make(map[string]bool)
+	for _, s := range segments[:maxCohortSegments-1] {
+		keep[s] = true
+	}
+	for i := range players {
+		if !keep[players[i].segment] {
+			players[i].segment = "other"
+		}
+	}
+}
+
+// ============================================
+// POSTGRES
+// ============================================
+
+// RefreshPlayerActivity rebuilds the player_daily_activity rows of one UTC
+// day from the raw frontend and PSP rows, returning how many players were
+// active. Only rebuild days whose raw rows are still retained.
+func (p *Postgres) RefreshPlayerActivity(ctx context.Context, day time.Time) (int64, error) {
+	day = utcDay(day)
+	first := func(expr string) string {
+		return fmt.Sprintf("(array_agg(%s ORDER BY time) FILTER (WHERE %s IS NOT NULL))[1]", expr, expr)
+	}
+	acquisition := make([]string, len(acquisitionKeys))
+	for i, k := range acquisitionKeys {
+		acquisition[i] = first(fmt.Sprintf("(metadata->>'%s')", k)) + " AS " + k
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO player_daily_activity (day, player_id, sessions, events, transactions, deposits,
+			country, device_type, utm_source, utm_medium, utm_campaign, ref_code)
+		WITH f AS (
+			SELECT player_id, COUNT(DISTINCT session_id) AS sessions, COUNT(*) AS events,
+			       %s AS country, %s AS device_type, %s
+			FROM frontend_metrics
+			WHERE time >= $1 AND time < $2 AND player_id IS NOT NULL
+			GROUP BY player_id
+		), t AS (
+			SELECT player_id, COUNT(*) AS transactions,
+			       COUNT(*) FILTER (WHERE operation = 'deposit' AND success) AS deposits
+			FROM psp_metrics
+			WHERE time >= $1 AND time < $2 AND player_id IS NOT NULL
+			GROUP BY player_id
+		)
+		SELECT $1::date, player_id, COALESCE(f.sessions, 0), COALESCE(f.events, 0),
+		       COALESCE(t.transactions, 0), COALESCE(t.deposits, 0),
+		       f.country, f.device_type, f.utm_source, f.utm_medium, f.utm_campaign, f.ref_code
+		FROM f FULL JOIN t USING (player_id)
+	`, first("country"), first("device_type"), strings.Join(acquisition, ", "))
+
+	var n int64
+	err := pgx.BeginTxFunc(ctx, p.writer, pgx.TxOptions{}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM player_daily_activity WHERE day = $1::date`, day); err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, query, day, day.Add(24*time.Hour))
+		n = tag.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("refresh player activity %s: %w", day.Format(time.DateOnly), err)
+	}
+	return n, nil
+}
+
+// LatestActivityDay returns the last day in player_daily_activity, zero when empty
+func (p *Postgres) LatestActivityDay(ctx context.Context) (time.Time, error) {
+	var day *time.Time
+	if err := p.reader.QueryRow(ctx, `SELECT MAX(day) FROM player_daily_activity`).Scan(&day); err != nil {
+		return time.Time{}, fmt.Errorf("query latest activity day: %w", err)
+	}
+	if day == nil {
+		return time.Time{}, nil
+	}
+	return *day, nil
+}
+
+// GetCohorts reads the activity of the players whose first (deposit) day
+// falls in the range and computes the cohort matrix
+func (p *Postgres) GetCohorts(ctx context.Context, q Query, opts CohortOptions) (*CohortReport, error) {
+	if err := cohortOptions(&opts); err != nil {
+		return nil, err
+	}
+	from, to, err := cohortRange(q)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.reader.Query(ctx, cohortQuery(opts), from, to, maxCohortOffset(opts))
+	if err != nil {
+		return nil, fmt.Errorf("query cohorts: %w", err)
+	}
+	defer rows.Close()
+
+	var players []cohortPlayer
+	for rows.Next() {
+		var c cohortPlayer
+		var offsets, deposits []int32
+		if err := rows.Scan(&c.start, &c.segment, &offsets, &deposits); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		c.days = make(map[int]int64, len(offsets))
+		for i, d := range offsets {
+			c.days[int(d)] = activityValue(opts, int64(deposits[i]))
+		}
+		players = append(players, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query cohorts: %w", err)
+	}
+
+	return computeCohorts(opts, from, to, players), nil
+}
+
+// cohortQuery selects, per player starting in [$1, $2), the start day, the
+// segment and the day offsets up to $3 with their deposits. Only players active
+// in the range can start in it, so they are found through the day index and
+// their history before the range end read through the primary key, instead of
+// grouping the whole table.
+func cohortQuery(opts CohortOptions) string {
+	start, counted, active := "MIN(day)", "TRUE", "TRUE"
+	if opts.Kind == "deposit" {
+		start, counted, active = "MIN(day) FILTER (WHERE deposits > 0)", "deposits > 0", "a.deposits > 0"
+	}
+	segment := "NULL::text"
+	if col := CohortSegments[opts.Segment]; col != "" {
+		segment = fmt.Sprintf("(array_agg(%s ORDER BY day) FILTER (WHERE %s IS NOT NULL))[1]", col, col)
+	}
+	return fmt.Sprintf(`
+		WITH candidates AS (
+			SELECT DISTINCT player_id
+			FROM player_daily_activity
+			WHERE day >= $1::date AND day < $2::date AND %[3]s
+		), players AS (
+			SELECT player_id, %[1]s AS start, %[2]s AS segment
+			FROM player_daily_activity
+			JOIN candidates USING (player_id)
+			WHERE day < $2::date
+			GROUP BY player_id
+		)
+		SELECT p.start, COALESCE(p.segment, ''), array_agg(a.day - p.start), array_agg(a.deposits)
+		FROM players p
+		JOIN player_daily_activity a ON a.player_id = p.player_id
+		 AND a.day >= p.start AND a.day <= p.start + $3::int
+		WHERE p.start >= $1::date AND %[4]s
+		GROUP BY p.player_id, p.start, p.segment
+	`, start, segment, counted, active)
+}
+
+// activityValue is what a day of activity counts for: its deposits in deposit
+// cohorts, presence otherwise
+func activityValue(opts CohortOptions, deposits int64) int64 {
+	if opts.Kind == "deposit" {
+		return deposits
+	}
+	return 1
+}
+
+// ============================================
+// MEMORY
+// ============================================
+
+func (m *Memory) RefreshPlayerActivity(ctx context.Context, day time.Time) (int64, error) {
+	day = utcDay(day)
+	end := day.Add(24 * time.Hour)
+	inDay := func(t time.Time) bool { return !t.Before(day) && t.Before(end) }
+
+	type building struct {
+		PlayerDay
+		sessions map[string]bool
+		seen     map[string]time.Time // when each attribute was taken
+	}
+	players := make(map[string]*building)
+	get := func(id string) *building {
+		b := players[id]
+		if b == nil {
+			b = &building{PlayerDay: PlayerDay{Day: day, PlayerID: id}, sessions: make(map[string]bool), seen: make(map[string]time.Time)}
+			players[id] = b
+		}
+		return b
+	}
+	// first keeps the value of the earliest event that has one
+	first := func(b *building, field *string, name, v string, t time.Time) {
+		if at, ok := b.seen[name]; v != "" && (!ok || t.Before(at)) {
+			*field, b.seen[name] = v, t
+		}
+	}
+
+	m.mu.RLock()
+	for _, e := range m.frontend {
+		if e.PlayerID == nil || !inDay(e.Time) {
+			continue
+		}
+		b := get(*e.PlayerID)
+		b.Events++
+		b.sessions[e.SessionID] = true
+		first(b, &b.Country, "country", e.Country, e.Time)
+		first(b, &b.DeviceType, "device_type", e.DeviceType, e.Time)
+		var doc any
+		if json.Unmarshal(e.Metadata, &doc) == nil {
+			fields := []*string{&b.UTMSource, &b.UTMMedium, &b.UTMCampaign, &b.RefCode}
+			for i, k := range acquisitionKeys {
+				if v, ok := metadataAt(doc, []string{k}); ok {
+					first(b, fields[i], k, v, e.Time)
+				}
+			}
+		}
+	}
+	for _, r := range m.psp {
+		if r.PlayerID == nil || !inDay(r.Time) {
+			continue
+		}
+		b := get(*r.PlayerID)
+		b.Transactions++
+		if r.Operation == "deposit" && r.Success {
+			b.Deposits++
+		}
+	}
+	m.mu.RUnlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.activity[:0]
+	for _, a := range m.activity {
+		if !a.Day.Equal(day) {
+			kept = append(kept, a)
+		}
+	}
+	m.activity = kept
+	for _, b := range players {
+		b.Sessions = int64(len(b.sessions))
+		m.activity = append(m.activity, b.PlayerDay)
+	}
+	return int64(len(players)), nil
+}
+
+func (m *Memory) LatestActivityDay(ctx context.Context) (time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var latest time.Time
+	for _, a := range m.activity {
+		if a.Day.After(latest) {
+			latest = a.Day
+		}
+	}
+	return latest, nil
+}
+
+func (m *Memory) GetCohorts(ctx context.Context, q Query, opts CohortOptions) (*CohortReport, error) {
+	if err := cohortOptions(&opts); err != nil {
+		return nil, err
+	}
+	from, to, err := cohortRange(q)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	byPlayer := make(map[string][]PlayerDay)
+	for _, a := range m.activity {
+		byPlayer[a.PlayerID] = append(byPlayer[a.PlayerID], a)
+	}
+	m.mu.RUnlock()
+
+	segmentOf := func(a PlayerDay) string {
+		switch opts.Segment {
+		case "country":
+			return a.Country
+		case "device":
+			return a.DeviceType
+		case "utm_source":
+			return a.UTMSource
+		case "utm_medium":
+			return a.UTMMedium
+		case "utm_campaign":
+			return a.UTMCampaign
+		case "ref_code":
+			return a.RefCode
+		}
+		return ""
+	}
+	last := maxCohortOffset(opts)
+
+	var players []cohortPlayer
+	for _, days := range byPlayer {
+		sort.Slice(days, func(i, j int) bool { return days[i].Day.Before(days[j].Day) })
+		c := cohortPlayer{days: make(map[int]int64)}
+		found := false
+		for _, a := range days {
+			if c.segment == "" && a.Day.Before(to) {
+				c.segment = segmentOf(a)
+			}
+			if !found && (opts.Kind == "retention" || a.Deposits > 0) {
+				c.start, found = a.Day, true
+			}
+		}
+		if !found || c.start.Before(from) || !c.start.Before(to) {
+			continue
+		}
+		for _, a := range days {
+			d := int(a.Day.Sub(c.start) / (24 * time.Hour))
+			if d >= 0 && d <= last && (opts.Kind == "retention" || a.Deposits > 0) {
+				c.days[d] = activityValue(opts, a.Deposits)
+			}
+		}
+		players = append(players, c)
+	}
+
+	return computeCohorts(opts, from, to, players), nil
+}
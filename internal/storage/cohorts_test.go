@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+// cohortWeek is a Monday long enough ago for every default cohort column to
+// have elapsed
+func cohortWeek() time.Time {
+	return weekOf(utcDay(time.Now())).AddDate(0, 0, -70)
+}
+
+// activeDays builds a cohort player's activity from day offsets and counts
+func activeDays(days ...int) map[int]int64 {
+	m := make(map[int]int64)
+	for i := 0; i+1 < len(days); i += 2 {
+		m[days[i]] = int64(days[i+1])
+	}
+	return m
+}
+
+// rateOf renders a nullable rate for comparisons
+func rateOf(r *float64) string {
+	if r == nil {
+		return "null"
+	}
+	return fmt.Sprintf("%.2f", *r)
+}
+
+func checkCohort(t *testing.T, c Cohort, week time.Time, segment string, players int64, d1, d7, d30 string, weeks ...string) {
+	t.Helper()
+	if !c.Week.Equal(week) || c.Segment != segment || c.Players != players {
+		t.Errorf("cohort = %s/%q with %d players, want %s/%q with %d", c.Week.Format(time.DateOnly), c.Segment, c.Players, week.Format(time.DateOnly), segment, players)
+	}
+	got := []string{rateOf(c.D1), rateOf(c.D7), rateOf(c.D30)}
+	for _, w := range c.Weeks {
+		got = append(got, rateOf(w))
+	}
+	want := append([]string{d1, d7, d30}, weeks...)
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("%s/%q rates (d1 d7 d30 weeks...) = %v, want %v", week.Format(time.DateOnly), segment, got, want)
+	}
+}
+
+func TestComputeCohortsRetention(t *testing.T) {
+	week := cohortWeek()
+	recent := utcDay(time.Now()).AddDate(0, 0, -3)
+	opts := CohortOptions{Kind: "retention", Weeks: 2}
+	report := computeCohorts(opts, week, utcDay(time.Now()), []cohortPlayer{
+		{start: week, days: activeDays(0, 1, 1, 1, 7, 1)},
+		{start: week.AddDate(0, 0, 2), days: activeDays(0, 1, 30, 1)},
+		// Only D1 has elapsed for this one
+		{start: recent, days: activeDays(0, 1, 1, 1)},
+	})
+
+	if len(report.Cohorts) != 2 {
+		t.Fatalf("got %d cohorts, want 2: %+v", len(report.Cohorts), report.Cohorts)
+	}
+	checkCohort(t, report.Cohorts[0], week, "", 2, "50.00", "50.00", "50.00", "100.00", "50.00")
+	checkCohort(t, report.Cohorts[1], weekOf(recent), "", 1, "100.00", "null", "null", "null", "null")
+}
+
+func TestComputeCohortsDeposit(t *testing.T) {
+	week := cohortWeek()
+	opts := CohortOptions{Kind: "deposit", Weeks: 3}
+	report := computeCohorts(opts, week, utcDay(time.Now()), []cohortPlayer{
+		// Second deposit on day 5: counts from D7 and week 0 on
+		{start: week, days: activeDays(0, 1, 5, 1)},
+		// Two deposits on the first day
+		{start: week, days: activeDays(0, 2)},
+		// Second deposit on day 10
+		{start: week, days: activeDays(0, 1, 10, 1)},
+		{start: week, days: activeDays(0, 1)},
+	})
+
+	if len(report.Cohorts) != 1 {
+		t.Fatalf("got %d cohorts, want 1: %+v", len(report.Cohorts), report.Cohorts)
+	}
+	checkCohort(t, report.Cohorts[0], week, "", 4, "25.00", "50.00", "75.00", "50.00", "75.00", "75.00")
+}
+
+func TestMergeSmallSegments(t *testing.T) {
+	var players []cohortPlayer
+	// Segment s00 has 30 players, s01 29 and so on; 25 segments in all
+	for s := 0; s < 25; s++ {
+		for i := 0; i < 30-s; i++ {
+			players = append(players, cohortPlayer{segment: fmt.Sprintf("s%02d", s)})
+		}
+	}
+	players = append(players, cohortPlayer{})
+
+	mergeSmallSegments(players)
+	sizes := make(map[string]int)
+	for _, p := range players {
+		sizes[p.segment]++
+	}
+	if len(sizes) != maxCohortSegments {
+		t.Errorf("got %d segments, want %d: %v", len(sizes), maxCohortSegments, sizes)
+	}
+	// The player without a value is the smallest segment, so it is merged too
+	if sizes["s00"] != 30 || sizes["s18"] != 12 || sizes["s19"] != 0 || sizes["unknown"] != 0 {
+		t.Errorf("kept segments = %v", sizes)
+	}
+	if want := 11 + 10 + 9 + 8 + 7 + 6 + 1; sizes["other"] != want {
+		t.Errorf("other = %d, want %d", sizes["other"], want)
+	}
+
+	few := []cohortPlayer{{segment: "BR"}, {}, {segment: "BR"}}
+	mergeSmallSegments(few)
+	if few[0].segment != "BR" || few[1].segment != "unknown" {
+		t.Errorf("few segments = %+v, want BR and unknown kept", few)
+	}
+}
+
+// activityMemory holds raw rows of four players in the week of cohortWeek,
+// rolled up into player_daily_activity:
+//
+//	A: BR, seen on day 0, deposits on days 1 and 4
+//	B: no frontend rows, deposits on day 2, fails one on day 3
+//	C: BR, seen on day 0 and 1
+//	D: seen on day 0 without a country, from DE on day 8
+func activityMemory(t *testing.T) (*Memory, time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	week := cohortWeek()
+	day := func(n int) time.Time { return week.AddDate(0, 0, n).Add(12 * time.Hour) }
+	seen := func(n int, player, country string) model.EnrichedEvent {
+		return model.EnrichedEvent{FrontendEvent: model.FrontendEvent{Time: day(n), SessionID: player + "-session", PlayerID: ptr(player), EventType: "page_load"}, Country: country}
+	}
+	deposit := func(n int, player string, ok bool) model.PSPMetric {
+		return model.PSPMetric{Time: day(n), PSPName: "PIX", Operation: "deposit", Success: ok, PlayerID: ptr(player)}
+	}
+
+	m := NewMemory(0)
+	for _, err := range []error{
+		m.CopyFrontendMetrics(ctx, []model.EnrichedEvent{
+			seen(0, "A", "BR"), seen(0, "C", "BR"), seen(1, "C", "BR"), seen(0, "D", ""), seen(8, "D", "DE"),
+		}),
+		m.InsertPSPMetrics(ctx, []model.PSPMetric{
+			deposit(1, "A", true), deposit(4, "A", true), deposit(2, "B", true), deposit(3, "B", false),
+		}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for n := 0; n <= 8; n++ {
+		if _, err := m.RefreshPlayerActivity(ctx, day(n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m, week
+}
+
+func TestMemoryCohorts(t *testing.T) {
+	m, week := activityMemory(t)
+	ctx := context.Background()
+	q := Query{Start: week, End: week.AddDate(0, 0, 7)}
+
+	report, err := m.GetCohorts(ctx, q, CohortOptions{Segment: "country", Weeks: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Cohorts) != 2 {
+		t.Fatalf("got %d retention cohorts, want 2: %+v", len(report.Cohorts), report.Cohorts)
+	}
+	// D's country is only seen after the range, so D stays unknown. B's failed
+	// deposit is activity on its day 1; D returns on day 8, in week 1.
+	checkCohort(t, report.Cohorts[0], week, "BR", 2, "100.00", "0.00", "0.00", "100.00", "0.00")
+	checkCohort(t, report.Cohorts[1], week, "unknown", 2, "50.00", "0.00", "0.00", "100.00", "50.00")
+
+	report, err = m.GetCohorts(ctx, q, CohortOptions{Kind: "deposit", Segment: "country", Weeks: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Cohorts) != 2 {
+		t.Fatalf("got %d deposit cohorts, want 2: %+v", len(report.Cohorts), report.Cohorts)
+	}
+	// A deposits again 3 days after the first; B's failed deposit does not count
+	checkCohort(t, report.Cohorts[0], week, "BR", 1, "0.00", "100.00", "100.00", "100.00", "100.00")
+	checkCohort(t, report.Cohorts[1], week, "unknown", 1, "0.00", "0.00", "0.00", "0.00", "0.00")
+
+	// Cohorts only hold players whose first day falls in the range
+	report, err = m.GetCohorts(ctx, Query{Start: week.AddDate(0, 0, 1), End: week.AddDate(0, 0, 7)}, CohortOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Cohorts) != 1 || report.Cohorts[0].Players != 1 {
+		t.Errorf("cohorts from day 1 = %+v, want only B", report.Cohorts)
+	}
+}
+
+func TestCohortQuery(t *testing.T) {
+	for _, kind := range []string{"retention", "deposit"} {
+		query := cohortQuery(CohortOptions{Kind: kind, Segment: "country"})
+		// Players are taken from the range and their history read up to its end
+		for _, want := range []string{
+			"FROM player_daily_activity\n\t\t\tWHERE day >= $1::date AND day < $2::date",
+			"JOIN candidates USING (player_id)\n\t\t\tWHERE day < $2::date",
+		} {
+			if !strings.Contains(query, want) {
+				t.Errorf("%s query does not contain %q:\n%s", kind, want, query)
+			}
+		}
+		if strings.Count(query, "FROM player_daily_activity") != 2 {
+			t.Errorf("%s query reads player_daily_activity other than through candidates:\n%s", kind, query)
+		}
+	}
+	if query := cohortQuery(CohortOptions{Kind: "deposit"}); !strings.Contains(query, "day < $2::date AND deposits > 0") || !strings.Contains(query, "AND a.deposits > 0") {
+		t.Errorf("deposit query does not start cohorts at deposits:\n%s", query)
+	}
+}
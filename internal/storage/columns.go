@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+// Column lists and row encoders shared by the INSERT and COPY write paths.
+// Every write goes through these, so the two paths cannot drift apart.
+
+var frontendColumns = []string{
+	"time", "session_id", "player_id", "device_type", "browser", "country",
+	"event_type", "page_path", "lcp_ms", "fid_ms", "cls", "ttfb_ms", "fcp_ms", "inp_ms",
+	"metric_name", "metric_value", "release", "metadata",
+}
+
+func frontendRow(e model.EnrichedEvent) []interface{} {
+	return []interface{}{
+		e.Time, e.SessionID, e.PlayerID, e.DeviceType, e.Browser, e.Country,
+		e.EventType, e.PagePath, e.LCP, e.FID, e.CLS, e.TTFB, e.FCP, e.INP,
+		e.MetricName, e.MetricValue, e.Release, e.Metadata,
+	}
+}
+
+var apiColumns = []string{
+	"time", "service_name", "endpoint", "method", "duration_ms", "status_code",
+	"player_id", "request_id", "error_type", "error_message", "error_fingerprint",
+	"request_size", "response_size", "release", "metadata",
+}
+
+func apiRow(m model.APIMetric) []interface{} {
+	return []interface{}{
+		m.Time, m.ServiceName, m.Endpoint, m.Method, m.DurationMS, m.StatusCode,
+		m.PlayerID, m.RequestID, m.ErrorType, m.ErrorMessage, fingerprintOf(apiError(m)),
+		m.RequestSize, m.ResponseSize, m.Release, m.Metadata,
+	}
+}
+
+var pspColumns = []string{
+	"time", "psp_name", "operation", "duration_ms", "success",
+	"player_id", "transaction_id", "amount", "currency",
+	"error_code", "error_message", "error_fingerprint", "psp_response_code", "release", "metadata",
+}
+
+func pspRow(m model.PSPMetric) []interface{} {
+	return []interface{}{
+		m.Time, m.PSPName, m.Operation, m.DurationMS, m.Success,
+		m.PlayerID, m.TransactionID, m.Amount, m.Currency,
+		m.ErrorCode, m.ErrorMessage, fingerprintOf(pspError(m)), m.PSPResponseCode, m.Release, m.Metadata,
+	}
+}
+
+var gameColumns = []string{
+	"time", "provider", "game_id", "game_type", "load_time_ms", "launch_success",
+	"player_id", "session_id", "device_type", "error_type", "error_message", "error_fingerprint",
+	"release", "metadata",
+}
+
+func gameRow(m model.GameMetric) []interface{} {
+	return []interface{}{
+		m.Time, m.Provider, m.GameID, m.GameType, m.LoadTimeMS, m.LaunchSuccess,
+		m.PlayerID, m.SessionID, m.DeviceType, m.ErrorType, m.ErrorMessage, fingerprintOf(gameError(m)),
+		m.Release, m.Metadata,
+	}
+}
+
+var wsColumns = []string{
+	"time", "connection_id", "player_id", "event_type", "latency_ms",
+	"messages_sent", "messages_received", "close_code", "close_reason",
+	"endpoint", "device_type", "release", "metadata",
+}
+
+func wsRow(m model.WebSocketMetric) []interface{} {
+	return []interface{}{
+		m.Time, m.ConnectionID, m.PlayerID, m.EventType, m.LatencyMS,
+		m.MessagesSent, m.MessagesReceived, m.CloseCode, m.CloseReason,
+		m.Endpoint, m.DeviceType, m.Release, m.Metadata,
+	}
+}
+
+// encodeRows applies a row encoder to a batch
+func encodeRows[T any](items []T, row func(T) []interface{}) [][]interface{} {
+	rows := make([][]interface{}, len(items))
+	for i, item := range items {
+		rows[i] = row(item)
+	}
+	return rows
+}
@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+// CustomMetricRow is one bucket of a custom metric (Pulse.track) per device and
+// page, from custom_metrics_5m or its hourly/daily rollups
+type CustomMetricRow struct {
+	Bucket      time.Time `json:"bucket"`
+	MetricName  string    `json:"metric_name"`
+	DeviceType  string    `json:"device_type"`
+	PagePath    string    `json:"page_path"`
+	SampleCount int64     `json:"sample_count"`
+	Avg         float64   `json:"avg"`
+	P50         float64   `json:"p50"`
+	P95         float64   `json:"p95"`
+	P99         float64   `json:"p99"`
+}
+
+// CustomMetricInfo is one entry of the custom metric catalog
+type CustomMetricInfo struct {
+	MetricName  string    `json:"metric_name"`
+	SampleCount int64     `json:"sample_count"`
+	Avg         float64   `json:"avg"`
+	Pages       int64     `json:"pages"`
+	Devices     int64     `json:"devices"`
+	FirstSeen   time.Time `json:"first_seen"` // start of the first bucket with samples
+	LastSeen    time.Time `json:"last_seen"`  // start of the last bucket with samples
+}
+
+// CustomMetricOptions filters custom metrics by metadata tags, dot-separated
+// path → text value. Tags are not kept by the aggregates, so tag filters read
+// raw rows and only cover raw retention.
+type CustomMetricOptions struct {
+	Metadata map[string]string
+}
+
+// maxCustomCatalog caps the metric names listed by the catalog
+const maxCustomCatalog = 500
+
+// customStats are the statistics a custom metric timeseries can plot
+var customStats = map[string]string{
+	"count": "SUM(sample_count)::float8",
+	"avg":   "COALESCE(mean(rollup(value_sketch)), 0)",
+	"p50":   "COALESCE(approx_percentile(0.5, rollup(value_sketch)), 0)",
+	"p95":   "COALESCE(approx_percentile(0.95, rollup(value_sketch)), 0)",
+	"p99":   "COALESCE(approx_percentile(0.99, rollup(value_sketch)), 0)",
+}
+
+// planCustom plans q against the custom metric aggregates, switching to raw
+// rows when metadata tags are filtered
+func planCustom(q Query, opts CustomMetricOptions) (queryPlan, error) {
+	p, err := customSource.plan(q)
+	if err != nil {
+		return p, err
+	}
+	if p.metadata, err = metadataConditions(opts.Metadata); err != nil {
+		return p, err
+	}
+	if len(p.metadata) > 0 {
+		p.view = ""
+	}
+	return p, nil
+}
+
+// customStat validates a timeseries request: a known stat (avg by default) and
+// a metric_name filter, as values of different metrics do not mix
+func customStat(stat string, q Query) (string, error) {
+	if stat == "" {
+		stat = "avg"
+	}
+	expr, ok := customStats[stat]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown stat %q, available: count, avg, p50, p95, p99", ErrInvalidArgument, stat)
+	}
+	if q.Filters["metric_name"] == "" {
+		return "", fmt.Errorf("%w: metric_name is required", ErrInvalidArgument)
+	}
+	return expr, nil
+}
+
+// ============================================
+// POSTGRES
+// ============================================
+
+// GetCustomMetrics returns count, mean and p50/p95/p99 of every custom metric
+// per bucket, device and page
+func (p *Postgres) GetCustomMetrics(ctx context.Context, q Query, opts CustomMetricOptions) ([]CustomMetricRow, error) {
+	plan, err := planCustom(q, opts)
+	if err != nil {
+		return nil, err
+	}
+	rel, args := customSource.relation(plan)
+	query := fmt.Sprintf(`
+		SELECT bucket, metric_name, COALESCE(device_type, 'unknown'), COALESCE(page_path, '/'), sample_count,
+		       COALESCE(mean(value_sketch), 0), COALESCE(approx_percentile(0.5, value_sketch), 0),
+		       COALESCE(approx_percentile(0.95, value_sketch), 0), COALESCE(approx_percentile(0.99, value_sketch), 0)
+		FROM (%s) v
+		ORDER BY bucket DESC, metric_name, device_type, page_path
+	`, rel)
+
+	rows, err := p.reader.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query custom metrics: %w", err)
+	}
+	defer rows.Close()
+
+	result := []CustomMetricRow{}
+	for rows.Next() {
+		var r CustomMetricRow
+		if err := rows.Scan(&r.Bucket, &r.MetricName, &r.DeviceType, &r.PagePath, &r.SampleCount,
+			&r.Avg, &r.P50, &r.P95, &r.P99); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// GetCustomMetricsTimeSeries returns one statistic of a custom metric over time
+// across the devices and pages matching the filters
+func (p *Postgres) GetCustomMetricsTimeSeries(ctx context.Context, stat string, q Query, opts CustomMetricOptions) ([]TimeSeriesPoint, error) {
+	expr, err := customStat(stat, q)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planCustom(q, opts)
+	if err != nil {
+		return nil, err
+	}
+	rel, args := customSource.relation(plan)
+	// The statistic expression comes from customStats, never from the request
+	query := fmt.Sprintf(`
+		SELECT bucket, %s
+		FROM (%s) v
+		GROUP BY bucket
+		ORDER BY bucket ASC
+	`, expr, rel)
+
+	return p.queryTimeSeries(ctx, "query custom metrics timeseries", query, args...)
+}
+
+// GetCustomMetricCatalog lists the custom metric names seen in the range,
+// most samples first
+func (p *Postgres) GetCustomMetricCatalog(ctx context.Context, q Query) ([]CustomMetricInfo, error) {
+	plan, err := customSource.plan(Query{Start: q.Start, End: q.End, Filters: q.Filters})
+	if err != nil {
+		return nil, err
+	}
+	rel, args := customSource.relation(plan)
+	query := fmt.Sprintf(`
+		SELECT metric_name, SUM(sample_count)::bigint, COALESCE(mean(rollup(value_sketch)), 0),
+		       COUNT(DISTINCT page_path), COUNT(DISTINCT device_type), min(bucket), max(bucket)
+		FROM (%s) v
+		GROUP BY metric_name
+		ORDER BY 2 DESC, metric_name
+		LIMIT %d
+	`, rel, maxCustomCatalog)
+
+	rows, err := p.reader.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query custom metric catalog: %w", err)
+	}
+	defer rows.Close()
+
+	result := []CustomMetricInfo{}
+	for rows.Next() {
+		var c CustomMetricInfo
+		if err := rows.Scan(&c.MetricName, &c.SampleCount, &c.Avg, &c.Pages, &c.Devices, &c.FirstSeen, &c.LastSeen); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
+
+// ============================================
+// MEMORY
+// ============================================
+
+// customEvents calls fn for every custom metric event in the plan's range
+// matching the filters and metadata tags
+func (m *Memory) customEvents(p queryPlan, q Query, opts CustomMetricOptions, fn func(e model.EnrichedEvent)) {
+	for _, e := range m.frontend {
+		if e.MetricName == nil || e.MetricValue == nil || !p.contains(e.Time) ||
+			!matches(q.Filters, func(dim string) string { return frontendDim(e, dim) }) ||
+			!metadataMatches(e.Metadata, opts.Metadata) {
+			continue
+		}
+		fn(e)
+	}
+}
+
+func (m *Memory) GetCustomMetrics(ctx context.Context, q Query, opts CustomMetricOptions) ([]CustomMetricRow, error) {
+	p, err := planCustom(q, opts)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	type key struct {
+		bucket                   time.Time
+		metric, device, pagePath string
+	}
+	groups := make(map[key][]float64)
+	m.customEvents(p, q, opts, func(e model.EnrichedEvent) {
+		k := key{p.bucket(e.Time), *e.MetricName, orDefault(e.DeviceType, "unknown"), orDefault(e.PagePath, "/")}
+		groups[k] = append(groups[k], *e.MetricValue)
+	})
+
+	result := make([]CustomMetricRow, 0, len(groups))
+	for k, values := range groups {
+		result = append(result, CustomMetricRow{
+			Bucket:      k.bucket,
+			MetricName:  k.metric,
+			DeviceType:  k.device,
+			PagePath:    k.pagePath,
+			SampleCount: int64(len(values)),
+			Avg:         mean(values),
+			P50:         percentileCont(values, 0.5),
+			P95:         percentileCont(values, 0.95),
+			P99:         percentileCont(values, 0.99),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if !a.Bucket.Equal(b.Bucket) {
+			return a.Bucket.After(b.Bucket)
+		}
+		if a.MetricName != b.MetricName {
+			return a.MetricName < b.MetricName
+		}
+		if a.DeviceType != b.DeviceType {
+			return a.DeviceType < b.DeviceType
+		}
+		return a.PagePath < b.PagePath
+	})
+	return result, nil
+}
+
+func (m *Memory) GetCustomMetricsTimeSeries(ctx context.Context, stat string, q Query, opts CustomMetricOptions) ([]TimeSeriesPoint, error) {
+	if _, err := customStat(stat, q); err != nil {
+		return nil, err
+	}
+	p, err := planCustom(q, opts)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	buckets := make(map[time.Time][]float64)
+	m.customEvents(p, q, opts, func(e model.EnrichedEvent) {
+		b := p.bucket(e.Time)
+		buckets[b] = append(buckets[b], *e.MetricValue)
+	})
+
+	result := make([]TimeSeriesPoint, 0, len(buckets))
+	for b, values := range buckets {
+		var value float64
+		switch stat {
+		case "count":
+			value = float64(len(values))
+		case "p50":
+			value = percentileCont(values, 0.5)
+		case "p95":
+			value = percentileCont(values, 0.95)
+		case "p99":
+			value = percentileCont(values, 0.99)
+		default:
+			value = mean(values)
+		}
+		result = append(result, TimeSeriesPoint{Time: b, Value: value})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	return result, nil
+}
+
+func (m *Memory) GetCustomMetricCatalog(ctx context.Context, q Query) ([]CustomMetricInfo, error) {
+	q = Query{Start: q.Start, End: q.End, Filters: q.Filters}
+	p, err := customSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	type entry struct {
+		info           CustomMetricInfo
+		values         []float64
+		pages, devices map[string]bool
+	}
+	entries := make(map[string]*entry)
+	m.customEvents(p, q, CustomMetricOptions{}, func(e model.EnrichedEvent) {
+		name, b := *e.MetricName, p.bucket(e.Time)
+		en, ok := entries[name]
+		if !ok {
+			en = &entry{info: CustomMetricInfo{MetricName: name, FirstSeen: b, LastSeen: b}, pages: map[string]bool{}, devices: map[string]bool{}}
+			entries[name] = en
+		}
+		en.values = append(en.values, *e.MetricValue)
+		en.pages[e.PagePath], en.devices[e.DeviceType] = true, true
+		if b.Before(en.info.FirstSeen) {
+			en.info.FirstSeen = b
+		}
+		if b.After(en.info.LastSeen) {
+			en.info.LastSeen = b
+		}
+	})
+
+	result := make([]CustomMetricInfo, 0, len(entries))
+	for _, en := range entries {
+		en.info.SampleCount, en.info.Avg = int64(len(en.values)), mean(en.values)
+		en.info.Pages, en.info.Devices = int64(len(en.pages)), int64(len(en.devices))
+		result = append(result, en.info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SampleCount != result[j].SampleCount {
+			return result[i].SampleCount > result[j].SampleCount
+		}
+		return result[i].MetricName < result[j].MetricName
+	})
+	if len(result) > maxCustomCatalog {
+		result = result[:maxCustomCatalog]
+	}
+	return result, nil
+}
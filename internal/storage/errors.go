@@ -0,0 +1,522 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/fingerprint"
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+// ErrorSources are the event sources whose failures are fingerprinted
+var ErrorSources = []string{"api", "psp", "game"}
+
+// ErrorOptions selects and ranks error groups
+type ErrorOptions struct {
+	Sources     []string // subset of ErrorSources; empty means every source the filters apply to
+	Fingerprint string   // only this group
+	OrderBy     string   // count (default), players or last_seen
+	Limit       int
+}
+
+// ErrorGroup is every failure with one fingerprint: the same source, error
+// code and message once IDs and numbers are stripped
+type ErrorGroup struct {
+	Fingerprint     string    `json:"fingerprint"`
+	Source          string    `json:"source"`     // api, psp or game
+	ErrorType       string    `json:"error_type"` // error_type, error_code for PSPs, or HTTP <status>
+	Pattern         string    `json:"pattern"`    // normalized message
+	SampleMessage   string    `json:"sample_message"`
+	Count           int64     `json:"count"`
+	AffectedPlayers int64     `json:"affected_players"`
+	Affected        []string  `json:"affected"`   // services, PSPs or game providers, at most maxAffected
+	FirstSeen       time.Time `json:"first_seen"` // earliest occurrence ever stored, also before the range
+	LastSeen        time.Time `json:"last_seen"`  // latest occurrence in the range
+	New             bool      `json:"new"`        // first seen within the range
+	Sparkline       []int64   `json:"sparkline"`  // occurrences per equal slice of the range, oldest first
+}
+
+const (
+	// sparklineBuckets is the number of sparkline points over the range
+	sparklineBuckets = 24
+	// defaultErrorLimit is the number of groups returned without a limit
+	defaultErrorLimit = 50
+	// maxAffected bounds the services, PSPs or providers listed per group
+	maxAffected = 20
+)
+
+// errorSource describes where one source keeps its failures
+type errorSource struct {
+	name     string
+	table    string
+	code     string // SQL aggregate for the group's error code
+	affected string // column naming the failing service, PSP or provider
+	dims     map[string]string
+}
+
+var errorSources = map[string]errorSource{
+	"api":  {"api", "api_metrics", "COALESCE(NULLIF(min(error_type), ''), 'HTTP ' || min(status_code))", "service_name", apiSource.dims},
+	"psp":  {"psp", "psp_metrics", "COALESCE(min(error_code), '')", "psp_name", pspSource.dims},
+	"game": {"game", "game_metrics", "COALESCE(min(error_type), '')", "provider", gameSource.dims},
+}
+
+// errorOrders rank groups in SQL and again after merging the sources
+var errorOrders = map[string]struct {
+	sql  string
+	less func(a, b *ErrorGroup) bool
+}{
+	"count":     {"count(*) DESC", func(a, b *ErrorGroup) bool { return a.Count > b.Count }},
+	"players":   {"count(DISTINCT player_id) DESC", func(a, b *ErrorGroup) bool { return a.AffectedPlayers > b.AffectedPlayers }},
+	"last_seen": {"max(time) DESC", func(a, b *ErrorGroup) bool { return a.LastSeen.After(b.LastSeen) }},
+}
+
+// apiError returns the code and message of a failed request. Requests count
+// as failed when they carry error details or a 5xx status.
+func apiError(m model.APIMetric) (source, code, message string, ok bool) {
+	if m.ErrorType == nil && m.ErrorMessage == nil && m.StatusCode < 500 {
+		return "api", "", "", false
+	}
+	code = deref(m.ErrorType)
+	if code == "" {
+		code = fmt.Sprintf("HTTP %d", m.StatusCode)
+	}
+	return "api", code, deref(m.ErrorMessage), true
+}
+
+// pspError returns the code and message of a failed or erroring transaction
+func pspError(m model.PSPMetric) (source, code, message string, ok bool) {
+	if m.Success && m.ErrorCode == nil && m.ErrorMessage == nil {
+		return "psp", "", "", false
+	}
+	return "psp", deref(m.ErrorCode), deref(m.ErrorMessage), true
+}
+
+// gameError returns the type and message of a failed or erroring launch
+func gameError(m model.GameMetric) (source, code, message string, ok bool) {
+	if m.LaunchSuccess && m.ErrorType == nil && m.ErrorMessage == nil {
+		return "game", "", "", false
+	}
+	return "game", deref(m.ErrorType), deref(m.ErrorMessage), true
+}
+
+// fingerprintOf is the stored error_fingerprint: nil for rows without a failure
+func fingerprintOf(source, code, message string, ok bool) *string {
+	if !ok {
+		return nil
+	}
+	fp := fingerprint.Of(source, code, message)
+	return &fp
+}
+
+// errorSourcesFor validates q and opts and returns the sources to read
+func errorSourcesFor(q Query, opts *ErrorOptions) ([]errorSource, error) {
+	if !q.Start.Before(q.end()) {
+		return nil, fmt.Errorf("%w: start must be before end", ErrInvalidArgument)
+	}
+	if opts.OrderBy == "" {
+		opts.OrderBy = "count"
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultErrorLimit
+	}
+	if _, ok := errorOrders[opts.OrderBy]; !ok {
+		return nil, fmt.Errorf("%w: invalid order_by %q: use count, players or last_seen", ErrInvalidArgument, opts.OrderBy)
+	}
+
+	names := opts.Sources
+	if len(names) == 0 {
+		for _, name := range ErrorSources {
+			if len(q.only(errorSources[name].dims).Filters) == len(q.Filters) {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%w: no error source supports these filters", ErrInvalidArgument)
+		}
+	}
+
+	var result []errorSource
+	for _, name := range names {
+		src, ok := errorSources[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: error source %q, available: %s", ErrInvalidArgument, name, strings.Join(ErrorSources, ", "))
+		}
+		for dim := range q.Filters {
+			if _, ok := src.dims[dim]; !ok {
+				return nil, fmt.Errorf("%w: cannot filter %s errors by %q", ErrInvalidArgument, name, dim)
+			}
+		}
+		result = append(result, src)
+	}
+	return result, nil
+}
+
+// rankErrors orders the merged groups of all sources and keeps the top ones
+func rankErrors(groups []ErrorGroup, opts ErrorOptions) []ErrorGroup {
+	less := errorOrders[opts.OrderBy].less
+	sort.SliceStable(groups, func(i, j int) bool {
+		if less(&groups[i], &groups[j]) {
+			return true
+		}
+		if less(&groups[j], &groups[i]) {
+			return false
+		}
+		return groups[i].Fingerprint < groups[j].Fingerprint
+	})
+	if opts.Limit > 0 && len(groups) > opts.Limit {
+		groups = groups[:opts.Limit]
+	}
+	return groups
+}
+
+// sparkline spreads the range over its buckets; period totals get one
+type sparkline struct {
+	start time.Time
+	width time.Duration
+	n     int
+}
+
+func newSparkline(q Query, end time.Time) sparkline {
+	n := sparklineBuckets
+	if q.Whole {
+		n = 1
+	}
+	width := end.Sub(q.Start) / time.Duration(n)
+	if width <= 0 {
+		width = 1
+	}
+	return sparkline{start: q.Start, width: width, n: n}
+}
+
+// index returns the bucket of t, clamped to the range
+func (s sparkline) index(t time.Time) int {
+	i := int(t.Sub(s.start) / s.width)
+	return max(0, min(i, s.n-1))
+}
+
+// ============================================
+// POSTGRES
+// ============================================
+
+// GetErrorGroups groups the failures in the range by fingerprint across the
+// selected sources
+func (p *Postgres) GetErrorGroups(ctx context.Context, q Query, opts ErrorOptions) ([]ErrorGroup, error) {
+	sources, err := errorSourcesFor(q, &opts)
+	if err != nil {
+		return nil, err
+	}
+	q.End = q.end()
+
+	var groups []ErrorGroup
+	for _, src := range sources {
+		rows, err := p.errorGroups(ctx, src, q, opts)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, rows...)
+	}
+	groups = rankErrors(groups, opts)
+
+	spark := newSparkline(q, q.End)
+	for _, src := range sources {
+		if err := p.errorDetails(ctx, src, q, opts, spark, groups); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// errorWhere is the WHERE clause and arguments shared by the error queries;
+// $1 and $2 are the range
+func errorWhere(src errorSource, q Query, opts ErrorOptions) (string, []any) {
+	where := []string{"time >= $1", "time < $2", "error_fingerprint IS NOT NULL"}
+	args := []any{q.Start, q.End}
+
+	dims := make([]string, 0, len(q.Filters))
+	for dim := range q.Filters {
+		dims = append(dims, dim)
+	}
+	sort.Strings(dims)
+	for _, dim := range dims {
+		args = append(args, q.Filters[dim])
+		where = append(where, fmt.Sprintf("%s = $%d", src.dims[dim], len(args)))
+	}
+	if opts.Fingerprint != "" {
+		args = append(args, opts.Fingerprint)
+		where = append(where, fmt.Sprintf("error_fingerprint = $%d", len(args)))
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// errorGroups returns the top groups of one source, without sparkline
+func (p *Postgres) errorGroups(ctx context.Context, src errorSource, q Query, opts ErrorOptions) ([]ErrorGroup, error) {
+	where, args := errorWhere(src, q, opts)
+	query := fmt.Sprintf(`
+		SELECT error_fingerprint, %s, COALESCE(min(error_message), ''),
+		       count(*), count(DISTINCT player_id), min(time), max(time),
+		       (array_agg(DISTINCT %s ORDER BY %s))[1:%d]
+		FROM %s
+		WHERE %s
+		GROUP BY error_fingerprint
+		ORDER BY %s, error_fingerprint
+		LIMIT %d
+	`, src.code, src.affected, src.affected, maxAffected, src.table, where, errorOrders[opts.OrderBy].sql, opts.Limit)
+
+	rows, err := p.reader.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query %s errors: %w", src.name, err)
+	}
+	defer rows.Close()
+
+	var result []ErrorGroup
+	for rows.Next() {
+		g := ErrorGroup{Source: src.name}
+		if err := rows.Scan(&g.Fingerprint, &g.ErrorType, &g.SampleMessage, &g.Count, &g.AffectedPlayers,
+			&g.FirstSeen, &g.LastSeen, &g.Affected); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		g.Pattern = fingerprint.Normalize(g.SampleMessage)
+		result = append(result, g)
+	}
+	return result, rows.Err()
+}
+
+// errorDetails fills in the sparkline and first sighting of the groups of one source
+func (p *Postgres) errorDetails(ctx context.Context, src errorSource, q Query, opts ErrorOptions, spark sparkline, groups []ErrorGroup) error {
+	byFingerprint := make(map[string]*ErrorGroup)
+	var fps []string
+	for i := range groups {
+		if groups[i].Source == src.name {
+			groups[i].Sparkline = make([]int64, spark.n)
+			byFingerprint[groups[i].Fingerprint] = &groups[i]
+			fps = append(fps, groups[i].Fingerprint)
+		}
+	}
+	if len(fps) == 0 {
+		return nil
+	}
+
+	where, args := errorWhere(src, q, opts)
+	args = append(args, fps, spark.width.Seconds())
+	query := fmt.Sprintf(`
+		SELECT error_fingerprint, floor(extract(epoch FROM time - $1) / $%d)::int, count(*)
+		FROM %s
+		WHERE %s AND error_fingerprint = ANY($%d)
+		GROUP BY 1, 2
+	`, len(args), src.table, where, len(args)-1)
+
+	rows, err := p.reader.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query %s error sparklines: %w", src.name, err)
+	}
+	for rows.Next() {
+		var fp string
+		var bucket int
+		var count int64
+		if err := rows.Scan(&fp, &bucket, &count); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan row: %w", err)
+		}
+		if g := byFingerprint[fp]; g != nil {
+			g.Sparkline[max(0, min(bucket, spark.n-1))] += count
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query %s error sparklines: %w", src.name, err)
+	}
+
+	// The range minimum stands in for groups written before first sightings were kept
+	rows, err = p.reader.Query(ctx, `
+		SELECT fingerprint, first_seen FROM error_fingerprints
+		WHERE source = $1 AND fingerprint = ANY($2)
+	`, src.name, fps)
+	if err != nil {
+		return fmt.Errorf("query %s first sightings: %w", src.name, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fp string
+		var firstSeen time.Time
+		if err := rows.Scan(&fp, &firstSeen); err != nil {
+			return fmt.Errorf("scan row: %w", err)
+		}
+		if g := byFingerprint[fp]; g != nil && firstSeen.Before(g.FirstSeen) {
+			g.FirstSeen = firstSeen
+		}
+	}
+	for _, g := range byFingerprint {
+		g.New = !g.FirstSeen.Before(q.Start)
+	}
+	return rows.Err()
+}
+
+// recordFirstSeen keeps the earliest sighting of every fingerprint in a
+// written batch, so first_seen needs no scan of compressed chunks. The rows
+// are stored already; a failure here is logged rather than failing the write,
+// which a retry would duplicate.
+func (p *Postgres) recordFirstSeen(ctx context.Context, source string, columns []string, rows [][]interface{}) {
+	col := -1
+	for i, c := range columns {
+		if c == "error_fingerprint" {
+			col = i
+		}
+	}
+	firstSeen := make(map[string]time.Time)
+	for _, row := range rows {
+		fp, _ := row[col].(*string)
+		t, _ := row[0].(time.Time)
+		if fp == nil {
+			continue
+		}
+		if seen, ok := firstSeen[*fp]; !ok || t.Before(seen) {
+			firstSeen[*fp] = t
+		}
+	}
+	if len(firstSeen) == 0 {
+		return
+	}
+
+	fps := make([]string, 0, len(firstSeen))
+	times := make([]time.Time, 0, len(firstSeen))
+	for fp, t := range firstSeen {
+		fps = append(fps, fp)
+		times = append(times, t)
+	}
+	_, err := p.writer.Exec(ctx, `
+		INSERT INTO error_fingerprints (source, fingerprint, first_seen)
+		SELECT $1, fp, t FROM unnest($2::text[], $3::timestamptz[]) AS s(fp, t)
+		ON CONFLICT (source, fingerprint) DO UPDATE SET first_seen = EXCLUDED.first_seen
+		WHERE EXCLUDED.first_seen < error_fingerprints.first_seen
+	`, source, fps, times)
+	if err != nil {
+		slog.Warn("failed to record error first sightings", "source", source, "error", err)
+	}
+}
+
+// ============================================
+// MEMORY
+// ============================================
+
+// errorEvent is one failure as GetErrorGroups sees it
+type errorEvent struct {
+	time                  time.Time
+	code, message, player string
+	affected              string
+	matched               bool // passes the query filters
+}
+
+// GetErrorGroups fingerprints the stored failures on read and groups them like
+// the Postgres backend
+func (m *Memory) GetErrorGroups(ctx context.Context, q Query, opts ErrorOptions) ([]ErrorGroup, error) {
+	sources, err := errorSourcesFor(q, &opts)
+	if err != nil {
+		return nil, err
+	}
+	end := q.end()
+	p := queryPlan{start: q.Start, end: end}
+	spark := newSparkline(q, end)
+
+	var groups []ErrorGroup
+	for _, src := range sources {
+		events := m.errorEvents(src.name, q.Filters)
+
+		type acc struct {
+			group    ErrorGroup
+			players  map[string]bool
+			affected map[string]bool
+		}
+		accs := make(map[string]*acc)
+		firstSeen := make(map[string]time.Time)
+		for fp, evs := range events {
+			for _, e := range evs {
+				if seen, ok := firstSeen[fp]; !ok || e.time.Before(seen) {
+					firstSeen[fp] = e.time
+				}
+				if !e.matched || !p.contains(e.time) || (opts.Fingerprint != "" && fp != opts.Fingerprint) {
+					continue
+				}
+				a := accs[fp]
+				if a == nil {
+					a = &acc{
+						group:    ErrorGroup{Fingerprint: fp, Source: src.name, ErrorType: e.code, SampleMessage: e.message, Sparkline: make([]int64, spark.n)},
+						players:  make(map[string]bool),
+						affected: make(map[string]bool),
+					}
+					accs[fp] = a
+				}
+				g := &a.group
+				g.Count++
+				g.Sparkline[spark.index(e.time)]++
+				if e.time.After(g.LastSeen) {
+					g.LastSeen = e.time
+				}
+				if e.message != "" && (g.SampleMessage == "" || e.message < g.SampleMessage) {
+					g.SampleMessage = e.message
+				}
+				if e.player != "" {
+					a.players[e.player] = true
+				}
+				a.affected[e.affected] = true
+			}
+		}
+
+		for fp, a := range accs {
+			g := a.group
+			g.AffectedPlayers = int64(len(a.players))
+			for name := range a.affected {
+				g.Affected = append(g.Affected, name)
+			}
+			sort.Strings(g.Affected)
+			if len(g.Affected) > maxAffected {
+				g.Affected = g.Affected[:maxAffected]
+			}
+			g.FirstSeen = firstSeen[fp]
+			g.New = !g.FirstSeen.Before(q.Start)
+			g.Pattern = fingerprint.Normalize(g.SampleMessage)
+			groups = append(groups, g)
+		}
+	}
+	return rankErrors(groups, opts), nil
+}
+
+// errorEvents returns every stored failure of a source by fingerprint, marking
+// those that pass filters. First sightings ignore the filters, as in Postgres.
+func (m *Memory) errorEvents(source string, filters map[string]string) map[string][]errorEvent {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := make(map[string][]errorEvent)
+	add := func(t time.Time, source, code, message string, ok bool, player *string, affected string, dim func(string) string) {
+		if !ok {
+			return
+		}
+		fp := fingerprint.Of(source, code, message)
+		events[fp] = append(events[fp], errorEvent{
+			time: t, code: code, message: message, player: deref(player), affected: affected,
+			matched: matches(filters, dim),
+		})
+	}
+	switch source {
+	case "api":
+		for _, r := range m.api {
+			src, code, msg, ok := apiError(r)
+			add(r.Time, src, code, msg, ok, r.PlayerID, r.ServiceName, func(d string) string { return apiDim(r, d) })
+		}
+	case "psp":
+		for _, r := range m.psp {
+			src, code, msg, ok := pspError(r)
+			add(r.Time, src, code, msg, ok, r.PlayerID, r.PSPName, func(d string) string { return pspDim(r, d) })
+		}
+	case "game":
+		for _, r := range m.game {
+			src, code, msg, ok := gameError(r)
+			add(r.Time, src, code, msg, ok, r.PlayerID, r.Provider, func(d string) string { return gameDim(r, d) })
+		}
+	}
+	return events
+}
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+// eventTable is a raw hypertable readable row by row
+type eventTable struct {
+	table   string
+	columns []string
+	dims    map[string]string // filter name → column
+}
+
+// eventTables names the raw tables behind ScanEvents
+var eventTables = map[string]eventTable{
+	"frontend": {"frontend_metrics", frontendColumns, sessionDims},
+	"api":      {"api_metrics", apiColumns, apiSource.dims},
+	"psp":      {"psp_metrics", pspColumns, pspSource.dims},
+	"game":     {"game_metrics", gameColumns, gameSource.dims},
+	"ws":       {"websocket_metrics", wsColumns, wsSource.dims},
+}
+
+// EventTables returns the table names accepted by ScanEvents
+func EventTables() []string {
+	names := make([]string, 0, len(eventTables))
+	for name := range eventTables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EventColumns returns the columns ScanEvents yields for table, in order
+func EventColumns(table string) ([]string, error) {
+	t, ok := eventTables[table]
+	if !ok {
+		return nil, fmt.Errorf("%w: event table %q, available: %s", ErrNotFound, table, strings.Join(EventTables(), ", "))
+	}
+	return t.columns, nil
+}
+
+// eventQuery validates q for a raw table and returns the table plus the filter
+// columns and values in a stable order
+func eventQuery(table string, q Query) (eventTable, []string, []any, error) {
+	t, ok := eventTables[table]
+	if !ok {
+		_, err := EventColumns(table)
+		return t, nil, nil, err
+	}
+	if !q.Start.Before(q.end()) {
+		return t, nil, nil, fmt.Errorf("%w: start must be before end", ErrInvalidArgument)
+	}
+	names := make([]string, 0, len(q.Filters))
+	for dim := range q.Filters {
+		names = append(names, dim)
+	}
+	sort.Strings(names)
+
+	var cols []string
+	var values []any
+	for _, dim := range names {
+		col, ok := t.dims[dim]
+		if !ok {
+			return t, nil, nil, fmt.Errorf("%w: cannot filter %s events by %q", ErrInvalidArgument, table, dim)
+		}
+		cols = append(cols, col)
+		values = append(values, q.Filters[dim])
+	}
+	return t, cols, values, nil
+}
+
+// ScanEvents streams the raw rows of table in the range and filters, oldest
+// first. Values are nil or one of time.Time, int32, int64, float64, bool or
+// string; JSON columns are passed as their text.
+func (p *Postgres) ScanEvents(ctx context.Context, table string, q Query, fn func(values []any) error) error {
+	t, filterCols, filterValues, err := eventQuery(table, q)
+	if err != nil {
+		return err
+	}
+
+	kinds, err := p.ArchiveColumns(ctx, t.table)
+	if err != nil {
+		return err
+	}
+	kindOf := make(map[string]string, len(kinds))
+	for _, c := range kinds {
+		kindOf[c.Name] = c.Kind
+	}
+	exprs := make([]string, len(t.columns))
+	for i, col := range t.columns {
+		kind, ok := kindOf[col]
+		if !ok {
+			kind = KindString
+		}
+		exprs[i] = pgx.Identifier{col}.Sanitize() + archiveCast[kind]
+	}
+
+	where := []string{"time >= $1", "time < $2"}
+	for i, col := range filterCols {
+		where = append(where, fmt.Sprintf("%s = $%d", col, i+3))
+	}
+	args := append([]any{q.Start, q.end()}, filterValues...)
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY time`,
+		strings.Join(exprs, ", "), t.table, strings.Join(where, " AND "))
+
+	// A slow client holds the statement open; its context ends it instead
+	return p.readWithoutStatementTimeout(ctx, func(conn *pgxpool.Conn) error {
+		rows, err := conn.Query(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("query %s: %w", t.table, err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			values, err := rows.Values()
+			if err != nil {
+				return fmt.Errorf("scan row: %w", err)
+			}
+			if err := fn(values); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+}
+
+// ScanEvents streams raw rows like the Postgres backend. Matching rows are
+// copied under the lock so a slow client does not block writes.
+func (m *Memory) ScanEvents(ctx context.Context, table string, q Query, fn func(values []any) error) error {
+	_, _, _, err := eventQuery(table, q)
+	if err != nil {
+		return err
+	}
+	p := queryPlan{start: q.Start, end: q.end()}
+
+	m.mu.RLock()
+	var rows [][]any
+	switch table {
+	case "frontend":
+		rows = scanRows(m.frontend, p, q.Filters, func(e model.EnrichedEvent) time.Time { return e.Time }, frontendDim, frontendRow)
+	case "api":
+		rows = scanRows(m.api, p, q.Filters, func(r model.APIMetric) time.Time { return r.Time }, apiDim, apiRow)
+	case "psp":
+		rows = scanRows(m.psp, p, q.Filters, func(r model.PSPMetric) time.Time { return r.Time }, pspDim, pspRow)
+	case "game":
+		rows = scanRows(m.game, p, q.Filters, func(r model.GameMetric) time.Time { return r.Time }, gameDim, gameRow)
+	case "ws":
+		rows = scanRows(m.ws, p, q.Filters, func(r model.WebSocketMetric) time.Time { return r.Time }, wsDim, wsRow)
+	}
+	m.mu.RUnlock()
+
+	for _, values := range rows {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanRows encodes the items in the plan's range that match filters, in time
+// order, with values normalized as ScanEvents documents
+func scanRows[T any](items []T, p queryPlan, filters map[string]string, at func(T) time.Time, dim func(T, string) string, row func(T) []interface{}) [][]any {
+	var matched []T
+	for _, it := range items {
+		if p.contains(at(it)) && matches(filters, func(d string) string { return dim(it, d) }) {
+			matched = append(matched, it)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return at(matched[i]).Before(at(matched[j])) })
+
+	rows := make([][]any, len(matched))
+	for i, it := range matched {
+		values := row(it)
+		for j, v := range values {
+			values[j] = plainValue(v)
+		}
+		rows[i] = values
+	}
+	return rows
+}
+
+// plainValue dereferences pointers and turns JSON into text, so memory rows
+// carry the same value types as rows read from Postgres
+func plainValue(v any) any {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case json.RawMessage:
+		if len(x) == 0 {
+			return nil
+		}
+		return string(x)
+	case int:
+		return int64(x)
+	case float32:
+		return float64(x)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		return plainValue(rv.Elem().Interface())
+	}
+	return v
+}
@@ -0,0 +1,424 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// EventLookups are the ID parameters of GetEvents; each is a UUID column of
+// the tables that have it
+var EventLookups = []string{"player_id", "session_id", "request_id", "transaction_id", "connection_id"}
+
+// Raw event page limits
+const (
+	DefaultEventLimit  = 100
+	MaxEventLimit      = 1000
+	maxMetadataFilters = 5
+	maxMetadataDepth   = 8
+)
+
+// EventQuery narrows and pages a raw event read
+type EventQuery struct {
+	Lookups   map[string]string // EventLookups name → UUID
+	Metadata  map[string]string // dot-separated metadata path → text value
+	Columns   []string          // projection in order; empty means all
+	Limit     int
+	Cursor    string        // NextCursor of the previous page
+	Ascending bool          // oldest first; newest first by default
+	Timeout   time.Duration // statement timeout (Postgres); 0 keeps the reader's
+}
+
+// EventPage is one page of raw events. Rows hold the projected columns in
+// order; metadata is embedded as JSON.
+type EventPage struct {
+	Table      string   `json:"table"`
+	Columns    []string `json:"columns"`
+	Rows       [][]any  `json:"rows"`
+	NextCursor string   `json:"next_cursor,omitempty"` // absent on the last page
+}
+
+// eventCursor is the position after the last row of a page: the time of that
+// row and how many rows at that time were returned so far. The next page reads
+// from that time on (the time index bounds it) and skips those rows, so rows
+// with identical content are all returned. Ties are ordered by a hash of the
+// row content in Postgres and by storage order in Memory.
+type eventCursor struct {
+	Time time.Time `json:"t"`
+	Skip int       `json:"n"`
+}
+
+// advance returns the cursor after rows with the given times, read from c on
+func (c *eventCursor) advance(times []time.Time) *eventCursor {
+	if len(times) == 0 {
+		return c
+	}
+	last := times[len(times)-1]
+	n := 0
+	for i := len(times) - 1; i >= 0 && times[i].Equal(last); i-- {
+		n++
+	}
+	// A page only reaches the cursor's time again if it is all at that time
+	if c != nil && c.Time.Equal(last) {
+		n += c.Skip
+	}
+	return &eventCursor{Time: last, Skip: n}
+}
+
+func (c eventCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeEventCursor(s string) (*eventCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var c eventCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil || c.Time.IsZero() || c.Skip < 1 {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidArgument)
+	}
+	return &c, nil
+}
+
+var uuidLookup = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// eventCondition is one equality on a column, or on a metadata path when path is set
+type eventCondition struct {
+	column string
+	path   []string
+	value  string
+}
+
+// metadataConditions validates dot-separated metadata path filters and
+// returns them in a stable order
+func metadataConditions(metadata map[string]string) ([]eventCondition, error) {
+	if len(metadata) > maxMetadataFilters {
+		return nil, fmt.Errorf("%w: at most %d metadata filters", ErrInvalidArgument, maxMetadataFilters)
+	}
+	paths := make([]string, 0, len(metadata))
+	for path := range metadata {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var conditions []eventCondition
+	for _, path := range paths {
+		keys := strings.Split(path, ".")
+		if len(keys) > maxMetadataDepth || slices.Contains(keys, "") {
+			return nil, fmt.Errorf("%w: invalid metadata path %q", ErrInvalidArgument, path)
+		}
+		conditions = append(conditions, eventCondition{column: "metadata", path: keys, value: metadata[path]})
+	}
+	return conditions, nil
+}
+
+// eventPlan is a validated GetEvents request
+type eventPlan struct {
+	name       string
+	table      eventTable
+	start, end time.Time
+	conditions []eventCondition
+	columns    []string
+	limit      int
+	cursor     *eventCursor
+	ascending  bool
+}
+
+// planEvents validates a raw event read against the table's columns
+func planEvents(table string, q Query, eq EventQuery) (eventPlan, error) {
+	t, filterCols, filterValues, err := eventQuery(table, q)
+	if err != nil {
+		return eventPlan{}, err
+	}
+	p := eventPlan{name: table, table: t, start: q.Start, end: q.end(), limit: eq.Limit, ascending: eq.Ascending}
+	if p.limit <= 0 {
+		p.limit = DefaultEventLimit
+	}
+	if p.limit > MaxEventLimit {
+		return p, fmt.Errorf("%w: limit must be at most %d", ErrInvalidArgument, MaxEventLimit)
+	}
+	if p.cursor, err = decodeEventCursor(eq.Cursor); err != nil {
+		return p, err
+	}
+
+	for i, col := range filterCols {
+		p.conditions = append(p.conditions, eventCondition{column: col, value: filterValues[i].(string)})
+	}
+	for _, name := range EventLookups {
+		v, ok := eq.Lookups[name]
+		if !ok {
+			continue
+		}
+		if !slices.Contains(t.columns, name) {
+			return p, fmt.Errorf("%w: %s events have no %s", ErrInvalidArgument, table, name)
+		}
+		if !uuidLookup.MatchString(v) {
+			return p, fmt.Errorf("%w: %s must be a UUID", ErrInvalidArgument, name)
+		}
+		p.conditions = append(p.conditions, eventCondition{column: name, value: strings.ToLower(v)})
+	}
+
+	metadata, err := metadataConditions(eq.Metadata)
+	if err != nil {
+		return p, err
+	}
+	p.conditions = append(p.conditions, metadata...)
+
+	p.columns = t.columns
+	if len(eq.Columns) > 0 {
+		p.columns = nil
+		for _, col := range eq.Columns {
+			if !slices.Contains(t.columns, col) {
+				return p, fmt.Errorf("%w: %s events have no column %q, available: %s", ErrInvalidArgument, table, col, strings.Join(t.columns, ", "))
+			}
+			if !slices.Contains(p.columns, col) {
+				p.columns = append(p.columns, col)
+			}
+		}
+	}
+	return p, nil
+}
+
+// page turns rows fetched one past the limit into an EventPage; each row ends
+// with its time, which is cut off
+func (p eventPlan) page(rows [][]any) (*EventPage, error) {
+	page := &EventPage{Table: p.name, Columns: p.columns, Rows: make([][]any, 0, min(len(rows), p.limit))}
+	more := len(rows) > p.limit
+	if more {
+		rows = rows[:p.limit]
+	}
+	times := make([]time.Time, len(rows))
+	for i, row := range rows {
+		t, ok := row[len(row)-1].(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("%s row %d has no time: %T", p.name, i, row[len(row)-1])
+		}
+		times[i] = t
+	}
+	if more {
+		page.NextCursor = p.cursor.advance(times).encode()
+	}
+	metadata := slices.Index(p.columns, "metadata")
+	for _, row := range rows {
+		row = row[:len(row)-1]
+		if metadata >= 0 {
+			if s, ok := row[metadata].(string); ok && json.Valid([]byte(s)) {
+				row[metadata] = json.RawMessage(s)
+			}
+		}
+		page.Rows = append(page.Rows, row)
+	}
+	return page, nil
+}
+
+// ============================================
+// POSTGRES
+// ============================================
+
+// GetEvents returns one page of raw rows, newest first unless ascending. It
+// runs read-only under eq.Timeout so an unselective filter cannot hold the
+// reader pool.
+func (p *Postgres) GetEvents(ctx context.Context, table string, q Query, eq EventQuery) (*EventPage, error) {
+	plan, err := planEvents(table, q, eq)
+	if err != nil {
+		return nil, err
+	}
+
+	kinds, err := p.ArchiveColumns(ctx, plan.table.table)
+	if err != nil {
+		return nil, err
+	}
+	kindOf := make(map[string]string, len(kinds))
+	for _, c := range kinds {
+		kindOf[c.Name] = c.Kind
+	}
+	query, args := plan.sql(kindOf)
+
+	var rows [][]any
+	err = p.readWithTimeout(ctx, eq.Timeout, func(tx pgx.Tx) error {
+		res, err := tx.Query(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("query %s: %w", plan.table.table, err)
+		}
+		defer res.Close()
+		for res.Next() {
+			values, err := res.Values()
+			if err != nil {
+				return fmt.Errorf("scan row: %w", err)
+			}
+			rows = append(rows, values)
+		}
+		return res.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan.page(rows)
+}
+
+// sql selects the plan's page, one row past the limit, with the time appended
+// to each row. kindOf maps columns to archive kinds for their casts.
+func (p eventPlan) sql(kindOf map[string]string) (string, []any) {
+	exprs := make([]string, 0, len(p.columns)+1)
+	for _, col := range p.columns {
+		kind, ok := kindOf[col]
+		if !ok {
+			kind = KindString
+		}
+		exprs = append(exprs, pgx.Identifier{col}.Sanitize()+archiveCast[kind])
+	}
+	exprs = append(exprs, "time")
+
+	where := []string{"time >= $1", "time < $2"}
+	args := []any{p.start, p.end}
+	for _, c := range p.conditions {
+		if c.path != nil {
+			args = append(args, c.path, c.value)
+			where = append(where, fmt.Sprintf("metadata #>> $%d = $%d", len(args)-1, len(args)))
+			continue
+		}
+		args = append(args, c.value)
+		where = append(where, fmt.Sprintf("%s = $%d", pgx.Identifier{c.column}.Sanitize(), len(args)))
+	}
+	cmp, dir := "<=", "DESC"
+	if p.ascending {
+		cmp, dir = ">=", "ASC"
+	}
+	offset := 0
+	if p.cursor != nil {
+		args = append(args, p.cursor.Time)
+		where = append(where, fmt.Sprintf("time %s $%d", cmp, len(args)))
+		offset = p.cursor.Skip
+	}
+	// Only rows at the cursor's time precede the ones to return, so the offset
+	// skips exactly those already returned
+	return fmt.Sprintf(`SELECT %s FROM %s x WHERE %s ORDER BY time %s, md5(x::text) %s LIMIT %d OFFSET %d`,
+		strings.Join(exprs, ", "), p.table.table, strings.Join(where, " AND "), dir, dir, p.limit+1, offset), args
+}
+
+// ============================================
+// MEMORY
+// ============================================
+
+// GetEvents pages raw rows like the Postgres backend; rows sharing a time
+// keep their storage order
+func (m *Memory) GetEvents(ctx context.Context, table string, q Query, eq EventQuery) (*EventPage, error) {
+	plan, err := planEvents(table, q, eq)
+	if err != nil {
+		return nil, err
+	}
+
+	var all [][]any
+	err = m.ScanEvents(ctx, table, Query{Start: plan.start, End: plan.end}, func(values []any) error {
+		all = append(all, values)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	columns := plan.table.columns
+	index := make(map[string]int, len(columns))
+	for i, col := range columns {
+		index[col] = i
+	}
+	type timed struct {
+		values []any
+		time   time.Time
+	}
+	var matched []timed
+	for _, values := range all {
+		if !memoryConditions(plan.conditions, index, values) {
+			continue
+		}
+		r := timed{values: values, time: values[index["time"]].(time.Time)}
+		if c := plan.cursor; c != nil && (plan.ascending && r.time.Before(c.Time) || !plan.ascending && r.time.After(c.Time)) {
+			continue
+		}
+		matched = append(matched, r)
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if plan.ascending {
+			return matched[i].time.Before(matched[j].time)
+		}
+		return matched[i].time.After(matched[j].time)
+	})
+	if plan.cursor != nil {
+		matched = matched[min(plan.cursor.Skip, len(matched)):]
+	}
+	if len(matched) > plan.limit+1 {
+		matched = matched[:plan.limit+1]
+	}
+
+	rows := make([][]any, len(matched))
+	for i, r := range matched {
+		row := make([]any, 0, len(plan.columns)+1)
+		for _, col := range plan.columns {
+			row = append(row, r.values[index[col]])
+		}
+		rows[i] = append(row, r.time)
+	}
+	return plan.page(rows)
+}
+
+// memoryConditions applies column and metadata path equalities to an encoded row
+func memoryConditions(conditions []eventCondition, index map[string]int, values []any) bool {
+	for _, c := range conditions {
+		v := values[index[c.column]]
+		if c.path == nil {
+			// Lookups are UUIDs, which Postgres compares case-insensitively
+			s, ok := v.(string)
+			if !ok || s != c.value && !(slices.Contains(EventLookups, c.column) && strings.EqualFold(s, c.value)) {
+				return false
+			}
+			continue
+		}
+		s, _ := v.(string)
+		var doc any
+		if json.Unmarshal([]byte(s), &doc) != nil {
+			return false
+		}
+		if text, ok := metadataAt(doc, c.path); !ok || text != c.value {
+			return false
+		}
+	}
+	return true
+}
+
+// metadataAt follows a key path into a decoded metadata document and renders
+// the value found there like #>>
+func metadataAt(doc any, path []string) (string, bool) {
+	for _, k := range path {
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		doc = obj[k]
+	}
+	return metadataText(doc)
+}
+
+// metadataText renders a JSON value the way Postgres #>> does
+func metadataText(v any) (string, bool) {
+	switch x := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return x, true
+	default:
+		b, err := json.Marshal(x)
+		return string(b), err == nil
+	}
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+func TestEventCursor(t *testing.T) {
+	c := eventCursor{Time: base.Add(90 * time.Second), Skip: 2}
+	got, err := decodeEventCursor(c.encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Time.Equal(c.Time) || got.Skip != c.Skip {
+		t.Errorf("round trip = %+v, want %+v", *got, c)
+	}
+	if got, err := decodeEventCursor(""); got != nil || err != nil {
+		t.Errorf("empty cursor = %v, %v; want nil, nil", got, err)
+	}
+	for _, s := range []string{
+		"not base64!",
+		"e30",                         // {}
+		eventCursor{Skip: 1}.encode(), // no time
+		eventCursor{Time: base}.encode(),
+	} {
+		if _, err := decodeEventCursor(s); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("decodeEventCursor(%q): err = %v, want ErrInvalidArgument", s, err)
+		}
+	}
+}
+
+func TestEventCursorAdvance(t *testing.T) {
+	at := func(minutes ...int) []time.Time {
+		var times []time.Time
+		for _, m := range minutes {
+			times = append(times, base.Add(time.Duration(m)*time.Minute))
+		}
+		return times
+	}
+	tests := []struct {
+		name  string
+		from  *eventCursor
+		times []time.Time
+		want  *eventCursor
+	}{
+		{"first page", nil, at(1, 2, 3), &eventCursor{Time: base.Add(3 * time.Minute), Skip: 1}},
+		{"page ends in a tie", nil, at(1, 3, 3), &eventCursor{Time: base.Add(3 * time.Minute), Skip: 2}},
+		{"tie continues from the cursor", &eventCursor{Time: base.Add(3 * time.Minute), Skip: 2}, at(3, 3), &eventCursor{Time: base.Add(3 * time.Minute), Skip: 4}},
+		{"tie ends", &eventCursor{Time: base.Add(3 * time.Minute), Skip: 2}, at(3, 4), &eventCursor{Time: base.Add(4 * time.Minute), Skip: 1}},
+		{"descending", nil, at(5, 4, 4), &eventCursor{Time: base.Add(4 * time.Minute), Skip: 2}},
+		{"no rows", &eventCursor{Time: base, Skip: 1}, nil, &eventCursor{Time: base, Skip: 1}},
+	}
+	for _, tt := range tests {
+		got := tt.from.advance(tt.times)
+		if !got.Time.Equal(tt.want.Time) || got.Skip != tt.want.Skip {
+			t.Errorf("%s: cursor = %+v, want %+v", tt.name, *got, *tt.want)
+		}
+	}
+}
+
+func TestEventsSQL(t *testing.T) {
+	q := Query{Start: base, End: base.Add(time.Hour), Filters: map[string]string{"service": "wallet"}}
+	cursor := eventCursor{Time: base.Add(10 * time.Minute), Skip: 3}
+	tests := []struct {
+		name string
+		eq   EventQuery
+		want []string
+	}{
+		{
+			name: "first page",
+			eq:   EventQuery{Columns: []string{"endpoint"}, Limit: 10},
+			want: []string{`SELECT "endpoint"::text, time FROM api_metrics x WHERE time >= $1 AND time < $2 AND "service_name" = $3 ORDER BY time DESC, md5(x::text) DESC LIMIT 11 OFFSET 0`},
+		},
+		{
+			name: "newest first",
+			eq:   EventQuery{Columns: []string{"endpoint"}, Limit: 10, Cursor: cursor.encode()},
+			want: []string{`AND time <= $4 ORDER BY time DESC, md5(x::text) DESC LIMIT 11 OFFSET 3`},
+		},
+		{
+			name: "oldest first",
+			eq:   EventQuery{Columns: []string{"endpoint"}, Limit: 10, Cursor: cursor.encode(), Ascending: true},
+			want: []string{`AND time >= $4 ORDER BY time ASC, md5(x::text) ASC LIMIT 11 OFFSET 3`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planEvents("api", q, tt.eq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sql, args := plan.sql(nil)
+			for _, s := range tt.want {
+				if !strings.Contains(sql, s) {
+					t.Errorf("query lacks %q:\n%s", s, sql)
+				}
+			}
+			if strings.Contains(sql, " OR ") {
+				t.Errorf("cursor condition is not a plain time range:\n%s", sql)
+			}
+			want := 3
+			if tt.eq.Cursor != "" {
+				want++
+			}
+			if len(args) != want {
+				t.Errorf("got %d args, want %d", len(args), want)
+			}
+		})
+	}
+}
+
+func TestMemoryGetEventsPages(t *testing.T) {
+	m := fixtureMemory(t)
+	ctx := context.Background()
+	// rows sharing a time, two of them identical, so pages end inside ties
+	err := m.InsertAPIMetrics(ctx, []model.APIMetric{
+		{Time: base.Add(10 * time.Minute), ServiceName: "wallet", Endpoint: "/withdraw", Method: "POST", DurationMS: 80, StatusCode: 200},
+		{Time: base.Add(10 * time.Minute), ServiceName: "wallet", Endpoint: "/balance", Method: "GET", DurationMS: 20, StatusCode: 200},
+		{Time: base.Add(10 * time.Minute), ServiceName: "wallet", Endpoint: "/balance", Method: "GET", DurationMS: 20, StatusCode: 200},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := Query{Start: base, End: base.Add(2 * time.Hour)}
+	columns := []string{"time", "endpoint", "method"}
+
+	all, err := m.GetEvents(ctx, "api", q, EventQuery{Columns: columns, Limit: MaxEventLimit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, row := range all.Rows {
+		want = append(want, fmt.Sprint(row...))
+	}
+	slices.Sort(want)
+	if len(want) != 7 {
+		t.Fatalf("fixture has %d rows, want 7", len(want))
+	}
+
+	for _, ascending := range []bool{true, false} {
+		t.Run(fmt.Sprintf("ascending=%v", ascending), func(t *testing.T) {
+			var seen []string
+			var times []time.Time
+			eq := EventQuery{Columns: columns, Limit: 2, Ascending: ascending}
+			for pages := 0; ; pages++ {
+				if pages > 7 {
+					t.Fatal("cursor does not advance")
+				}
+				page, err := m.GetEvents(ctx, "api", q, eq)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(page.Rows) > eq.Limit {
+					t.Fatalf("page has %d rows, limit %d", len(page.Rows), eq.Limit)
+				}
+				for _, row := range page.Rows {
+					if len(row) != len(eq.Columns) {
+						t.Fatalf("row %v has %d values, want %d", row, len(row), len(eq.Columns))
+					}
+					times = append(times, row[0].(time.Time))
+					seen = append(seen, fmt.Sprint(row...))
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				eq.Cursor = page.NextCursor
+			}
+
+			got := slices.Clone(seen)
+			slices.Sort(got)
+			if !slices.Equal(got, want) {
+				t.Errorf("paged through %v, want every row once: %v", seen, want)
+			}
+			ordered := slices.IsSortedFunc(times, func(a, b time.Time) int {
+				if ascending {
+					return a.Compare(b)
+				}
+				return b.Compare(a)
+			})
+			if !ordered {
+				t.Errorf("rows out of order: %v", times)
+			}
+		})
+	}
+
+	if _, err := m.GetEvents(ctx, "api", q, EventQuery{Cursor: "garbage"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("malformed cursor: err = %v, want ErrInvalidArgument", err)
+	}
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ExportAuditRow records one data export
+type ExportAuditRow struct {
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	Resource   string    `json:"resource"`
+	Format     string    `json:"format"`
+	Params     string    `json:"params"`
+	Rows       int64     `json:"rows"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+	Error      *string   `json:"error"`
+}
+
+// maxMemoryExportAudit bounds the audit rows kept by the memory backend
+const maxMemoryExportAudit = 1000
+
+// RecordExport appends an export to the audit trail
+func (p *Postgres) RecordExport(ctx context.Context, row ExportAuditRow) error {
+	_, err := p.writer.Exec(ctx, `
+		INSERT INTO export_audit (time, actor, resource, format, params, row_count, byte_count, duration_ms, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, row.Time, row.Actor, row.Resource, row.Format, row.Params, row.Rows, row.Bytes, row.DurationMS, row.Error)
+	if err != nil {
+		return fmt.Errorf("insert export_audit: %w", err)
+	}
+	return nil
+}
+
+// GetExportAudit returns the most recent exports, optionally of one actor
+func (p *Postgres) GetExportAudit(ctx context.Context, actor string, limit int) ([]ExportAuditRow, error) {
+	rows, err := p.reader.Query(ctx, `
+		SELECT time, actor, resource, format, params, row_count, byte_count, duration_ms, error
+		FROM export_audit
+		WHERE $1 = '' OR actor = $1
+		ORDER BY time DESC
+		LIMIT $2
+	`, actor, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query export_audit: %w", err)
+	}
+	defer rows.Close()
+
+	var result []ExportAuditRow
+	for rows.Next() {
+		var r ExportAuditRow
+		if err := rows.Scan(&r.Time, &r.Actor, &r.Resource, &r.Format, &r.Params, &r.Rows, &r.Bytes, &r.DurationMS, &r.Error); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		result = append(result, r)
+	}
+
+	return result, rows.Err()
+}
+
+func (m *Memory) RecordExport(ctx context.Context, row ExportAuditRow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.exports = append(m.exports, row)
+	if len(m.exports) > maxMemoryExportAudit {
+		m.exports = m.exports[len(m.exports)-maxMemoryExportAudit:]
+	}
+	return nil
+}
+
+func (m *Memory) GetExportAudit(ctx context.Context, actor string, limit int) ([]ExportAuditRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []ExportAuditRow
+	for i := len(m.exports) - 1; i >= 0 && len(result) < limit; i-- {
+		if actor == "" || m.exports[i].Actor == actor {
+			result = append(result, m.exports[i])
+		}
+	}
+	return result, nil
+}
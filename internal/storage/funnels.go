@@ -0,0 +1,701 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Funnel is a stored conversion funnel: ordered steps that must all happen
+// within Window of the first
+type Funnel struct {
+	ID            int64        `json:"id"`
+	Name          string       `json:"name"`
+	Description   string       `json:"description"`
+	Steps         []FunnelStep `json:"steps"`
+	WindowSeconds int64        `json:"window_seconds"`
+	CreatedBy     string       `json:"created_by"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// FunnelStep matches frontend events or PSP transactions. Every set field
+// must match; metadata paths are dot-separated and compared as text.
+type FunnelStep struct {
+	Name       string            `json:"name"`
+	Source     string            `json:"source"`                // frontend (default) or psp
+	EventType  string            `json:"event_type,omitempty"`  // frontend, e.g. interaction
+	MetricName string            `json:"metric_name,omitempty"` // frontend, e.g. deposit_button_click
+	PagePath   string            `json:"page_path,omitempty"`   // frontend
+	Operation  string            `json:"operation,omitempty"`   // psp, e.g. deposit
+	PSPName    string            `json:"psp_name,omitempty"`    // psp
+	Success    *bool             `json:"success,omitempty"`     // psp
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// Funnel limits
+const (
+	maxFunnelSteps  = 10
+	maxFunnelWindow = 30 * 24 * time.Hour
+	// maxFunnelEvents bounds the matching rows one report loads
+	maxFunnelEvents = 1_000_000
+)
+
+// FunnelBreakdowns are the dimensions a funnel report can be segmented by
+var FunnelBreakdowns = []string{"device", "country", "psp"}
+
+// FunnelOptions selects how a funnel report counts
+type FunnelOptions struct {
+	By        string // session (default) or player
+	Breakdown string // one of FunnelBreakdowns, or empty
+}
+
+// FunnelReport is a funnel computed over a range: step 1 happens in the
+// range, later steps within the window after it
+type FunnelReport struct {
+	FunnelID  int64              `json:"funnel_id"`
+	Name      string             `json:"name"`
+	By        string             `json:"by"`
+	Start     time.Time          `json:"start"`
+	End       time.Time          `json:"end"`
+	Window    string             `json:"window"`
+	Steps     []FunnelStepResult `json:"steps"`
+	Breakdown string             `json:"breakdown,omitempty"`
+	Segments  []FunnelSegment    `json:"segments,omitempty"` // largest first
+}
+
+// FunnelStepResult counts the sessions or players that reached a step
+type FunnelStepResult struct {
+	Step           int     `json:"step"`
+	Name           string  `json:"name"`
+	Count          int64   `json:"count"`
+	Conversion     float64 `json:"conversion"`      // % of step 1
+	StepConversion float64 `json:"step_conversion"` // % of the previous step
+	DropOff        int64   `json:"drop_off"`        // lost since the previous step
+}
+
+// FunnelSegment is the funnel for one breakdown value
+type FunnelSegment struct {
+	Value string             `json:"value"`
+	Steps []FunnelStepResult `json:"steps"`
+}
+
+// Validate checks a definition before it is stored
+func (f *Funnel) Validate() error {
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" || len(f.Name) > 100 {
+		return fmt.Errorf("%w: name must be 1 to 100 characters", ErrInvalidArgument)
+	}
+	if len(f.Steps) < 2 || len(f.Steps) > maxFunnelSteps {
+		return fmt.Errorf("%w: a funnel has 2 to %d steps", ErrInvalidArgument, maxFunnelSteps)
+	}
+	if w := time.Duration(f.WindowSeconds) * time.Second; w <= 0 || w > maxFunnelWindow {
+		return fmt.Errorf("%w: window_seconds must be between 1 and %d", ErrInvalidArgument, int64(maxFunnelWindow.Seconds()))
+	}
+	for i := range f.Steps {
+		s := &f.Steps[i]
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("Step %d", i+1)
+		}
+		if s.Source == "" {
+			s.Source = "frontend"
+		}
+		for path := range s.Metadata {
+			keys := strings.Split(path, ".")
+			if len(keys) > maxMetadataDepth || slicesContainEmpty(keys) {
+				return fmt.Errorf("%w: step %d: invalid metadata path %q", ErrInvalidArgument, i+1, path)
+			}
+		}
+		switch s.Source {
+		case "frontend":
+			if s.Operation != "" || s.PSPName != "" || s.Success != nil {
+				return fmt.Errorf("%w: step %d: operation, psp_name and success apply to psp steps", ErrInvalidArgument, i+1)
+			}
+			if s.EventType == "" && s.MetricName == "" && s.PagePath == "" && len(s.Metadata) == 0 {
+				return fmt.Errorf("%w: step %d matches every frontend event", ErrInvalidArgument, i+1)
+			}
+		case "psp":
+			if s.EventType != "" || s.MetricName != "" || s.PagePath != "" {
+				return fmt.Errorf("%w: step %d: event_type, metric_name and page_path apply to frontend steps", ErrInvalidArgument, i+1)
+			}
+			if s.Operation == "" && s.PSPName == "" && s.Success == nil && len(s.Metadata) == 0 {
+				return fmt.Errorf("%w: step %d matches every PSP transaction", ErrInvalidArgument, i+1)
+			}
+		default:
+			return fmt.Errorf("%w: step %d: source must be frontend or psp", ErrInvalidArgument, i+1)
+		}
+	}
+	return nil
+}
+
+func slicesContainEmpty(keys []string) bool {
+	for _, k := range keys {
+		if k == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPSPSteps reports whether any step reads PSP transactions
+func (f *Funnel) hasPSPSteps() bool {
+	for _, s := range f.Steps {
+		if s.Source == "psp" {
+			return true
+		}
+	}
+	return false
+}
+
+// funnelOptions validates opts, filling in defaults
+func funnelOptions(opts *FunnelOptions) error {
+	switch opts.By {
+	case "":
+		opts.By = "session"
+	case "session", "player":
+	default:
+		return fmt.Errorf("%w: by must be session or player", ErrInvalidArgument)
+	}
+	switch opts.Breakdown {
+	case "", "device", "country", "psp":
+	default:
+		return fmt.Errorf("%w: breakdown must be one of %s", ErrInvalidArgument, strings.Join(FunnelBreakdowns, ", "))
+	}
+	return nil
+}
+
+// funnelEvent is a row matching at least one step
+type funnelEvent struct {
+	time    time.Time
+	session string // empty for PSP rows
+	player  string
+	device  string
+	country string
+	psp     string
+	steps   []bool // which steps the row matches
+}
+
+// computeFunnel finds, per session or player, the furthest step reached by a
+// sequence starting in the range and finishing within the window, then counts
+func computeFunnel(f Funnel, q Query, opts FunnelOptions, events []funnelEvent) *FunnelReport {
+	window := time.Duration(f.WindowSeconds) * time.Second
+	end := q.end()
+
+	// Entities with their events in time order. PSP rows have no session, so
+	// in session mode they belong to every session of their player.
+	entities := make(map[string][]funnelEvent)
+	var psp []funnelEvent
+	for _, e := range events {
+		switch {
+		case opts.By == "player" && e.player != "":
+			entities[e.player] = append(entities[e.player], e)
+		case opts.By == "session" && e.session != "":
+			entities[e.session] = append(entities[e.session], e)
+		case opts.By == "session" && e.player != "":
+			psp = append(psp, e)
+		}
+	}
+	if len(psp) > 0 {
+		byPlayer := make(map[string][]funnelEvent)
+		for _, e := range psp {
+			byPlayer[e.player] = append(byPlayer[e.player], e)
+		}
+		for key, evs := range entities {
+			for _, e := range evs {
+				if e.player != "" {
+					entities[key] = append(evs, byPlayer[e.player]...)
+					break
+				}
+			}
+		}
+	}
+
+	n := len(f.Steps)
+	total := make([]int64, n)
+	segments := make(map[string][]int64)
+	for _, evs := range entities {
+		sort.SliceStable(evs, func(i, j int) bool { return evs[i].time.Before(evs[j].time) })
+		depth, path := deepestPath(evs, n, q.Start, end, window)
+		if depth == 0 {
+			continue
+		}
+		for k := 0; k < depth; k++ {
+			total[k]++
+		}
+		if opts.Breakdown != "" {
+			value := funnelSegment(opts.Breakdown, evs, path)
+			if segments[value] == nil {
+				segments[value] = make([]int64, n)
+			}
+			for k := 0; k < depth; k++ {
+				segments[value][k]++
+			}
+		}
+	}
+
+	report := &FunnelReport{
+		FunnelID:  f.ID,
+		Name:      f.Name,
+		By:        opts.By,
+		Start:     q.Start,
+		End:       end,
+		Window:    window.String(),
+		Steps:     funnelSteps(f, total),
+		Breakdown: opts.Breakdown,
+	}
+	for value, counts := range segments {
+		report.Segments = append(report.Segments, FunnelSegment{Value: value, Steps: funnelSteps(f, counts)})
+	}
+	sort.Slice(report.Segments, func(i, j int) bool {
+		a, b := report.Segments[i], report.Segments[j]
+		if a.Steps[0].Count != b.Steps[0].Count {
+			return a.Steps[0].Count > b.Steps[0].Count
+		}
+		return a.Value < b.Value
+	})
+	return report
+}
+
+// deepestPath tries every step 1 event in the range and follows the earliest
+// match of each later step within the window. It returns the most steps
+// reached and the events that reached them.
+func deepestPath(evs []funnelEvent, steps int, start, end time.Time, window time.Duration) (int, []int) {
+	best, bestPath := 0, []int(nil)
+	for i, e := range evs {
+		if !e.steps[0] || e.time.Before(start) || !e.time.Before(end) {
+			continue
+		}
+		path := []int{i}
+		deadline := e.time.Add(window)
+		for j := i + 1; j < len(evs) && len(path) < steps; j++ {
+			if evs[j].time.After(deadline) {
+				break
+			}
+			if evs[j].steps[len(path)] {
+				path = append(path, j)
+			}
+		}
+		if len(path) > best {
+			best, bestPath = len(path), path
+		}
+		if best == steps {
+			break
+		}
+	}
+	return best, bestPath
+}
+
+// funnelSegment is the breakdown value of an entity: device and country of
+// its first frontend event on the path (or at all), the PSP of its first PSP step
+func funnelSegment(breakdown string, evs []funnelEvent, path []int) string {
+	pick := func(value func(funnelEvent) string) string {
+		for _, i := range path {
+			if v := value(evs[i]); v != "" {
+				return v
+			}
+		}
+		if breakdown != "psp" {
+			for _, e := range evs {
+				if v := value(e); v != "" {
+					return v
+				}
+			}
+		}
+		return ""
+	}
+	var v string
+	switch breakdown {
+	case "device":
+		v = pick(func(e funnelEvent) string { return e.device })
+	case "country":
+		v = pick(func(e funnelEvent) string { return e.country })
+	case "psp":
+		v = pick(func(e funnelEvent) string { return e.psp })
+		if v == "" {
+			return "none"
+		}
+	}
+	if v == "" {
+		return "unknown"
+	}
+	return v
+}
+
+// funnelSteps turns per-step counts into conversion and drop-off
+func funnelSteps(f Funnel, counts []int64) []FunnelStepResult {
+	result := make([]FunnelStepResult, len(counts))
+	for k, c := range counts {
+		r := FunnelStepResult{Step: k + 1, Name: f.Steps[k].Name, Count: c, Conversion: percentOf(c, counts[0]), StepConversion: 100}
+		if k > 0 {
+			r.StepConversion = percentOf(c, counts[k-1])
+			r.DropOff = counts[k-1] - c
+		}
+		if counts[0] == 0 {
+			r.Conversion, r.StepConversion = 0, 0
+		}
+		result[k] = r
+	}
+	return result
+}
+
+// ============================================
+// POSTGRES
+// ============================================
+
+// ListFunnels returns every stored funnel by name
+func (p *Postgres) ListFunnels(ctx context.Context) ([]Funnel, error) {
+	rows, err := p.reader.Query(ctx, `
+		SELECT id, name, description, steps, window_seconds, created_by, created_at, updated_at
+		FROM funnels ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("query funnels: %w", err)
+	}
+	defer rows.Close()
+
+	result := []Funnel{}
+	for rows.Next() {
+		f, err := scanFunnel(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *f)
+	}
+	return result, rows.Err()
+}
+
+// GetFunnel returns one funnel, ErrNotFound if it does not exist
+func (p *Postgres) GetFunnel(ctx context.Context, id int64) (*Funnel, error) {
+	row := p.reader.QueryRow(ctx, `
+		SELECT id, name, description, steps, window_seconds, created_by, created_at, updated_at
+		FROM funnels WHERE id = $1
+	`, id)
+	f, err := scanFunnel(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: funnel %d", ErrNotFound, id)
+	}
+	return f, err
+}
+
+func scanFunnel(row pgx.Row) (*Funnel, error) {
+	var f Funnel
+	var steps []byte
+	if err := row.Scan(&f.ID, &f.Name, &f.Description, &steps, &f.WindowSeconds, &f.CreatedBy, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan funnel: %w", err)
+	}
+	if err := json.Unmarshal(steps, &f.Steps); err != nil {
+		return nil, fmt.Errorf("decode funnel %d steps: %w", f.ID, err)
+	}
+	return &f, nil
+}
+
+// SaveFunnel creates f when its ID is zero and replaces it otherwise, filling
+// in the ID and timestamps
+func (p *Postgres) SaveFunnel(ctx context.Context, f *Funnel) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	steps, err := json.Marshal(f.Steps)
+	if err != nil {
+		return fmt.Errorf("encode funnel steps: %w", err)
+	}
+
+	var row pgx.Row
+	if f.ID == 0 {
+		row = p.writer.QueryRow(ctx, `
+			INSERT INTO funnels (name, description, steps, window_seconds, created_by)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_by, created_at, updated_at
+		`, f.Name, f.Description, steps, f.WindowSeconds, f.CreatedBy)
+	} else {
+		row = p.writer.QueryRow(ctx, `
+			UPDATE funnels SET name = $2, description = $3, steps = $4, window_seconds = $5, updated_at = NOW()
+			WHERE id = $1
+			RETURNING id, created_by, created_at, updated_at
+		`, f.ID, f.Name, f.Description, steps, f.WindowSeconds)
+	}
+	err = row.Scan(&f.ID, &f.CreatedBy, &f.CreatedAt, &f.UpdatedAt)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return fmt.Errorf("%w: funnel %d", ErrNotFound, f.ID)
+	case errors.As(err, &pgErr) && pgErr.Code == "23505":
+		return fmt.Errorf("%w: a funnel named %q exists", ErrInvalidArgument, f.Name)
+	case err != nil:
+		return fmt.Errorf("save funnel: %w", err)
+	}
+	return nil
+}
+
+// DeleteFunnel removes a funnel, ErrNotFound if it does not exist
+func (p *Postgres) DeleteFunnel(ctx context.Context, id int64) error {
+	tag, err := p.writer.Exec(ctx, `DELETE FROM funnels WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete funnel: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: funnel %d", ErrNotFound, id)
+	}
+	return nil
+}
+
+// GetFunnelReport loads the frontend and PSP rows matching any step, with the
+// step predicates evaluated in SQL, and computes the funnel
+func (p *Postgres) GetFunnelReport(ctx context.Context, f Funnel, q Query, opts FunnelOptions) (*FunnelReport, error) {
+	if err := funnelOptions(&opts); err != nil {
+		return nil, err
+	}
+	if !q.Start.Before(q.end()) {
+		return nil, fmt.Errorf("%w: start must be before end", ErrInvalidArgument)
+	}
+	// Later steps may happen up to a window after the range
+	start, end := q.Start, q.end().Add(time.Duration(f.WindowSeconds)*time.Second)
+	sources := []string{"frontend"}
+	if f.hasPSPSteps() {
+		sources = append(sources, "psp")
+	}
+
+	var events []funnelEvent
+	for _, source := range sources {
+		query, args := funnelQuery(f, source, opts.By, start, end)
+		rows, err := p.reader.Query(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("query funnel events: %w", err)
+		}
+		for rows.Next() {
+			var e funnelEvent
+			if err := rows.Scan(&e.time, &e.session, &e.player, &e.device, &e.country, &e.psp, &e.steps); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("scan row: %w", err)
+			}
+			events = append(events, e)
+			if len(events) > maxFunnelEvents {
+				rows.Close()
+				return nil, fmt.Errorf("%w: more than %d matching events, narrow the range", ErrInvalidArgument, maxFunnelEvents)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("query funnel events: %w", err)
+		}
+	}
+
+	return computeFunnel(f, q, opts, events), nil
+}
+
+// funnelQuery selects the rows of one source matching any step of f in
+// [start, end), with a boolean per step. Each query numbers its own arguments:
+// $1 start, $2 end, then the step values.
+func funnelQuery(f Funnel, source, by string, start, end time.Time) (string, []any) {
+	args := []any{start, end}
+	conds := make([]string, len(f.Steps))
+	for i, s := range f.Steps {
+		if s.Source != source {
+			conds[i] = "false"
+			continue
+		}
+		var where []string
+		eq := func(col string, v any) {
+			args = append(args, v)
+			where = append(where, fmt.Sprintf("%s = $%d", col, len(args)))
+		}
+		if s.EventType != "" {
+			eq("event_type", s.EventType)
+		}
+		if s.MetricName != "" {
+			eq("metric_name", s.MetricName)
+		}
+		if s.PagePath != "" {
+			eq("page_path", s.PagePath)
+		}
+		if s.Operation != "" {
+			eq("operation", s.Operation)
+		}
+		if s.PSPName != "" {
+			eq("psp_name", s.PSPName)
+		}
+		if s.Success != nil {
+			eq("success", *s.Success)
+		}
+		paths := make([]string, 0, len(s.Metadata))
+		for path := range s.Metadata {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			args = append(args, strings.Split(path, "."), s.Metadata[path])
+			where = append(where, fmt.Sprintf("metadata #>> $%d = $%d", len(args)-1, len(args)))
+		}
+		conds[i] = "(" + strings.Join(where, " AND ") + ")"
+	}
+
+	if source == "psp" {
+		return fmt.Sprintf(`
+			SELECT time, '', player_id::text, '', '', psp_name, ARRAY[%s]
+			FROM psp_metrics
+			WHERE time >= $1 AND time < $2 AND player_id IS NOT NULL AND (%s)
+		`, strings.Join(conds, ", "), strings.Join(conds, " OR ")), args
+	}
+	entity := "session_id IS NOT NULL"
+	if by == "player" {
+		entity = "player_id IS NOT NULL"
+	}
+	return fmt.Sprintf(`
+		SELECT time, session_id::text, COALESCE(player_id::text, ''), COALESCE(device_type, ''), COALESCE(country, ''), '',
+		       ARRAY[%s]
+		FROM frontend_metrics
+		WHERE time >= $1 AND time < $2 AND %s AND (%s)
+	`, strings.Join(conds, ", "), entity, strings.Join(conds, " OR ")), args
+}
+
+// ============================================
+// MEMORY
+// ============================================
+
+func (m *Memory) ListFunnels(ctx context.Context) ([]Funnel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := append([]Funnel{}, m.funnels...)
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (m *Memory) GetFunnel(ctx context.Context, id int64) (*Funnel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, f := range m.funnels {
+		if f.ID == id {
+			return &f, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: funnel %d", ErrNotFound, id)
+}
+
+func (m *Memory) SaveFunnel(ctx context.Context, f *Funnel) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	index := -1
+	for i, other := range m.funnels {
+		if other.Name == f.Name && other.ID != f.ID {
+			return fmt.Errorf("%w: a funnel named %q exists", ErrInvalidArgument, f.Name)
+		}
+		if other.ID == f.ID {
+			index = i
+		}
+	}
+	now := time.Now()
+	if f.ID == 0 {
+		m.nextFunnelID++
+		f.ID, f.CreatedAt, f.UpdatedAt = m.nextFunnelID, now, now
+		m.funnels = append(m.funnels, *f)
+		return nil
+	}
+	if index < 0 {
+		return fmt.Errorf("%w: funnel %d", ErrNotFound, f.ID)
+	}
+	f.CreatedBy, f.CreatedAt, f.UpdatedAt = m.funnels[index].CreatedBy, m.funnels[index].CreatedAt, now
+	m.funnels[index] = *f
+	return nil
+}
+
+func (m *Memory) DeleteFunnel(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, f := range m.funnels {
+		if f.ID == id {
+			m.funnels = append(m.funnels[:i], m.funnels[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: funnel %d", ErrNotFound, id)
+}
+
+// GetFunnelReport matches the steps against the stored rows like the SQL does
+func (m *Memory) GetFunnelReport(ctx context.Context, f Funnel, q Query, opts FunnelOptions) (*FunnelReport, error) {
+	if err := funnelOptions(&opts); err != nil {
+		return nil, err
+	}
+	if !q.Start.Before(q.end()) {
+		return nil, fmt.Errorf("%w: start must be before end", ErrInvalidArgument)
+	}
+	p := queryPlan{start: q.Start, end: q.end().Add(time.Duration(f.WindowSeconds) * time.Second)}
+
+	m.mu.RLock()
+	var events []funnelEvent
+	for _, e := range m.frontend {
+		if !p.contains(e.Time) || (opts.By == "player" && e.PlayerID == nil) {
+			continue
+		}
+		if steps, ok := matchSteps(f, "frontend", func(s FunnelStep) bool {
+			return (s.EventType == "" || s.EventType == e.EventType) &&
+				(s.MetricName == "" || s.MetricName == deref(e.MetricName)) &&
+				(s.PagePath == "" || s.PagePath == e.PagePath) &&
+				metadataMatches(e.Metadata, s.Metadata)
+		}); ok {
+			events = append(events, funnelEvent{time: e.Time, session: e.SessionID, player: deref(e.PlayerID),
+				device: e.DeviceType, country: e.Country, steps: steps})
+		}
+	}
+	for _, r := range m.psp {
+		if !p.contains(r.Time) || r.PlayerID == nil {
+			continue
+		}
+		if steps, ok := matchSteps(f, "psp", func(s FunnelStep) bool {
+			return (s.Operation == "" || s.Operation == r.Operation) &&
+				(s.PSPName == "" || s.PSPName == r.PSPName) &&
+				(s.Success == nil || *s.Success == r.Success) &&
+				metadataMatches(r.Metadata, s.Metadata)
+		}); ok {
+			events = append(events, funnelEvent{time: r.Time, player: *r.PlayerID, psp: r.PSPName, steps: steps})
+		}
+	}
+	m.mu.RUnlock()
+
+	return computeFunnel(f, q, opts, events), nil
+}
+
+// matchSteps evaluates the steps of one source against a row
+func matchSteps(f Funnel, source string, match func(FunnelStep) bool) ([]bool, bool) {
+	steps := make([]bool, len(f.Steps))
+	any := false
+	for i, s := range f.Steps {
+		if s.Source == source && match(s) {
+			steps[i], any = true, true
+		}
+	}
+	return steps, any
+}
+
+// metadataMatches applies dot-separated path predicates to a metadata document
+func metadataMatches(raw json.RawMessage, predicates map[string]string) bool {
+	if len(predicates) == 0 {
+		return true
+	}
+	var doc any
+	if json.Unmarshal(raw, &doc) != nil {
+		return false
+	}
+	for path, want := range predicates {
+		if text, ok := metadataAt(doc, strings.Split(path, ".")); !ok || text != want {
+			return false
+		}
+	}
+	return true
+}
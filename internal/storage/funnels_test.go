@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFunnelValidate(t *testing.T) {
+	page := FunnelStep{EventType: "page_view", PagePath: "/cashier"}
+	deposit := FunnelStep{Source: "psp", Operation: "deposit"}
+
+	tests := []struct {
+		name    string
+		funnel  Funnel
+		invalid bool
+	}{
+		{"valid", Funnel{Name: " Deposit ", Steps: []FunnelStep{page, deposit}, WindowSeconds: 3600}, false},
+		{"blank name", Funnel{Name: "  ", Steps: []FunnelStep{page, deposit}, WindowSeconds: 3600}, true},
+		{"one step", Funnel{Name: "f", Steps: []FunnelStep{page}, WindowSeconds: 3600}, true},
+		{"too many steps", Funnel{Name: "f", Steps: make([]FunnelStep, maxFunnelSteps+1), WindowSeconds: 3600}, true},
+		{"no window", Funnel{Name: "f", Steps: []FunnelStep{page, deposit}}, true},
+		{"window too long", Funnel{Name: "f", Steps: []FunnelStep{page, deposit}, WindowSeconds: int64(maxFunnelWindow.Seconds()) + 1}, true},
+		{"unknown source", Funnel{Name: "f", Steps: []FunnelStep{page, {Source: "ws", EventType: "x"}}, WindowSeconds: 3600}, true},
+		{"frontend step with psp field", Funnel{Name: "f", Steps: []FunnelStep{page, {EventType: "x", PSPName: "PIX"}}, WindowSeconds: 3600}, true},
+		{"psp step with frontend field", Funnel{Name: "f", Steps: []FunnelStep{page, {Source: "psp", PagePath: "/"}}, WindowSeconds: 3600}, true},
+		{"frontend step matching everything", Funnel{Name: "f", Steps: []FunnelStep{page, {}}, WindowSeconds: 3600}, true},
+		{"psp step matching everything", Funnel{Name: "f", Steps: []FunnelStep{page, {Source: "psp"}}, WindowSeconds: 3600}, true},
+		{"metadata only", Funnel{Name: "f", Steps: []FunnelStep{page, {Metadata: map[string]string{"cta.id": "hero"}}}, WindowSeconds: 3600}, false},
+		{"empty metadata key", Funnel{Name: "f", Steps: []FunnelStep{page, {Metadata: map[string]string{"cta..id": "x"}}}, WindowSeconds: 3600}, true},
+		{"metadata path too deep", Funnel{Name: "f", Steps: []FunnelStep{page, {Metadata: map[string]string{strings.Repeat("a.", maxMetadataDepth) + "a": "x"}}}, WindowSeconds: 3600}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.funnel.Validate()
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidArgument) {
+					t.Errorf("err = %v, want ErrInvalidArgument", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	f := Funnel{Name: " Deposit ", Steps: []FunnelStep{page, deposit}, WindowSeconds: 3600}
+	if err := f.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "Deposit" || f.Steps[0].Name != "Step 1" || f.Steps[0].Source != "frontend" || f.Steps[1].Source != "psp" {
+		t.Errorf("defaults not filled in: %+v", f)
+	}
+}
+
+func TestDeepestPath(t *testing.T) {
+	at := func(minutes int, steps ...bool) funnelEvent {
+		return funnelEvent{time: base.Add(time.Duration(minutes) * time.Minute), steps: steps}
+	}
+	end := base.Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		evs   []funnelEvent
+		depth int
+		path  []int
+	}{
+		{"in order", []funnelEvent{at(0, true, false, false), at(5, false, true, false), at(10, false, false, true)}, 3, []int{0, 1, 2}},
+		{"out of order", []funnelEvent{at(0, false, true, false), at(5, true, false, false)}, 1, []int{1}},
+		{"earliest match of each step", []funnelEvent{at(0, true, false), at(5, false, true), at(6, false, true)}, 2, []int{0, 1}},
+		{"beyond the window", []funnelEvent{at(0, true, false), at(31, false, true)}, 1, []int{0}},
+		{"later start reaches further", []funnelEvent{at(0, true, false), at(40, true, false), at(60, false, true)}, 2, []int{1, 2}},
+		{"start before the range", []funnelEvent{at(-5, true, false), at(1, false, true)}, 0, nil},
+		{"start at the range end", []funnelEvent{at(60, true, false), at(61, false, true)}, 0, nil},
+		{"one event matching several steps", []funnelEvent{at(0, true, true)}, 1, []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			depth, path := deepestPath(tt.evs, len(tt.evs[0].steps), base, end, 30*time.Minute)
+			if depth != tt.depth || len(path) != len(tt.path) {
+				t.Fatalf("depth %d path %v, want %d %v", depth, path, tt.depth, tt.path)
+			}
+			for i := range path {
+				if path[i] != tt.path[i] {
+					t.Errorf("path = %v, want %v", path, tt.path)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeFunnel(t *testing.T) {
+	f := Funnel{
+		ID:   7,
+		Name: "Deposit",
+		Steps: []FunnelStep{
+			{Name: "Cashier", EventType: "page_view", PagePath: "/cashier"},
+			{Name: "Click", MetricName: "deposit_click"},
+			{Name: "Paid", Source: "psp", Operation: "deposit"},
+		},
+		WindowSeconds: 3600,
+	}
+	frontend := func(session, player, device, country string, minutes int, steps ...bool) funnelEvent {
+		return funnelEvent{time: base.Add(time.Duration(minutes) * time.Minute), session: session, player: player, device: device, country: country, steps: steps}
+	}
+	psp := func(player, name string, minutes int) funnelEvent {
+		return funnelEvent{time: base.Add(time.Duration(minutes) * time.Minute), player: player, psp: name, steps: []bool{false, false, true}}
+	}
+	events := []funnelEvent{
+		// s1 pays through PIX after clicking
+		frontend("s1", "p1", "mobile", "BR", 0, true, false, false),
+		frontend("s1", "p1", "mobile", "BR", 5, false, true, false),
+		psp("p1", "PIX", 10),
+		// s2 clicks but pays after the window
+		frontend("s2", "p2", "desktop", "DE", 30, true, false, false),
+		frontend("s2", "p2", "desktop", "DE", 40, false, true, false),
+		psp("p2", "Stripe", 120),
+		// s3 is anonymous and stops at the cashier
+		frontend("s3", "", "mobile", "", 60, true, false, false),
+		// s4 of p1 starts after the range
+		frontend("s4", "p1", "desktop", "BR", 180, true, false, false),
+		// p3 pays without a session
+		psp("p3", "PIX", 15),
+	}
+	q := Query{Start: base, End: base.Add(2 * time.Hour)}
+
+	tests := []struct {
+		name     string
+		opts     FunnelOptions
+		counts   []int64
+		segments map[string][]int64
+		order    []string
+	}{
+		{name: "sessions", opts: FunnelOptions{By: "session"}, counts: []int64{3, 2, 1}},
+		{name: "players", opts: FunnelOptions{By: "player"}, counts: []int64{2, 2, 1}},
+		{
+			name:     "by device",
+			opts:     FunnelOptions{By: "session", Breakdown: "device"},
+			counts:   []int64{3, 2, 1},
+			segments: map[string][]int64{"mobile": {2, 1, 1}, "desktop": {1, 1, 0}},
+			order:    []string{"mobile", "desktop"},
+		},
+		{
+			name:     "by country",
+			opts:     FunnelOptions{By: "session", Breakdown: "country"},
+			counts:   []int64{3, 2, 1},
+			segments: map[string][]int64{"BR": {1, 1, 1}, "DE": {1, 1, 0}, "unknown": {1, 0, 0}},
+			order:    []string{"BR", "DE", "unknown"},
+		},
+		{
+			name:     "by psp",
+			opts:     FunnelOptions{By: "session", Breakdown: "psp"},
+			counts:   []int64{3, 2, 1},
+			segments: map[string][]int64{"none": {2, 1, 0}, "PIX": {1, 1, 1}},
+			order:    []string{"none", "PIX"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := computeFunnel(f, q, tt.opts, append([]funnelEvent(nil), events...))
+			if report.FunnelID != 7 || report.By != tt.opts.By || report.Window != "1h0m0s" || !report.End.Equal(q.End) {
+				t.Errorf("header = %+v", report)
+			}
+			checkFunnelCounts(t, "total", report.Steps, tt.counts)
+			if len(report.Segments) != len(tt.order) {
+				t.Fatalf("got %d segments, want %d: %+v", len(report.Segments), len(tt.order), report.Segments)
+			}
+			for i, s := range report.Segments {
+				if s.Value != tt.order[i] {
+					t.Errorf("segment %d = %q, want %q", i, s.Value, tt.order[i])
+				}
+				checkFunnelCounts(t, s.Value, s.Steps, tt.segments[s.Value])
+			}
+		})
+	}
+
+	steps := computeFunnel(f, q, FunnelOptions{By: "session"}, events).Steps
+	want := []FunnelStepResult{
+		{Step: 1, Name: "Cashier", Count: 3, Conversion: 100, StepConversion: 100},
+		{Step: 2, Name: "Click", Count: 2, Conversion: percentOf(2, 3), StepConversion: percentOf(2, 3), DropOff: 1},
+		{Step: 3, Name: "Paid", Count: 1, Conversion: percentOf(1, 3), StepConversion: 50, DropOff: 1},
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Errorf("step %d = %+v, want %+v", i+1, steps[i], want[i])
+		}
+	}
+}
+
+func checkFunnelCounts(t *testing.T, name string, steps []FunnelStepResult, want []int64) {
+	t.Helper()
+	if len(steps) != len(want) {
+		t.Fatalf("%s: got %d steps, want %d", name, len(steps), len(want))
+	}
+	for i, s := range steps {
+		if s.Count != want[i] {
+			t.Errorf("%s: step %d count = %d, want %d", name, i+1, s.Count, want[i])
+		}
+	}
+}
+
+func TestFunnelQuery(t *testing.T) {
+	f := Funnel{
+		Steps: []FunnelStep{
+			{Source: "frontend", EventType: "page_view", PagePath: "/cashier"},
+			{Source: "psp", Operation: "deposit", Success: ptr(true)},
+			{Source: "frontend", MetricName: "deposit_done", Metadata: map[string]string{"flow.psp": "pix", "amount": "50"}},
+			{Source: "psp", PSPName: "PIX"},
+		},
+	}
+	start, end := base, base.Add(time.Hour)
+	placeholder := regexp.MustCompile(`\$(\d+)`)
+
+	tests := []struct {
+		source, by string
+		args       []any
+		want       []string
+	}{
+		{
+			source: "frontend",
+			by:     "session",
+			args:   []any{start, end, "page_view", "/cashier", "deposit_done", []string{"amount"}, "50", []string{"flow", "psp"}, "pix"},
+			want: []string{
+				"FROM frontend_metrics",
+				"session_id IS NOT NULL",
+				"ARRAY[(event_type = $3 AND page_path = $4), false, (metric_name = $5 AND metadata #>> $6 = $7 AND metadata #>> $8 = $9), false]",
+			},
+		},
+		{
+			source: "frontend",
+			by:     "player",
+			args:   []any{start, end, "page_view", "/cashier", "deposit_done", []string{"amount"}, "50", []string{"flow", "psp"}, "pix"},
+			want:   []string{"player_id IS NOT NULL AND ("},
+		},
+		{
+			source: "psp",
+			by:     "session",
+			args:   []any{start, end, "deposit", true, "PIX"},
+			want: []string{
+				"FROM psp_metrics",
+				"ARRAY[false, (operation = $3 AND success = $4), false, (psp_name = $5)]",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source+" by "+tt.by, func(t *testing.T) {
+			sql, args := funnelQuery(f, tt.source, tt.by, start, end)
+			for _, s := range tt.want {
+				if !strings.Contains(sql, s) {
+					t.Errorf("query lacks %q:\n%s", s, sql)
+				}
+			}
+			if len(args) != len(tt.args) {
+				t.Fatalf("got %d args %v, want %v", len(args), args, tt.args)
+			}
+			for i := range args {
+				if !equalArg(args[i], tt.args[i]) {
+					t.Errorf("arg $%d = %v, want %v", i+1, args[i], tt.args[i])
+				}
+			}
+			// Every argument is referenced and nothing beyond them
+			used := map[int]bool{}
+			for _, m := range placeholder.FindAllStringSubmatch(sql, -1) {
+				n, _ := strconv.Atoi(m[1])
+				used[n] = true
+			}
+			for n := 1; n <= len(args); n++ {
+				if !used[n] {
+					t.Errorf("$%d is not used:\n%s", n, sql)
+				}
+			}
+			if len(used) != len(args) {
+				t.Errorf("query references %d placeholders for %d args:\n%s", len(used), len(args), sql)
+			}
+		})
+	}
+}
+
+func equalArg(a, b any) bool {
+	as, ok := a.([]string)
+	if !ok {
+		return a == b
+	}
+	bs, ok := b.([]string)
+	return ok && strings.Join(as, ".") == strings.Join(bs, ".")
+}
@@ -0,0 +1,906 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+// Memory is a self-contained Store for tests, demos and local development.
+// It keeps raw rows in memory and computes the continuous aggregates
+// (api_performance_v2_1m, psp_success_v2_5m, web_vitals_v3_hourly,
+// game_health_v2_5m, websocket_health_v2_1m)
+// on the fly with the same semantics as the SQL definitions.
+type Memory struct {
+	mu        sync.RWMutex
+	retention time.Duration
+
+	frontend    []model.EnrichedEvent
+	api         []model.APIMetric
+	psp         []model.PSPMetric
+	game        []model.GameMetric
+	ws          []model.WebSocketMetric
+	alerts      []AlertRow
+	exports     []ExportAuditRow
+	funnels     []Funnel
+	activity    []PlayerDay
+	deployments []Deployment
+
+	listeners        map[int]func()
+	nextID           int
+	nextFunnelID     int64
+	nextDeploymentID int64
+}
+
+// NewMemory creates an in-memory store. Rows older than retention are
+// discarded on write; zero keeps everything.
+func NewMemory(retention time.Duration) *Memory {
+	return &Memory{retention: retention}
+}
+
+func (m *Memory) Close() {}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+// ============================================
+// WRITES
+// ============================================
+
+func (m *Memory) InsertFrontendMetrics(ctx context.Context, events []model.EnrichedEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.frontend = prune(append(m.frontend, events...), m.cutoff(), func(e model.EnrichedEvent) time.Time { return e.Time })
+	return nil
+}
+
+func (m *Memory) CopyFrontendMetrics(ctx context.Context, events []model.EnrichedEvent) error {
+	return m.InsertFrontendMetrics(ctx, events)
+}
+
+func (m *Memory) InsertAPIMetrics(ctx context.Context, metrics []model.APIMetric) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.api = prune(append(m.api, metrics...), m.cutoff(), func(r model.APIMetric) time.Time { return r.Time })
+	return nil
+}
+
+func (m *Memory) CopyAPIMetrics(ctx context.Context, metrics []model.APIMetric) error {
+	return m.InsertAPIMetrics(ctx, metrics)
+}
+
+func (m *Memory) InsertPSPMetrics(ctx context.Context, metrics []model.PSPMetric) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.psp = prune(append(m.psp, metrics...), m.cutoff(), func(r model.PSPMetric) time.Time { return r.Time })
+	return nil
+}
+
+func (m *Memory) CopyPSPMetrics(ctx context.Context, metrics []model.PSPMetric) error {
+	return m.InsertPSPMetrics(ctx, metrics)
+}
+
+func (m *Memory) InsertGameMetrics(ctx context.Context, metrics []model.GameMetric) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.game = prune(append(m.game, metrics...), m.cutoff(), func(r model.GameMetric) time.Time { return r.Time })
+	return nil
+}
+
+func (m *Memory) CopyGameMetrics(ctx context.Context, metrics []model.GameMetric) error {
+	return m.InsertGameMetrics(ctx, metrics)
+}
+
+func (m *Memory) InsertWebSocketMetrics(ctx context.Context, metrics []model.WebSocketMetric) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ws = prune(append(m.ws, metrics...), m.cutoff(), func(r model.WebSocketMetric) time.Time { return r.Time })
+	return nil
+}
+
+func (m *Memory) CopyWebSocketMetrics(ctx context.Context, metrics []model.WebSocketMetric) error {
+	return m.InsertWebSocketMetrics(ctx, metrics)
+}
+
+// RefreshAggregates is a no-op: memory reads aggregate raw rows on the fly
+func (m *Memory) RefreshAggregates(ctx context.Context, table string, start, end time.Time) error {
+	return nil
+}
+
+// InsertAlert records an alert event (alerts are produced outside the collector in Postgres)
+func (m *Memory) InsertAlert(alert AlertRow) {
+	defer m.notifyAlerts()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.alerts = append(m.alerts, alert)
+}
+
+func (m *Memory) cutoff() time.Time {
+	if m.retention <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-m.retention)
+}
+
+// prune drops rows older than cutoff, reusing the backing array
+func prune[T any](rows []T, cutoff time.Time, timeOf func(T) time.Time) []T {
+	if cutoff.IsZero() {
+		return rows
+	}
+	kept := rows[:0]
+	for _, r := range rows {
+		if !timeOf(r).Before(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// ============================================
+// AGGREGATES
+// ============================================
+
+// apiAggregate computes api_performance rows for the plan's range and step
+func (m *Memory) apiAggregate(p queryPlan, filters map[string]string) []APIPerformanceRow {
+	type key struct {
+		bucket            time.Time
+		service, endpoint string
+	}
+	groups := make(map[key][]model.APIMetric)
+	for _, r := range m.api {
+		if !p.contains(r.Time) || !matches(filters, func(dim string) string { return apiDim(r, dim) }) {
+			continue
+		}
+		k := key{p.bucket(r.Time), r.ServiceName, r.Endpoint}
+		groups[k] = append(groups[k], r)
+	}
+
+	result := make([]APIPerformanceRow, 0, len(groups))
+	for k, rows := range groups {
+		durations := make([]float64, len(rows))
+		row := APIPerformanceRow{Bucket: k.bucket, ServiceName: k.service, Endpoint: k.endpoint, RequestCount: int64(len(rows))}
+		for i, r := range rows {
+			durations[i] = r.DurationMS
+			if r.StatusCode >= 400 {
+				row.ErrorCount++
+			}
+			if r.StatusCode >= 500 {
+				row.ServerErrorCount++
+			}
+		}
+		row.AvgDurationMS = mean(durations)
+		row.P95DurationMS = percentileCont(durations, 0.95)
+		row.P99DurationMS = percentileCont(durations, 0.99)
+		result = append(result, row)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if !a.Bucket.Equal(b.Bucket) {
+			return a.Bucket.After(b.Bucket)
+		}
+		if a.ServiceName != b.ServiceName {
+			return a.ServiceName < b.ServiceName
+		}
+		return a.Endpoint < b.Endpoint
+	})
+	return result
+}
+
+// pspAggregate computes psp_success rows for the plan's range and step
+func (m *Memory) pspAggregate(p queryPlan, filters map[string]string) []PSPHealthRow {
+	type key struct {
+		bucket  time.Time
+		psp, op string
+	}
+	groups := make(map[key][]model.PSPMetric)
+	for _, r := range m.psp {
+		if !p.contains(r.Time) || !matches(filters, func(dim string) string { return pspDim(r, dim) }) {
+			continue
+		}
+		k := key{p.bucket(r.Time), r.PSPName, r.Operation}
+		groups[k] = append(groups[k], r)
+	}
+
+	result := make([]PSPHealthRow, 0, len(groups))
+	for k, rows := range groups {
+		durations := make([]float64, len(rows))
+		row := PSPHealthRow{Bucket: k.bucket, PSPName: k.psp, Operation: k.op, TotalCount: int64(len(rows))}
+		for i, r := range rows {
+			durations[i] = r.DurationMS
+			if r.Success {
+				row.SuccessCount++
+				if r.Amount != nil {
+					row.TotalAmount += *r.Amount
+				}
+			}
+		}
+		row.AvgDurationMS = mean(durations)
+		row.P95DurationMS = percentileCont(durations, 0.95)
+		result = append(result, row)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if !a.Bucket.Equal(b.Bucket) {
+			return a.Bucket.After(b.Bucket)
+		}
+		if a.PSPName != b.PSPName {
+			return a.PSPName < b.PSPName
+		}
+		return a.Operation < b.Operation
+	})
+	return result
+}
+
+// gameAggregate computes game_health rows for the plan's range and step
+func (m *Memory) gameAggregate(p queryPlan, filters map[string]string) []GameHealthRow {
+	type key struct {
+		bucket             time.Time
+		provider, gameType string
+	}
+	groups := make(map[key][]model.GameMetric)
+	for _, r := range m.game {
+		if !p.contains(r.Time) || !matches(filters, func(dim string) string { return gameDim(r, dim) }) {
+			continue
+		}
+		gameType := "unknown"
+		if r.GameType != nil {
+			gameType = *r.GameType
+		}
+		k := key{p.bucket(r.Time), r.Provider, gameType}
+		groups[k] = append(groups[k], r)
+	}
+
+	result := make([]GameHealthRow, 0, len(groups))
+	for k, rows := range groups {
+		var loads []float64
+		row := GameHealthRow{Bucket: k.bucket, Provider: k.provider, GameType: k.gameType, LaunchCount: int64(len(rows))}
+		for _, r := range rows {
+			if r.LaunchSuccess {
+				row.SuccessCount++
+			}
+			loads = appendNonNil(loads, r.LoadTimeMS)
+		}
+		row.AvgLoadTimeMS = mean(loads)
+		row.P95LoadTimeMS = percentileCont(loads, 0.95)
+		result = append(result, row)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if !a.Bucket.Equal(b.Bucket) {
+			return a.Bucket.After(b.Bucket)
+		}
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		return a.GameType < b.GameType
+	})
+	return result
+}
+
+// wsAggregate computes websocket_health rows for the plan's range and step
+func (m *Memory) wsAggregate(p queryPlan, filters map[string]string) []WebSocketHealthRow {
+	type key struct {
+		bucket               time.Time
+		endpoint, deviceType string
+	}
+	groups := make(map[key][]model.WebSocketMetric)
+	for _, r := range m.ws {
+		if !p.contains(r.Time) || !matches(filters, func(dim string) string { return wsDim(r, dim) }) {
+			continue
+		}
+		k := key{p.bucket(r.Time), "unknown", "unknown"}
+		if r.Endpoint != nil {
+			k.endpoint = *r.Endpoint
+		}
+		if r.DeviceType != nil {
+			k.deviceType = *r.DeviceType
+		}
+		groups[k] = append(groups[k], r)
+	}
+
+	result := make([]WebSocketHealthRow, 0, len(groups))
+	for k, rows := range groups {
+		var latencies []float64
+		var reports int64
+		row := WebSocketHealthRow{Bucket: k.bucket, Endpoint: k.endpoint, DeviceType: k.deviceType}
+		for _, r := range rows {
+			switch r.EventType {
+			case "connect":
+				row.Connects++
+			case "disconnect":
+				row.Disconnects++
+			case "error":
+				row.Errors++
+			case "reconnect":
+				row.Reconnects++
+			}
+			latencies = appendNonNil(latencies, r.LatencyMS)
+			if r.MessagesSent != nil || r.MessagesReceived != nil {
+				reports++
+			}
+			if r.MessagesSent != nil {
+				row.MessagesSent += int64(*r.MessagesSent)
+			}
+			if r.MessagesReceived != nil {
+				row.MessagesReceived += int64(*r.MessagesReceived)
+			}
+			if r.CloseCode != nil {
+				switch *r.CloseCode {
+				case 1000:
+					row.CloseCodes.Normal++
+				case 1001:
+					row.CloseCodes.GoingAway++
+				case 1006:
+					row.CloseCodes.Abnormal++
+				default:
+					row.CloseCodes.Other++
+				}
+			}
+		}
+		row.LatencySamples = int64(len(latencies))
+		row.AvgLatencyMS = mean(latencies)
+		row.P50LatencyMS = percentileCont(latencies, 0.5)
+		row.P95LatencyMS = percentileCont(latencies, 0.95)
+		if reports > 0 {
+			row.MessagesPerConnection = float64(row.MessagesSent+row.MessagesReceived) / float64(reports)
+		}
+		result = append(result, row)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if !a.Bucket.Equal(b.Bucket) {
+			return a.Bucket.After(b.Bucket)
+		}
+		if a.Endpoint != b.Endpoint {
+			return a.Endpoint < b.Endpoint
+		}
+		return a.DeviceType < b.DeviceType
+	})
+	return result
+}
+
+// ============================================
+// DASHBOARD QUERIES
+// ============================================
+
+func (m *Memory) GetAPIPerformance(ctx context.Context, q Query) ([]APIPerformanceRow, error) {
+	p, err := apiSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.apiAggregate(p, q.Filters), nil
+}
+
+func (m *Memory) GetAPITimeSeries(ctx context.Context, q Query) ([]TimeSeriesPoint, error) {
+	p, err := apiSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rows := ascending(m.apiAggregate(p, q.Filters))
+	return ratioByBucket(rows, func(r APIPerformanceRow) time.Time { return r.Bucket },
+		func(r APIPerformanceRow) float64 { return r.AvgDurationMS * float64(r.RequestCount) },
+		func(r APIPerformanceRow) float64 { return float64(r.RequestCount) }, 0), nil
+}
+
+func (m *Memory) GetPSPHealth(ctx context.Context, q Query) ([]PSPHealthRow, error) {
+	p, err := pspSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.pspAggregate(p, q.Filters), nil
+}
+
+func (m *Memory) GetPSPTimeSeries(ctx context.Context, q Query) ([]TimeSeriesPoint, error) {
+	p, err := pspSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rows := ascending(m.pspAggregate(p, q.Filters))
+	return ratioByBucket(rows, func(r PSPHealthRow) time.Time { return r.Bucket },
+		func(r PSPHealthRow) float64 { return float64(r.SuccessCount) * 100 },
+		func(r PSPHealthRow) float64 { return float64(r.TotalCount) }, 100), nil
+}
+
+func (m *Memory) GetWebVitals(ctx context.Context, q Query) ([]WebVitalsRow, error) {
+	p, err := vitalsSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.vitalsAggregate(p, q.Filters), nil
+}
+
+func (m *Memory) GetGameHealth(ctx context.Context, q Query) ([]GameHealthRow, error) {
+	p, err := gameSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.gameAggregate(p, q.Filters), nil
+}
+
+func (m *Memory) GetGameTimeSeries(ctx context.Context, q Query) ([]TimeSeriesPoint, error) {
+	p, err := gameSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rows := ascending(m.gameAggregate(p, q.Filters))
+	return ratioByBucket(rows, func(r GameHealthRow) time.Time { return r.Bucket },
+		func(r GameHealthRow) float64 { return float64(r.SuccessCount) * 100 },
+		func(r GameHealthRow) float64 { return float64(r.LaunchCount) }, 100), nil
+}
+
+func (m *Memory) GetWebSocketHealth(ctx context.Context, q Query) ([]WebSocketHealthRow, error) {
+	p, err := wsSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.wsAggregate(p, q.Filters), nil
+}
+
+func (m *Memory) GetWebSocketTimeSeries(ctx context.Context, metric string, q Query) ([]TimeSeriesPoint, error) {
+	switch metric {
+	case "connects", "disconnects", "errors", "latency", "concurrent":
+	default:
+		return nil, fmt.Errorf("%w: unknown websocket metric %q", ErrInvalidArgument, metric)
+	}
+	if metric == "concurrent" && q.Whole {
+		return nil, fmt.Errorf("%w: concurrent connections have no period total", ErrInvalidArgument)
+	}
+	p, err := wsSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	start := p.start
+	if metric == "concurrent" {
+		p.start = start.Add(-max(wsConcurrencyLookback, p.step))
+	}
+	rows := ascending(m.wsAggregate(p, q.Filters))
+
+	var result []TimeSeriesPoint
+	var sum, weight, open float64
+	for i, r := range rows {
+		switch metric {
+		case "connects":
+			sum += float64(r.Connects)
+		case "disconnects":
+			sum += float64(r.Disconnects)
+		case "errors":
+			sum += float64(r.Errors)
+		case "latency":
+			sum += r.AvgLatencyMS * float64(r.LatencySamples)
+			weight += float64(r.LatencySamples)
+		case "concurrent":
+			open += float64(r.Connects + r.Reconnects - r.Disconnects)
+		}
+		if i < len(rows)-1 && rows[i+1].Bucket.Equal(r.Bucket) {
+			continue
+		}
+
+		switch metric {
+		case "latency":
+			value := 0.0
+			if weight > 0 {
+				value = sum / weight
+			}
+			result = append(result, TimeSeriesPoint{Time: r.Bucket, Value: value})
+		case "concurrent":
+			if !r.Bucket.Before(start) {
+				result = append(result, TimeSeriesPoint{Time: r.Bucket, Value: math.Max(open, 0)})
+			}
+		default:
+			result = append(result, TimeSeriesPoint{Time: r.Bucket, Value: sum})
+		}
+		sum, weight = 0, 0
+	}
+	return result, nil
+}
+
+func (m *Memory) GetPercentiles(ctx context.Context, source string, q Query) (*PercentileSummary, error) {
+	_, p, err := planPercentiles(source, q)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var values []float64
+	switch source {
+	case "api":
+		for _, r := range m.api {
+			if p.contains(r.Time) && matches(q.Filters, func(dim string) string { return apiDim(r, dim) }) {
+				values = append(values, r.DurationMS)
+			}
+		}
+	case "psp":
+		for _, r := range m.psp {
+			if p.contains(r.Time) && matches(q.Filters, func(dim string) string { return pspDim(r, dim) }) {
+				values = append(values, r.DurationMS)
+			}
+		}
+	case "game":
+		for _, r := range m.game {
+			if p.contains(r.Time) && matches(q.Filters, func(dim string) string { return gameDim(r, dim) }) {
+				values = appendNonNil(values, r.LoadTimeMS)
+			}
+		}
+	case "ws":
+		for _, r := range m.ws {
+			if p.contains(r.Time) && matches(q.Filters, func(dim string) string { return wsDim(r, dim) }) {
+				values = appendNonNil(values, r.LatencyMS)
+			}
+		}
+	case "custom":
+		for _, e := range m.frontend {
+			if e.MetricName != nil && p.contains(e.Time) && matches(q.Filters, func(dim string) string { return frontendDim(e, dim) }) {
+				values = appendNonNil(values, e.MetricValue)
+			}
+		}
+	default:
+		for _, e := range m.frontend {
+			if e.EventType == "web_vital" && p.contains(e.Time) && matches(q.Filters, func(dim string) string { return frontendDim(e, dim) }) {
+				values = appendNonNil(values, vitalValue(e, source))
+			}
+		}
+	}
+
+	return &PercentileSummary{
+		Source: source,
+		Count:  int64(len(values)),
+		Mean:   mean(values),
+		P50:    percentileCont(values, 0.50),
+		P75:    percentileCont(values, 0.75),
+		P90:    percentileCont(values, 0.90),
+		P95:    percentileCont(values, 0.95),
+		P99:    percentileCont(values, 0.99),
+	}, nil
+}
+
+func (m *Memory) GetOverviewMetrics(ctx context.Context, q Query) (*OverviewMetrics, error) {
+	apiPlan, pspPlan, gamePlan, err := overviewPlans(q)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := &OverviewMetrics{PSPSuccessRate: 100, GameSuccessRate: 100}
+
+	sessions := make(map[string]struct{})
+	for _, e := range m.frontend {
+		if apiPlan.contains(e.Time) && matches(q.only(sessionDims).Filters, func(dim string) string { return frontendDim(e, dim) }) {
+			sessions[e.SessionID] = struct{}{}
+		}
+	}
+	result.ActiveSessions = int64(len(sessions))
+
+	var requests, errors int64
+	var latencies []float64
+	apiFilters := q.only(apiSource.dims).Filters
+	for _, r := range m.api {
+		if apiPlan.contains(r.Time) && matches(apiFilters, func(dim string) string { return apiDim(r, dim) }) {
+			requests++
+			if r.StatusCode >= 400 {
+				errors++
+			}
+			latencies = append(latencies, r.DurationMS)
+		}
+	}
+	if requests > 0 {
+		result.ErrorRate = float64(errors) / float64(requests) * 100
+		result.AvgLatencyMS = mean(latencies)
+	}
+
+	var pspTotal, pspSuccess int64
+	for _, r := range m.pspAggregate(pspPlan, q.only(pspSource.dims).Filters) {
+		if r.Operation == "deposit" {
+			result.DepositsCount += r.TotalCount
+			result.DepositsVolume += r.TotalAmount
+		}
+		pspTotal += r.TotalCount
+		pspSuccess += r.SuccessCount
+	}
+	result.PSPSuccessRate = rate(pspSuccess, pspTotal)
+
+	var launches, launched int64
+	for _, r := range m.gameAggregate(gamePlan, q.only(gameSource.dims).Filters) {
+		launches += r.LaunchCount
+		launched += r.SuccessCount
+	}
+	result.GameSuccessRate = rate(launched, launches)
+
+	return result, nil
+}
+
+func (m *Memory) GetAlerts(ctx context.Context, q Query, resolved *bool) ([]AlertRow, error) {
+	if err := checkAlertQuery(q); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	end := q.end()
+	var result []AlertRow
+	for _, a := range m.alerts {
+		if resolved != nil && (a.ResolvedAt != nil) != *resolved {
+			continue
+		}
+		if a.Time.Before(q.Start) || !a.Time.Before(end) {
+			continue
+		}
+		result = append(result, a)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Time.After(result[j].Time) })
+	if len(result) > 100 {
+		result = result[:100]
+	}
+	return result, nil
+}
+
+func (m *Memory) AcknowledgeAlert(ctx context.Context, alertTime time.Time) error {
+	defer m.notifyAlerts()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.alerts {
+		if m.alerts[i].Time.Equal(alertTime) {
+			m.alerts[i].Acknowledged = true
+		}
+	}
+	return nil
+}
+
+// ListenAlerts calls fn after every InsertAlert or AcknowledgeAlert until ctx is done
+func (m *Memory) ListenAlerts(ctx context.Context, fn func()) error {
+	m.mu.Lock()
+	if m.listeners == nil {
+		m.listeners = make(map[int]func())
+	}
+	id := m.nextID
+	m.nextID++
+	m.listeners[id] = fn
+	m.mu.Unlock()
+
+	<-ctx.Done()
+
+	m.mu.Lock()
+	delete(m.listeners, id)
+	m.mu.Unlock()
+	return nil
+}
+
+// notifyAlerts runs the alert listeners; call without holding mu
+func (m *Memory) notifyAlerts() {
+	m.mu.RLock()
+	fns := make([]func(), 0, len(m.listeners))
+	for _, fn := range m.listeners {
+		fns = append(fns, fn)
+	}
+	m.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// ============================================
+// HELPERS
+// ============================================
+
+// percentileCont matches PostgreSQL PERCENTILE_CONT (linear interpolation)
+func percentileCont(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	pos := p * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// rate returns part/total as a percentage, 100 when total is zero
+func rate(part, total int64) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(part) / float64(total) * 100
+}
+
+func appendNonNil(values []float64, v *float64) []float64 {
+	if v == nil {
+		return values
+	}
+	return append(values, *v)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// matches reports whether every filter equals the row's value for that dimension
+func matches(filters map[string]string, dim func(string) string) bool {
+	for k, v := range filters {
+		if dim(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+func apiDim(r model.APIMetric, dim string) string {
+	switch dim {
+	case "service":
+		return r.ServiceName
+	case "endpoint":
+		return r.Endpoint
+	case "method":
+		return r.Method
+	case "release":
+		return deref(r.Release)
+	}
+	return ""
+}
+
+func pspDim(r model.PSPMetric, dim string) string {
+	switch dim {
+	case "psp":
+		return r.PSPName
+	case "operation":
+		return r.Operation
+	case "currency":
+		return deref(r.Currency)
+	case "release":
+		return deref(r.Release)
+	}
+	return ""
+}
+
+func gameDim(r model.GameMetric, dim string) string {
+	switch dim {
+	case "provider":
+		return r.Provider
+	case "game_type":
+		return deref(r.GameType)
+	case "device_type":
+		return deref(r.DeviceType)
+	case "release":
+		return deref(r.Release)
+	}
+	return ""
+}
+
+func wsDim(r model.WebSocketMetric, dim string) string {
+	switch dim {
+	case "endpoint":
+		return deref(r.Endpoint)
+	case "device_type":
+		return deref(r.DeviceType)
+	case "release":
+		return deref(r.Release)
+	}
+	return ""
+}
+
+func frontendDim(e model.EnrichedEvent, dim string) string {
+	switch dim {
+	case "device_type":
+		return e.DeviceType
+	case "country":
+		return e.Country
+	case "page_path":
+		return e.PagePath
+	case "metric_name":
+		return deref(e.MetricName)
+	case "release":
+		return deref(e.Release)
+	}
+	return ""
+}
+
+// vitalValue returns the Web Vitals metric (lcp, fid, cls, inp, ttfb, fcp) of an event
+func vitalValue(e model.EnrichedEvent, metric string) *float64 {
+	switch metric {
+	case "fid":
+		return e.FID
+	case "cls":
+		return e.CLS
+	case "inp":
+		return e.INP
+	case "ttfb":
+		return e.TTFB
+	case "fcp":
+		return e.FCP
+	}
+	return e.LCP
+}
+
+// ascending reverses rows sorted by bucket DESC into bucket ASC order
+func ascending[T any](rows []T) []T {
+	out := make([]T, len(rows))
+	for i, r := range rows {
+		out[len(rows)-1-i] = r
+	}
+	return out
+}
+
+// ratioByBucket sums num and den over rows sharing a bucket and returns num/den,
+// or empty when den is zero; rows must be bucket-ordered
+func ratioByBucket[T any](rows []T, bucketOf func(T) time.Time, num, den func(T) float64, empty float64) []TimeSeriesPoint {
+	var result []TimeSeriesPoint
+	var n, d float64
+	for i, r := range rows {
+		n += num(r)
+		d += den(r)
+		if i == len(rows)-1 || !bucketOf(rows[i+1]).Equal(bucketOf(r)) {
+			value := empty
+			if d > 0 {
+				value = n / d
+			}
+			result = append(result, TimeSeriesPoint{Time: bucketOf(r), Value: value})
+			n, d = 0, 0
+		}
+	}
+	return result
+}
@@ -0,0 +1,385 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+// base is the start of the fixture range, an hour boundary
+var base = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+func ptr[T any](v T) *T { return &v }
+
+// fixtureMemory returns a Memory without retention holding a small known data set
+func fixtureMemory(t *testing.T) *Memory {
+	t.Helper()
+	ctx := context.Background()
+	m := NewMemory(0)
+
+	api := []model.APIMetric{
+		{Time: base, ServiceName: "wallet", Endpoint: "/deposit", Method: "POST", DurationMS: 100, StatusCode: 200},
+		{Time: base.Add(10 * time.Minute), ServiceName: "wallet", Endpoint: "/deposit", Method: "POST", DurationMS: 300, StatusCode: 500},
+		{Time: base.Add(20 * time.Minute), ServiceName: "games", Endpoint: "/launch", Method: "GET", DurationMS: 50, StatusCode: 404},
+		{Time: base.Add(65 * time.Minute), ServiceName: "wallet", Endpoint: "/deposit", Method: "GET", DurationMS: 200, StatusCode: 200},
+	}
+	psp := []model.PSPMetric{
+		{Time: base, PSPName: "PIX", Operation: "deposit", DurationMS: 400, Success: true, Amount: ptr(50.0)},
+		{Time: base.Add(5 * time.Minute), PSPName: "PIX", Operation: "deposit", DurationMS: 900, Success: false, Amount: ptr(20.0)},
+		{Time: base.Add(70 * time.Minute), PSPName: "Stripe", Operation: "withdrawal", DurationMS: 700, Success: true, Amount: ptr(10.0)},
+		{Time: base.Add(75 * time.Minute), PSPName: "Stripe", Operation: "withdrawal", DurationMS: 500, Success: true, Amount: ptr(5.0)},
+	}
+	game := []model.GameMetric{
+		{Time: base, Provider: "evolution", GameType: ptr("live"), LoadTimeMS: ptr(1200.0), LaunchSuccess: true},
+		{Time: base.Add(30 * time.Minute), Provider: "evolution", GameType: ptr("live"), LoadTimeMS: ptr(2400.0), LaunchSuccess: false},
+	}
+	frontend := []model.EnrichedEvent{
+		{FrontendEvent: model.FrontendEvent{Time: base, SessionID: "s1", EventType: "page_view", DeviceType: "mobile"}, Country: "BR"},
+		{FrontendEvent: model.FrontendEvent{Time: base.Add(time.Minute), SessionID: "s1", EventType: "page_view", DeviceType: "mobile"}, Country: "BR"},
+		{FrontendEvent: model.FrontendEvent{Time: base.Add(2 * time.Minute), SessionID: "s2", EventType: "page_view", DeviceType: "desktop"}, Country: "DE"},
+	}
+	for _, err := range []error{
+		m.InsertAPIMetrics(ctx, api),
+		m.InsertPSPMetrics(ctx, psp),
+		m.CopyGameMetrics(ctx, game),
+		m.CopyFrontendMetrics(ctx, frontend),
+	} {
+		if err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+	return m
+}
+
+func TestMemoryAPIPerformance(t *testing.T) {
+	m := fixtureMemory(t)
+	end := base.Add(2 * time.Hour)
+
+	tests := []struct {
+		name string
+		q    Query
+		want []APIPerformanceRow
+	}{
+		{
+			name: "hourly buckets, newest first",
+			q:    Query{Start: base, End: end, Step: time.Hour},
+			want: []APIPerformanceRow{
+				{Bucket: base.Add(time.Hour), ServiceName: "wallet", Endpoint: "/deposit", RequestCount: 1, AvgDurationMS: 200, P95DurationMS: 200, P99DurationMS: 200},
+				{Bucket: base, ServiceName: "games", Endpoint: "/launch", RequestCount: 1, AvgDurationMS: 50, P95DurationMS: 50, P99DurationMS: 50, ErrorCount: 1},
+				{Bucket: base, ServiceName: "wallet", Endpoint: "/deposit", RequestCount: 2, AvgDurationMS: 200, P95DurationMS: 290, P99DurationMS: 298, ErrorCount: 1, ServerErrorCount: 1},
+			},
+		},
+		{
+			name: "service filter",
+			q:    Query{Start: base, End: end, Step: time.Hour, Filters: map[string]string{"service": "games"}},
+			want: []APIPerformanceRow{
+				{Bucket: base, ServiceName: "games", Endpoint: "/launch", RequestCount: 1, AvgDurationMS: 50, P95DurationMS: 50, P99DurationMS: 50, ErrorCount: 1},
+			},
+		},
+		{
+			name: "raw-only filter",
+			q:    Query{Start: base, End: end, Whole: true, Filters: map[string]string{"method": "POST"}},
+			want: []APIPerformanceRow{
+				{Bucket: base, ServiceName: "wallet", Endpoint: "/deposit", RequestCount: 2, AvgDurationMS: 200, P95DurationMS: 290, P99DurationMS: 298, ErrorCount: 1, ServerErrorCount: 1},
+			},
+		},
+		{
+			name: "whole range",
+			q:    Query{Start: base, End: end, Whole: true, Filters: map[string]string{"service": "wallet"}},
+			want: []APIPerformanceRow{
+				{Bucket: base, ServiceName: "wallet", Endpoint: "/deposit", RequestCount: 3, AvgDurationMS: 200, P95DurationMS: 290, P99DurationMS: 298, ErrorCount: 1, ServerErrorCount: 1},
+			},
+		},
+		{
+			name: "end is exclusive",
+			q:    Query{Start: base, End: base.Add(10 * time.Minute), Whole: true},
+			want: []APIPerformanceRow{
+				{Bucket: base, ServiceName: "wallet", Endpoint: "/deposit", RequestCount: 1, AvgDurationMS: 100, P95DurationMS: 100, P99DurationMS: 100},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.GetAPIPerformance(context.Background(), tt.q)
+			if err != nil {
+				t.Fatalf("GetAPIPerformance: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if !got[i].Bucket.Equal(tt.want[i].Bucket) {
+					t.Errorf("row %d bucket = %s, want %s", i, got[i].Bucket, tt.want[i].Bucket)
+				}
+				got[i].Bucket = tt.want[i].Bucket
+				if got[i] != tt.want[i] {
+					t.Errorf("row %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryTimeSeries(t *testing.T) {
+	m := fixtureMemory(t)
+	q := Query{Start: base, End: base.Add(2 * time.Hour), Step: time.Hour}
+
+	tests := []struct {
+		name string
+		get  func(context.Context, Query) ([]TimeSeriesPoint, error)
+		want []TimeSeriesPoint
+	}{
+		{"api mean latency", m.GetAPITimeSeries, []TimeSeriesPoint{{base, 150}, {base.Add(time.Hour), 200}}},
+		{"psp success rate", m.GetPSPTimeSeries, []TimeSeriesPoint{{base, 50}, {base.Add(time.Hour), 100}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get(context.Background(), q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Time.Equal(tt.want[i].Time) || got[i].Value != tt.want[i].Value {
+					t.Errorf("point %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryOverview(t *testing.T) {
+	m := fixtureMemory(t)
+
+	tests := []struct {
+		name string
+		q    Query
+		want OverviewMetrics
+	}{
+		{
+			name: "all sections",
+			q:    Query{Start: base, End: base.Add(2 * time.Hour)},
+			want: OverviewMetrics{
+				ActiveSessions: 2, DepositsCount: 2, DepositsVolume: 50, ErrorRate: 50, AvgLatencyMS: 162.5,
+				PSPSuccessRate: 75, GameSuccessRate: 50,
+			},
+		},
+		{
+			name: "filters apply to the sections that have them",
+			q:    Query{Start: base, End: base.Add(2 * time.Hour), Filters: map[string]string{"country": "BR", "psp": "Stripe"}},
+			want: OverviewMetrics{
+				ActiveSessions: 1, ErrorRate: 50, AvgLatencyMS: 162.5, PSPSuccessRate: 100, GameSuccessRate: 50,
+			},
+		},
+		{
+			name: "no traffic counts as healthy",
+			q:    Query{Start: base.Add(-time.Hour), End: base},
+			want: OverviewMetrics{PSPSuccessRate: 100, GameSuccessRate: 100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.GetOverviewMetrics(context.Background(), tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryInvalidQueries(t *testing.T) {
+	m := fixtureMemory(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{"start after end", func() error {
+			_, err := m.GetAPIPerformance(ctx, Query{Start: base, End: base.Add(-time.Hour)})
+			return err
+		}},
+		{"dimension of another source", func() error {
+			_, err := m.GetAPIPerformance(ctx, Query{Start: base, End: base.Add(time.Hour), Filters: map[string]string{"psp": "PIX"}})
+			return err
+		}},
+		{"step not a multiple of a level", func() error {
+			_, err := m.GetPSPHealth(ctx, Query{Start: base, End: base.Add(time.Hour), Step: 7 * time.Second})
+			return err
+		}},
+		{"too many points", func() error {
+			_, err := m.GetAPITimeSeries(ctx, Query{Start: base.Add(-30 * 24 * time.Hour), End: base, Step: time.Minute})
+			return err
+		}},
+		{"overview filter no section has", func() error {
+			_, err := m.GetOverviewMetrics(ctx, Query{Start: base, End: base.Add(time.Hour), Filters: map[string]string{"metric_name": "x"}})
+			return err
+		}},
+		{"alerts with filters", func() error {
+			_, err := m.GetAlerts(ctx, Query{Filters: map[string]string{"service": "wallet"}}, nil)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("err = %v, want ErrInvalidArgument", err)
+			}
+		})
+	}
+}
+
+func TestMemoryRetention(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(time.Hour)
+	now := time.Now()
+	err := m.InsertAPIMetrics(ctx, []model.APIMetric{
+		{Time: now.Add(-2 * time.Hour), ServiceName: "old", Endpoint: "/", Method: "GET", StatusCode: 200},
+		{Time: now.Add(-10 * time.Minute), ServiceName: "new", Endpoint: "/", Method: "GET", StatusCode: 200},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := m.GetAPIPerformance(ctx, Query{Start: now.Add(-3 * time.Hour), Whole: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].ServiceName != "new" {
+		t.Errorf("rows = %+v, want only the one inside retention", rows)
+	}
+}
+
+func TestMemoryAlerts(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(0)
+	resolvedAt := base.Add(time.Minute)
+	m.InsertAlert(AlertRow{Time: base, AlertType: "latency", Severity: "warning"})
+	m.InsertAlert(AlertRow{Time: base.Add(time.Hour), AlertType: "errors", Severity: "critical", ResolvedAt: &resolvedAt})
+
+	if err := m.AcknowledgeAlert(ctx, base); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		resolved *bool
+		want     []string
+	}{
+		{"all, newest first", nil, []string{"errors", "latency"}},
+		{"open", ptr(false), []string{"latency"}},
+		{"resolved", ptr(true), []string{"errors"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.GetAlerts(ctx, Query{}, tt.resolved)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var types []string
+			for _, a := range got {
+				types = append(types, a.AlertType)
+				if a.AlertType == "latency" && !a.Acknowledged {
+					t.Error("latency alert is not acknowledged")
+				}
+			}
+			if len(types) != len(tt.want) {
+				t.Fatalf("got %v, want %v", types, tt.want)
+			}
+			for i := range types {
+				if types[i] != tt.want[i] {
+					t.Errorf("got %v, want %v", types, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryScanEvents(t *testing.T) {
+	m := fixtureMemory(t)
+	end := base.Add(2 * time.Hour)
+
+	tests := []struct {
+		table   string
+		filters map[string]string
+		want    int
+	}{
+		{"api", nil, 4},
+		{"api", map[string]string{"service": "wallet", "method": "GET"}, 1},
+		{"psp", map[string]string{"psp": "PIX"}, 2},
+		{"game", map[string]string{"provider": "evolution"}, 2},
+		{"frontend", map[string]string{"country": "DE"}, 1},
+		{"ws", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.table, func(t *testing.T) {
+			columns, err := EventColumns(tt.table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var last time.Time
+			n := 0
+			err = m.ScanEvents(context.Background(), tt.table, Query{Start: base, End: end, Filters: tt.filters}, func(values []any) error {
+				if len(values) != len(columns) {
+					t.Fatalf("row has %d values, want %d", len(values), len(columns))
+				}
+				ts, ok := values[0].(time.Time)
+				if !ok || ts.Before(last) {
+					t.Errorf("rows are not oldest first: %v after %v", values[0], last)
+				}
+				last = ts
+				n++
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.want {
+				t.Errorf("got %d rows, want %d", n, tt.want)
+			}
+		})
+	}
+
+	err := m.ScanEvents(context.Background(), "nope", Query{Start: base, End: end}, func([]any) error { return nil })
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown table: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryPartialBuckets(t *testing.T) {
+	m := fixtureMemory(t)
+	ctx := context.Background()
+	// Two days from 10:15 read hourly buckets: the partial first bucket is
+	// read whole, like the last one
+	q := Query{Start: base.Add(15 * time.Minute), End: base.Add(48*time.Hour + 15*time.Minute)}
+
+	rows, err := m.GetAPIPerformance(ctx, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[time.Time]int64)
+	for _, r := range rows {
+		counts[r.Bucket] += r.RequestCount
+	}
+	if len(counts) != 2 || counts[base] != 3 || counts[base.Add(time.Hour)] != 1 {
+		t.Errorf("requests per bucket = %v, want 3 at 10:00 and 1 at 11:00", counts)
+	}
+
+	q.Whole = true
+	res, err := m.QueryMetrics(ctx, q, MetricQuery{Measures: []string{"api.requests"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(res.Rows) != fmt.Sprint([][]any{{base, 4.0}}) || !res.Start.Equal(base) || !res.End.Equal(base.Add(49*time.Hour)) {
+		t.Errorf("whole range = %v over %s–%s, want 4 requests over 10:00 to 11:00 two days later", res.Rows, res.Start, res.End)
+	}
+}
@@ -0,0 +1,429 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Migrations live in migrations/NNNN_name.up.sql and NNNN_name.down.sql.
+// A file starting with "-- migrate:no-transaction" is executed statement by
+// statement outside a transaction (required for continuous aggregates);
+// such migrations must be idempotent so a failed run can simply be retried.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const noTransactionDirective = "-- migrate:no-transaction"
+
+// migrationLockID is the advisory lock key serializing concurrent migrators
+const migrationLockID = 7_466_901_028
+
+// Migration is one embedded schema version
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// Migrations returns the embedded migrations ordered by version
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+		num, label, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q", name)
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d has no up file", m.Version)
+		}
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// MigrationStatus lists all embedded migrations with their applied time
+func (p *Postgres) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrations(ctx, p.writer)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		result[i] = MigrationStatus{Version: m.Version, Name: m.Name}
+		if t, ok := applied[m.Version]; ok {
+			result[i].AppliedAt = &t
+		}
+	}
+	return result, nil
+}
+
+// CheckSchema returns an error if any embedded migration is not applied
+func (p *Postgres) CheckSchema(ctx context.Context) error {
+	status, err := p.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			pending = append(pending, fmt.Sprintf("%04d_%s", s.Version, s.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("schema is behind, pending migrations: %s", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// MigrateUp applies all pending migrations in order and returns the applied versions
+func (p *Postgres) MigrateUp(ctx context.Context) ([]int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, release, err := p.lockMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := runMigration(ctx, conn, m.Up, func(ex dbConn) error {
+			_, err := ex.Exec(ctx,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+				m.Version, m.Name)
+			return err
+		}); err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m.Version)
+	}
+	return done, nil
+}
+
+// MigrateDown rolls back the latest `steps` applied migrations and returns their versions
+func (p *Postgres) MigrateDown(ctx context.Context, steps int) ([]int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, release, err := p.lockMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return done, fmt.Errorf("migration %04d_%s has no down file", m.Version, m.Name)
+		}
+		if err := runMigration(ctx, conn, m.Down, func(ex dbConn) error {
+			_, err := ex.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			return err
+		}); err != nil {
+			return done, fmt.Errorf("rollback %04d_%s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m.Version)
+	}
+	return done, nil
+}
+
+// lockMigrations acquires a dedicated connection holding the migration advisory lock
+func (p *Postgres) lockMigrations(ctx context.Context) (*pgxpool.Conn, func(), error) {
+	conn, err := p.writer.Acquire(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("acquire connection: %w", err)
+	}
+
+	// Migrations may run far longer than the configured statement_timeout
+	if _, err := conn.Exec(ctx, `SET statement_timeout = 0`); err != nil {
+		conn.Release()
+		return nil, nil, fmt.Errorf("disable statement timeout: %w", err)
+	}
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		conn.Exec(context.Background(), `RESET statement_timeout`)
+		conn.Release()
+		return nil, nil, fmt.Errorf("lock migrations: %w", err)
+	}
+
+	release := func() {
+		conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+		conn.Exec(context.Background(), `RESET statement_timeout`)
+		conn.Release()
+	}
+
+	if _, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`); err != nil {
+		release()
+		return nil, nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return conn, release, nil
+}
+
+// dbConn is satisfied by *pgxpool.Pool, *pgxpool.Conn and pgx.Tx
+type dbConn interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// appliedMigrations returns version -> applied_at; a missing table means nothing is applied
+func appliedMigrations(ctx context.Context, db dbConn) (map[int]time.Time, error) {
+	applied := make(map[int]time.Time)
+
+	var exists bool
+	rows, err := db.Query(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("check schema_migrations: %w", err)
+	}
+	for rows.Next() {
+		if err := rows.Scan(&exists); err != nil {
+			rows.Close()
+			return nil, err
+		}
+	}
+	rows.Close()
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err = db.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// runMigration executes a migration body and records it via record in the same unit of work
+func runMigration(ctx context.Context, conn *pgxpool.Conn, body string, record func(dbConn) error) error {
+	if strings.HasPrefix(strings.TrimSpace(body), noTransactionDirective) {
+		for _, stmt := range splitStatements(body) {
+			if _, err := conn.Exec(ctx, stmt); err != nil {
+				return fmt.Errorf("%w\nstatement: %s", err, firstLine(stmt))
+			}
+		}
+		return record(conn)
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, body); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// splitStatements splits SQL on top-level semicolons, respecting quotes,
+// comments and dollar-quoted bodies. Comment-only statements are dropped.
+func splitStatements(sql string) []string {
+	var stmts []string
+	var cur strings.Builder
+	hasCode := false
+
+	flush := func() {
+		if hasCode {
+			stmts = append(stmts, strings.TrimSpace(cur.String()))
+		}
+		cur.Reset()
+		hasCode = false
+	}
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			cur.WriteString(sql[i : i+end])
+			i += end - 1
+
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				end = len(sql) - i - 2
+			} else {
+				end += 2
+			}
+			cur.WriteString(sql[i : i+2+end])
+			i += 1 + end
+
+		case c == '\'' || c == '"':
+			// In E'...' strings a backslash escapes the next character
+			escapes := c == '\'' && i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i == 1 || !isIdentByte(sql[i-2]))
+			j := i + 1
+			for j < len(sql) {
+				if escapes && sql[j] == '\\' {
+					j += 2
+					continue
+				}
+				if sql[j] == c {
+					if j+1 < len(sql) && sql[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			cur.WriteString(sql[i:min(j+1, len(sql))])
+			hasCode = true
+			i = j
+
+		case c == '$':
+			tag := dollarTag(sql[i:])
+			if tag == "" {
+				cur.WriteByte(c)
+				hasCode = true
+				continue
+			}
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end < 0 {
+				end = len(sql) - i - len(tag)
+			} else {
+				end += len(tag)
+			}
+			cur.WriteString(sql[i : i+len(tag)+end])
+			hasCode = true
+			i += len(tag) + end - 1
+
+		case c == ';':
+			flush()
+
+		default:
+			cur.WriteByte(c)
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				hasCode = true
+			}
+		}
+	}
+	flush()
+	return stmts
+}
+
+// dollarTag returns the opening $tag$ at the start of s, or "" if there is none
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '$' {
+			return s[:i+1]
+		}
+		if !isIdentByte(c) || i == 1 && '0' <= c && c <= '9' {
+			return ""
+		}
+	}
+	return ""
+}
+
+// isIdentByte reports whether c can be part of an unquoted identifier
+func isIdentByte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
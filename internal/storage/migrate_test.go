@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{"plain", "SELECT 1; SELECT 2;\n", []string{"SELECT 1", "SELECT 2"}},
+		{"no trailing semicolon", "SELECT 1;\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"empty statements", ";;  ;\n", nil},
+		{"single quotes", "SELECT 'a;b'; SELECT 'it''s; fine';", []string{"SELECT 'a;b'", "SELECT 'it''s; fine'"}},
+		{"escape string", `SELECT E'it\'s; fine', e'\\'; SELECT 2;`, []string{`SELECT E'it\'s; fine', e'\\'`, "SELECT 2"}},
+		{"backslash in a plain string", `SELECT 'C:\'; SELECT 2;`, []string{`SELECT 'C:\'`, "SELECT 2"}},
+		{"identifier ending in e", `SELECT name'x;y'; SELECT 2;`, []string{`SELECT name'x;y'`, "SELECT 2"}},
+		{"quoted identifier", `CREATE TABLE "a;b" ("c""d" int);`, []string{`CREATE TABLE "a;b" ("c""d" int)`}},
+		{"dollar quotes", "DO $$ BEGIN PERFORM 1; END $$; SELECT 2;", []string{"DO $$ BEGIN PERFORM 1; END $$", "SELECT 2"}},
+		{
+			"tagged dollar quotes",
+			"CREATE FUNCTION f() RETURNS text AS $body$ SELECT $$;$$; $body$ LANGUAGE sql; SELECT 2;",
+			[]string{"CREATE FUNCTION f() RETURNS text AS $body$ SELECT $$;$$; $body$ LANGUAGE sql", "SELECT 2"},
+		},
+		{"positional parameters", "SELECT $1; SELECT $2::int;", []string{"SELECT $1", "SELECT $2::int"}},
+		{"line comments", "-- first; not a statement\nSELECT 1; -- trailing;\n", []string{"-- first; not a statement\nSELECT 1"}},
+		{"block comments", "/* a; b */ SELECT /* ; */ 1;\n/* only a comment; */", []string{"/* a; b */ SELECT /* ; */ 1"}},
+		{"comment only", "-- migrate:no-transaction\n-- nothing here;\n", nil},
+		{"unterminated quote", "SELECT 'a;", []string{"SELECT 'a;"}},
+		{"unterminated dollar quote", "DO $$ BEGIN;", []string{"DO $$ BEGIN;"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitStatements(tt.sql)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitStatements(%q)\n got %q\nwant %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDollarTag(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"$$ body", "$$"},
+		{"$body$ x", "$body$"},
+		{"$_a1$", "$_a1$"},
+		{"$1", ""},
+		{"$1$", ""},
+		{"$a-b$", ""},
+		{"$tag", ""},
+		{"$", ""},
+	}
+	for _, tt := range tests {
+		if got := dollarTag(tt.s); got != tt.want {
+			t.Errorf("dollarTag(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+// TestSplitNoTransactionMigrations checks the statements run one by one: none
+// is cut inside a string or function body
+func TestSplitNoTransactionMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verbs := []string{"ALTER", "CALL", "COMMENT", "CREATE", "DELETE", "DO", "DROP", "GRANT", "INSERT", "REFRESH", "SELECT", "UPDATE"}
+	found := false
+	for _, m := range migrations {
+		for direction, body := range map[string]string{"up": m.Up, "down": m.Down} {
+			if !strings.HasPrefix(strings.TrimSpace(body), noTransactionDirective) {
+				continue
+			}
+			found = true
+			stmts := splitStatements(body)
+			if len(stmts) == 0 {
+				t.Errorf("%04d %s: no statements", m.Version, direction)
+			}
+			for _, stmt := range stmts {
+				code := stripComments(stmt)
+				verb, _, _ := strings.Cut(code, " ")
+				if !slices.Contains(verbs, strings.ToUpper(strings.TrimSpace(verb))) {
+					t.Errorf("%04d %s: statement starts with %q:\n%s", m.Version, direction, verb, stmt)
+				}
+				if strings.Count(code, "'")%2 != 0 || strings.Count(code, "$$")%2 != 0 {
+					t.Errorf("%04d %s: statement cut inside a quote:\n%s", m.Version, direction, stmt)
+				}
+			}
+		}
+	}
+	if !found {
+		t.Fatal("no no-transaction migrations found")
+	}
+
+	// The sketch helper of 0005 has semicolons in its body
+	for _, m := range migrations {
+		if m.Version != 5 {
+			continue
+		}
+		for _, stmt := range splitStatements(m.Up) {
+			if strings.Contains(stmt, "RETURNS uddsketch") && strings.Count(stmt, "$$") != 2 {
+				t.Errorf("0005 function split inside its body:\n%s", stmt)
+			}
+		}
+	}
+}
+
+// stripComments drops -- comment lines, leaving the code of a statement
+func stripComments(stmt string) string {
+	var code []string
+	for _, line := range strings.Split(stmt, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+			code = append(code, line)
+		}
+	}
+	return strings.Join(code, " ")
+}
@@ -0,0 +1,18 @@
+-- migrate:no-transaction
+-- Drops the whole baseline schema. All metric data is lost.
+
+DROP FUNCTION IF EXISTS get_psp_health(INTERVAL);
+DROP FUNCTION IF EXISTS get_error_rate(VARCHAR, INTERVAL);
+
+DROP MATERIALIZED VIEW IF EXISTS game_health_5m;
+DROP MATERIALIZED VIEW IF EXISTS web_vitals_hourly;
+DROP MATERIALIZED VIEW IF EXISTS psp_success_5m;
+DROP MATERIALIZED VIEW IF EXISTS api_performance_1m;
+
+DROP TABLE IF EXISTS alert_events;
+DROP TABLE IF EXISTS business_metrics;
+DROP TABLE IF EXISTS websocket_metrics;
+DROP TABLE IF EXISTS game_metrics;
+DROP TABLE IF EXISTS psp_metrics;
+DROP TABLE IF EXISTS api_metrics;
+DROP TABLE IF EXISTS frontend_metrics;
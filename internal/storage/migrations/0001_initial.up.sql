@@ -1,6 +1,9 @@
+-- migrate:no-transaction
 -- ============================================
--- PRODUCT PULSE - Performance Monitoring Schema
--- TimescaleDB + PostgreSQL
+-- 0001 INITIAL SCHEMA
+-- Baseline of the original product_pulse_schema.sql, made idempotent so
+-- databases initialized by hand can adopt migrations with `migrate up`.
+-- Continuous aggregates cannot be created inside a transaction.
 -- ============================================
 
 -- Enable TimescaleDB extension
@@ -12,7 +15,7 @@ CREATE EXTENSION IF NOT EXISTS timescaledb;
 
 -- 1. Frontend Performance Events
 -- Web Vitals, page loads, interactions
-CREATE TABLE frontend_metrics (
+CREATE TABLE IF NOT EXISTS frontend_metrics (
     time            TIMESTAMPTZ NOT NULL,
     session_id      UUID NOT NULL,
     player_id       UUID,
@@ -41,12 +44,13 @@ CREATE TABLE frontend_metrics (
 );
 
 SELECT create_hypertable('frontend_metrics', 'time',
-    chunk_time_interval => INTERVAL '1 day'
+    chunk_time_interval => INTERVAL '1 day',
+    if_not_exists => TRUE
 );
 
 -- 2. API Performance Metrics
 -- Backend latency, errors, throughput
-CREATE TABLE api_metrics (
+CREATE TABLE IF NOT EXISTS api_metrics (
     time            TIMESTAMPTZ NOT NULL,
     service_name    VARCHAR(50) NOT NULL,  -- auth, wallet, games, bonus
     endpoint        VARCHAR(255) NOT NULL,
@@ -70,12 +74,13 @@ CREATE TABLE api_metrics (
 );
 
 SELECT create_hypertable('api_metrics', 'time',
-    chunk_time_interval => INTERVAL '1 day'
+    chunk_time_interval => INTERVAL '1 day',
+    if_not_exists => TRUE
 );
 
 -- 3. PSP (Payment Service Provider) Metrics
 -- Critical for deposit/withdrawal monitoring
-CREATE TABLE psp_metrics (
+CREATE TABLE IF NOT EXISTS psp_metrics (
     time            TIMESTAMPTZ NOT NULL,
     psp_name        VARCHAR(50) NOT NULL,  -- stripe, pix, muchbetter, etc
     operation       VARCHAR(20) NOT NULL,  -- deposit, withdrawal, verify
@@ -101,12 +106,13 @@ CREATE TABLE psp_metrics (
 );
 
 SELECT create_hypertable('psp_metrics', 'time',
-    chunk_time_interval => INTERVAL '1 day'
+    chunk_time_interval => INTERVAL '1 day',
+    if_not_exists => TRUE
 );
 
 -- 4. Game Provider Metrics
 -- SoftSwiss, Pragmatic, etc
-CREATE TABLE game_metrics (
+CREATE TABLE IF NOT EXISTS game_metrics (
     time            TIMESTAMPTZ NOT NULL,
     provider        VARCHAR(50) NOT NULL,
     game_id         VARCHAR(100),
@@ -129,12 +135,13 @@ CREATE TABLE game_metrics (
 );
 
 SELECT create_hypertable('game_metrics', 'time',
-    chunk_time_interval => INTERVAL '1 day'
+    chunk_time_interval => INTERVAL '1 day',
+    if_not_exists => TRUE
 );
 
 -- 5. WebSocket Connection Metrics
 -- Live games, real-time updates
-CREATE TABLE websocket_metrics (
+CREATE TABLE IF NOT EXISTS websocket_metrics (
     time            TIMESTAMPTZ NOT NULL,
     connection_id   UUID NOT NULL,
     player_id       UUID,
@@ -158,12 +165,13 @@ CREATE TABLE websocket_metrics (
 );
 
 SELECT create_hypertable('websocket_metrics', 'time',
-    chunk_time_interval => INTERVAL '1 day'
+    chunk_time_interval => INTERVAL '1 day',
+    if_not_exists => TRUE
 );
 
 -- 6. Business Metrics (Aggregated)
 -- GGR, sessions, conversions
-CREATE TABLE business_metrics (
+CREATE TABLE IF NOT EXISTS business_metrics (
     time            TIMESTAMPTZ NOT NULL,
     metric_type     VARCHAR(50) NOT NULL,  -- active_sessions, ggr, deposits, etc
     
@@ -180,12 +188,13 @@ CREATE TABLE business_metrics (
 );
 
 SELECT create_hypertable('business_metrics', 'time',
-    chunk_time_interval => INTERVAL '1 hour'
+    chunk_time_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
 );
 
 -- 7. Alert Events
 -- Anomalies, threshold breaches
-CREATE TABLE alert_events (
+CREATE TABLE IF NOT EXISTS alert_events (
     time            TIMESTAMPTZ NOT NULL,
     alert_type      VARCHAR(50) NOT NULL,
     severity        VARCHAR(10) NOT NULL,  -- info, warning, critical
@@ -205,7 +214,8 @@ CREATE TABLE alert_events (
 );
 
 SELECT create_hypertable('alert_events', 'time',
-    chunk_time_interval => INTERVAL '7 days'
+    chunk_time_interval => INTERVAL '7 days',
+    if_not_exists => TRUE
 );
 
 -- ============================================
@@ -213,106 +223,154 @@ SELECT create_hypertable('alert_events', 'time',
 -- ============================================
 
 -- Frontend
-CREATE INDEX idx_frontend_session ON frontend_metrics (session_id, time DESC);
-CREATE INDEX idx_frontend_player ON frontend_metrics (player_id, time DESC) WHERE player_id IS NOT NULL;
-CREATE INDEX idx_frontend_event_type ON frontend_metrics (event_type, time DESC);
-CREATE INDEX idx_frontend_page ON frontend_metrics (page_path, time DESC);
+CREATE INDEX IF NOT EXISTS idx_frontend_session ON frontend_metrics (session_id, time DESC);
+CREATE INDEX IF NOT EXISTS idx_frontend_player ON frontend_metrics (player_id, time DESC) WHERE player_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_frontend_event_type ON frontend_metrics (event_type, time DESC);
+CREATE INDEX IF NOT EXISTS idx_frontend_page ON frontend_metrics (page_path, time DESC);
 
 -- API
-CREATE INDEX idx_api_service ON api_metrics (service_name, time DESC);
-CREATE INDEX idx_api_endpoint ON api_metrics (endpoint, time DESC);
-CREATE INDEX idx_api_errors ON api_metrics (status_code, time DESC) WHERE status_code >= 400;
+CREATE INDEX IF NOT EXISTS idx_api_service ON api_metrics (service_name, time DESC);
+CREATE INDEX IF NOT EXISTS idx_api_endpoint ON api_metrics (endpoint, time DESC);
+CREATE INDEX IF NOT EXISTS idx_api_errors ON api_metrics (status_code, time DESC) WHERE status_code >= 400;
 
 -- PSP
-CREATE INDEX idx_psp_provider ON psp_metrics (psp_name, time DESC);
-CREATE INDEX idx_psp_operation ON psp_metrics (operation, success, time DESC);
-CREATE INDEX idx_psp_errors ON psp_metrics (psp_name, time DESC) WHERE NOT success;
+CREATE INDEX IF NOT EXISTS idx_psp_provider ON psp_metrics (psp_name, time DESC);
+CREATE INDEX IF NOT EXISTS idx_psp_operation ON psp_metrics (operation, success, time DESC);
+CREATE INDEX IF NOT EXISTS idx_psp_errors ON psp_metrics (psp_name, time DESC) WHERE NOT success;
 
 -- Games
-CREATE INDEX idx_game_provider ON game_metrics (provider, time DESC);
-CREATE INDEX idx_game_errors ON game_metrics (provider, time DESC) WHERE NOT launch_success;
+CREATE INDEX IF NOT EXISTS idx_game_provider ON game_metrics (provider, time DESC);
+CREATE INDEX IF NOT EXISTS idx_game_errors ON game_metrics (provider, time DESC) WHERE NOT launch_success;
 
 -- WebSocket
-CREATE INDEX idx_ws_player ON websocket_metrics (player_id, time DESC) WHERE player_id IS NOT NULL;
-CREATE INDEX idx_ws_errors ON websocket_metrics (time DESC) WHERE event_type = 'error';
+CREATE INDEX IF NOT EXISTS idx_ws_player ON websocket_metrics (player_id, time DESC) WHERE player_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ws_errors ON websocket_metrics (time DESC) WHERE event_type = 'error';
 
 -- Business
-CREATE INDEX idx_business_type ON business_metrics (metric_type, time DESC);
+CREATE INDEX IF NOT EXISTS idx_business_type ON business_metrics (metric_type, time DESC);
 
 -- Alerts
-CREATE INDEX idx_alerts_unresolved ON alert_events (severity, time DESC) WHERE resolved_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_alerts_unresolved ON alert_events (severity, time DESC) WHERE resolved_at IS NULL;
 
 -- ============================================
 -- RETENTION POLICIES
 -- ============================================
 
 -- Raw frontend metrics: 7 days (high volume)
-SELECT add_retention_policy('frontend_metrics', INTERVAL '7 days');
+SELECT add_retention_policy('frontend_metrics', INTERVAL '7 days', if_not_exists => TRUE);
 
 -- API metrics: 14 days
-SELECT add_retention_policy('api_metrics', INTERVAL '14 days');
+SELECT add_retention_policy('api_metrics', INTERVAL '14 days', if_not_exists => TRUE);
 
 -- PSP metrics: 90 days (compliance/audit)
-SELECT add_retention_policy('psp_metrics', INTERVAL '90 days');
+SELECT add_retention_policy('psp_metrics', INTERVAL '90 days', if_not_exists => TRUE);
 
 -- Game metrics: 30 days
-SELECT add_retention_policy('game_metrics', INTERVAL '30 days');
+SELECT add_retention_policy('game_metrics', INTERVAL '30 days', if_not_exists => TRUE);
 
 -- WebSocket: 7 days
-SELECT add_retention_policy('websocket_metrics', INTERVAL '7 days');
+SELECT add_retention_policy('websocket_metrics', INTERVAL '7 days', if_not_exists => TRUE);
 
 -- Business metrics: 1 year
-SELECT add_retention_policy('business_metrics', INTERVAL '365 days');
+SELECT add_retention_policy('business_metrics', INTERVAL '365 days', if_not_exists => TRUE);
 
 -- Alerts: 90 days
-SELECT add_retention_policy('alert_events', INTERVAL '90 days');
+SELECT add_retention_policy('alert_events', INTERVAL '90 days', if_not_exists => TRUE);
 
 -- ============================================
 -- COMPRESSION POLICIES
 -- ============================================
 
--- Enable compression on all hypertables
-ALTER TABLE frontend_metrics SET (
-    timescaledb.compress,
-    timescaledb.compress_segmentby = 'event_type, device_type',
-    timescaledb.compress_orderby = 'time DESC'
-);
-SELECT add_compression_policy('frontend_metrics', INTERVAL '1 day');
-
-ALTER TABLE api_metrics SET (
-    timescaledb.compress,
-    timescaledb.compress_segmentby = 'service_name, endpoint',
-    timescaledb.compress_orderby = 'time DESC'
-);
-SELECT add_compression_policy('api_metrics', INTERVAL '2 days');
-
-ALTER TABLE psp_metrics SET (
-    timescaledb.compress,
-    timescaledb.compress_segmentby = 'psp_name, operation',
-    timescaledb.compress_orderby = 'time DESC'
-);
-SELECT add_compression_policy('psp_metrics', INTERVAL '3 days');
-
-ALTER TABLE game_metrics SET (
-    timescaledb.compress,
-    timescaledb.compress_segmentby = 'provider',
-    timescaledb.compress_orderby = 'time DESC'
-);
-SELECT add_compression_policy('game_metrics', INTERVAL '2 days');
-
-ALTER TABLE websocket_metrics SET (
-    timescaledb.compress,
-    timescaledb.compress_segmentby = 'event_type',
-    timescaledb.compress_orderby = 'time DESC'
-);
-SELECT add_compression_policy('websocket_metrics', INTERVAL '1 day');
-
-ALTER TABLE business_metrics SET (
-    timescaledb.compress,
-    timescaledb.compress_segmentby = 'metric_type',
-    timescaledb.compress_orderby = 'time DESC'
-);
-SELECT add_compression_policy('business_metrics', INTERVAL '7 days');
+-- Enable compression on all hypertables (skipped when already enabled)
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM timescaledb_information.hypertables
+        WHERE hypertable_name = 'frontend_metrics' AND compression_enabled
+    ) THEN
+        ALTER TABLE frontend_metrics SET (
+            timescaledb.compress,
+            timescaledb.compress_segmentby = 'event_type, device_type',
+            timescaledb.compress_orderby = 'time DESC'
+        );
+    END IF;
+END $$;
+SELECT add_compression_policy('frontend_metrics', INTERVAL '1 day', if_not_exists => TRUE);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM timescaledb_information.hypertables
+        WHERE hypertable_name = 'api_metrics' AND compression_enabled
+    ) THEN
+        ALTER TABLE api_metrics SET (
+            timescaledb.compress,
+            timescaledb.compress_segmentby = 'service_name, endpoint',
+            timescaledb.compress_orderby = 'time DESC'
+        );
+    END IF;
+END $$;
+SELECT add_compression_policy('api_metrics', INTERVAL '2 days', if_not_exists => TRUE);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM timescaledb_information.hypertables
+        WHERE hypertable_name = 'psp_metrics' AND compression_enabled
+    ) THEN
+        ALTER TABLE psp_metrics SET (
+            timescaledb.compress,
+            timescaledb.compress_segmentby = 'psp_name, operation',
+            timescaledb.compress_orderby = 'time DESC'
+        );
+    END IF;
+END $$;
+SELECT add_compression_policy('psp_metrics', INTERVAL '3 days', if_not_exists => TRUE);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM timescaledb_information.hypertables
+        WHERE hypertable_name = 'game_metrics' AND compression_enabled
+    ) THEN
+        ALTER TABLE game_metrics SET (
+            timescaledb.compress,
+            timescaledb.compress_segmentby = 'provider',
+            timescaledb.compress_orderby = 'time DESC'
+        );
+    END IF;
+END $$;
+SELECT add_compression_policy('game_metrics', INTERVAL '2 days', if_not_exists => TRUE);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM timescaledb_information.hypertables
+        WHERE hypertable_name = 'websocket_metrics' AND compression_enabled
+    ) THEN
+        ALTER TABLE websocket_metrics SET (
+            timescaledb.compress,
+            timescaledb.compress_segmentby = 'event_type',
+            timescaledb.compress_orderby = 'time DESC'
+        );
+    END IF;
+END $$;
+SELECT add_compression_policy('websocket_metrics', INTERVAL '1 day', if_not_exists => TRUE);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM timescaledb_information.hypertables
+        WHERE hypertable_name = 'business_metrics' AND compression_enabled
+    ) THEN
+        ALTER TABLE business_metrics SET (
+            timescaledb.compress,
+            timescaledb.compress_segmentby = 'metric_type',
+            timescaledb.compress_orderby = 'time DESC'
+        );
+    END IF;
+END $$;
+SELECT add_compression_policy('business_metrics', INTERVAL '7 days', if_not_exists => TRUE);
 
 -- ============================================
 -- CONTINUOUS AGGREGATES (Materialized Views)
@@ -320,7 +378,7 @@ SELECT add_compression_policy('business_metrics', INTERVAL '7 days');
 -- ============================================
 
 -- API Performance Summary (1-minute buckets)
-CREATE MATERIALIZED VIEW api_performance_1m
+CREATE MATERIALIZED VIEW IF NOT EXISTS api_performance_1m
 WITH (timescaledb.continuous) AS
 SELECT
     time_bucket('1 minute', time) AS bucket,
@@ -339,11 +397,12 @@ WITH NO DATA;
 SELECT add_continuous_aggregate_policy('api_performance_1m',
     start_offset => INTERVAL '10 minutes',
     end_offset => INTERVAL '1 minute',
-    schedule_interval => INTERVAL '1 minute'
+    schedule_interval => INTERVAL '1 minute',
+    if_not_exists => TRUE
 );
 
 -- PSP Success Rates (5-minute buckets)
-CREATE MATERIALIZED VIEW psp_success_5m
+CREATE MATERIALIZED VIEW IF NOT EXISTS psp_success_5m
 WITH (timescaledb.continuous) AS
 SELECT
     time_bucket('5 minutes', time) AS bucket,
@@ -361,11 +420,12 @@ WITH NO DATA;
 SELECT add_continuous_aggregate_policy('psp_success_5m',
     start_offset => INTERVAL '30 minutes',
     end_offset => INTERVAL '5 minutes',
-    schedule_interval => INTERVAL '5 minutes'
+    schedule_interval => INTERVAL '5 minutes',
+    if_not_exists => TRUE
 );
 
 -- Web Vitals Summary (hourly)
-CREATE MATERIALIZED VIEW web_vitals_hourly
+CREATE MATERIALIZED VIEW IF NOT EXISTS web_vitals_hourly
 WITH (timescaledb.continuous) AS
 SELECT
     time_bucket('1 hour', time) AS bucket,
@@ -392,11 +452,12 @@ WITH NO DATA;
 SELECT add_continuous_aggregate_policy('web_vitals_hourly',
     start_offset => INTERVAL '3 hours',
     end_offset => INTERVAL '1 hour',
-    schedule_interval => INTERVAL '1 hour'
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
 );
 
 -- Game Provider Health (5-minute buckets)
-CREATE MATERIALIZED VIEW game_health_5m
+CREATE MATERIALIZED VIEW IF NOT EXISTS game_health_5m
 WITH (timescaledb.continuous) AS
 SELECT
     time_bucket('5 minutes', time) AS bucket,
@@ -413,7 +474,8 @@ WITH NO DATA;
 SELECT add_continuous_aggregate_policy('game_health_5m',
     start_offset => INTERVAL '30 minutes',
     end_offset => INTERVAL '5 minutes',
-    schedule_interval => INTERVAL '5 minutes'
+    schedule_interval => INTERVAL '5 minutes',
+    if_not_exists => TRUE
 );
 
 -- ============================================
@@ -463,38 +525,3 @@ BEGIN
     ORDER BY success_rate ASC;
 END;
 $$ LANGUAGE plpgsql;
-
--- ============================================
--- EXAMPLE QUERIES FOR DASHBOARD
--- ============================================
-
--- Real-time API health (last 5 minutes)
--- SELECT * FROM api_performance_1m 
--- WHERE bucket > NOW() - INTERVAL '5 minutes'
--- ORDER BY bucket DESC;
-
--- PSP success rates
--- SELECT * FROM get_psp_health('15 minutes');
-
--- Web Vitals by page (last 24 hours)
--- SELECT * FROM web_vitals_hourly
--- WHERE bucket > NOW() - INTERVAL '24 hours'
--- ORDER BY bucket DESC;
-
--- Active alerts
--- SELECT * FROM alert_events
--- WHERE resolved_at IS NULL
--- ORDER BY severity DESC, time DESC;
-
--- ============================================
--- GRANTS (adjust for your setup)
--- ============================================
-
--- Read-only role for dashboard
--- CREATE ROLE pulse_reader;
--- GRANT SELECT ON ALL TABLES IN SCHEMA public TO pulse_reader;
--- GRANT SELECT ON ALL SEQUENCES IN SCHEMA public TO pulse_reader;
-
--- Writer role for collectors
--- CREATE ROLE pulse_writer;
--- GRANT INSERT ON frontend_metrics, api_metrics, psp_metrics, game_metrics, websocket_metrics, business_metrics TO pulse_writer;
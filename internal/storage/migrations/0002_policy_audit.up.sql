@@ -0,0 +1,12 @@
+-- Audit trail for retention / compression policy changes made through the admin API
+CREATE TABLE IF NOT EXISTS policy_audit (
+    id              BIGSERIAL PRIMARY KEY,
+    time            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    actor           VARCHAR(255) NOT NULL,  -- email of the super admin
+    hypertable      VARCHAR(63) NOT NULL,
+    policy          VARCHAR(20) NOT NULL,   -- retention, compression
+    old_value       TEXT,                   -- interval, NULL = no policy
+    new_value       TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_policy_audit_time ON policy_audit (time DESC);
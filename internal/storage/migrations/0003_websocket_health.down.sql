@@ -0,0 +1,2 @@
+-- migrate:no-transaction
+DROP MATERIALIZED VIEW IF EXISTS websocket_health_1m;
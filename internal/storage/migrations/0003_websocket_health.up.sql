@@ -0,0 +1,34 @@
+-- migrate:no-transaction
+-- WebSocket connection health (1-minute buckets)
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS websocket_health_1m
+WITH (timescaledb.continuous) AS
+SELECT
+    time_bucket('1 minute', time) AS bucket,
+    endpoint,
+    device_type,
+    SUM(CASE WHEN event_type = 'connect' THEN 1 ELSE 0 END) AS connects,
+    SUM(CASE WHEN event_type = 'disconnect' THEN 1 ELSE 0 END) AS disconnects,
+    SUM(CASE WHEN event_type = 'error' THEN 1 ELSE 0 END) AS errors,
+    SUM(CASE WHEN event_type = 'reconnect' THEN 1 ELSE 0 END) AS reconnects,
+    COUNT(latency_ms) AS latency_count,
+    AVG(latency_ms) AS avg_latency_ms,
+    PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY latency_ms) AS p50_latency_ms,
+    PERCENTILE_CONT(0.95) WITHIN GROUP (ORDER BY latency_ms) AS p95_latency_ms,
+    COUNT(CASE WHEN messages_sent IS NOT NULL OR messages_received IS NOT NULL THEN 1 END) AS message_reports,
+    COALESCE(SUM(messages_sent), 0) AS messages_sent,
+    COALESCE(SUM(messages_received), 0) AS messages_received,
+    SUM(CASE WHEN close_code = 1000 THEN 1 ELSE 0 END) AS close_normal,
+    SUM(CASE WHEN close_code = 1001 THEN 1 ELSE 0 END) AS close_going_away,
+    SUM(CASE WHEN close_code = 1006 THEN 1 ELSE 0 END) AS close_abnormal,
+    SUM(CASE WHEN close_code IS NOT NULL AND close_code NOT IN (1000, 1001, 1006) THEN 1 ELSE 0 END) AS close_other
+FROM websocket_metrics
+GROUP BY bucket, endpoint, device_type
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('websocket_health_1m',
+    start_offset => INTERVAL '10 minutes',
+    end_offset => INTERVAL '1 minute',
+    schedule_interval => INTERVAL '1 minute',
+    if_not_exists => TRUE
+);
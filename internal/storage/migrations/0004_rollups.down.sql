@@ -0,0 +1,10 @@
+-- migrate:no-transaction
+DROP MATERIALIZED VIEW IF EXISTS websocket_health_1d;
+DROP MATERIALIZED VIEW IF EXISTS websocket_health_1h;
+DROP MATERIALIZED VIEW IF EXISTS web_vitals_daily;
+DROP MATERIALIZED VIEW IF EXISTS game_health_1d;
+DROP MATERIALIZED VIEW IF EXISTS game_health_1h;
+DROP MATERIALIZED VIEW IF EXISTS psp_success_1d;
+DROP MATERIALIZED VIEW IF EXISTS psp_success_1h;
+DROP MATERIALIZED VIEW IF EXISTS api_performance_1d;
+DROP MATERIALIZED VIEW IF EXISTS api_performance_1h;
@@ -0,0 +1,249 @@
+-- migrate:no-transaction
+-- Hourly and daily rollups layered on the existing continuous aggregates.
+-- Counts and sums are exact; averages are weighted by sample count.
+-- Percentiles are not mergeable, so a rollup reports the highest percentile
+-- of its finer buckets (an upper bound).
+-- Rollups are real-time (materialized_only = false) so the newest bucket is
+-- computed from the finer aggregate until it is materialized.
+
+-- ============================================
+-- API
+-- ============================================
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS api_performance_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', bucket) AS bucket,
+    service_name,
+    endpoint,
+    SUM(request_count) AS request_count,
+    SUM(avg_duration_ms * request_count) / NULLIF(SUM(request_count), 0) AS avg_duration_ms,
+    MAX(p95_duration_ms) AS p95_duration_ms,
+    MAX(p99_duration_ms) AS p99_duration_ms,
+    SUM(error_count) AS error_count,
+    SUM(server_error_count) AS server_error_count
+FROM api_performance_1m
+GROUP BY 1, service_name, endpoint
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('api_performance_1h',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes',
+    if_not_exists => TRUE
+);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS api_performance_1d
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 day', bucket) AS bucket,
+    service_name,
+    endpoint,
+    SUM(request_count) AS request_count,
+    SUM(avg_duration_ms * request_count) / NULLIF(SUM(request_count), 0) AS avg_duration_ms,
+    MAX(p95_duration_ms) AS p95_duration_ms,
+    MAX(p99_duration_ms) AS p99_duration_ms,
+    SUM(error_count) AS error_count,
+    SUM(server_error_count) AS server_error_count
+FROM api_performance_1h
+GROUP BY 1, service_name, endpoint
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('api_performance_1d',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+-- ============================================
+-- PSP
+-- ============================================
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS psp_success_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', bucket) AS bucket,
+    psp_name,
+    operation,
+    SUM(total_count) AS total_count,
+    SUM(success_count) AS success_count,
+    SUM(avg_duration_ms * total_count) / NULLIF(SUM(total_count), 0) AS avg_duration_ms,
+    MAX(p95_duration_ms) AS p95_duration_ms,
+    SUM(total_amount) AS total_amount
+FROM psp_success_5m
+GROUP BY 1, psp_name, operation
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('psp_success_1h',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes',
+    if_not_exists => TRUE
+);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS psp_success_1d
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 day', bucket) AS bucket,
+    psp_name,
+    operation,
+    SUM(total_count) AS total_count,
+    SUM(success_count) AS success_count,
+    SUM(avg_duration_ms * total_count) / NULLIF(SUM(total_count), 0) AS avg_duration_ms,
+    MAX(p95_duration_ms) AS p95_duration_ms,
+    SUM(total_amount) AS total_amount
+FROM psp_success_1h
+GROUP BY 1, psp_name, operation
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('psp_success_1d',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+-- ============================================
+-- GAMES
+-- ============================================
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS game_health_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', bucket) AS bucket,
+    provider,
+    game_type,
+    SUM(launch_count) AS launch_count,
+    SUM(success_count) AS success_count,
+    SUM(avg_load_time_ms * launch_count) / NULLIF(SUM(launch_count), 0) AS avg_load_time_ms,
+    MAX(p95_load_time_ms) AS p95_load_time_ms
+FROM game_health_5m
+GROUP BY 1, provider, game_type
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('game_health_1h',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes',
+    if_not_exists => TRUE
+);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS game_health_1d
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 day', bucket) AS bucket,
+    provider,
+    game_type,
+    SUM(launch_count) AS launch_count,
+    SUM(success_count) AS success_count,
+    SUM(avg_load_time_ms * launch_count) / NULLIF(SUM(launch_count), 0) AS avg_load_time_ms,
+    MAX(p95_load_time_ms) AS p95_load_time_ms
+FROM game_health_1h
+GROUP BY 1, provider, game_type
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('game_health_1d',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+-- ============================================
+-- WEB VITALS (base aggregate is already hourly)
+-- ============================================
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS web_vitals_daily
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 day', bucket) AS bucket,
+    device_type,
+    page_path,
+    SUM(sample_count) AS sample_count,
+    SUM(avg_lcp_ms * sample_count) / NULLIF(SUM(sample_count), 0) AS avg_lcp_ms,
+    MAX(p75_lcp_ms) AS p75_lcp_ms,
+    SUM(avg_fid_ms * sample_count) / NULLIF(SUM(sample_count), 0) AS avg_fid_ms,
+    MAX(p75_fid_ms) AS p75_fid_ms,
+    SUM(avg_cls * sample_count) / NULLIF(SUM(sample_count), 0) AS avg_cls,
+    MAX(p75_cls) AS p75_cls,
+    SUM(avg_inp_ms * sample_count) / NULLIF(SUM(sample_count), 0) AS avg_inp_ms,
+    MAX(p75_inp_ms) AS p75_inp_ms
+FROM web_vitals_hourly
+GROUP BY 1, device_type, page_path
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('web_vitals_daily',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+-- ============================================
+-- WEBSOCKET
+-- ============================================
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS websocket_health_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', bucket) AS bucket,
+    endpoint,
+    device_type,
+    SUM(connects) AS connects,
+    SUM(disconnects) AS disconnects,
+    SUM(errors) AS errors,
+    SUM(reconnects) AS reconnects,
+    SUM(latency_count) AS latency_count,
+    SUM(avg_latency_ms * latency_count) / NULLIF(SUM(latency_count), 0) AS avg_latency_ms,
+    MAX(p50_latency_ms) AS p50_latency_ms,
+    MAX(p95_latency_ms) AS p95_latency_ms,
+    SUM(message_reports) AS message_reports,
+    SUM(messages_sent) AS messages_sent,
+    SUM(messages_received) AS messages_received,
+    SUM(close_normal) AS close_normal,
+    SUM(close_going_away) AS close_going_away,
+    SUM(close_abnormal) AS close_abnormal,
+    SUM(close_other) AS close_other
+FROM websocket_health_1m
+GROUP BY 1, endpoint, device_type
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('websocket_health_1h',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes',
+    if_not_exists => TRUE
+);
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS websocket_health_1d
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 day', bucket) AS bucket,
+    endpoint,
+    device_type,
+    SUM(connects) AS connects,
+    SUM(disconnects) AS disconnects,
+    SUM(errors) AS errors,
+    SUM(reconnects) AS reconnects,
+    SUM(latency_count) AS latency_count,
+    SUM(avg_latency_ms * latency_count) / NULLIF(SUM(latency_count), 0) AS avg_latency_ms,
+    MAX(p50_latency_ms) AS p50_latency_ms,
+    MAX(p95_latency_ms) AS p95_latency_ms,
+    SUM(message_reports) AS message_reports,
+    SUM(messages_sent) AS messages_sent,
+    SUM(messages_received) AS messages_received,
+    SUM(close_normal) AS close_normal,
+    SUM(close_going_away) AS close_going_away,
+    SUM(close_abnormal) AS close_abnormal,
+    SUM(close_other) AS close_other
+FROM websocket_health_1h
+GROUP BY 1, endpoint, device_type
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('websocket_health_1d',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
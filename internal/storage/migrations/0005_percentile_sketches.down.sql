@@ -0,0 +1,121 @@
+-- migrate:no-transaction
+-- Drops the sketch aggregates and resumes refreshing the PERCENTILE_CONT ones
+-- (0001, 0003, 0004). Their policies only cover recent buckets: refresh the
+-- time since 0005 ran with refresh_continuous_aggregate while raw data for it
+-- is still kept.
+
+DROP MATERIALIZED VIEW IF EXISTS websocket_health_v2_1d;
+DROP MATERIALIZED VIEW IF EXISTS websocket_health_v2_1h;
+DROP MATERIALIZED VIEW IF EXISTS websocket_health_v2_1m;
+DROP MATERIALIZED VIEW IF EXISTS web_vitals_v2_daily;
+DROP MATERIALIZED VIEW IF EXISTS web_vitals_v2_hourly;
+DROP MATERIALIZED VIEW IF EXISTS game_health_v2_1d;
+DROP MATERIALIZED VIEW IF EXISTS game_health_v2_1h;
+DROP MATERIALIZED VIEW IF EXISTS game_health_v2_5m;
+DROP MATERIALIZED VIEW IF EXISTS psp_success_v2_1d;
+DROP MATERIALIZED VIEW IF EXISTS psp_success_v2_1h;
+DROP MATERIALIZED VIEW IF EXISTS psp_success_v2_5m;
+DROP MATERIALIZED VIEW IF EXISTS api_performance_v2_1d;
+DROP MATERIALIZED VIEW IF EXISTS api_performance_v2_1h;
+DROP MATERIALIZED VIEW IF EXISTS api_performance_v2_1m;
+
+DROP FUNCTION IF EXISTS legacy_sketch(BIGINT, DOUBLE PRECISION, DOUBLE PRECISION[], DOUBLE PRECISION[]);
+DROP TABLE IF EXISTS aggregate_cutovers;
+
+SELECT add_continuous_aggregate_policy('api_performance_1m',
+    start_offset => INTERVAL '10 minutes',
+    end_offset => INTERVAL '1 minute',
+    schedule_interval => INTERVAL '1 minute',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('api_performance_1h',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('api_performance_1d',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('psp_success_5m',
+    start_offset => INTERVAL '30 minutes',
+    end_offset => INTERVAL '5 minutes',
+    schedule_interval => INTERVAL '5 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('psp_success_1h',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('psp_success_1d',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('game_health_5m',
+    start_offset => INTERVAL '30 minutes',
+    end_offset => INTERVAL '5 minutes',
+    schedule_interval => INTERVAL '5 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('game_health_1h',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('game_health_1d',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('web_vitals_hourly',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('web_vitals_daily',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('websocket_health_1m',
+    start_offset => INTERVAL '10 minutes',
+    end_offset => INTERVAL '1 minute',
+    schedule_interval => INTERVAL '1 minute',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('websocket_health_1h',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('websocket_health_1d',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
@@ -0,0 +1,433 @@
+-- migrate:no-transaction
+-- Mergeable timescaledb_toolkit sketches (percentile_agg = uddsketch, 200
+-- buckets, 0.1% relative error) instead of PERCENTILE_CONT columns. Sketches
+-- combine with rollup(), so percentiles and means stay correct across buckets,
+-- rollup levels and any dimension combination; read them with
+-- approx_percentile(), mean() and num_vals().
+--
+-- Continuous aggregates cannot gain columns, so the sketch aggregates are new
+-- *_v2_* views next to the PERCENTILE_CONT ones (0001, 0003, 0004). The new
+-- views are materialized from the raw tables; aggregate_cutovers records the
+-- first day each one covers completely. Earlier buckets stay in the old views,
+-- which keep their history but are no longer refreshed, and queries read them
+-- through legacy_sketch(). Drop them (and their eras in resolution.go) once
+-- that history is no longer needed.
+
+CREATE EXTENSION IF NOT EXISTS timescaledb_toolkit;
+
+CREATE TABLE IF NOT EXISTS aggregate_cutovers (
+    hierarchy   TEXT PRIMARY KEY,       -- finest view of the hierarchy, without its bucket suffix
+    since       TIMESTAMPTZ NOT NULL    -- first bucket served by it; earlier ones come from the views it replaced
+);
+
+-- legacy_sketch approximates the sketch of an old PERCENTILE_CONT row from the
+-- summary it kept: up to 100 synthetic values holding the given percentiles
+-- (quantiles ascending), with the rest set so their mean is mean_value. Means
+-- and the stored percentiles read back closely; other percentiles and
+-- num_vals() are estimates, counts come from the count columns.
+CREATE OR REPLACE FUNCTION legacy_sketch(
+    n BIGINT, mean_value DOUBLE PRECISION, quantiles DOUBLE PRECISION[], vals DOUBLE PRECISION[]
+) RETURNS uddsketch LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$
+    SELECT percentile_agg(COALESCE(high, low))
+    FROM (
+        SELECT high,
+               GREATEST((k * mean_value - COALESCE(SUM(high) OVER (), 0))
+                        / NULLIF(COUNT(*) FILTER (WHERE high IS NULL) OVER (), 0), 0) AS low
+        FROM (
+            SELECT LEAST(n, 100) AS k,
+                   (SELECT v FROM unnest(quantiles, vals) AS a(q, v)
+                    WHERE i >= q * LEAST(n, 100) ORDER BY q DESC LIMIT 1) AS high
+            FROM generate_series(1, LEAST(n, 100)) AS i
+        ) positions
+    ) samples
+$$;
+
+-- ============================================
+-- API
+-- ============================================
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS api_performance_v2_1m
+WITH (timescaledb.continuous) AS
+SELECT
+    time_bucket('1 minute', time) AS bucket,
+    service_name,
+    endpoint,
+    COUNT(*) AS request_count,
+    percentile_agg(duration_ms) AS duration_sketch,
+    SUM(CASE WHEN status_code >= 400 THEN 1 ELSE 0 END) AS error_count,
+    SUM(CASE WHEN status_code >= 500 THEN 1 ELSE 0 END) AS server_error_count
+FROM api_metrics
+GROUP BY bucket, service_name, endpoint
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS api_performance_v2_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', bucket) AS bucket,
+    service_name,
+    endpoint,
+    SUM(request_count) AS request_count,
+    rollup(duration_sketch) AS duration_sketch,
+    SUM(error_count) AS error_count,
+    SUM(server_error_count) AS server_error_count
+FROM api_performance_v2_1m
+GROUP BY 1, service_name, endpoint
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS api_performance_v2_1d
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 day', bucket) AS bucket,
+    service_name,
+    endpoint,
+    SUM(request_count) AS request_count,
+    rollup(duration_sketch) AS duration_sketch,
+    SUM(error_count) AS error_count,
+    SUM(server_error_count) AS server_error_count
+FROM api_performance_v2_1h
+GROUP BY 1, service_name, endpoint
+WITH NO DATA;
+
+-- ============================================
+-- PSP
+-- ============================================
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS psp_success_v2_5m
+WITH (timescaledb.continuous) AS
+SELECT
+    time_bucket('5 minutes', time) AS bucket,
+    psp_name,
+    operation,
+    COUNT(*) AS total_count,
+    SUM(CASE WHEN success THEN 1 ELSE 0 END) AS success_count,
+    percentile_agg(duration_ms) AS duration_sketch,
+    SUM(amount) FILTER (WHERE success) AS total_amount
+FROM psp_metrics
+GROUP BY bucket, psp_name, operation
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS psp_success_v2_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', bucket) AS bucket,
+    psp_name,
+    operation,
+    SUM(total_count) AS total_count,
+    SUM(success_count) AS success_count,
+    rollup(duration_sketch) AS duration_sketch,
+    SUM(total_amount) AS total_amount
+FROM psp_success_v2_5m
+GROUP BY 1, psp_name, operation
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS psp_success_v2_1d
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 day', bucket) AS bucket,
+    psp_name,
+    operation,
+    SUM(total_count) AS total_count,
+    SUM(success_count) AS success_count,
+    rollup(duration_sketch) AS duration_sketch,
+    SUM(total_amount) AS total_amount
+FROM psp_success_v2_1h
+GROUP BY 1, psp_name, operation
+WITH NO DATA;
+
+-- ============================================
+-- GAMES
+-- ============================================
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS game_health_v2_5m
+WITH (timescaledb.continuous) AS
+SELECT
+    time_bucket('5 minutes', time) AS bucket,
+    provider,
+    game_type,
+    COUNT(*) AS launch_count,
+    SUM(CASE WHEN launch_success THEN 1 ELSE 0 END) AS success_count,
+    percentile_agg(load_time_ms) AS load_time_sketch
+FROM game_metrics
+GROUP BY bucket, provider, game_type
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS game_health_v2_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', bucket) AS bucket,
+    provider,
+    game_type,
+    SUM(launch_count) AS launch_count,
+    SUM(success_count) AS success_count,
+    rollup(load_time_sketch) AS load_time_sketch
+FROM game_health_v2_5m
+GROUP BY 1, provider, game_type
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS game_health_v2_1d
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 day', bucket) AS bucket,
+    provider,
+    game_type,
+    SUM(launch_count) AS launch_count,
+    SUM(success_count) AS success_count,
+    rollup(load_time_sketch) AS load_time_sketch
+FROM game_health_v2_1h
+GROUP BY 1, provider, game_type
+WITH NO DATA;
+
+-- ============================================
+-- WEB VITALS
+-- ============================================
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS web_vitals_v2_hourly
+WITH (timescaledb.continuous) AS
+SELECT
+    time_bucket('1 hour', time) AS bucket,
+    device_type,
+    page_path,
+    COUNT(*) AS sample_count,
+    percentile_agg(lcp_ms) AS lcp_sketch,
+    percentile_agg(fid_ms) AS fid_sketch,
+    percentile_agg(cls) AS cls_sketch,
+    percentile_agg(inp_ms) AS inp_sketch
+FROM frontend_metrics
+WHERE event_type = 'web_vital'
+GROUP BY bucket, device_type, page_path
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS web_vitals_v2_daily
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 day', bucket) AS bucket,
+    device_type,
+    page_path,
+    SUM(sample_count) AS sample_count,
+    rollup(lcp_sketch) AS lcp_sketch,
+    rollup(fid_sketch) AS fid_sketch,
+    rollup(cls_sketch) AS cls_sketch,
+    rollup(inp_sketch) AS inp_sketch
+FROM web_vitals_v2_hourly
+GROUP BY 1, device_type, page_path
+WITH NO DATA;
+
+-- ============================================
+-- WEBSOCKET
+-- ============================================
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS websocket_health_v2_1m
+WITH (timescaledb.continuous) AS
+SELECT
+    time_bucket('1 minute', time) AS bucket,
+    endpoint,
+    device_type,
+    SUM(CASE WHEN event_type = 'connect' THEN 1 ELSE 0 END) AS connects,
+    SUM(CASE WHEN event_type = 'disconnect' THEN 1 ELSE 0 END) AS disconnects,
+    SUM(CASE WHEN event_type = 'error' THEN 1 ELSE 0 END) AS errors,
+    SUM(CASE WHEN event_type = 'reconnect' THEN 1 ELSE 0 END) AS reconnects,
+    percentile_agg(latency_ms) AS latency_sketch,
+    COUNT(CASE WHEN messages_sent IS NOT NULL OR messages_received IS NOT NULL THEN 1 END) AS message_reports,
+    COALESCE(SUM(messages_sent), 0) AS messages_sent,
+    COALESCE(SUM(messages_received), 0) AS messages_received,
+    SUM(CASE WHEN close_code = 1000 THEN 1 ELSE 0 END) AS close_normal,
+    SUM(CASE WHEN close_code = 1001 THEN 1 ELSE 0 END) AS close_going_away,
+    SUM(CASE WHEN close_code = 1006 THEN 1 ELSE 0 END) AS close_abnormal,
+    SUM(CASE WHEN close_code IS NOT NULL AND close_code NOT IN (1000, 1001, 1006) THEN 1 ELSE 0 END) AS close_other
+FROM websocket_metrics
+GROUP BY bucket, endpoint, device_type
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS websocket_health_v2_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', bucket) AS bucket,
+    endpoint,
+    device_type,
+    SUM(connects) AS connects,
+    SUM(disconnects) AS disconnects,
+    SUM(errors) AS errors,
+    SUM(reconnects) AS reconnects,
+    rollup(latency_sketch) AS latency_sketch,
+    SUM(message_reports) AS message_reports,
+    SUM(messages_sent) AS messages_sent,
+    SUM(messages_received) AS messages_received,
+    SUM(close_normal) AS close_normal,
+    SUM(close_going_away) AS close_going_away,
+    SUM(close_abnormal) AS close_abnormal,
+    SUM(close_other) AS close_other
+FROM websocket_health_v2_1m
+GROUP BY 1, endpoint, device_type
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS websocket_health_v2_1d
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 day', bucket) AS bucket,
+    endpoint,
+    device_type,
+    SUM(connects) AS connects,
+    SUM(disconnects) AS disconnects,
+    SUM(errors) AS errors,
+    SUM(reconnects) AS reconnects,
+    rollup(latency_sketch) AS latency_sketch,
+    SUM(message_reports) AS message_reports,
+    SUM(messages_sent) AS messages_sent,
+    SUM(messages_received) AS messages_received,
+    SUM(close_normal) AS close_normal,
+    SUM(close_going_away) AS close_going_away,
+    SUM(close_abnormal) AS close_abnormal,
+    SUM(close_other) AS close_other
+FROM websocket_health_v2_1h
+GROUP BY 1, endpoint, device_type
+WITH NO DATA;
+
+-- ============================================
+-- REFRESH POLICIES (same windows as the PERCENTILE_CONT views)
+-- ============================================
+
+SELECT add_continuous_aggregate_policy('api_performance_v2_1m',
+    start_offset => INTERVAL '10 minutes',
+    end_offset => INTERVAL '1 minute',
+    schedule_interval => INTERVAL '1 minute',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('api_performance_v2_1h',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('api_performance_v2_1d',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('psp_success_v2_5m',
+    start_offset => INTERVAL '30 minutes',
+    end_offset => INTERVAL '5 minutes',
+    schedule_interval => INTERVAL '5 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('psp_success_v2_1h',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('psp_success_v2_1d',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('game_health_v2_5m',
+    start_offset => INTERVAL '30 minutes',
+    end_offset => INTERVAL '5 minutes',
+    schedule_interval => INTERVAL '5 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('game_health_v2_1h',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('game_health_v2_1d',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('web_vitals_v2_hourly',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('web_vitals_v2_daily',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('websocket_health_v2_1m',
+    start_offset => INTERVAL '10 minutes',
+    end_offset => INTERVAL '1 minute',
+    schedule_interval => INTERVAL '1 minute',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('websocket_health_v2_1h',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('websocket_health_v2_1d',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+-- The PERCENTILE_CONT views only serve buckets before the cutover from now on
+SELECT remove_continuous_aggregate_policy('api_performance_1m', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('api_performance_1h', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('api_performance_1d', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('psp_success_5m', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('psp_success_1h', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('psp_success_1d', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('game_health_5m', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('game_health_1h', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('game_health_1d', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('web_vitals_hourly', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('web_vitals_daily', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('websocket_health_1m', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('websocket_health_1h', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('websocket_health_1d', if_exists => TRUE);
+
+-- ============================================
+-- BACKFILL from raw data, finer levels first
+-- ============================================
+
+CALL refresh_continuous_aggregate('api_performance_v2_1m', NULL, NULL);
+CALL refresh_continuous_aggregate('api_performance_v2_1h', NULL, NULL);
+CALL refresh_continuous_aggregate('api_performance_v2_1d', NULL, NULL);
+CALL refresh_continuous_aggregate('psp_success_v2_5m', NULL, NULL);
+CALL refresh_continuous_aggregate('psp_success_v2_1h', NULL, NULL);
+CALL refresh_continuous_aggregate('psp_success_v2_1d', NULL, NULL);
+CALL refresh_continuous_aggregate('game_health_v2_5m', NULL, NULL);
+CALL refresh_continuous_aggregate('game_health_v2_1h', NULL, NULL);
+CALL refresh_continuous_aggregate('game_health_v2_1d', NULL, NULL);
+CALL refresh_continuous_aggregate('web_vitals_v2_hourly', NULL, NULL);
+CALL refresh_continuous_aggregate('web_vitals_v2_daily', NULL, NULL);
+CALL refresh_continuous_aggregate('websocket_health_v2_1m', NULL, NULL);
+CALL refresh_continuous_aggregate('websocket_health_v2_1h', NULL, NULL);
+CALL refresh_continuous_aggregate('websocket_health_v2_1d', NULL, NULL);
+
+-- The first whole day of raw data is the first bucket every level of a new
+-- hierarchy has complete; without raw data the new views start today
+INSERT INTO aggregate_cutovers (hierarchy, since)
+SELECT h, COALESCE(first_day, time_bucket('1 day', now()))
+FROM (VALUES
+    ('api_performance_v2', (SELECT time_bucket('1 day', MIN(time)) + INTERVAL '1 day' FROM api_metrics)),
+    ('psp_success_v2', (SELECT time_bucket('1 day', MIN(time)) + INTERVAL '1 day' FROM psp_metrics)),
+    ('game_health_v2', (SELECT time_bucket('1 day', MIN(time)) + INTERVAL '1 day' FROM game_metrics)),
+    ('web_vitals_v2', (SELECT time_bucket('1 day', MIN(time)) + INTERVAL '1 day' FROM frontend_metrics WHERE event_type = 'web_vital')),
+    ('websocket_health_v2', (SELECT time_bucket('1 day', MIN(time)) + INTERVAL '1 day' FROM websocket_metrics))
+) AS c(h, first_day)
+ON CONFLICT (hierarchy) DO NOTHING;
@@ -0,0 +1,11 @@
+-- Chunks exported to the Parquet archive
+CREATE TABLE IF NOT EXISTS archive_manifest (
+    hypertable      VARCHAR(63) NOT NULL,
+    chunk_name      VARCHAR(63) NOT NULL,
+    range_start     TIMESTAMPTZ NOT NULL,
+    range_end       TIMESTAMPTZ NOT NULL,
+    row_count       BIGINT NOT NULL,
+    object_keys     TEXT[] NOT NULL,        -- one file per table and day
+    archived_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (hypertable, chunk_name)
+);
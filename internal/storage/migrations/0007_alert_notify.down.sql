@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS alert_events_notify ON alert_events;
+DROP FUNCTION IF EXISTS notify_alert_event();
@@ -0,0 +1,16 @@
+-- Notify listeners (the live stream) when alerts are raised, acknowledged or resolved
+CREATE OR REPLACE FUNCTION notify_alert_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('alert_events', json_build_object(
+        'time', NEW.time,
+        'alert_type', NEW.alert_type,
+        'severity', NEW.severity
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS alert_events_notify ON alert_events;
+CREATE TRIGGER alert_events_notify
+    AFTER INSERT OR UPDATE ON alert_events
+    FOR EACH ROW EXECUTE FUNCTION notify_alert_event();
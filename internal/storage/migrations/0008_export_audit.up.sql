@@ -0,0 +1,16 @@
+-- Audit trail of data exports (CSV, XLSX, NDJSON) made through the dashboard API
+CREATE TABLE IF NOT EXISTS export_audit (
+    id              BIGSERIAL PRIMARY KEY,
+    time            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    actor           VARCHAR(255) NOT NULL,  -- email of the signed-in user
+    resource        TEXT NOT NULL,          -- request path, e.g. /api/metrics/psp
+    format          VARCHAR(10) NOT NULL,   -- csv, xlsx, ndjson
+    params          TEXT NOT NULL,          -- query string without the token
+    row_count       BIGINT NOT NULL,
+    byte_count      BIGINT NOT NULL,
+    duration_ms     DOUBLE PRECISION NOT NULL,
+    error           TEXT                    -- NULL when the export completed
+);
+
+CREATE INDEX IF NOT EXISTS idx_export_audit_time ON export_audit (time DESC);
+CREATE INDEX IF NOT EXISTS idx_export_audit_actor ON export_audit (actor, time DESC);
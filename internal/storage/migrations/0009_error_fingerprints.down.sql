@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS error_fingerprints;
+
+DROP INDEX IF EXISTS idx_game_fingerprint;
+DROP INDEX IF EXISTS idx_psp_fingerprint;
+DROP INDEX IF EXISTS idx_api_fingerprint;
+
+ALTER TABLE game_metrics DROP COLUMN IF EXISTS error_fingerprint;
+ALTER TABLE psp_metrics DROP COLUMN IF EXISTS error_fingerprint;
+ALTER TABLE api_metrics DROP COLUMN IF EXISTS error_fingerprint;
@@ -0,0 +1,17 @@
+-- Error fingerprints: failures grouped by source, code and normalized message.
+-- Computed on ingest; rows written before this migration have none.
+ALTER TABLE api_metrics ADD COLUMN error_fingerprint VARCHAR(16);
+ALTER TABLE psp_metrics ADD COLUMN error_fingerprint VARCHAR(16);
+ALTER TABLE game_metrics ADD COLUMN error_fingerprint VARCHAR(16);
+
+CREATE INDEX IF NOT EXISTS idx_api_fingerprint ON api_metrics (error_fingerprint, time DESC) WHERE error_fingerprint IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_psp_fingerprint ON psp_metrics (error_fingerprint, time DESC) WHERE error_fingerprint IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_game_fingerprint ON game_metrics (error_fingerprint, time DESC) WHERE error_fingerprint IS NOT NULL;
+
+-- Earliest sighting per fingerprint, so first_seen needs no scan of compressed chunks
+CREATE TABLE IF NOT EXISTS error_fingerprints (
+    source          VARCHAR(10) NOT NULL,   -- api, psp, game
+    fingerprint     VARCHAR(16) NOT NULL,
+    first_seen      TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (source, fingerprint)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_game_player;
+DROP INDEX IF EXISTS idx_psp_player;
+DROP INDEX IF EXISTS idx_api_player;
@@ -0,0 +1,5 @@
+-- Player lookups for the timeline and event explorer; frontend and WebSocket
+-- metrics have had theirs since 0001
+CREATE INDEX IF NOT EXISTS idx_api_player ON api_metrics (player_id, time DESC) WHERE player_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_psp_player ON psp_metrics (player_id, time DESC) WHERE player_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_game_player ON game_metrics (player_id, time DESC) WHERE player_id IS NOT NULL;
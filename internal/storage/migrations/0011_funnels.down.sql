@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_frontend_metric_name;
+DROP TABLE IF EXISTS funnels;
@@ -0,0 +1,14 @@
+-- Conversion funnel definitions; steps is the JSON-encoded []FunnelStep
+CREATE TABLE IF NOT EXISTS funnels (
+    id              BIGSERIAL PRIMARY KEY,
+    name            VARCHAR(100) NOT NULL UNIQUE,
+    description     TEXT NOT NULL DEFAULT '',
+    steps           JSONB NOT NULL,
+    window_seconds  INTEGER NOT NULL CHECK (window_seconds > 0),
+    created_by      VARCHAR(255) NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Funnel steps filter frontend events by metric name
+CREATE INDEX IF NOT EXISTS idx_frontend_metric_name ON frontend_metrics (metric_name, time DESC) WHERE metric_name IS NOT NULL;
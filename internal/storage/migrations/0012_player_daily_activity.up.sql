@@ -0,0 +1,25 @@
+-- What each player did per UTC day, rebuilt nightly from frontend_metrics and
+-- psp_metrics. Raw frontend rows are kept for days only, so this table is the
+-- long-term record cohorts read; it has no retention policy.
+CREATE TABLE IF NOT EXISTS player_daily_activity (
+    day             DATE NOT NULL,
+    player_id       UUID NOT NULL,
+    sessions        INTEGER NOT NULL DEFAULT 0,
+    events          INTEGER NOT NULL DEFAULT 0,
+    transactions    INTEGER NOT NULL DEFAULT 0,  -- PSP operations of any kind
+    deposits        INTEGER NOT NULL DEFAULT 0,  -- successful deposits
+
+    -- First values seen that day
+    country         VARCHAR(2),
+    device_type     VARCHAR(20),
+    utm_source      VARCHAR(255),
+    utm_medium      VARCHAR(255),
+    utm_campaign    VARCHAR(255),
+    ref_code        VARCHAR(255),
+
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (player_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_activity_day ON player_daily_activity (day);
+CREATE INDEX IF NOT EXISTS idx_activity_deposits ON player_daily_activity (player_id, day) WHERE deposits > 0;
@@ -0,0 +1,23 @@
+-- migrate:no-transaction
+-- Back to the 0005 Web Vitals aggregates (LCP, FID, CLS, INP sketches only).
+-- Their policies only cover recent buckets: refresh the time since 0013 ran
+-- with refresh_continuous_aggregate while raw data for it is still kept.
+
+DROP MATERIALIZED VIEW IF EXISTS web_vitals_v3_daily;
+DROP MATERIALIZED VIEW IF EXISTS web_vitals_v3_hourly;
+
+DELETE FROM aggregate_cutovers WHERE hierarchy = 'web_vitals_v3';
+
+SELECT add_continuous_aggregate_policy('web_vitals_v2_hourly',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('web_vitals_v2_daily',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
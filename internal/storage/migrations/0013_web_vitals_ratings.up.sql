@@ -0,0 +1,107 @@
+-- migrate:no-transaction
+-- Web Vitals gain TTFB and FCP, and per metric the sample counts in Google's
+-- rating bands (good / needs improvement / poor) next to the sketch, which
+-- gives p50/p75/p90/p99. Thresholds (good up to, poor above):
+--   LCP 2500/4000 ms, FID 100/300 ms, CLS 0.1/0.25, INP 200/500 ms,
+--   TTFB 800/1800 ms, FCP 1800/3000 ms
+--
+-- The columns go into new web_vitals_v3_* aggregates next to the 0005 ones,
+-- which keep the buckets before the web_vitals_v3 cutover and are no longer
+-- refreshed. For those buckets queries estimate the bands from the sketches.
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS web_vitals_v3_hourly
+WITH (timescaledb.continuous) AS
+SELECT
+    time_bucket('1 hour', time) AS bucket,
+    device_type,
+    page_path,
+    COUNT(*) AS sample_count,
+    percentile_agg(lcp_ms) AS lcp_sketch,
+    SUM(CASE WHEN lcp_ms <= 2500 THEN 1 ELSE 0 END) AS lcp_good,
+    SUM(CASE WHEN lcp_ms > 2500 AND lcp_ms <= 4000 THEN 1 ELSE 0 END) AS lcp_needs_improvement,
+    SUM(CASE WHEN lcp_ms > 4000 THEN 1 ELSE 0 END) AS lcp_poor,
+    percentile_agg(fid_ms) AS fid_sketch,
+    SUM(CASE WHEN fid_ms <= 100 THEN 1 ELSE 0 END) AS fid_good,
+    SUM(CASE WHEN fid_ms > 100 AND fid_ms <= 300 THEN 1 ELSE 0 END) AS fid_needs_improvement,
+    SUM(CASE WHEN fid_ms > 300 THEN 1 ELSE 0 END) AS fid_poor,
+    percentile_agg(cls) AS cls_sketch,
+    SUM(CASE WHEN cls <= 0.1 THEN 1 ELSE 0 END) AS cls_good,
+    SUM(CASE WHEN cls > 0.1 AND cls <= 0.25 THEN 1 ELSE 0 END) AS cls_needs_improvement,
+    SUM(CASE WHEN cls > 0.25 THEN 1 ELSE 0 END) AS cls_poor,
+    percentile_agg(inp_ms) AS inp_sketch,
+    SUM(CASE WHEN inp_ms <= 200 THEN 1 ELSE 0 END) AS inp_good,
+    SUM(CASE WHEN inp_ms > 200 AND inp_ms <= 500 THEN 1 ELSE 0 END) AS inp_needs_improvement,
+    SUM(CASE WHEN inp_ms > 500 THEN 1 ELSE 0 END) AS inp_poor,
+    percentile_agg(ttfb_ms) AS ttfb_sketch,
+    SUM(CASE WHEN ttfb_ms <= 800 THEN 1 ELSE 0 END) AS ttfb_good,
+    SUM(CASE WHEN ttfb_ms > 800 AND ttfb_ms <= 1800 THEN 1 ELSE 0 END) AS ttfb_needs_improvement,
+    SUM(CASE WHEN ttfb_ms > 1800 THEN 1 ELSE 0 END) AS ttfb_poor,
+    percentile_agg(fcp_ms) AS fcp_sketch,
+    SUM(CASE WHEN fcp_ms <= 1800 THEN 1 ELSE 0 END) AS fcp_good,
+    SUM(CASE WHEN fcp_ms > 1800 AND fcp_ms <= 3000 THEN 1 ELSE 0 END) AS fcp_needs_improvement,
+    SUM(CASE WHEN fcp_ms > 3000 THEN 1 ELSE 0 END) AS fcp_poor
+FROM frontend_metrics
+WHERE event_type = 'web_vital'
+GROUP BY bucket, device_type, page_path
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS web_vitals_v3_daily
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 day', bucket) AS bucket,
+    device_type,
+    page_path,
+    SUM(sample_count) AS sample_count,
+    rollup(lcp_sketch) AS lcp_sketch,
+    SUM(lcp_good) AS lcp_good,
+    SUM(lcp_needs_improvement) AS lcp_needs_improvement,
+    SUM(lcp_poor) AS lcp_poor,
+    rollup(fid_sketch) AS fid_sketch,
+    SUM(fid_good) AS fid_good,
+    SUM(fid_needs_improvement) AS fid_needs_improvement,
+    SUM(fid_poor) AS fid_poor,
+    rollup(cls_sketch) AS cls_sketch,
+    SUM(cls_good) AS cls_good,
+    SUM(cls_needs_improvement) AS cls_needs_improvement,
+    SUM(cls_poor) AS cls_poor,
+    rollup(inp_sketch) AS inp_sketch,
+    SUM(inp_good) AS inp_good,
+    SUM(inp_needs_improvement) AS inp_needs_improvement,
+    SUM(inp_poor) AS inp_poor,
+    rollup(ttfb_sketch) AS ttfb_sketch,
+    SUM(ttfb_good) AS ttfb_good,
+    SUM(ttfb_needs_improvement) AS ttfb_needs_improvement,
+    SUM(ttfb_poor) AS ttfb_poor,
+    rollup(fcp_sketch) AS fcp_sketch,
+    SUM(fcp_good) AS fcp_good,
+    SUM(fcp_needs_improvement) AS fcp_needs_improvement,
+    SUM(fcp_poor) AS fcp_poor
+FROM web_vitals_v3_hourly
+GROUP BY 1, device_type, page_path
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('web_vitals_v3_hourly',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('web_vitals_v3_daily',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+SELECT remove_continuous_aggregate_policy('web_vitals_v2_hourly', if_exists => TRUE);
+SELECT remove_continuous_aggregate_policy('web_vitals_v2_daily', if_exists => TRUE);
+
+CALL refresh_continuous_aggregate('web_vitals_v3_hourly', NULL, NULL);
+CALL refresh_continuous_aggregate('web_vitals_v3_daily', NULL, NULL);
+
+INSERT INTO aggregate_cutovers (hierarchy, since)
+SELECT 'web_vitals_v3', COALESCE(time_bucket('1 day', MIN(time)) + INTERVAL '1 day', time_bucket('1 day', now()))
+FROM frontend_metrics
+WHERE event_type = 'web_vital'
+ON CONFLICT (hierarchy) DO NOTHING;
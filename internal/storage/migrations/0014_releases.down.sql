@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS deployments;
+
+DROP INDEX IF EXISTS idx_ws_release;
+DROP INDEX IF EXISTS idx_game_release;
+DROP INDEX IF EXISTS idx_psp_release;
+DROP INDEX IF EXISTS idx_api_release;
+DROP INDEX IF EXISTS idx_frontend_release;
+
+ALTER TABLE websocket_metrics DROP COLUMN IF EXISTS release;
+ALTER TABLE game_metrics DROP COLUMN IF EXISTS release;
+ALTER TABLE psp_metrics DROP COLUMN IF EXISTS release;
+ALTER TABLE api_metrics DROP COLUMN IF EXISTS release;
+ALTER TABLE frontend_metrics DROP COLUMN IF EXISTS release;
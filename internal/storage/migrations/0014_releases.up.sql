@@ -0,0 +1,28 @@
+-- Release tags: which build produced each row, set by the SDKs.
+-- Rows written before this migration have none.
+ALTER TABLE frontend_metrics ADD COLUMN release VARCHAR(100);
+ALTER TABLE api_metrics ADD COLUMN release VARCHAR(100);
+ALTER TABLE psp_metrics ADD COLUMN release VARCHAR(100);
+ALTER TABLE game_metrics ADD COLUMN release VARCHAR(100);
+ALTER TABLE websocket_metrics ADD COLUMN release VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS idx_frontend_release ON frontend_metrics (release, time DESC) WHERE release IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_api_release ON api_metrics (release, time DESC) WHERE release IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_psp_release ON psp_metrics (release, time DESC) WHERE release IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_game_release ON game_metrics (release, time DESC) WHERE release IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ws_release ON websocket_metrics (release, time DESC) WHERE release IS NOT NULL;
+
+-- Deployment annotations; the previous deployment is the default baseline
+-- of a release comparison
+CREATE TABLE IF NOT EXISTS deployments (
+    id              BIGSERIAL PRIMARY KEY,
+    release         VARCHAR(100) NOT NULL,
+    service         VARCHAR(100) NOT NULL DEFAULT '',
+    environment     VARCHAR(50) NOT NULL DEFAULT '',
+    description     TEXT NOT NULL DEFAULT '',
+    deployed_at     TIMESTAMPTZ NOT NULL,
+    created_by      VARCHAR(255) NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_deployments_time ON deployments (deployed_at DESC);
@@ -0,0 +1,4 @@
+-- migrate:no-transaction
+DROP MATERIALIZED VIEW IF EXISTS custom_metrics_1d;
+DROP MATERIALIZED VIEW IF EXISTS custom_metrics_1h;
+DROP MATERIALIZED VIEW IF EXISTS custom_metrics_5m;
@@ -0,0 +1,69 @@
+-- migrate:no-transaction
+-- Custom metrics (Pulse.track: metric_name / metric_value on frontend_metrics)
+-- by metric, device and page, with a value sketch for mean and percentiles.
+-- The rollups outlive the 7-day raw frontend retention.
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS custom_metrics_5m
+WITH (timescaledb.continuous) AS
+SELECT
+    time_bucket('5 minutes', time) AS bucket,
+    metric_name,
+    device_type,
+    page_path,
+    COUNT(*) AS sample_count,
+    percentile_agg(metric_value) AS value_sketch
+FROM frontend_metrics
+WHERE metric_name IS NOT NULL AND metric_value IS NOT NULL
+GROUP BY bucket, metric_name, device_type, page_path
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS custom_metrics_1h
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 hour', bucket) AS bucket,
+    metric_name,
+    device_type,
+    page_path,
+    SUM(sample_count) AS sample_count,
+    rollup(value_sketch) AS value_sketch
+FROM custom_metrics_5m
+GROUP BY 1, metric_name, device_type, page_path
+WITH NO DATA;
+
+CREATE MATERIALIZED VIEW IF NOT EXISTS custom_metrics_1d
+WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+SELECT
+    time_bucket('1 day', bucket) AS bucket,
+    metric_name,
+    device_type,
+    page_path,
+    SUM(sample_count) AS sample_count,
+    rollup(value_sketch) AS value_sketch
+FROM custom_metrics_1h
+GROUP BY 1, metric_name, device_type, page_path
+WITH NO DATA;
+
+SELECT add_continuous_aggregate_policy('custom_metrics_5m',
+    start_offset => INTERVAL '30 minutes',
+    end_offset => INTERVAL '5 minutes',
+    schedule_interval => INTERVAL '5 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('custom_metrics_1h',
+    start_offset => INTERVAL '3 hours',
+    end_offset => INTERVAL '1 hour',
+    schedule_interval => INTERVAL '30 minutes',
+    if_not_exists => TRUE
+);
+
+SELECT add_continuous_aggregate_policy('custom_metrics_1d',
+    start_offset => INTERVAL '3 days',
+    end_offset => INTERVAL '1 day',
+    schedule_interval => INTERVAL '1 hour',
+    if_not_exists => TRUE
+);
+
+CALL refresh_continuous_aggregate('custom_metrics_5m', NULL, NULL);
+CALL refresh_continuous_aggregate('custom_metrics_1h', NULL, NULL);
+CALL refresh_continuous_aggregate('custom_metrics_1d', NULL, NULL);
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// PercentileSummary is a latency distribution merged over a time range and filter
+type PercentileSummary struct {
+	Source string  `json:"source"`
+	Count  int64   `json:"count"`
+	Mean   float64 `json:"mean"`
+	P50    float64 `json:"p50"`
+	P75    float64 `json:"p75"`
+	P90    float64 `json:"p90"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+}
+
+// percentileSource maps a source name to its metric family and sketch column
+type percentileSource struct {
+	source *source
+	sketch string
+}
+
+var percentileSources = map[string]percentileSource{
+	"api":    {apiSource, "duration_sketch"},
+	"psp":    {pspSource, "duration_sketch"},
+	"game":   {gameSource, "load_time_sketch"},
+	"ws":     {wsSource, "latency_sketch"},
+	"lcp":    {vitalsSource, "lcp_sketch"},
+	"fid":    {vitalsSource, "fid_sketch"},
+	"cls":    {vitalsSource, "cls_sketch"},
+	"inp":    {vitalsSource, "inp_sketch"},
+	"ttfb":   {vitalsSource, "ttfb_sketch"},
+	"fcp":    {vitalsSource, "fcp_sketch"},
+	"custom": {customSource, "value_sketch"},
+}
+
+// planPercentiles rejects unknown sources and plans q against the source
+func planPercentiles(name string, q Query) (percentileSource, queryPlan, error) {
+	src, ok := percentileSources[name]
+	if !ok {
+		return src, queryPlan{}, fmt.Errorf("%w: unknown source %q", ErrInvalidArgument, name)
+	}
+	p, err := src.source.plan(q)
+	return src, p, err
+}
+
+// GetPercentiles merges the sketches of a source over the query range and
+// filters into one distribution
+func (p *Postgres) GetPercentiles(ctx context.Context, name string, q Query) (*PercentileSummary, error) {
+	src, plan, err := planPercentiles(name, q)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, args := src.source.relation(plan)
+	query := fmt.Sprintf(`
+		WITH merged AS (
+			SELECT rollup(%s) AS sketch FROM (%s) v
+		)
+		SELECT COALESCE(num_vals(sketch), 0)::bigint, COALESCE(mean(sketch), 0),
+		       COALESCE(approx_percentile(0.50, sketch), 0), COALESCE(approx_percentile(0.75, sketch), 0),
+		       COALESCE(approx_percentile(0.90, sketch), 0), COALESCE(approx_percentile(0.95, sketch), 0),
+		       COALESCE(approx_percentile(0.99, sketch), 0)
+		FROM merged
+	`, src.sketch, rel)
+
+	result := &PercentileSummary{Source: name}
+	err = p.reader.QueryRow(ctx, query, args...).Scan(
+		&result.Count, &result.Mean,
+		&result.P50, &result.P75, &result.P90, &result.P95, &result.P99,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query %s percentiles: %w", name, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// HypertableInfo summarizes a hypertable's storage and policies
+type HypertableInfo struct {
+	Name                   string  `json:"name"`
+	NumChunks              int64   `json:"num_chunks"`
+	CompressedChunks       int64   `json:"compressed_chunks"`
+	CompressionEnabled     bool    `json:"compression_enabled"`
+	TotalBytes             int64   `json:"total_bytes"`
+	BeforeCompressionBytes int64   `json:"before_compression_bytes"`
+	AfterCompressionBytes  int64   `json:"after_compression_bytes"`
+	CompressionRatio       float64 `json:"compression_ratio"` // before / after, 0 if nothing compressed
+	RetentionDropAfter     *string `json:"retention_drop_after"`
+	CompressAfter          *string `json:"compress_after"`
+}
+
+// ChunkInfo describes one chunk of a hypertable
+type ChunkInfo struct {
+	Name         string    `json:"name"`
+	RangeStart   time.Time `json:"range_start"`
+	RangeEnd     time.Time `json:"range_end"`
+	IsCompressed bool      `json:"is_compressed"`
+	TotalBytes   int64     `json:"total_bytes"`
+}
+
+// PolicyAuditRow records one policy change
+type PolicyAuditRow struct {
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	Hypertable string    `json:"hypertable"`
+	Policy     string    `json:"policy"`
+	OldValue   *string   `json:"old_value"`
+	NewValue   *string   `json:"new_value"`
+}
+
+// minRetention guards against accidentally dropping almost all data
+const minRetention = 24 * time.Hour
+
+// intervalUnits are the units accepted in policy intervals. Months and years
+// count 30 and 360 days, as Postgres does when comparing intervals.
+var intervalUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+	"mon": 30 * 24 * time.Hour, "mons": 30 * 24 * time.Hour, "month": 30 * 24 * time.Hour, "months": 30 * 24 * time.Hour,
+	"y": 360 * 24 * time.Hour, "year": 360 * 24 * time.Hour, "years": 360 * 24 * time.Hour,
+}
+
+// parsePolicyInterval parses a policy interval such as "180 days" or
+// "1 year 6 months": one or more whole, non-negative amounts with a unit.
+// This is the subset of the Postgres interval syntax passed on to
+// TimescaleDB unchanged.
+func parsePolicyInterval(s string) (time.Duration, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("%w: empty interval", ErrInvalidArgument)
+	}
+
+	var total time.Duration
+	for len(fields) > 0 {
+		// The unit may follow the amount directly ("7d") or as the next field
+		num := strings.TrimRight(fields[0], "abcdefghijklmnopqrstuvwxyz")
+		unit := fields[0][len(num):]
+		fields = fields[1:]
+		if unit == "" && len(fields) > 0 {
+			unit, fields = fields[0], fields[1:]
+		}
+
+		n, err := strconv.ParseInt(num, 10, 64)
+		step, ok := intervalUnits[unit]
+		if err != nil || n < 0 || !ok || n > int64((1<<63-1-total)/step) {
+			return 0, fmt.Errorf("%w: invalid interval %q", ErrInvalidArgument, s)
+		}
+		total += time.Duration(n) * step
+	}
+	return total, nil
+}
+
+// checkRetention validates a retention interval before it reaches the database
+func checkRetention(dropAfter string) error {
+	d, err := parsePolicyInterval(dropAfter)
+	if err != nil {
+		return err
+	}
+	if d < minRetention {
+		return fmt.Errorf("%w: retention must be at least 1 day", ErrInvalidArgument)
+	}
+	return nil
+}
+
+// checkCompression validates a compression interval before it reaches the database
+func checkCompression(compressAfter string) error {
+	d, err := parsePolicyInterval(compressAfter)
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return fmt.Errorf("%w: compression interval must be positive", ErrInvalidArgument)
+	}
+	return nil
+}
+
+// ListHypertables returns all user hypertables with sizes and current policies
+func (p *Postgres) ListHypertables(ctx context.Context) ([]HypertableInfo, error) {
+	query := `
+		SELECT h.hypertable_name, h.num_chunks, h.compression_enabled,
+		       COALESCE(hypertable_size(format('%I.%I', h.hypertable_schema, h.hypertable_name)::regclass), 0),
+		       COALESCE(cs.number_compressed_chunks, 0),
+		       COALESCE(cs.before_compression_total_bytes, 0),
+		       COALESCE(cs.after_compression_total_bytes, 0),
+		       (SELECT j.config->>'drop_after' FROM timescaledb_information.jobs j
+		        WHERE j.hypertable_schema = h.hypertable_schema AND j.hypertable_name = h.hypertable_name
+		          AND j.proc_name = 'policy_retention' LIMIT 1),
+		       (SELECT j.config->>'compress_after' FROM timescaledb_information.jobs j
+		        WHERE j.hypertable_schema = h.hypertable_schema AND j.hypertable_name = h.hypertable_name
+		          AND j.proc_name = 'policy_compression' LIMIT 1)
+		FROM timescaledb_information.hypertables h
+		LEFT JOIN LATERAL hypertable_compression_stats(
+		    format('%I.%I', h.hypertable_schema, h.hypertable_name)::regclass) cs ON true
+		WHERE h.hypertable_schema = 'public'
+		ORDER BY h.hypertable_name
+	`
+
+	rows, err := p.reader.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query hypertables: %w", err)
+	}
+	defer rows.Close()
+
+	var result []HypertableInfo
+	for rows.Next() {
+		var r HypertableInfo
+		if err := rows.Scan(
+			&r.Name, &r.NumChunks, &r.CompressionEnabled, &r.TotalBytes,
+			&r.CompressedChunks, &r.BeforeCompressionBytes, &r.AfterCompressionBytes,
+			&r.RetentionDropAfter, &r.CompressAfter,
+		); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		if r.AfterCompressionBytes > 0 {
+			r.CompressionRatio = float64(r.BeforeCompressionBytes) / float64(r.AfterCompressionBytes)
+		}
+		result = append(result, r)
+	}
+
+	return result, rows.Err()
+}
+
+// GetHypertableChunks lists the chunks of a hypertable with their sizes
+func (p *Postgres) GetHypertableChunks(ctx context.Context, hypertable string) ([]ChunkInfo, error) {
+	if err := p.requireHypertable(ctx, hypertable); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT c.chunk_name, c.range_start, c.range_end, c.is_compressed, COALESCE(d.total_bytes, 0)
+		FROM timescaledb_information.chunks c
+		LEFT JOIN chunks_detailed_size($1::regclass) d
+		       ON d.chunk_schema = c.chunk_schema AND d.chunk_name = c.chunk_name
+		WHERE c.hypertable_schema = 'public' AND c.hypertable_name = $2
+		ORDER BY c.range_start DESC
+	`
+
+	rows, err := p.reader.Query(ctx, query, hypertable, hypertable)
+	if err != nil {
+		return nil, fmt.Errorf("query chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var result []ChunkInfo
+	for rows.Next() {
+		var r ChunkInfo
+		if err := rows.Scan(&r.Name, &r.RangeStart, &r.RangeEnd, &r.IsCompressed, &r.TotalBytes); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		result = append(result, r)
+	}
+
+	return result, rows.Err()
+}
+
+// SetRetentionPolicy replaces the retention policy of a hypertable; nil removes it
+func (p *Postgres) SetRetentionPolicy(ctx context.Context, hypertable string, dropAfter *string, actor string) error {
+	if dropAfter != nil {
+		if err := checkRetention(*dropAfter); err != nil {
+			return err
+		}
+	}
+	if err := p.requireHypertable(ctx, hypertable); err != nil {
+		return err
+	}
+
+	return pgx.BeginFunc(ctx, p.writer, func(tx pgx.Tx) error {
+		old, err := currentPolicy(ctx, tx, hypertable, "policy_retention", "drop_after")
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `SELECT remove_retention_policy($1::regclass, if_exists => TRUE)`, hypertable); err != nil {
+			return fmt.Errorf("remove retention policy: %w", err)
+		}
+		if dropAfter != nil {
+			if _, err := tx.Exec(ctx, `SELECT add_retention_policy($1::regclass, $2::interval)`, hypertable, *dropAfter); err != nil {
+				return fmt.Errorf("add retention policy: %w", err)
+			}
+		}
+
+		return auditPolicy(ctx, tx, actor, hypertable, "retention", old, dropAfter)
+	})
+}
+
+// SetCompressionPolicy replaces the compression policy of a hypertable; nil removes it
+func (p *Postgres) SetCompressionPolicy(ctx context.Context, hypertable string, compressAfter *string, actor string) error {
+	if compressAfter != nil {
+		if err := checkCompression(*compressAfter); err != nil {
+			return err
+		}
+	}
+	if err := p.requireHypertable(ctx, hypertable); err != nil {
+		return err
+	}
+
+	return pgx.BeginFunc(ctx, p.writer, func(tx pgx.Tx) error {
+		var enabled bool
+		if err := tx.QueryRow(ctx, `
+			SELECT compression_enabled FROM timescaledb_information.hypertables
+			WHERE hypertable_schema = 'public' AND hypertable_name = $1
+		`, hypertable).Scan(&enabled); err != nil {
+			return fmt.Errorf("query compression settings: %w", err)
+		}
+		if !enabled && compressAfter != nil {
+			return fmt.Errorf("%w: compression is not enabled on %s", ErrInvalidArgument, hypertable)
+		}
+
+		old, err := currentPolicy(ctx, tx, hypertable, "policy_compression", "compress_after")
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `SELECT remove_compression_policy($1::regclass, if_exists => TRUE)`, hypertable); err != nil {
+			return fmt.Errorf("remove compression policy: %w", err)
+		}
+		if compressAfter != nil {
+			if _, err := tx.Exec(ctx, `SELECT add_compression_policy($1::regclass, $2::interval)`, hypertable, *compressAfter); err != nil {
+				return fmt.Errorf("add compression policy: %w", err)
+			}
+		}
+
+		return auditPolicy(ctx, tx, actor, hypertable, "compression", old, compressAfter)
+	})
+}
+
+// GetPolicyAudit returns the most recent policy changes
+func (p *Postgres) GetPolicyAudit(ctx context.Context, limit int) ([]PolicyAuditRow, error) {
+	rows, err := p.reader.Query(ctx, `
+		SELECT time, actor, hypertable, policy, old_value, new_value
+		FROM policy_audit
+		ORDER BY time DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query policy_audit: %w", err)
+	}
+	defer rows.Close()
+
+	var result []PolicyAuditRow
+	for rows.Next() {
+		var r PolicyAuditRow
+		if err := rows.Scan(&r.Time, &r.Actor, &r.Hypertable, &r.Policy, &r.OldValue, &r.NewValue); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		result = append(result, r)
+	}
+
+	return result, rows.Err()
+}
+
+// requireHypertable returns ErrNotFound unless name is a public hypertable.
+// Callers rely on this before passing the name to ::regclass.
+func (p *Postgres) requireHypertable(ctx context.Context, name string) error {
+	var exists bool
+	err := p.reader.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM timescaledb_information.hypertables
+			WHERE hypertable_schema = 'public' AND hypertable_name = $1
+		)
+	`, name).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("query hypertables: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("%w: hypertable %q", ErrNotFound, name)
+	}
+	return nil
+}
+
+func currentPolicy(ctx context.Context, tx pgx.Tx, hypertable, proc, key string) (*string, error) {
+	var value *string
+	err := tx.QueryRow(ctx, `
+		SELECT config->>$3 FROM timescaledb_information.jobs
+		WHERE hypertable_schema = 'public' AND hypertable_name = $1 AND proc_name = $2
+		LIMIT 1
+	`, hypertable, proc, key).Scan(&value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %w", proc, err)
+	}
+	return value, nil
+}
+
+func auditPolicy(ctx context.Context, tx pgx.Tx, actor, hypertable, policy string, oldValue, newValue *string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO policy_audit (actor, hypertable, policy, old_value, new_value)
+		VALUES ($1, $2, $3, $4, $5)
+	`, actor, hypertable, policy, oldValue, newValue)
+	if err != nil {
+		return fmt.Errorf("insert policy_audit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParsePolicyInterval(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"180 days", 180 * day},
+		{"1 day", day},
+		{"7d", 7 * day},
+		{"12h", 12 * time.Hour},
+		{"90 Minutes", 90 * time.Minute},
+		{"2 weeks", 14 * day},
+		{"6 months", 180 * day},
+		{"1 year 6 months", 540 * day},
+		{"1 mon 2d 3h", 32*day + 3*time.Hour},
+		{"  3   hours ", 3 * time.Hour},
+		{"0 days", 0},
+	}
+	for _, tt := range tests {
+		got, err := parsePolicyInterval(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parsePolicyInterval(%q) = %s, %v; want %s", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{
+		"", "   ", "days", "7", "7 fortnights", "-7 days", "1.5 days", "7 days ago",
+		"1 day; DROP TABLE api_metrics", "P7D", "01:00:00", "9223372036854775807 days",
+	} {
+		if d, err := parsePolicyInterval(in); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("parsePolicyInterval(%q) = %s, %v; want ErrInvalidArgument", in, d, err)
+		}
+	}
+}
+
+func TestCheckPolicies(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(string) error
+		in    string
+		valid bool
+	}{
+		{"retention at minimum", checkRetention, "1 day", true},
+		{"retention in hours", checkRetention, "24 hours", true},
+		{"retention long", checkRetention, "1 year", true},
+		{"retention too short", checkRetention, "23 hours", false},
+		{"retention zero", checkRetention, "0 days", false},
+		{"retention malformed", checkRetention, "forever", false},
+		{"compression short", checkCompression, "1 hour", true},
+		{"compression", checkCompression, "7 days", true},
+		{"compression zero", checkCompression, "0 days", false},
+		{"compression malformed", checkCompression, "7 dayz", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.check(tt.in)
+			if tt.valid && err != nil {
+				t.Errorf("%q rejected: %v", tt.in, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("%q = %v, want ErrInvalidArgument", tt.in, err)
+			}
+		})
+	}
+}
@@ -2,31 +2,77 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mcbile/product-pulse/internal/model"
 )
 
+// Postgres is the TimescaleDB backend. Collect paths use the writer pool;
+// dashboard reads use the reader pool, which may point at a replica so a
+// dashboard refresh storm cannot starve ingestion.
 type Postgres struct {
-	pool *pgxpool.Pool
+	writer *pgxpool.Pool
+	reader *pgxpool.Pool
 }
 
-func NewPostgres(databaseURL string) (*Postgres, error) {
-	config, err := pgxpool.ParseConfig(databaseURL)
+// PoolConfig configures one connection pool
+type PoolConfig struct {
+	URL              string
+	MaxConns         int32
+	MinConns         int32
+	StatementTimeout time.Duration // 0 = server default
+	ApplicationName  string
+}
+
+// Options configures the writer and reader pools. An empty Reader.URL reuses
+// the writer database with a separate pool.
+type Options struct {
+	Writer PoolConfig
+	Reader PoolConfig
+}
+
+// PoolStats is a snapshot of one connection pool
+type PoolStats struct {
+	TotalConns           int32   `json:"total_conns"`
+	IdleConns            int32   `json:"idle_conns"`
+	AcquiredConns        int32   `json:"acquired_conns"`
+	MaxConns             int32   `json:"max_conns"`
+	AcquireCount         int64   `json:"acquire_count"`
+	EmptyAcquireCount    int64   `json:"empty_acquire_count"`
+	CanceledAcquireCount int64   `json:"canceled_acquire_count"`
+	AvgAcquireTimeMS     float64 `json:"avg_acquire_time_ms"`
+}
+
+func NewPostgres(opts Options) (*Postgres, error) {
+	writer, err := newPool(opts.Writer)
 	if err != nil {
-		return nil, fmt.Errorf("parse config: %w", err)
+		return nil, fmt.Errorf("writer pool: %w", err)
 	}
 
-	// Connection pool settings
-	config.MaxConns = 20
-	config.MinConns = 5
-	config.MaxConnLifetime = time.Hour
-	config.MaxConnIdleTime = 30 * time.Minute
-	config.HealthCheckPeriod = time.Minute
+	readerCfg := opts.Reader
+	if readerCfg.URL == "" {
+		readerCfg.URL = opts.Writer.URL
+	}
+	reader, err := newPool(readerCfg)
+	if err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("reader pool: %w", err)
+	}
+
+	return &Postgres{writer: writer, reader: reader}, nil
+}
+
+func newPool(cfg PoolConfig) (*pgxpool.Pool, error) {
+	config, err := poolConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
@@ -38,255 +84,311 @@ func NewPostgres(databaseURL string) (*Postgres, error) {
 	defer cancel()
 
 	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("ping: %w", err)
 	}
 
-	return &Postgres{pool: pool}, nil
+	return pool, nil
 }
 
-func (p *Postgres) Close() {
-	p.pool.Close()
+// poolConfig translates a PoolConfig into pgx pool settings
+func poolConfig(cfg PoolConfig) (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+
+	// Connection pool settings
+	config.MaxConns = cfg.MaxConns
+	config.MinConns = cfg.MinConns
+	config.MaxConnLifetime = time.Hour
+	config.MaxConnIdleTime = 30 * time.Minute
+	config.HealthCheckPeriod = time.Minute
+
+	if cfg.ApplicationName != "" {
+		config.ConnConfig.RuntimeParams["application_name"] = cfg.ApplicationName
+	}
+	if cfg.StatementTimeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = fmt.Sprint(cfg.StatementTimeout.Milliseconds())
+	}
+	return config, nil
 }
 
-func (p *Postgres) Ping(ctx context.Context) error {
-	return p.pool.Ping(ctx)
+func (p *Postgres) Close() {
+	p.reader.Close()
+	p.writer.Close()
 }
 
-// InsertFrontendMetrics batch inserts frontend events
-func (p *Postgres) InsertFrontendMetrics(ctx context.Context, events []model.EnrichedEvent) error {
-	if len(events) == 0 {
-		return nil
+func (p *Postgres) Ping(ctx context.Context) error {
+	if err := p.writer.Ping(ctx); err != nil {
+		return fmt.Errorf("writer: %w", err)
 	}
-
-	// Build batch insert
-	columns := []string{
-		"time", "session_id", "player_id", "device_type", "browser", "country",
-		"event_type", "page_path", "lcp_ms", "fid_ms", "cls", "ttfb_ms", "fcp_ms", "inp_ms",
-		"metric_name", "metric_value", "metadata",
+	if err := p.reader.Ping(ctx); err != nil {
+		return fmt.Errorf("reader: %w", err)
 	}
+	return nil
+}
 
-	valueStrings := make([]string, 0, len(events))
-	valueArgs := make([]interface{}, 0, len(events)*len(columns))
-
-	for i, e := range events {
-		base := i * len(columns)
-		placeholders := make([]string, len(columns))
-		for j := range columns {
-			placeholders[j] = fmt.Sprintf("$%d", base+j+1)
-		}
-		valueStrings = append(valueStrings, "("+strings.Join(placeholders, ", ")+")")
+// PoolStats returns a snapshot of the writer and reader pools
+func (p *Postgres) PoolStats() map[string]PoolStats {
+	return map[string]PoolStats{
+		"writer": poolStats(p.writer),
+		"reader": poolStats(p.reader),
+	}
+}
 
-		valueArgs = append(valueArgs,
-			e.Time, e.SessionID, e.PlayerID, e.DeviceType, e.Browser, e.Country,
-			e.EventType, e.PagePath, e.LCP, e.FID, e.CLS, e.TTFB, e.FCP, e.INP,
-			e.MetricName, e.MetricValue, e.Metadata,
-		)
+func poolStats(pool *pgxpool.Pool) PoolStats {
+	s := pool.Stat()
+	var avgAcquire float64
+	if s.AcquireCount() > 0 {
+		avgAcquire = float64(s.AcquireDuration().Microseconds()) / float64(s.AcquireCount()) / 1000
+	}
+	return PoolStats{
+		TotalConns:           s.TotalConns(),
+		IdleConns:            s.IdleConns(),
+		AcquiredConns:        s.AcquiredConns(),
+		MaxConns:             s.MaxConns(),
+		AcquireCount:         s.AcquireCount(),
+		EmptyAcquireCount:    s.EmptyAcquireCount(),
+		CanceledAcquireCount: s.CanceledAcquireCount(),
+		AvgAcquireTimeMS:     avgAcquire,
 	}
+}
 
-	query := fmt.Sprintf(
-		"INSERT INTO frontend_metrics (%s) VALUES %s",
-		strings.Join(columns, ", "),
-		strings.Join(valueStrings, ", "),
-	)
+// withoutStatementTimeout runs fn on a writer connection with statement_timeout
+// disabled, for maintenance work such as migrations and aggregate refreshes
+func (p *Postgres) withoutStatementTimeout(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	return unboundedConn(ctx, p.writer, fn)
+}
 
-	_, err := p.pool.Exec(ctx, query, valueArgs...)
-	return err
+// readWithoutStatementTimeout is withoutStatementTimeout on a reader
+// connection, for streaming reads whose length depends on the client
+func (p *Postgres) readWithoutStatementTimeout(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	return unboundedConn(ctx, p.reader, fn)
 }
 
-// InsertAPIMetrics batch inserts API metrics
-func (p *Postgres) InsertAPIMetrics(ctx context.Context, metrics []model.APIMetric) error {
-	if len(metrics) == 0 {
-		return nil
+func unboundedConn(ctx context.Context, pool *pgxpool.Pool, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire connection: %w", err)
 	}
+	defer conn.Release()
 
-	columns := []string{
-		"time", "service_name", "endpoint", "method", "duration_ms", "status_code",
-		"player_id", "request_id", "error_type", "error_message",
-		"request_size", "response_size", "metadata",
+	if _, err := conn.Exec(ctx, `SET statement_timeout = 0`); err != nil {
+		return err
 	}
+	defer conn.Exec(context.Background(), `RESET statement_timeout`)
 
-	valueStrings := make([]string, 0, len(metrics))
-	valueArgs := make([]interface{}, 0, len(metrics)*len(columns))
+	return fn(conn)
+}
 
-	for i, m := range metrics {
-		base := i * len(columns)
-		placeholders := make([]string, len(columns))
-		for j := range columns {
-			placeholders[j] = fmt.Sprintf("$%d", base+j+1)
+// readWithTimeout runs fn in a read-only transaction on a reader connection
+// with statement_timeout set to timeout (0 keeps the reader's), for ad-hoc
+// reads shaped by the request. A cancelled statement is ErrTimeout.
+func (p *Postgres) readWithTimeout(ctx context.Context, timeout time.Duration, fn func(tx pgx.Tx) error) error {
+	err := pgx.BeginTxFunc(ctx, p.reader, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		if timeout > 0 {
+			if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())); err != nil {
+				return err
+			}
 		}
-		valueStrings = append(valueStrings, "("+strings.Join(placeholders, ", ")+")")
-
-		valueArgs = append(valueArgs,
-			m.Time, m.ServiceName, m.Endpoint, m.Method, m.DurationMS, m.StatusCode,
-			m.PlayerID, m.RequestID, m.ErrorType, m.ErrorMessage,
-			m.RequestSize, m.ResponseSize, m.Metadata,
-		)
+		return fn(tx)
+	})
+	var pgErr *pgconn.PgError
+	if (errors.As(err, &pgErr) && pgErr.Code == "57014") || errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: narrow the range or filters", ErrTimeout)
 	}
-
-	query := fmt.Sprintf(
-		"INSERT INTO api_metrics (%s) VALUES %s",
-		strings.Join(columns, ", "),
-		strings.Join(valueStrings, ", "),
-	)
-
-	_, err := p.pool.Exec(ctx, query, valueArgs...)
 	return err
 }
 
-// InsertPSPMetrics batch inserts PSP metrics
-func (p *Postgres) InsertPSPMetrics(ctx context.Context, metrics []model.PSPMetric) error {
-	if len(metrics) == 0 {
+// maxQueryParams is the PostgreSQL bind parameter limit per statement
+const maxQueryParams = 65535
+
+// insertRows writes rows with multi-VALUES INSERTs, split into statements that
+// stay under the parameter limit and wrapped in one transaction
+func (p *Postgres) insertRows(ctx context.Context, table string, columns []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
 		return nil
 	}
 
-	columns := []string{
-		"time", "psp_name", "operation", "duration_ms", "success",
-		"player_id", "transaction_id", "amount", "currency",
-		"error_code", "error_message", "psp_response_code", "metadata",
-	}
+	perStatement := maxQueryParams / len(columns)
 
-	valueStrings := make([]string, 0, len(metrics))
-	valueArgs := make([]interface{}, 0, len(metrics)*len(columns))
+	return pgx.BeginFunc(ctx, p.writer, func(tx pgx.Tx) error {
+		for start := 0; start < len(rows); start += perStatement {
+			chunk := rows[start:min(start+perStatement, len(rows))]
 
-	for i, m := range metrics {
-		base := i * len(columns)
-		placeholders := make([]string, len(columns))
-		for j := range columns {
-			placeholders[j] = fmt.Sprintf("$%d", base+j+1)
-		}
-		valueStrings = append(valueStrings, "("+strings.Join(placeholders, ", ")+")")
+			valueStrings := make([]string, 0, len(chunk))
+			valueArgs := make([]interface{}, 0, len(chunk)*len(columns))
 
-		valueArgs = append(valueArgs,
-			m.Time, m.PSPName, m.Operation, m.DurationMS, m.Success,
-			m.PlayerID, m.TransactionID, m.Amount, m.Currency,
-			m.ErrorCode, m.ErrorMessage, m.PSPResponseCode, m.Metadata,
-		)
-	}
+			for i, row := range chunk {
+				base := i * len(columns)
+				placeholders := make([]string, len(columns))
+				for j := range columns {
+					placeholders[j] = fmt.Sprintf("$%d", base+j+1)
+				}
+				valueStrings = append(valueStrings, "("+strings.Join(placeholders, ", ")+")")
+				valueArgs = append(valueArgs, row...)
+			}
 
-	query := fmt.Sprintf(
-		"INSERT INTO psp_metrics (%s) VALUES %s",
-		strings.Join(columns, ", "),
-		strings.Join(valueStrings, ", "),
-	)
+			query := fmt.Sprintf(
+				"INSERT INTO %s (%s) VALUES %s",
+				table,
+				strings.Join(columns, ", "),
+				strings.Join(valueStrings, ", "),
+			)
 
-	_, err := p.pool.Exec(ctx, query, valueArgs...)
-	return err
+			if _, err := tx.Exec(ctx, query, valueArgs...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-// InsertGameMetrics batch inserts game provider metrics
-func (p *Postgres) InsertGameMetrics(ctx context.Context, metrics []model.GameMetric) error {
-	if len(metrics) == 0 {
+// copyRows writes rows with the COPY protocol
+func (p *Postgres) copyRows(ctx context.Context, table string, columns []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
 		return nil
 	}
 
-	columns := []string{
-		"time", "provider", "game_id", "game_type", "load_time_ms", "launch_success",
-		"player_id", "session_id", "device_type", "error_type", "error_message", "metadata",
-	}
+	_, err := p.writer.CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromRows(rows))
+	return err
+}
 
-	valueStrings := make([]string, 0, len(metrics))
-	valueArgs := make([]interface{}, 0, len(metrics)*len(columns))
+// InsertFrontendMetrics batch inserts frontend events
+func (p *Postgres) InsertFrontendMetrics(ctx context.Context, events []model.EnrichedEvent) error {
+	return p.insertRows(ctx, "frontend_metrics", frontendColumns, encodeRows(events, frontendRow))
+}
 
-	for i, m := range metrics {
-		base := i * len(columns)
-		placeholders := make([]string, len(columns))
-		for j := range columns {
-			placeholders[j] = fmt.Sprintf("$%d", base+j+1)
-		}
-		valueStrings = append(valueStrings, "("+strings.Join(placeholders, ", ")+")")
+// CopyFrontendMetrics uses COPY for maximum throughput
+func (p *Postgres) CopyFrontendMetrics(ctx context.Context, events []model.EnrichedEvent) error {
+	return p.copyRows(ctx, "frontend_metrics", frontendColumns, encodeRows(events, frontendRow))
+}
 
-		valueArgs = append(valueArgs,
-			m.Time, m.Provider, m.GameID, m.GameType, m.LoadTimeMS, m.LaunchSuccess,
-			m.PlayerID, m.SessionID, m.DeviceType, m.ErrorType, m.ErrorMessage, m.Metadata,
-		)
+// InsertAPIMetrics batch inserts API metrics
+func (p *Postgres) InsertAPIMetrics(ctx context.Context, metrics []model.APIMetric) error {
+	rows := encodeRows(metrics, apiRow)
+	if err := p.insertRows(ctx, "api_metrics", apiColumns, rows); err != nil {
+		return err
 	}
-
-	query := fmt.Sprintf(
-		"INSERT INTO game_metrics (%s) VALUES %s",
-		strings.Join(columns, ", "),
-		strings.Join(valueStrings, ", "),
-	)
-
-	_, err := p.pool.Exec(ctx, query, valueArgs...)
-	return err
+	p.recordFirstSeen(ctx, "api", apiColumns, rows)
+	return nil
 }
 
-// InsertWebSocketMetrics batch inserts WebSocket metrics
-func (p *Postgres) InsertWebSocketMetrics(ctx context.Context, metrics []model.WebSocketMetric) error {
-	if len(metrics) == 0 {
-		return nil
+// CopyAPIMetrics uses COPY for API metrics
+func (p *Postgres) CopyAPIMetrics(ctx context.Context, metrics []model.APIMetric) error {
+	rows := encodeRows(metrics, apiRow)
+	if err := p.copyRows(ctx, "api_metrics", apiColumns, rows); err != nil {
+		return err
 	}
+	p.recordFirstSeen(ctx, "api", apiColumns, rows)
+	return nil
+}
 
-	columns := []string{
-		"time", "connection_id", "player_id", "event_type", "latency_ms",
-		"messages_sent", "messages_received", "close_code", "close_reason",
-		"endpoint", "device_type", "metadata",
+// InsertPSPMetrics batch inserts PSP metrics
+func (p *Postgres) InsertPSPMetrics(ctx context.Context, metrics []model.PSPMetric) error {
+	rows := encodeRows(metrics, pspRow)
+	if err := p.insertRows(ctx, "psp_metrics", pspColumns, rows); err != nil {
+		return err
 	}
+	p.recordFirstSeen(ctx, "psp", pspColumns, rows)
+	return nil
+}
 
-	valueStrings := make([]string, 0, len(metrics))
-	valueArgs := make([]interface{}, 0, len(metrics)*len(columns))
+// CopyPSPMetrics uses COPY for PSP metrics
+func (p *Postgres) CopyPSPMetrics(ctx context.Context, metrics []model.PSPMetric) error {
+	rows := encodeRows(metrics, pspRow)
+	if err := p.copyRows(ctx, "psp_metrics", pspColumns, rows); err != nil {
+		return err
+	}
+	p.recordFirstSeen(ctx, "psp", pspColumns, rows)
+	return nil
+}
 
-	for i, m := range metrics {
-		base := i * len(columns)
-		placeholders := make([]string, len(columns))
-		for j := range columns {
-			placeholders[j] = fmt.Sprintf("$%d", base+j+1)
-		}
-		valueStrings = append(valueStrings, "("+strings.Join(placeholders, ", ")+")")
+// InsertGameMetrics batch inserts game provider metrics
+func (p *Postgres) InsertGameMetrics(ctx context.Context, metrics []model.GameMetric) error {
+	rows := encodeRows(metrics, gameRow)
+	if err := p.insertRows(ctx, "game_metrics", gameColumns, rows); err != nil {
+		return err
+	}
+	p.recordFirstSeen(ctx, "game", gameColumns, rows)
+	return nil
+}
 
-		valueArgs = append(valueArgs,
-			m.Time, m.ConnectionID, m.PlayerID, m.EventType, m.LatencyMS,
-			m.MessagesSent, m.MessagesReceived, m.CloseCode, m.CloseReason,
-			m.Endpoint, m.DeviceType, m.Metadata,
-		)
+// CopyGameMetrics uses COPY for game provider metrics
+func (p *Postgres) CopyGameMetrics(ctx context.Context, metrics []model.GameMetric) error {
+	rows := encodeRows(metrics, gameRow)
+	if err := p.copyRows(ctx, "game_metrics", gameColumns, rows); err != nil {
+		return err
 	}
+	p.recordFirstSeen(ctx, "game", gameColumns, rows)
+	return nil
+}
+
+// InsertWebSocketMetrics batch inserts WebSocket metrics
+func (p *Postgres) InsertWebSocketMetrics(ctx context.Context, metrics []model.WebSocketMetric) error {
+	return p.insertRows(ctx, "websocket_metrics", wsColumns, encodeRows(metrics, wsRow))
+}
 
-	query := fmt.Sprintf(
-		"INSERT INTO websocket_metrics (%s) VALUES %s",
-		strings.Join(columns, ", "),
-		strings.Join(valueStrings, ", "),
-	)
+// CopyWebSocketMetrics uses COPY for WebSocket metrics
+func (p *Postgres) CopyWebSocketMetrics(ctx context.Context, metrics []model.WebSocketMetric) error {
+	return p.copyRows(ctx, "websocket_metrics", wsColumns, encodeRows(metrics, wsRow))
+}
 
-	_, err := p.pool.Exec(ctx, query, valueArgs...)
-	return err
+// continuousAggregates lists the continuous aggregates built on each hypertable,
+// in refresh order (rollups after the aggregates they read from)
+var continuousAggregates = map[string][]string{
+	"frontend_metrics":  append(viewsOf(vitalsResolutions), viewsOf(customResolutions)...),
+	"api_metrics":       viewsOf(apiResolutions),
+	"psp_metrics":       viewsOf(pspResolutions),
+	"game_metrics":      viewsOf(gameResolutions),
+	"websocket_metrics": viewsOf(wsResolutions),
 }
 
-// CopyFrontendMetrics uses COPY for maximum throughput
-func (p *Postgres) CopyFrontendMetrics(ctx context.Context, events []model.EnrichedEvent) error {
-	if len(events) == 0 {
+// RefreshAggregates re-materializes the continuous aggregates of a table over [start, end].
+// The window is widened to whole days so it always covers complete buckets.
+func (p *Postgres) RefreshAggregates(ctx context.Context, table string, start, end time.Time) error {
+	views, ok := continuousAggregates[table]
+	if !ok {
+		return fmt.Errorf("unknown table %q", table)
+	}
+
+	windowStart := start.UTC().Truncate(24 * time.Hour)
+	windowEnd := end.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+
+	return p.withoutStatementTimeout(ctx, func(conn *pgxpool.Conn) error {
+		for _, view := range views {
+			// CALL cannot run inside a transaction block
+			if _, err := conn.Exec(ctx,
+				`CALL refresh_continuous_aggregate($1::regclass, $2::timestamptz, $3::timestamptz)`,
+				view, windowStart, windowEnd,
+			); err != nil {
+				return fmt.Errorf("refresh %s: %w", view, err)
+			}
+		}
 		return nil
-	}
+	})
+}
 
-	columns := []string{
-		"time", "session_id", "player_id", "device_type", "browser", "country",
-		"event_type", "page_path", "lcp_ms", "fid_ms", "cls", "ttfb_ms", "fcp_ms", "inp_ms",
-		"metric_name", "metric_value", "metadata",
+// DeleteRange removes the raw rows of a metrics table in [start, end), for
+// synthetic data such as `collector bench` writes. Aggregates are not touched.
+func (p *Postgres) DeleteRange(ctx context.Context, table string, start, end time.Time) (int64, error) {
+	if _, ok := continuousAggregates[table]; !ok {
+		return 0, fmt.Errorf("unknown table %q", table)
 	}
-
-	rows := make([][]interface{}, len(events))
-	for i, e := range events {
-		rows[i] = []interface{}{
-			e.Time, e.SessionID, e.PlayerID, e.DeviceType, e.Browser, e.Country,
-			e.EventType, e.PagePath, e.LCP, e.FID, e.CLS, e.TTFB, e.FCP, e.INP,
-			e.MetricName, e.MetricValue, e.Metadata,
-		}
+	// The table name is one of the keys above, never caller input
+	tag, err := p.writer.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE time >= $1 AND time < $2`, table), start, end)
+	if err != nil {
+		return 0, fmt.Errorf("delete from %s: %w", table, err)
 	}
-
-	_, err := p.pool.CopyFrom(
-		ctx,
-		pgx.Identifier{"frontend_metrics"},
-		columns,
-		pgx.CopyFromRows(rows),
-	)
-
-	return err
+	return tag.RowsAffected(), nil
 }
 
 // ============================================
 // DASHBOARD QUERY METHODS
 // ============================================
 
-// APIPerformanceRow represents a row from api_performance_1m
+// APIPerformanceRow represents a row from api_performance_v2_1m or its hourly/daily rollups
 type APIPerformanceRow struct {
 	Bucket           time.Time `json:"bucket"`
 	ServiceName      string    `json:"service_name"`
@@ -300,19 +402,24 @@ type APIPerformanceRow struct {
 }
 
 // GetAPIPerformance retrieves API performance metrics from continuous aggregate
-func (p *Postgres) GetAPIPerformance(ctx context.Context, start time.Time) ([]APIPerformanceRow, error) {
-	query := `
+func (p *Postgres) GetAPIPerformance(ctx context.Context, q Query) ([]APIPerformanceRow, error) {
+	plan, err := apiSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	rel, args := apiSource.relation(plan)
+	query := fmt.Sprintf(`
 		SELECT bucket, service_name, endpoint, request_count,
-		       avg_duration_ms, p95_duration_ms, p99_duration_ms,
+		       mean(duration_sketch), approx_percentile(0.95, duration_sketch),
+		       approx_percentile(0.99, duration_sketch),
 		       error_count, server_error_count
-		FROM api_performance_1m
-		WHERE bucket >= $1
+		FROM (%s) v
 		ORDER BY bucket DESC, service_name, endpoint
-	`
+	`, rel)
 
-	rows, err := p.pool.Query(ctx, query, start)
+	rows, err := p.reader.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("query api_performance_1m: %w", err)
+		return nil, fmt.Errorf("query api performance: %w", err)
 	}
 	defer rows.Close()
 
@@ -338,34 +445,24 @@ type TimeSeriesPoint struct {
 	Value float64   `json:"value"`
 }
 
-// GetAPITimeSeries retrieves time series for a specific service
-func (p *Postgres) GetAPITimeSeries(ctx context.Context, serviceName string, start time.Time) ([]TimeSeriesPoint, error) {
-	query := `
-		SELECT bucket, avg_duration_ms
-		FROM api_performance_1m
-		WHERE service_name = $1 AND bucket >= $2
-		ORDER BY bucket ASC
-	`
-
-	rows, err := p.pool.Query(ctx, query, serviceName, start)
+// GetAPITimeSeries retrieves mean API latency over time
+func (p *Postgres) GetAPITimeSeries(ctx context.Context, q Query) ([]TimeSeriesPoint, error) {
+	plan, err := apiSource.plan(q)
 	if err != nil {
-		return nil, fmt.Errorf("query api timeseries: %w", err)
-	}
-	defer rows.Close()
-
-	var result []TimeSeriesPoint
-	for rows.Next() {
-		var r TimeSeriesPoint
-		if err := rows.Scan(&r.Time, &r.Value); err != nil {
-			return nil, fmt.Errorf("scan row: %w", err)
-		}
-		result = append(result, r)
+		return nil, err
 	}
+	rel, args := apiSource.relation(plan)
+	query := fmt.Sprintf(`
+		SELECT bucket, mean(rollup(duration_sketch))
+		FROM (%s) v
+		GROUP BY bucket
+		ORDER BY bucket ASC
+	`, rel)
 
-	return result, rows.Err()
+	return p.queryTimeSeries(ctx, "query api timeseries", query, args...)
 }
 
-// PSPHealthRow represents a row from psp_success_5m
+// PSPHealthRow represents a row from psp_success_v2_5m or its hourly/daily rollups
 type PSPHealthRow struct {
 	Bucket        time.Time `json:"bucket"`
 	PSPName       string    `json:"psp_name"`
@@ -378,18 +475,23 @@ type PSPHealthRow struct {
 }
 
 // GetPSPHealth retrieves PSP health metrics from continuous aggregate
-func (p *Postgres) GetPSPHealth(ctx context.Context, start time.Time) ([]PSPHealthRow, error) {
-	query := `
+func (p *Postgres) GetPSPHealth(ctx context.Context, q Query) ([]PSPHealthRow, error) {
+	plan, err := pspSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	rel, args := pspSource.relation(plan)
+	query := fmt.Sprintf(`
 		SELECT bucket, psp_name, operation, total_count, success_count,
-		       avg_duration_ms, p95_duration_ms, COALESCE(total_amount, 0)
-		FROM psp_success_5m
-		WHERE bucket >= $1
+		       mean(duration_sketch), approx_percentile(0.95, duration_sketch),
+		       COALESCE(total_amount, 0)
+		FROM (%s) v
 		ORDER BY bucket DESC, psp_name, operation
-	`
+	`, rel)
 
-	rows, err := p.pool.Query(ctx, query, start)
+	rows, err := p.reader.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("query psp_success_5m: %w", err)
+		return nil, fmt.Errorf("query psp health: %w", err)
 	}
 	defer rows.Close()
 
@@ -408,35 +510,25 @@ func (p *Postgres) GetPSPHealth(ctx context.Context, start time.Time) ([]PSPHeal
 	return result, rows.Err()
 }
 
-// GetPSPTimeSeries retrieves time series for a specific PSP
-func (p *Postgres) GetPSPTimeSeries(ctx context.Context, pspName string, start time.Time) ([]TimeSeriesPoint, error) {
-	query := `
-		SELECT bucket,
-		       CASE WHEN total_count > 0 THEN success_count::float / total_count * 100 ELSE 100 END as success_rate
-		FROM psp_success_5m
-		WHERE psp_name = $1 AND bucket >= $2
-		ORDER BY bucket ASC
-	`
-
-	rows, err := p.pool.Query(ctx, query, pspName, start)
+// GetPSPTimeSeries retrieves PSP success rate over time
+func (p *Postgres) GetPSPTimeSeries(ctx context.Context, q Query) ([]TimeSeriesPoint, error) {
+	plan, err := pspSource.plan(q)
 	if err != nil {
-		return nil, fmt.Errorf("query psp timeseries: %w", err)
-	}
-	defer rows.Close()
-
-	var result []TimeSeriesPoint
-	for rows.Next() {
-		var r TimeSeriesPoint
-		if err := rows.Scan(&r.Time, &r.Value); err != nil {
-			return nil, fmt.Errorf("scan row: %w", err)
-		}
-		result = append(result, r)
+		return nil, err
 	}
+	rel, args := pspSource.relation(plan)
+	query := fmt.Sprintf(`
+		SELECT bucket,
+		       COALESCE(SUM(success_count)::float / NULLIF(SUM(total_count), 0) * 100, 100) as success_rate
+		FROM (%s) v
+		GROUP BY bucket
+		ORDER BY bucket ASC
+	`, rel)
 
-	return result, rows.Err()
+	return p.queryTimeSeries(ctx, "query psp timeseries", query, args...)
 }
 
-// WebVitalsRow represents a row from web_vitals_hourly
+// WebVitalsRow represents a row from web_vitals_v3_hourly or its daily rollup
 type WebVitalsRow struct {
 	Bucket      time.Time `json:"bucket"`
 	DeviceType  string    `json:"device_type"`
@@ -450,34 +542,62 @@ type WebVitalsRow struct {
 	P75CLS      float64   `json:"p75_cls"`
 	AvgINPMS    float64   `json:"avg_inp_ms"`
 	P75INPMS    float64   `json:"p75_inp_ms"`
+	AvgTTFBMS   float64   `json:"avg_ttfb_ms"`
+	P75TTFBMS   float64   `json:"p75_ttfb_ms"`
+	AvgFCPMS    float64   `json:"avg_fcp_ms"`
+	P75FCPMS    float64   `json:"p75_fcp_ms"`
+
+	// Percentiles and rating bands per metric
+	LCP  VitalSummary `json:"lcp"`
+	FID  VitalSummary `json:"fid"`
+	CLS  VitalSummary `json:"cls"`
+	INP  VitalSummary `json:"inp"`
+	TTFB VitalSummary `json:"ttfb"`
+	FCP  VitalSummary `json:"fcp"`
+	// CWVPass is the Core Web Vitals assessment: the p75 of LCP, INP and CLS
+	// are all good. Null without samples of any of them.
+	CWVPass *bool `json:"cwv_pass"`
 }
 
-// GetWebVitals retrieves Web Vitals metrics from continuous aggregate
-func (p *Postgres) GetWebVitals(ctx context.Context, start time.Time) ([]WebVitalsRow, error) {
-	query := `
-		SELECT bucket, COALESCE(device_type, 'unknown'), COALESCE(page_path, '/'),
-		       sample_count, COALESCE(avg_lcp_ms, 0), COALESCE(p75_lcp_ms, 0),
-		       COALESCE(avg_fid_ms, 0), COALESCE(p75_fid_ms, 0),
-		       COALESCE(avg_cls, 0), COALESCE(p75_cls, 0),
-		       COALESCE(avg_inp_ms, 0), COALESCE(p75_inp_ms, 0)
-		FROM web_vitals_hourly
-		WHERE bucket >= $1
-		ORDER BY bucket DESC, device_type, page_path
-	`
+// GameHealthRow represents a row from game_health_v2_5m or its hourly/daily rollups
+type GameHealthRow struct {
+	Bucket        time.Time `json:"bucket"`
+	Provider      string    `json:"provider"`
+	GameType      string    `json:"game_type"`
+	LaunchCount   int64     `json:"launch_count"`
+	SuccessCount  int64     `json:"success_count"`
+	AvgLoadTimeMS float64   `json:"avg_load_time_ms"`
+	P95LoadTimeMS float64   `json:"p95_load_time_ms"`
+}
+
+// GetGameHealth retrieves game provider health metrics
+func (p *Postgres) GetGameHealth(ctx context.Context, q Query) ([]GameHealthRow, error) {
+	plan, err := gameSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	rel, args := gameSource.relation(plan)
+	query := fmt.Sprintf(`
+		SELECT bucket, provider, COALESCE(game_type, 'unknown'),
+		       launch_count, success_count,
+		       COALESCE(mean(load_time_sketch), 0), COALESCE(approx_percentile(0.95, load_time_sketch), 0)
+		FROM (%s) v
+		ORDER BY bucket DESC, provider, game_type
+	`, rel)
 
-	rows, err := p.pool.Query(ctx, query, start)
+	rows, err := p.reader.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("query web_vitals_hourly: %w", err)
+		return nil, fmt.Errorf("query game health: %w", err)
 	}
 	defer rows.Close()
 
-	var result []WebVitalsRow
+	var result []GameHealthRow
 	for rows.Next() {
-		var r WebVitalsRow
+		var r GameHealthRow
 		if err := rows.Scan(
-			&r.Bucket, &r.DeviceType, &r.PagePath, &r.SampleCount,
-			&r.AvgLCPMS, &r.P75LCPMS, &r.AvgFIDMS, &r.P75FIDMS,
-			&r.AvgCLS, &r.P75CLS, &r.AvgINPMS, &r.P75INPMS,
+			&r.Bucket, &r.Provider, &r.GameType,
+			&r.LaunchCount, &r.SuccessCount,
+			&r.AvgLoadTimeMS, &r.P95LoadTimeMS,
 		); err != nil {
 			return nil, fmt.Errorf("scan row: %w", err)
 		}
@@ -487,104 +607,159 @@ func (p *Postgres) GetWebVitals(ctx context.Context, start time.Time) ([]WebVita
 	return result, rows.Err()
 }
 
-// GetWebVitalsTimeSeries retrieves time series for a specific metric
-func (p *Postgres) GetWebVitalsTimeSeries(ctx context.Context, metric string, start time.Time) ([]TimeSeriesPoint, error) {
-	// Map metric name to column
-	column := "avg_lcp_ms"
-	switch metric {
-	case "lcp":
-		column = "avg_lcp_ms"
-	case "fid":
-		column = "avg_fid_ms"
-	case "cls":
-		column = "avg_cls"
-	case "inp":
-		column = "avg_inp_ms"
+// GetGameTimeSeries retrieves game launch success rate over time
+func (p *Postgres) GetGameTimeSeries(ctx context.Context, q Query) ([]TimeSeriesPoint, error) {
+	plan, err := gameSource.plan(q)
+	if err != nil {
+		return nil, err
 	}
-
+	rel, args := gameSource.relation(plan)
 	query := fmt.Sprintf(`
-		SELECT bucket, COALESCE(AVG(%s), 0)
-		FROM web_vitals_hourly
-		WHERE bucket >= $1
+		SELECT bucket,
+		       COALESCE(SUM(success_count)::float / NULLIF(SUM(launch_count), 0) * 100, 100)
+		FROM (%s) v
 		GROUP BY bucket
 		ORDER BY bucket ASC
-	`, column)
-
-	rows, err := p.pool.Query(ctx, query, start)
-	if err != nil {
-		return nil, fmt.Errorf("query vitals timeseries: %w", err)
-	}
-	defer rows.Close()
+	`, rel)
 
-	var result []TimeSeriesPoint
-	for rows.Next() {
-		var r TimeSeriesPoint
-		if err := rows.Scan(&r.Time, &r.Value); err != nil {
-			return nil, fmt.Errorf("scan row: %w", err)
-		}
-		result = append(result, r)
-	}
+	return p.queryTimeSeries(ctx, "query game timeseries", query, args...)
+}
 
-	return result, rows.Err()
+// WebSocketHealthRow represents a row from websocket_health_v2_1m or its hourly/daily rollups
+type WebSocketHealthRow struct {
+	Bucket                time.Time       `json:"bucket"`
+	Endpoint              string          `json:"endpoint"`
+	DeviceType            string          `json:"device_type"`
+	Connects              int64           `json:"connects"`
+	Disconnects           int64           `json:"disconnects"`
+	Errors                int64           `json:"errors"`
+	Reconnects            int64           `json:"reconnects"`
+	LatencySamples        int64           `json:"latency_samples"`
+	AvgLatencyMS          float64         `json:"avg_latency_ms"`
+	P50LatencyMS          float64         `json:"p50_latency_ms"`
+	P95LatencyMS          float64         `json:"p95_latency_ms"`
+	MessagesSent          int64           `json:"messages_sent"`
+	MessagesReceived      int64           `json:"messages_received"`
+	MessagesPerConnection float64         `json:"messages_per_connection"`
+	CloseCodes            CloseCodeCounts `json:"close_codes"`
 }
 
-// GameHealthRow represents a row from game_health_5m
-type GameHealthRow struct {
-	Bucket        time.Time `json:"bucket"`
-	Provider      string    `json:"provider"`
-	GameType      string    `json:"game_type"`
-	LaunchCount   int64     `json:"launch_count"`
-	SuccessCount  int64     `json:"success_count"`
-	AvgLoadTimeMS float64   `json:"avg_load_time_ms"`
-	P95LoadTimeMS float64   `json:"p95_load_time_ms"`
+// CloseCodeCounts buckets WebSocket close codes
+type CloseCodeCounts struct {
+	Normal    int64 `json:"normal"`     // 1000
+	GoingAway int64 `json:"going_away"` // 1001
+	Abnormal  int64 `json:"abnormal"`   // 1006
+	Other     int64 `json:"other"`
 }
 
-// GetGameHealth retrieves game provider health metrics
-func (p *Postgres) GetGameHealth(ctx context.Context, start time.Time) ([]GameHealthRow, error) {
-	query := `
-		SELECT bucket, provider, COALESCE(game_type, 'unknown'),
-		       launch_count, success_count,
-		       COALESCE(avg_load_time_ms, 0), COALESCE(p95_load_time_ms, 0)
-		FROM game_health_5m
-		WHERE bucket >= $1
-		ORDER BY bucket DESC, provider, game_type
-	`
+// wsConcurrencyLookback is how far before start connect/close events are
+// replayed to seed the concurrent-connections estimate
+const wsConcurrencyLookback = time.Hour
 
-	rows, err := p.pool.Query(ctx, query, start)
+// GetWebSocketHealth retrieves WebSocket connection health by endpoint and device
+func (p *Postgres) GetWebSocketHealth(ctx context.Context, q Query) ([]WebSocketHealthRow, error) {
+	plan, err := wsSource.plan(q)
 	if err != nil {
-		return nil, fmt.Errorf("query game_health_5m: %w", err)
+		return nil, err
+	}
+	rel, args := wsSource.relation(plan)
+	query := fmt.Sprintf(`
+		SELECT bucket, COALESCE(endpoint, 'unknown'), COALESCE(device_type, 'unknown'),
+		       connects, disconnects, errors, reconnects, COALESCE(num_vals(latency_sketch), 0)::bigint,
+		       COALESCE(mean(latency_sketch), 0), COALESCE(approx_percentile(0.5, latency_sketch), 0),
+		       COALESCE(approx_percentile(0.95, latency_sketch), 0),
+		       messages_sent, messages_received, message_reports,
+		       close_normal, close_going_away, close_abnormal, close_other
+		FROM (%s) v
+		ORDER BY bucket DESC, endpoint, device_type
+	`, rel)
+
+	rows, err := p.reader.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query websocket health: %w", err)
 	}
 	defer rows.Close()
 
-	var result []GameHealthRow
+	var result []WebSocketHealthRow
 	for rows.Next() {
-		var r GameHealthRow
+		var r WebSocketHealthRow
+		var reports int64
 		if err := rows.Scan(
-			&r.Bucket, &r.Provider, &r.GameType,
-			&r.LaunchCount, &r.SuccessCount,
-			&r.AvgLoadTimeMS, &r.P95LoadTimeMS,
+			&r.Bucket, &r.Endpoint, &r.DeviceType,
+			&r.Connects, &r.Disconnects, &r.Errors, &r.Reconnects, &r.LatencySamples,
+			&r.AvgLatencyMS, &r.P50LatencyMS, &r.P95LatencyMS,
+			&r.MessagesSent, &r.MessagesReceived, &reports,
+			&r.CloseCodes.Normal, &r.CloseCodes.GoingAway, &r.CloseCodes.Abnormal, &r.CloseCodes.Other,
 		); err != nil {
 			return nil, fmt.Errorf("scan row: %w", err)
 		}
+		if reports > 0 {
+			r.MessagesPerConnection = float64(r.MessagesSent+r.MessagesReceived) / float64(reports)
+		}
 		result = append(result, r)
 	}
 
 	return result, rows.Err()
 }
 
-// GetGameTimeSeries retrieves time series for a specific provider
-func (p *Postgres) GetGameTimeSeries(ctx context.Context, provider string, start time.Time) ([]TimeSeriesPoint, error) {
-	query := `
-		SELECT bucket,
-		       CASE WHEN launch_count > 0 THEN success_count::float / launch_count * 100 ELSE 100 END
-		FROM game_health_5m
-		WHERE provider = $1 AND bucket >= $2
-		ORDER BY bucket ASC
-	`
+// GetWebSocketTimeSeries retrieves a WebSocket metric over time.
+// metric is one of connects, disconnects, errors, latency or concurrent.
+func (p *Postgres) GetWebSocketTimeSeries(ctx context.Context, metric string, q Query) ([]TimeSeriesPoint, error) {
+	plan, err := wsSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var query string
+	switch metric {
+	case "connects", "disconnects", "errors":
+		rel, args := wsSource.relation(plan)
+		query = fmt.Sprintf(`
+			SELECT bucket, SUM(%s)::float
+			FROM (%s) v
+			GROUP BY bucket
+			ORDER BY bucket ASC
+		`, metric, rel)
+		return p.queryTimeSeries(ctx, "query websocket timeseries", query, args...)
+	case "latency":
+		rel, args := wsSource.relation(plan)
+		query = fmt.Sprintf(`
+			SELECT bucket, COALESCE(mean(rollup(latency_sketch)), 0)
+			FROM (%s) v
+			GROUP BY bucket
+			ORDER BY bucket ASC
+		`, rel)
+		return p.queryTimeSeries(ctx, "query websocket timeseries", query, args...)
+	case "concurrent":
+		if plan.whole {
+			return nil, fmt.Errorf("%w: concurrent connections have no period total", ErrInvalidArgument)
+		}
+		// Running sum of opened minus closed connections, seeded from a lookback window
+		start := plan.start
+		plan.start = start.Add(-max(wsConcurrencyLookback, plan.step))
+		rel, args := wsSource.relation(plan)
+		args = append(args, start)
+		query = fmt.Sprintf(`
+			SELECT bucket, GREATEST(open, 0)::float
+			FROM (
+				SELECT bucket, SUM(SUM(connects + reconnects - disconnects)) OVER (ORDER BY bucket) AS open
+				FROM (%s) v
+				GROUP BY bucket
+			) s
+			WHERE bucket >= $%d
+			ORDER BY bucket ASC
+		`, rel, len(args))
+		return p.queryTimeSeries(ctx, "query websocket timeseries", query, args...)
+	default:
+		return nil, fmt.Errorf("%w: unknown websocket metric %q", ErrInvalidArgument, metric)
+	}
+}
 
-	rows, err := p.pool.Query(ctx, query, provider, start)
+// queryTimeSeries runs a (time, value) query on the reader pool
+func (p *Postgres) queryTimeSeries(ctx context.Context, what, query string, args ...any) ([]TimeSeriesPoint, error) {
+	rows, err := p.reader.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("query game timeseries: %w", err)
+		return nil, fmt.Errorf("%s: %w", what, err)
 	}
 	defer rows.Close()
 
@@ -612,51 +787,85 @@ type OverviewMetrics struct {
 	GameSuccessRate float64 `json:"game_success_rate"`
 }
 
+// overviewPlans splits an overview query into per-section plans. Each filter
+// applies to the sections that have the dimension; a filter no section has is
+// rejected.
+func overviewPlans(q Query) (api, psp, game queryPlan, err error) {
+	for dim := range q.Filters {
+		_, a := apiSource.dims[dim]
+		_, b := pspSource.dims[dim]
+		_, c := gameSource.dims[dim]
+		_, d := sessionDims[dim]
+		if !a && !b && !c && !d {
+			return api, psp, game, fmt.Errorf("%w: cannot filter by %q here", ErrInvalidArgument, dim)
+		}
+	}
+	// The overview returns totals, so the step only picks the view
+	q.Step = 0
+	if api, err = apiSource.plan(q.only(apiSource.dims)); err != nil {
+		return
+	}
+	if psp, err = pspSource.plan(q.only(pspSource.dims)); err != nil {
+		return
+	}
+	game, err = gameSource.plan(q.only(gameSource.dims))
+	return
+}
+
 // GetOverviewMetrics retrieves aggregated overview metrics
-func (p *Postgres) GetOverviewMetrics(ctx context.Context, start time.Time) (*OverviewMetrics, error) {
+func (p *Postgres) GetOverviewMetrics(ctx context.Context, q Query) (*OverviewMetrics, error) {
+	apiPlan, pspPlan, gamePlan, err := overviewPlans(q)
+	if err != nil {
+		return nil, err
+	}
 	result := &OverviewMetrics{}
 
-	// Active sessions (distinct session_ids in last 15 min)
-	err := p.pool.QueryRow(ctx, `
+	// Active sessions (distinct session_ids in range)
+	args := []any{q.Start, q.end()}
+	where := []string{"time >= $1", "time < $2"}
+	for dim, v := range q.only(sessionDims).Filters {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf("%s = $%d", sessionDims[dim], len(args)))
+	}
+	err = p.reader.QueryRow(ctx, `
 		SELECT COUNT(DISTINCT session_id)
 		FROM frontend_metrics
-		WHERE time >= $1
-	`, start).Scan(&result.ActiveSessions)
+		WHERE `+strings.Join(where, " AND "), args...).Scan(&result.ActiveSessions)
 	if err != nil {
 		return nil, fmt.Errorf("query active sessions: %w", err)
 	}
 
 	// API error rate and latency
-	err = p.pool.QueryRow(ctx, `
+	rel, args := apiSource.relation(apiPlan)
+	err = p.reader.QueryRow(ctx, `
 		SELECT
-			COALESCE(AVG(CASE WHEN error_count > 0 THEN error_count::float / NULLIF(request_count, 0) * 100 ELSE 0 END), 0),
-			COALESCE(AVG(avg_duration_ms), 0)
-		FROM api_performance_1m
-		WHERE bucket >= $1
-	`, start).Scan(&result.ErrorRate, &result.AvgLatencyMS)
+			COALESCE(SUM(error_count)::float / NULLIF(SUM(request_count), 0) * 100, 0),
+			COALESCE(mean(rollup(duration_sketch)), 0)
+		FROM (`+rel+`) v
+	`, args...).Scan(&result.ErrorRate, &result.AvgLatencyMS)
 	if err != nil {
 		return nil, fmt.Errorf("query api metrics: %w", err)
 	}
 
 	// PSP metrics
-	err = p.pool.QueryRow(ctx, `
+	rel, args = pspSource.relation(pspPlan)
+	err = p.reader.QueryRow(ctx, `
 		SELECT
 			COALESCE(SUM(CASE WHEN operation = 'deposit' THEN total_count ELSE 0 END), 0),
 			COALESCE(SUM(CASE WHEN operation = 'deposit' THEN total_amount ELSE 0 END), 0),
-			COALESCE(AVG(CASE WHEN total_count > 0 THEN success_count::float / total_count * 100 ELSE 100 END), 100)
-		FROM psp_success_5m
-		WHERE bucket >= $1
-	`, start).Scan(&result.DepositsCount, &result.DepositsVolume, &result.PSPSuccessRate)
+			COALESCE(SUM(success_count)::float / NULLIF(SUM(total_count), 0) * 100, 100)
+		FROM (`+rel+`) v
+	`, args...).Scan(&result.DepositsCount, &result.DepositsVolume, &result.PSPSuccessRate)
 	if err != nil {
 		return nil, fmt.Errorf("query psp metrics: %w", err)
 	}
 
 	// Game success rate
-	err = p.pool.QueryRow(ctx, `
-		SELECT COALESCE(AVG(CASE WHEN launch_count > 0 THEN success_count::float / launch_count * 100 ELSE 100 END), 100)
-		FROM game_health_5m
-		WHERE bucket >= $1
-	`, start).Scan(&result.GameSuccessRate)
+	rel, args = gameSource.relation(gamePlan)
+	err = p.reader.QueryRow(ctx, `
+		SELECT COALESCE(SUM(success_count)::float / NULLIF(SUM(launch_count), 0) * 100, 100)
+		FROM (`+rel+`) v
+	`, args...).Scan(&result.GameSuccessRate)
 	if err != nil {
 		return nil, fmt.Errorf("query game metrics: %w", err)
 	}
@@ -678,19 +887,28 @@ type AlertRow struct {
 	Message        string     `json:"message"`
 }
 
-// GetAlerts retrieves alert events
-func (p *Postgres) GetAlerts(ctx context.Context, resolved *bool) ([]AlertRow, error) {
+// GetAlerts retrieves alert events in the query range; a zero start is unbounded
+func (p *Postgres) GetAlerts(ctx context.Context, q Query, resolved *bool) ([]AlertRow, error) {
+	if err := checkAlertQuery(q); err != nil {
+		return nil, err
+	}
+	var start *time.Time
+	if !q.Start.IsZero() {
+		start = &q.Start
+	}
+
 	query := `
 		SELECT time, alert_type, severity, COALESCE(source_table, ''),
 		       COALESCE(metric_name, ''), COALESCE(threshold_value, 0),
 		       COALESCE(actual_value, 0), acknowledged, resolved_at, COALESCE(message, '')
 		FROM alert_events
 		WHERE ($1::boolean IS NULL OR (resolved_at IS NOT NULL) = $1)
+		  AND ($2::timestamptz IS NULL OR time >= $2) AND time < $3
 		ORDER BY time DESC
 		LIMIT 100
 	`
 
-	rows, err := p.pool.Query(ctx, query, resolved)
+	rows, err := p.reader.Query(ctx, query, resolved, start, q.end())
 	if err != nil {
 		return nil, fmt.Errorf("query alerts: %w", err)
 	}
@@ -714,10 +932,34 @@ func (p *Postgres) GetAlerts(ctx context.Context, resolved *bool) ([]AlertRow, e
 
 // AcknowledgeAlert marks an alert as acknowledged
 func (p *Postgres) AcknowledgeAlert(ctx context.Context, alertTime time.Time) error {
-	_, err := p.pool.Exec(ctx, `
+	_, err := p.writer.Exec(ctx, `
 		UPDATE alert_events
 		SET acknowledged = true
 		WHERE time = $1
 	`, alertTime)
 	return err
 }
+
+// ListenAlerts waits for alert_events notifications (see migration 0007) and
+// calls fn for each. It holds one writer connection: replicas do not deliver
+// notifications.
+func (p *Postgres) ListenAlerts(ctx context.Context, fn func()) error {
+	conn, err := p.writer.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN alert_events"); err != nil {
+		return fmt.Errorf("listen alert_events: %w", err)
+	}
+	for {
+		if _, err := conn.Conn().WaitForNotification(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("wait for alert notification: %w", err)
+		}
+		fn()
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestPoolConfig(t *testing.T) {
+	config, err := poolConfig(PoolConfig{
+		URL:              "postgres://pulse@127.0.0.1:1/pulse",
+		MaxConns:         10,
+		MinConns:         2,
+		StatementTimeout: 15 * time.Second,
+		ApplicationName:  "pulse-collector/reader",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MaxConns != 10 || config.MinConns != 2 {
+		t.Errorf("conns = %d/%d, want 10/2", config.MaxConns, config.MinConns)
+	}
+	params := config.ConnConfig.RuntimeParams
+	if params["statement_timeout"] != "15000" {
+		t.Errorf("statement_timeout = %q, want 15000", params["statement_timeout"])
+	}
+	if params["application_name"] != "pulse-collector/reader" {
+		t.Errorf("application_name = %q", params["application_name"])
+	}
+
+	// Zero values leave the server defaults alone
+	config, err = poolConfig(PoolConfig{URL: "postgres://pulse@127.0.0.1:1/pulse", MaxConns: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.ConnConfig.RuntimeParams["statement_timeout"]; ok {
+		t.Error("statement_timeout set without a timeout")
+	}
+
+	if _, err := poolConfig(PoolConfig{URL: "postgres://pulse@127.0.0.1:notaport/pulse"}); err == nil {
+		t.Error("bad URL accepted")
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	// Pools connect lazily, so stats are available without a server
+	lazyPool := func(max int32) *pgxpool.Pool {
+		config, err := poolConfig(PoolConfig{URL: "postgres://pulse@127.0.0.1:1/pulse", MaxConns: max})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool, err := pgxpool.NewWithConfig(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(pool.Close)
+		return pool
+	}
+	p := &Postgres{writer: lazyPool(20), reader: lazyPool(10)}
+
+	stats := p.PoolStats()
+	if len(stats) != 2 {
+		t.Fatalf("pools = %v, want writer and reader", stats)
+	}
+	if got := stats["writer"]; got.MaxConns != 20 || got.TotalConns != 0 || got.AvgAcquireTimeMS != 0 {
+		t.Errorf("writer = %+v", got)
+	}
+	if got := stats["reader"]; got.MaxConns != 10 || got.TotalConns != 0 {
+		t.Errorf("reader = %+v", got)
+	}
+}
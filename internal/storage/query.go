@@ -0,0 +1,395 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Query selects the time range, bucket width and dimension filters of a dashboard read
+type Query struct {
+	Start   time.Time
+	End     time.Time         // zero means now
+	Step    time.Duration     // zero picks the bucket width from the range
+	Filters map[string]string // dimension name (see Dimensions) → exact value
+	Whole   bool              // one bucket at Start spanning the range (period totals); Step is ignored
+}
+
+// Dimensions are the filter names accepted in Query.Filters. Each source
+// supports a subset; filtering a source by anything else is ErrInvalidArgument.
+var Dimensions = []string{
+	"service", "endpoint", "method",
+	"psp", "operation", "currency",
+	"provider", "game_type",
+	"device_type", "country", "page_path",
+	"metric_name", "release",
+}
+
+// maxPoints caps the buckets one query may return
+const maxPoints = 5000
+
+// end returns the end of the range, now if open
+func (q Query) end() time.Time {
+	if q.End.IsZero() {
+		return time.Now()
+	}
+	return q.End
+}
+
+// only returns q with the filters restricted to dims
+func (q Query) only(dims map[string]string) Query {
+	filters := make(map[string]string)
+	for dim, v := range q.Filters {
+		if _, ok := dims[dim]; ok {
+			filters[dim] = v
+		}
+	}
+	q.Filters = filters
+	return q
+}
+
+// checkAlertQuery rejects what alert listings cannot honour: filters and steps
+func checkAlertQuery(q Query) error {
+	if len(q.Filters) > 0 || q.Step != 0 {
+		return fmt.Errorf("%w: alerts accept only start and end", ErrInvalidArgument)
+	}
+	if !q.Start.IsZero() && !q.Start.Before(q.end()) {
+		return fmt.Errorf("%w: start must be before end", ErrInvalidArgument)
+	}
+	return nil
+}
+
+// aggColumn is one column of an aggregate: how it is merged across buckets of a
+// view and how it is computed from raw rows
+type aggColumn struct {
+	name  string
+	merge string
+	raw   string
+}
+
+// era is an aggregate hierarchy a source's levels replaced. Its views hold the
+// buckets before the replacement's cutover and are read for that part of a range.
+type era struct {
+	levels  []resolution      // same bucket widths as the source's levels
+	until   string            // aggregate_cutovers hierarchy that replaced it
+	columns map[string]string // merge expressions differing from the source's
+}
+
+// merge returns the expression computing column c from the era's views
+func (e era) merge(c aggColumn) string {
+	if expr, ok := e.columns[c.name]; ok {
+		return expr
+	}
+	return c.merge
+}
+
+// cutover is the first bucket of an aggregate hierarchy, as an SQL expression
+func cutover(hierarchy string) string {
+	return fmt.Sprintf("COALESCE((SELECT since FROM aggregate_cutovers WHERE hierarchy = '%s'), '-infinity')", hierarchy)
+}
+
+// source describes one metric family: its aggregate hierarchy and the raw
+// hypertable the finest level is computed from, so filters on dimensions the
+// aggregates do not keep can fall back to raw rows
+type source struct {
+	levels   []resolution
+	history  []era // replaced hierarchies, oldest first
+	raw      string
+	rawWhere string
+	groupBy  []string          // dimension columns kept by the aggregates
+	columns  []aggColumn       // aggregate columns, named as in the views
+	dims     map[string]string // filter name → column
+	rawOnly  bool              // groupBy has columns the aggregates do not keep
+}
+
+var (
+	apiSource = &source{
+		levels:  apiResolutions,
+		history: []era{apiLegacy},
+		raw:     "api_metrics",
+		groupBy: []string{"service_name", "endpoint"},
+		columns: []aggColumn{
+			{"request_count", "SUM(request_count)::bigint", "COUNT(*)"},
+			{"duration_sketch", "rollup(duration_sketch)", "percentile_agg(duration_ms)"},
+			{"error_count", "SUM(error_count)::bigint", "SUM(CASE WHEN status_code >= 400 THEN 1 ELSE 0 END)"},
+			{"server_error_count", "SUM(server_error_count)::bigint", "SUM(CASE WHEN status_code >= 500 THEN 1 ELSE 0 END)"},
+		},
+		dims: map[string]string{"service": "service_name", "endpoint": "endpoint", "method": "method", "release": "release"},
+	}
+	pspSource = &source{
+		levels:  pspResolutions,
+		history: []era{pspLegacy},
+		raw:     "psp_metrics",
+		groupBy: []string{"psp_name", "operation"},
+		columns: []aggColumn{
+			{"total_count", "SUM(total_count)::bigint", "COUNT(*)"},
+			{"success_count", "SUM(success_count)::bigint", "SUM(CASE WHEN success THEN 1 ELSE 0 END)"},
+			{"duration_sketch", "rollup(duration_sketch)", "percentile_agg(duration_ms)"},
+			{"total_amount", "SUM(total_amount)", "SUM(amount) FILTER (WHERE success)"},
+		},
+		dims: map[string]string{"psp": "psp_name", "operation": "operation", "currency": "currency", "release": "release"},
+	}
+	gameSource = &source{
+		levels:  gameResolutions,
+		history: []era{gameLegacy},
+		raw:     "game_metrics",
+		groupBy: []string{"provider", "game_type"},
+		columns: []aggColumn{
+			{"launch_count", "SUM(launch_count)::bigint", "COUNT(*)"},
+			{"success_count", "SUM(success_count)::bigint", "SUM(CASE WHEN launch_success THEN 1 ELSE 0 END)"},
+			{"load_time_sketch", "rollup(load_time_sketch)", "percentile_agg(load_time_ms)"},
+		},
+		dims: map[string]string{"provider": "provider", "game_type": "game_type", "device_type": "device_type", "release": "release"},
+	}
+	vitalsSource = &source{
+		levels:   vitalsResolutions,
+		history:  []era{vitalsLegacy, vitalsV2},
+		raw:      "frontend_metrics",
+		rawWhere: "event_type = 'web_vital'",
+		groupBy:  []string{"device_type", "page_path"},
+		columns:  vitalsColumns(),
+		dims:     map[string]string{"device_type": "device_type", "page_path": "page_path", "country": "country", "release": "release"},
+	}
+	wsSource = &source{
+		levels:  wsResolutions,
+		history: []era{wsLegacy},
+		raw:     "websocket_metrics",
+		groupBy: []string{"endpoint", "device_type"},
+		columns: []aggColumn{
+			{"connects", "SUM(connects)::bigint", "SUM(CASE WHEN event_type = 'connect' THEN 1 ELSE 0 END)"},
+			{"disconnects", "SUM(disconnects)::bigint", "SUM(CASE WHEN event_type = 'disconnect' THEN 1 ELSE 0 END)"},
+			{"errors", "SUM(errors)::bigint", "SUM(CASE WHEN event_type = 'error' THEN 1 ELSE 0 END)"},
+			{"reconnects", "SUM(reconnects)::bigint", "SUM(CASE WHEN event_type = 'reconnect' THEN 1 ELSE 0 END)"},
+			{"latency_sketch", "rollup(latency_sketch)", "percentile_agg(latency_ms)"},
+			{"message_reports", "SUM(message_reports)::bigint", "COUNT(CASE WHEN messages_sent IS NOT NULL OR messages_received IS NOT NULL THEN 1 END)"},
+			{"messages_sent", "SUM(messages_sent)::bigint", "COALESCE(SUM(messages_sent), 0)"},
+			{"messages_received", "SUM(messages_received)::bigint", "COALESCE(SUM(messages_received), 0)"},
+			{"close_normal", "SUM(close_normal)::bigint", "SUM(CASE WHEN close_code = 1000 THEN 1 ELSE 0 END)"},
+			{"close_going_away", "SUM(close_going_away)::bigint", "SUM(CASE WHEN close_code = 1001 THEN 1 ELSE 0 END)"},
+			{"close_abnormal", "SUM(close_abnormal)::bigint", "SUM(CASE WHEN close_code = 1006 THEN 1 ELSE 0 END)"},
+			{"close_other", "SUM(close_other)::bigint", "SUM(CASE WHEN close_code IS NOT NULL AND close_code NOT IN (1000, 1001, 1006) THEN 1 ELSE 0 END)"},
+		},
+		dims: map[string]string{"endpoint": "endpoint", "device_type": "device_type", "release": "release"},
+	}
+
+	customSource = &source{
+		levels:   customResolutions,
+		raw:      "frontend_metrics",
+		rawWhere: "metric_name IS NOT NULL AND metric_value IS NOT NULL",
+		groupBy:  []string{"metric_name", "device_type", "page_path"},
+		columns: []aggColumn{
+			{"sample_count", "SUM(sample_count)::bigint", "COUNT(*)"},
+			{"value_sketch", "rollup(value_sketch)", "percentile_agg(metric_value)"},
+		},
+		dims: map[string]string{"metric_name": "metric_name", "device_type": "device_type", "page_path": "page_path", "country": "country", "release": "release"},
+	}
+
+	// sessionDims filters the active-sessions count on raw frontend_metrics
+	sessionDims = map[string]string{"device_type": "device_type", "country": "country", "page_path": "page_path", "release": "release"}
+)
+
+// sources names the metric families behind each dashboard section
+var sources = map[string]*source{
+	"api":    apiSource,
+	"psp":    pspSource,
+	"vitals": vitalsSource,
+	"game":   gameSource,
+	"ws":     wsSource,
+	"custom": customSource,
+}
+
+// queryPlan is a validated Query resolved against a source
+type queryPlan struct {
+	start, end time.Time
+	step       time.Duration
+	whole      bool   // a single bucket at start
+	view       string // empty when reading raw rows
+	filters    []string
+	values     []any
+	metadata   []eventCondition // metadata path equalities; raw rows only
+}
+
+// contains reports whether t falls in the plan's range
+func (p queryPlan) contains(t time.Time) bool {
+	return !t.Before(p.start) && t.Before(p.end)
+}
+
+// bucket returns the bucket a time in the range falls into
+func (p queryPlan) bucket(t time.Time) time.Time {
+	if p.whole {
+		return p.start.UTC()
+	}
+	return t.UTC().Truncate(p.step)
+}
+
+// plan validates q for the source and picks the view and bucket width. Without
+// a step the coarsest level giving at least minPoints buckets is used; an
+// explicit step must be a multiple of some level's bucket unless raw rows are read.
+// When a view is read the range is widened to the view's bucket boundaries.
+func (s *source) plan(q Query) (queryPlan, error) {
+	p := queryPlan{start: q.Start, end: q.end()}
+	if !p.start.Before(p.end) {
+		return p, fmt.Errorf("%w: start must be before end", ErrInvalidArgument)
+	}
+
+	raw := s.rawOnly
+	names := make([]string, 0, len(q.Filters))
+	for dim := range q.Filters {
+		names = append(names, dim)
+	}
+	sort.Strings(names)
+	for _, dim := range names {
+		col, ok := s.dims[dim]
+		if !ok {
+			return p, fmt.Errorf("%w: cannot filter by %q here", ErrInvalidArgument, dim)
+		}
+		raw = raw || !slices.Contains(s.groupBy, col)
+		p.filters = append(p.filters, col)
+		p.values = append(p.values, q.Filters[dim])
+	}
+
+	span := p.end.Sub(p.start)
+	level := pickResolution(s.levels, span)
+	switch {
+	case q.Whole:
+		p.step, p.whole = span, true
+	case q.Step < 0:
+		return p, fmt.Errorf("%w: step must be positive", ErrInvalidArgument)
+	case q.Step == 0:
+		p.step = level.bucket
+	case raw:
+		p.step = q.Step
+	default:
+		found := false
+		for i := len(s.levels) - 1; i >= 0 && !found; i-- {
+			if q.Step%s.levels[i].bucket == 0 {
+				level, found = s.levels[i], true
+			}
+		}
+		if !found {
+			return p, fmt.Errorf("%w: step must be a multiple of %s", ErrInvalidArgument, s.levels[0].bucket)
+		}
+		p.step = q.Step
+	}
+	if !raw {
+		// Aggregate buckets cannot be split, so read every bucket the range
+		// touches: the partial first bucket is kept whole like the last one
+		p.view = level.view
+		p.start = p.start.Truncate(level.bucket)
+		if end := p.end.Truncate(level.bucket); end.Before(p.end) {
+			p.end = end.Add(level.bucket)
+		}
+		span = p.end.Sub(p.start)
+		if p.whole {
+			p.step = span
+		}
+	}
+	if span/p.step > maxPoints {
+		return p, fmt.Errorf("%w: range of %s at step %s exceeds %d points", ErrInvalidArgument, span, p.step, maxPoints)
+	}
+	return p, nil
+}
+
+// relation returns a subquery with the columns of the source's aggregates,
+// re-bucketed to the plan step and restricted to its range and filters, plus
+// its arguments ($1 step, $2 start, $3 end, then filter values). Buckets before
+// the cutover of the source's levels are read from the views they replaced.
+func (s *source) relation(p queryPlan) (string, []any) {
+	args := append([]any{p.step, p.start, p.end}, p.values...)
+	var where []string
+	for i, col := range p.filters {
+		where = append(where, fmt.Sprintf("%s = $%d", col, i+4))
+	}
+	for _, c := range p.metadata {
+		args = append(args, c.path, c.value)
+		where = append(where, fmt.Sprintf("metadata #>> $%d = $%d", len(args)-1, len(args)))
+	}
+
+	if p.view == "" {
+		if s.rawWhere != "" {
+			where = append([]string{s.rawWhere}, where...)
+		}
+		return s.rebucket(p, s.raw, "time", where, func(c aggColumn) string { return c.raw }), args
+	}
+	if len(s.history) == 0 {
+		return s.rebucket(p, p.view, "bucket", where, func(c aggColumn) string { return c.merge }), args
+	}
+
+	level := slices.IndexFunc(s.levels, func(l resolution) bool { return l.view == p.view })
+	parts := make([]string, 0, len(s.history)+1)
+	since := ""
+	for _, e := range s.history {
+		bounds := append(slices.Clip(where), "bucket < "+cutover(e.until))
+		if since != "" {
+			bounds = append(bounds, "bucket >= "+since)
+		}
+		parts = append(parts, s.rebucket(p, e.levels[level].view, "bucket", bounds, e.merge))
+		since = cutover(e.until)
+	}
+	parts = append(parts, s.rebucket(p, p.view, "bucket", append(slices.Clip(where), "bucket >= "+since),
+		func(c aggColumn) string { return c.merge }))
+
+	cols := append([]string{"bucket"}, s.groupBy...)
+	for _, c := range s.columns {
+		cols = append(cols, c.merge+" AS "+c.name)
+	}
+	return fmt.Sprintf("SELECT %s FROM (%s) eras GROUP BY 1, %s",
+		strings.Join(cols, ", "), strings.Join(parts, " UNION ALL "), strings.Join(s.groupBy, ", ")), args
+}
+
+// rebucket selects the source's columns from one table or view in the plan's
+// range and buckets, computing each with expr
+func (s *source) rebucket(p queryPlan, from, timeCol string, where []string, expr func(aggColumn) string) string {
+	where = append([]string{timeCol + " >= $2", timeCol + " < $3"}, where...)
+	bucket := "time_bucket($1::interval, " + timeCol + ")"
+	if p.whole {
+		// Origin at the range start with the span as width: one bucket
+		bucket = "time_bucket($1::interval, " + timeCol + ", $2::timestamptz)"
+	}
+	cols := []string{bucket + " AS bucket"}
+	cols = append(cols, s.groupBy...)
+	for _, c := range s.columns {
+		cols = append(cols, expr(c)+" AS "+c.name)
+	}
+
+	// Table, view and column names come from the source definitions, never from the request
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s GROUP BY 1, %s",
+		strings.Join(cols, ", "), from, strings.Join(where, " AND "), strings.Join(s.groupBy, ", "))
+}
+
+// ReadRange returns the range a query on source reads: Start and End widened
+// to whole buckets when an aggregate is read. Unknown sources and invalid
+// queries return the range unchanged.
+func ReadRange(name string, q Query) (start, end time.Time) {
+	src, ok := sources[name]
+	if !ok {
+		src = percentileSources[name].source
+	}
+	if src == nil {
+		return q.Start, q.end()
+	}
+	p, err := src.plan(q.only(src.dims))
+	if err != nil {
+		return q.Start, q.end()
+	}
+	return p.start, p.end
+}
+
+// BucketSize returns the bucket width a query on source will read, or 0 for an
+// unknown source or invalid query. Percentile sources are accepted too.
+func BucketSize(name string, q Query) time.Duration {
+	src, ok := sources[name]
+	if !ok {
+		src = percentileSources[name].source
+	}
+	if src == nil {
+		return 0
+	}
+	p, err := src.plan(q.only(src.dims))
+	if err != nil {
+		return 0
+	}
+	return p.step
+}
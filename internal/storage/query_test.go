@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	end := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tests := []struct {
+		name    string
+		q       Query
+		view    string
+		step    time.Duration
+		whole   bool
+		invalid bool
+	}{
+		{name: "hour reads minutes", q: Query{Start: end.Add(-time.Hour), End: end}, view: "api_performance_v2_1m", step: time.Minute},
+		{name: "20h still reads minutes", q: Query{Start: end.Add(-20 * time.Hour), End: end}, view: "api_performance_v2_1m", step: time.Minute},
+		{name: "two days read hours", q: Query{Start: end.Add(-2 * day), End: end}, view: "api_performance_v2_1h", step: time.Hour},
+		{name: "23 days still read hours", q: Query{Start: end.Add(-23 * day), End: end}, view: "api_performance_v2_1h", step: time.Hour},
+		{name: "30 days read days", q: Query{Start: end.Add(-30 * day), End: end}, view: "api_performance_v2_1d", step: day},
+		{name: "step picks the coarsest dividing level", q: Query{Start: end.Add(-2 * day), End: end, Step: 2 * time.Hour}, view: "api_performance_v2_1h", step: 2 * time.Hour},
+		{name: "step of minutes", q: Query{Start: end.Add(-2 * day), End: end, Step: 15 * time.Minute}, view: "api_performance_v2_1m", step: 15 * time.Minute},
+		{name: "step not a multiple", q: Query{Start: end.Add(-time.Hour), End: end, Step: 90 * time.Second}, invalid: true},
+		{name: "raw filter takes any step", q: Query{Start: end.Add(-time.Hour), End: end, Step: 90 * time.Second, Filters: map[string]string{"method": "GET"}}, step: 90 * time.Second},
+		{name: "aggregate filter keeps the view", q: Query{Start: end.Add(-time.Hour), End: end, Filters: map[string]string{"service": "wallet"}}, view: "api_performance_v2_1m", step: time.Minute},
+		{name: "whole range", q: Query{Start: end.Add(-30 * day), End: end, Whole: true}, view: "api_performance_v2_1d", step: 30 * day, whole: true},
+		{name: "too many points", q: Query{Start: end.Add(-10 * day), End: end, Step: time.Minute}, invalid: true},
+		{name: "negative step", q: Query{Start: end.Add(-time.Hour), End: end, Step: -time.Minute}, invalid: true},
+		{name: "empty range", q: Query{Start: end, End: end}, invalid: true},
+		{name: "unknown filter", q: Query{Start: end.Add(-time.Hour), End: end, Filters: map[string]string{"psp": "stripe"}}, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := apiSource.plan(tt.q)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidArgument) {
+					t.Fatalf("err = %v, want ErrInvalidArgument", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.view != tt.view || p.step != tt.step || p.whole != tt.whole {
+				t.Errorf("plan = view %q, step %s, whole %v; want %q, %s, %v", p.view, p.step, p.whole, tt.view, tt.step, tt.whole)
+			}
+		})
+	}
+}
+
+func TestPlanAlignsRange(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2024, 5, 1, 10, 7, 30, 0, time.UTC)
+	hour := start.Truncate(time.Hour)
+	midnight := start.Truncate(day)
+	tests := []struct {
+		name       string
+		q          Query
+		start, end time.Time
+		step       time.Duration
+	}{
+		{"hourly buckets touched", Query{Start: start, End: start.Add(2 * day)}, hour, hour.Add(2*day + time.Hour), time.Hour},
+		{"end on a boundary", Query{Start: start, End: hour.Add(2 * day)}, hour, hour.Add(2 * day), time.Hour},
+		{"daily buckets touched", Query{Start: start, End: start.Add(30 * day)}, midnight, midnight.Add(31 * day), day},
+		{"explicit step reads minutes", Query{Start: start, End: start.Add(2 * day), Step: 15 * time.Minute},
+			start.Truncate(time.Minute), start.Add(2*day + 30*time.Second), 15 * time.Minute},
+		{"whole range spans the buckets read", Query{Start: start, End: start.Add(2 * day), Whole: true}, hour, hour.Add(2*day + time.Hour), 2*day + time.Hour},
+		{"raw rows keep the range", Query{Start: start, End: start.Add(2 * day), Filters: map[string]string{"method": "GET"}}, start, start.Add(2 * day), time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := apiSource.plan(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !p.start.Equal(tt.start) || !p.end.Equal(tt.end) || p.step != tt.step {
+				t.Errorf("plan = %s–%s step %s, want %s–%s step %s", p.start, p.end, p.step, tt.start, tt.end, tt.step)
+			}
+			if s, e := ReadRange("api", tt.q); !s.Equal(p.start) || !e.Equal(p.end) {
+				t.Errorf("ReadRange = %s–%s, want the plan's", s, e)
+			}
+		})
+	}
+
+	if s, e := ReadRange("nope", Query{Start: start, End: start.Add(time.Hour)}); !s.Equal(start) || !e.Equal(start.Add(time.Hour)) {
+		t.Errorf("unknown source: ReadRange = %s–%s, want the range unchanged", s, e)
+	}
+}
+
+func TestSourceHistory(t *testing.T) {
+	all := map[string]*source{"game providers": gameProviderSource}
+	for name, src := range sources {
+		all[name] = src
+	}
+	for name, src := range all {
+		if !src.rawOnly && len(src.history) == 0 && name != "custom" {
+			t.Errorf("%s: no history, so buckets before the sketch cutover are not read", name)
+		}
+		for _, e := range src.history {
+			if len(e.levels) != len(src.levels) {
+				t.Errorf("%s: era %s has %d levels, want %d", name, e.until, len(e.levels), len(src.levels))
+				continue
+			}
+			for i, l := range e.levels {
+				if l.bucket != src.levels[i].bucket {
+					t.Errorf("%s: era %s level %s has bucket %s, want %s", name, e.until, l.view, l.bucket, src.levels[i].bucket)
+				}
+			}
+			for col := range e.columns {
+				found := false
+				for _, c := range src.columns {
+					found = found || c.name == col
+				}
+				if !found {
+					t.Errorf("%s: era %s maps unknown column %q", name, e.until, col)
+				}
+			}
+		}
+	}
+}
+
+func TestRelationEras(t *testing.T) {
+	end := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		q       Query
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "daily",
+			q:    Query{Start: end.Add(-30 * 24 * time.Hour), End: end},
+			want: []string{
+				"FROM api_performance_1d WHERE",
+				"FROM api_performance_v2_1d WHERE",
+				"bucket < COALESCE((SELECT since FROM aggregate_cutovers WHERE hierarchy = 'api_performance_v2'), '-infinity')",
+				"bucket >= COALESCE((SELECT since FROM aggregate_cutovers WHERE hierarchy = 'api_performance_v2'), '-infinity')",
+				"legacy_sketch(request_count::bigint, avg_duration_ms::float8, ARRAY[0.95, 0.99]::float8[], ARRAY[p95_duration_ms, p99_duration_ms]::float8[])",
+				") eras GROUP BY 1, service_name, endpoint",
+			},
+		},
+		{
+			name: "filtered minutes",
+			q:    Query{Start: end.Add(-time.Hour), End: end, Filters: map[string]string{"service": "wallet"}},
+			want: []string{
+				"FROM api_performance_1m WHERE bucket >= $2 AND bucket < $3 AND service_name = $4 AND bucket <",
+				"FROM api_performance_v2_1m WHERE bucket >= $2 AND bucket < $3 AND service_name = $4 AND bucket >=",
+			},
+		},
+		{
+			name:    "raw",
+			q:       Query{Start: end.Add(-time.Hour), End: end, Filters: map[string]string{"method": "GET"}},
+			want:    []string{"FROM api_metrics WHERE time >= $2 AND time < $3 AND method = $4 GROUP BY 1, service_name, endpoint"},
+			notWant: []string{"UNION ALL", "aggregate_cutovers"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := apiSource.plan(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sql, args := apiSource.relation(p)
+			if len(args) != 3+len(tt.q.Filters) {
+				t.Errorf("got %d args, want %d", len(args), 3+len(tt.q.Filters))
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(sql, s) {
+					t.Errorf("relation lacks %q:\n%s", s, sql)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(sql, s) {
+					t.Errorf("relation has %q:\n%s", s, sql)
+				}
+			}
+		})
+	}
+}
+
+func TestRelationVitalsEras(t *testing.T) {
+	end := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	p, err := vitalsSource.plan(Query{Start: end.Add(-60 * 24 * time.Hour), End: end})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, _ := vitalsSource.relation(p)
+	v2, v3 := cutover("web_vitals_v2"), cutover("web_vitals_v3")
+	for _, s := range []string{
+		"FROM web_vitals_daily WHERE bucket >= $2 AND bucket < $3 AND bucket < " + v2 + " GROUP BY",
+		"FROM web_vitals_v2_daily WHERE bucket >= $2 AND bucket < $3 AND bucket < " + v3 + " AND bucket >= " + v2 + " GROUP BY",
+		"FROM web_vitals_v3_daily WHERE bucket >= $2 AND bucket < $3 AND bucket >= " + v3 + " GROUP BY",
+		"NULL::uddsketch AS ttfb_sketch",
+		"COALESCE(ROUND((approx_percentile_rank(2500, rollup(lcp_sketch))) * num_vals(rollup(lcp_sketch))), 0)::bigint AS lcp_good",
+	} {
+		if !strings.Contains(sql, s) {
+			t.Errorf("relation lacks %q:\n%s", s, sql)
+		}
+	}
+}
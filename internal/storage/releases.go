@@ -0,0 +1,665 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+// Deployment is an annotation of a release going out
+type Deployment struct {
+	ID          int64     `json:"id"`
+	Release     string    `json:"release"`
+	Service     string    `json:"service,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	Description string    `json:"description,omitempty"`
+	DeployedAt  time.Time `json:"deployed_at"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const (
+	// DefaultDeploymentLimit is the number of deployments listed without a limit
+	DefaultDeploymentLimit = 100
+	// MaxDeploymentLimit caps DeploymentOptions.Limit
+	MaxDeploymentLimit = 1000
+)
+
+// Validate trims the fields, defaults the deploy time to now and checks lengths
+func (d *Deployment) Validate() error {
+	d.Release = strings.TrimSpace(d.Release)
+	d.Service = strings.TrimSpace(d.Service)
+	d.Environment = strings.TrimSpace(d.Environment)
+	if d.Release == "" || len(d.Release) > 100 {
+		return fmt.Errorf("%w: release must be 1 to 100 characters", ErrInvalidArgument)
+	}
+	if len(d.Service) > 100 {
+		return fmt.Errorf("%w: service must be at most 100 characters", ErrInvalidArgument)
+	}
+	if len(d.Environment) > 50 {
+		return fmt.Errorf("%w: environment must be at most 50 characters", ErrInvalidArgument)
+	}
+	if d.DeployedAt.IsZero() {
+		d.DeployedAt = time.Now().UTC()
+	}
+	return nil
+}
+
+// DeploymentOptions narrows a deployment listing. The release and service
+// filters of the Query apply as well.
+type DeploymentOptions struct {
+	Environment string
+	Limit       int
+}
+
+// deploymentDims are the Query filters a deployment listing accepts
+var deploymentDims = map[string]string{"release": "release", "service": "service"}
+
+// deploymentFilters rejects filters deployments do not have and applies the
+// default limit
+func deploymentFilters(q Query, opts *DeploymentOptions) error {
+	for dim := range q.Filters {
+		if _, ok := deploymentDims[dim]; !ok {
+			return fmt.Errorf("%w: cannot filter deployments by %q", ErrInvalidArgument, dim)
+		}
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultDeploymentLimit
+	}
+	if opts.Limit > MaxDeploymentLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidArgument, MaxDeploymentLimit)
+	}
+	return nil
+}
+
+// ReleaseOptions picks what a release is compared against
+type ReleaseOptions struct {
+	Baseline    string // release to compare with; the previously deployed one when empty
+	Environment string // restricts the deployment lookup of the baseline
+}
+
+// ReleaseComparison is a release's vitals, latency and error rates against a
+// baseline release, both read over the same range
+type ReleaseComparison struct {
+	Release     string          `json:"release"`
+	Baseline    string          `json:"baseline"`
+	Start       time.Time       `json:"start"`
+	End         time.Time       `json:"end"`
+	Metrics     []ReleaseMetric `json:"metrics"`
+	Regressions int             `json:"regressions"`
+}
+
+// ReleaseMetric is one compared metric. Every metric is worse when higher.
+type ReleaseMetric struct {
+	Metric          string   `json:"metric"` // e.g. lcp_p75, api_p95, psp_failure_rate
+	Unit            string   `json:"unit,omitempty"`
+	Baseline        *float64 `json:"baseline"`
+	Current         *float64 `json:"current"`
+	ChangePct       *float64 `json:"change_pct"`
+	BaselineSamples int64    `json:"baseline_samples"`
+	Samples         int64    `json:"samples"`
+	PValue          *float64 `json:"p_value"` // two-sided; nil when a side has too few samples
+	Significant     bool     `json:"significant"`
+	Regression      bool     `json:"regression"` // significant, worse and by at least minReleaseChange
+}
+
+const (
+	// releaseAlpha is the significance level of the release tests
+	releaseAlpha = 0.05
+	// minReleaseSamples is the smallest sample per release a test is run on
+	minReleaseSamples = 30
+	// minReleaseChange is the relative worsening, in percent, below which a
+	// significant difference is not reported as a regression
+	minReleaseChange = 5.0
+)
+
+// releaseSource is a backend metric family compared by latency and failures
+type releaseSource struct {
+	name, table string
+	latency     string // column
+	failed      string // condition
+	failure     string // metric suffix
+	dims        map[string]string
+}
+
+var releaseSources = []releaseSource{
+	{"api", "api_metrics", "duration_ms", "status_code >= 400", "error_rate", apiSource.dims},
+	{"psp", "psp_metrics", "duration_ms", "NOT success", "failure_rate", pspSource.dims},
+	{"game", "game_metrics", "load_time_ms", "NOT launch_success", "failure_rate", gameSource.dims},
+}
+
+// releaseDist is a distribution of one release: the sample count, the
+// reported quantile and the count above the metric's threshold
+type releaseDist struct {
+	samples int64
+	value   float64
+	over    int64
+}
+
+// releaseRate counts failures among all rows
+type releaseRate struct {
+	total, failed int64
+}
+
+// releaseStats are the raw aggregates of one release. Vitals are counted over
+// their good threshold and latency over the baseline release's p95.
+type releaseStats struct {
+	vitals   map[string]releaseDist
+	latency  map[string]releaseDist
+	failures map[string]releaseRate
+}
+
+func newReleaseStats() *releaseStats {
+	return &releaseStats{
+		vitals:   make(map[string]releaseDist),
+		latency:  make(map[string]releaseDist),
+		failures: make(map[string]releaseRate),
+	}
+}
+
+// releaseQuery validates a comparison and drops the release filter, which
+// the two sides set themselves
+func releaseQuery(release string, q Query, opts ReleaseOptions) (Query, error) {
+	if release == "" || opts.Baseline == "" {
+		return q, fmt.Errorf("%w: release and baseline are required", ErrInvalidArgument)
+	}
+	if release == opts.Baseline {
+		return q, fmt.Errorf("%w: release %q cannot be its own baseline", ErrInvalidArgument, release)
+	}
+	q = Query{Start: q.Start, End: q.end(), Filters: q.Filters}
+	if !q.Start.Before(q.End) {
+		return q, fmt.Errorf("%w: start must be before end", ErrInvalidArgument)
+	}
+	if _, ok := q.Filters["release"]; ok {
+		filters := make(map[string]string, len(q.Filters))
+		for k, v := range q.Filters {
+			if k != "release" {
+				filters[k] = v
+			}
+		}
+		q.Filters = filters
+	}
+	return q, nil
+}
+
+// compareReleases tests every metric of current against baseline
+func compareReleases(release, baseline string, q Query, current, base *releaseStats) *ReleaseComparison {
+	c := &ReleaseComparison{Release: release, Baseline: baseline, Start: q.Start, End: q.End, Metrics: []ReleaseMetric{}}
+	add := func(m ReleaseMetric) {
+		if m.Regression {
+			c.Regressions++
+		}
+		c.Metrics = append(c.Metrics, m)
+	}
+
+	for _, v := range webVitals {
+		cur, old := current.vitals[v.name], base.vitals[v.name]
+		if cur.samples == 0 && old.samples == 0 {
+			continue
+		}
+		// p75 is what the rating is judged by; the test is on the share not rated good
+		add(releaseMetric(v.name+"_p75", v.unit, cur, old))
+	}
+	for _, src := range releaseSources {
+		if cur, old := current.latency[src.name], base.latency[src.name]; cur.samples > 0 || old.samples > 0 {
+			// The test is on the share slower than the baseline's p95
+			add(releaseMetric(src.name+"_p95", "ms", cur, old))
+		}
+		cur, old := current.failures[src.name], base.failures[src.name]
+		if cur.total == 0 && old.total == 0 {
+			continue
+		}
+		add(releaseMetric(src.name+"_"+src.failure, "%",
+			releaseDist{cur.total, percentOf(cur.failed, cur.total), cur.failed},
+			releaseDist{old.total, percentOf(old.failed, old.total), old.failed}))
+	}
+	return c
+}
+
+// releaseMetric compares two distributions by their reported value and tests
+// whether their shares over the threshold differ
+func releaseMetric(name, unit string, cur, old releaseDist) ReleaseMetric {
+	m := ReleaseMetric{Metric: name, Unit: unit, BaselineSamples: old.samples, Samples: cur.samples}
+	if old.samples > 0 {
+		m.Baseline = &old.value
+	}
+	if cur.samples > 0 {
+		m.Current = &cur.value
+	}
+	if m.Baseline != nil && m.Current != nil && old.value != 0 {
+		change := (cur.value - old.value) / old.value * 100
+		m.ChangePct = &change
+	}
+
+	m.PValue = twoProportionTest(cur.over, cur.samples, old.over, old.samples)
+	if m.PValue == nil {
+		return m
+	}
+	m.Significant = *m.PValue < releaseAlpha
+	worse := float64(cur.over)/float64(cur.samples) > float64(old.over)/float64(old.samples)
+	material := (m.ChangePct == nil && cur.value > old.value) || (m.ChangePct != nil && *m.ChangePct >= minReleaseChange)
+	m.Regression = m.Significant && worse && material
+	return m
+}
+
+// twoProportionTest returns the two-sided p-value of a pooled z-test on x1/n1
+// against x2/n2, or nil when either sample is below minReleaseSamples
+func twoProportionTest(x1, n1, x2, n2 int64) *float64 {
+	if n1 < minReleaseSamples || n2 < minReleaseSamples {
+		return nil
+	}
+	p1, p2 := float64(x1)/float64(n1), float64(x2)/float64(n2)
+	pooled := float64(x1+x2) / float64(n1+n2)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(n1) + 1/float64(n2)))
+	p := 1.0
+	if se > 0 {
+		p = math.Erfc(math.Abs(p1-p2) / se / math.Sqrt2)
+	}
+	return &p
+}
+
+// ============================================
+// POSTGRES
+// ============================================
+
+// RecordDeployment stores a deployment annotation and fills its ID
+func (p *Postgres) RecordDeployment(ctx context.Context, d *Deployment) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	err := p.writer.QueryRow(ctx, `
+		INSERT INTO deployments (release, service, environment, description, deployed_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, d.Release, d.Service, d.Environment, d.Description, d.DeployedAt, d.CreatedBy).Scan(&d.ID, &d.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert deployment: %w", err)
+	}
+	return nil
+}
+
+// ListDeployments returns the deployments in the range, newest first
+func (p *Postgres) ListDeployments(ctx context.Context, q Query, opts DeploymentOptions) ([]Deployment, error) {
+	if err := deploymentFilters(q, &opts); err != nil {
+		return nil, err
+	}
+	where := []string{"deployed_at >= $1", "deployed_at < $2"}
+	args := []any{q.Start, q.end()}
+	for _, dim := range []string{"release", "service"} {
+		if v, ok := q.Filters[dim]; ok {
+			args = append(args, v)
+			where = append(where, fmt.Sprintf("%s = $%d", deploymentDims[dim], len(args)))
+		}
+	}
+	if opts.Environment != "" {
+		args = append(args, opts.Environment)
+		where = append(where, fmt.Sprintf("environment = $%d", len(args)))
+	}
+	args = append(args, opts.Limit)
+
+	rows, err := p.reader.Query(ctx, fmt.Sprintf(`
+		SELECT id, release, service, environment, description, deployed_at, created_by, created_at
+		FROM deployments WHERE %s
+		ORDER BY deployed_at DESC, id DESC LIMIT $%d
+	`, strings.Join(where, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("query deployments: %w", err)
+	}
+	defer rows.Close()
+
+	result := []Deployment{}
+	for rows.Next() {
+		var d Deployment
+		if err := rows.Scan(&d.ID, &d.Release, &d.Service, &d.Environment, &d.Description, &d.DeployedAt, &d.CreatedBy, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan deployment: %w", err)
+		}
+		result = append(result, d)
+	}
+	return result, rows.Err()
+}
+
+// CompareReleases compares release with its baseline from raw rows tagged
+// with either. Without a baseline the release deployed before release's first
+// deployment is used, matching the service filter and environment when given.
+func (p *Postgres) CompareReleases(ctx context.Context, release string, q Query, opts ReleaseOptions) (*ReleaseComparison, error) {
+	if opts.Baseline == "" {
+		baseline, err := p.previousRelease(ctx, release, q.Filters["service"], opts.Environment)
+		if err != nil {
+			return nil, err
+		}
+		opts.Baseline = baseline
+	}
+	q, err := releaseQuery(release, q, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := map[string]*releaseStats{release: newReleaseStats(), opts.Baseline: newReleaseStats()}
+	if err := p.releaseVitals(ctx, release, opts.Baseline, q, stats); err != nil {
+		return nil, err
+	}
+	for _, src := range releaseSources {
+		if err := p.releaseBackend(ctx, src, release, opts.Baseline, q, stats); err != nil {
+			return nil, err
+		}
+	}
+	return compareReleases(release, opts.Baseline, q, stats[release], stats[opts.Baseline]), nil
+}
+
+// previousRelease returns the release deployed last before release was first
+func (p *Postgres) previousRelease(ctx context.Context, release, service, environment string) (string, error) {
+	var first *time.Time
+	err := p.reader.QueryRow(ctx, `
+		SELECT min(deployed_at) FROM deployments
+		WHERE release = $1 AND ($2 = '' OR service = $2) AND ($3 = '' OR environment = $3)
+	`, release, service, environment).Scan(&first)
+	if err != nil {
+		return "", fmt.Errorf("query deployment of %s: %w", release, err)
+	}
+	if first == nil {
+		return "", fmt.Errorf("%w: no deployment of %q is recorded, pass a baseline", ErrInvalidArgument, release)
+	}
+
+	var previous string
+	err = p.reader.QueryRow(ctx, `
+		SELECT release FROM deployments
+		WHERE deployed_at < $1 AND release <> $2 AND ($3 = '' OR service = $3) AND ($4 = '' OR environment = $4)
+		ORDER BY deployed_at DESC, id DESC LIMIT 1
+	`, *first, release, service, environment).Scan(&previous)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("%w: no deployment before %q is recorded, pass a baseline", ErrInvalidArgument, release)
+	}
+	if err != nil {
+		return "", fmt.Errorf("query previous deployment: %w", err)
+	}
+	return previous, nil
+}
+
+// releaseWhere returns the conditions and arguments shared by the release
+// queries: $1 start, $2 end, $3 release, $4 baseline, then the filters
+func releaseWhere(release, baseline string, q Query, dims map[string]string) ([]string, []any) {
+	where := []string{"time >= $1", "time < $2", "release IN ($3, $4)"}
+	args := []any{q.Start, q.End, release, baseline}
+	filters := q.only(dims).Filters
+	names := make([]string, 0, len(filters))
+	for dim := range filters {
+		names = append(names, dim)
+	}
+	sort.Strings(names)
+	for _, dim := range names {
+		args = append(args, filters[dim])
+		where = append(where, fmt.Sprintf("%s = $%d", dims[dim], len(args)))
+	}
+	return where, args
+}
+
+// releaseVitals reads p75 and the count above the good threshold per metric
+func (p *Postgres) releaseVitals(ctx context.Context, release, baseline string, q Query, stats map[string]*releaseStats) error {
+	where, args := releaseWhere(release, baseline, q, vitalsSource.dims)
+	where = append(where, vitalsSource.rawWhere)
+	cols := []string{"release"}
+	for _, v := range webVitals {
+		cols = append(cols,
+			fmt.Sprintf("COUNT(%s)", v.column),
+			fmt.Sprintf("COALESCE(percentile_cont(0.75) WITHIN GROUP (ORDER BY %s), 0)", v.column),
+			fmt.Sprintf("COUNT(*) FILTER (WHERE %s > %g)", v.column, v.good))
+	}
+
+	// Column names and thresholds come from webVitals, never from the request
+	rows, err := p.reader.Query(ctx, fmt.Sprintf(`SELECT %s FROM frontend_metrics WHERE %s GROUP BY release`,
+		strings.Join(cols, ", "), strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return fmt.Errorf("query release vitals: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		dists := make([]releaseDist, len(webVitals))
+		dest := []any{&name}
+		for i := range dists {
+			dest = append(dest, &dists[i].samples, &dists[i].value, &dists[i].over)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("scan release vitals: %w", err)
+		}
+		for i, v := range webVitals {
+			stats[name].vitals[v.name] = dists[i]
+		}
+	}
+	return rows.Err()
+}
+
+// releaseBackend reads p95 latency, the count above the baseline's p95 and
+// the failures of one backend source
+func (p *Postgres) releaseBackend(ctx context.Context, src releaseSource, release, baseline string, q Query, stats map[string]*releaseStats) error {
+	where, args := releaseWhere(release, baseline, q, src.dims)
+
+	// Table, column and condition come from releaseSources, never from the request
+	rows, err := p.reader.Query(ctx, fmt.Sprintf(`
+		WITH tagged AS (
+			SELECT release, %s AS latency, (%s) AS failed FROM %s WHERE %s
+		), threshold AS (
+			SELECT percentile_cont(0.95) WITHIN GROUP (ORDER BY latency) AS p95 FROM tagged WHERE release = $4
+		)
+		SELECT release, COUNT(latency),
+		       COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY latency), 0),
+		       COUNT(*) FILTER (WHERE latency > t.p95),
+		       COUNT(*), COUNT(*) FILTER (WHERE failed)
+		FROM tagged CROSS JOIN threshold t
+		GROUP BY release
+	`, src.latency, src.failed, src.table, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return fmt.Errorf("query release %s: %w", src.name, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var d releaseDist
+		var r releaseRate
+		if err := rows.Scan(&name, &d.samples, &d.value, &d.over, &r.total, &r.failed); err != nil {
+			return fmt.Errorf("scan release %s: %w", src.name, err)
+		}
+		stats[name].latency[src.name] = d
+		stats[name].failures[src.name] = r
+	}
+	return rows.Err()
+}
+
+// ============================================
+// MEMORY
+// ============================================
+
+func (m *Memory) RecordDeployment(ctx context.Context, d *Deployment) error {
+	if err := d.Validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextDeploymentID++
+	d.ID, d.CreatedAt = m.nextDeploymentID, time.Now()
+	m.deployments = append(m.deployments, *d)
+	return nil
+}
+
+func (m *Memory) ListDeployments(ctx context.Context, q Query, opts DeploymentOptions) ([]Deployment, error) {
+	if err := deploymentFilters(q, &opts); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	end := q.end()
+	result := []Deployment{}
+	for _, d := range m.deployments {
+		if d.DeployedAt.Before(q.Start) || !d.DeployedAt.Before(end) {
+			continue
+		}
+		if !matches(q.Filters, func(dim string) string { return deploymentDim(d, dim) }) {
+			continue
+		}
+		if opts.Environment != "" && d.Environment != opts.Environment {
+			continue
+		}
+		result = append(result, d)
+	}
+	sortDeployments(result)
+	if len(result) > opts.Limit {
+		result = result[:opts.Limit]
+	}
+	return result, nil
+}
+
+func (m *Memory) CompareReleases(ctx context.Context, release string, q Query, opts ReleaseOptions) (*ReleaseComparison, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if opts.Baseline == "" {
+		baseline, err := m.previousRelease(release, q.Filters["service"], opts.Environment)
+		if err != nil {
+			return nil, err
+		}
+		opts.Baseline = baseline
+	}
+	q, err := releaseQuery(release, q, opts)
+	if err != nil {
+		return nil, err
+	}
+	p := queryPlan{start: q.Start, end: q.End}
+
+	vitals := map[string][]model.EnrichedEvent{}
+	filters := q.only(vitalsSource.dims).Filters
+	for _, e := range m.frontend {
+		tag := deref(e.Release)
+		if e.EventType != "web_vital" || !p.contains(e.Time) || (tag != release && tag != opts.Baseline) ||
+			!matches(filters, func(dim string) string { return frontendDim(e, dim) }) {
+			continue
+		}
+		vitals[tag] = append(vitals[tag], e)
+	}
+
+	type backendRow struct {
+		latency *float64
+		failed  bool
+	}
+	backend := map[string]map[string][]backendRow{release: {}, opts.Baseline: {}}
+	sourceFilters := make(map[string]map[string]string, len(releaseSources))
+	for _, src := range releaseSources {
+		sourceFilters[src.name] = q.only(src.dims).Filters
+	}
+	collect := func(src, tag string, t time.Time, dim func(string) string, row backendRow) {
+		if p.contains(t) && (tag == release || tag == opts.Baseline) && matches(sourceFilters[src], dim) {
+			backend[tag][src] = append(backend[tag][src], row)
+		}
+	}
+	for _, r := range m.api {
+		collect("api", deref(r.Release), r.Time, func(dim string) string { return apiDim(r, dim) },
+			backendRow{&r.DurationMS, r.StatusCode >= 400})
+	}
+	for _, r := range m.psp {
+		collect("psp", deref(r.Release), r.Time, func(dim string) string { return pspDim(r, dim) },
+			backendRow{&r.DurationMS, !r.Success})
+	}
+	for _, r := range m.game {
+		collect("game", deref(r.Release), r.Time, func(dim string) string { return gameDim(r, dim) },
+			backendRow{r.LoadTimeMS, !r.LaunchSuccess})
+	}
+
+	stats := map[string]*releaseStats{release: newReleaseStats(), opts.Baseline: newReleaseStats()}
+	for tag, events := range vitals {
+		for _, v := range webVitals {
+			values := vitalValues(events, v.name)
+			d := releaseDist{samples: int64(len(values)), value: percentileCont(values, 0.75)}
+			for _, x := range values {
+				if x > v.good {
+					d.over++
+				}
+			}
+			stats[tag].vitals[v.name] = d
+		}
+	}
+	for _, src := range releaseSources {
+		latencies := func(tag string) []float64 {
+			var values []float64
+			for _, row := range backend[tag][src.name] {
+				values = appendNonNil(values, row.latency)
+			}
+			return values
+		}
+		threshold := percentileCont(latencies(opts.Baseline), 0.95)
+		for tag, s := range stats {
+			values := latencies(tag)
+			d := releaseDist{samples: int64(len(values)), value: percentileCont(values, 0.95)}
+			for _, x := range values {
+				if x > threshold {
+					d.over++
+				}
+			}
+			r := releaseRate{total: int64(len(backend[tag][src.name]))}
+			for _, row := range backend[tag][src.name] {
+				if row.failed {
+					r.failed++
+				}
+			}
+			s.latency[src.name], s.failures[src.name] = d, r
+		}
+	}
+	return compareReleases(release, opts.Baseline, q, stats[release], stats[opts.Baseline]), nil
+}
+
+// previousRelease returns the release deployed last before release was first
+func (m *Memory) previousRelease(release, service, environment string) (string, error) {
+	var deployments []Deployment
+	for _, d := range m.deployments {
+		if (service == "" || d.Service == service) && (environment == "" || d.Environment == environment) {
+			deployments = append(deployments, d)
+		}
+	}
+	sortDeployments(deployments)
+
+	first := -1
+	for i, d := range deployments {
+		if d.Release == release {
+			first = i
+		}
+	}
+	if first < 0 {
+		return "", fmt.Errorf("%w: no deployment of %q is recorded, pass a baseline", ErrInvalidArgument, release)
+	}
+	for _, d := range deployments[first+1:] {
+		if d.Release != release && d.DeployedAt.Before(deployments[first].DeployedAt) {
+			return d.Release, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no deployment before %q is recorded, pass a baseline", ErrInvalidArgument, release)
+}
+
+// sortDeployments orders deployments newest first
+func sortDeployments(deployments []Deployment) {
+	sort.Slice(deployments, func(i, j int) bool {
+		a, b := deployments[i], deployments[j]
+		if !a.DeployedAt.Equal(b.DeployedAt) {
+			return a.DeployedAt.After(b.DeployedAt)
+		}
+		return a.ID > b.ID
+	})
+}
+
+func deploymentDim(d Deployment, dim string) string {
+	switch dim {
+	case "release":
+		return d.Release
+	case "service":
+		return d.Service
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTwoProportionTest(t *testing.T) {
+	tests := []struct {
+		name           string
+		x1, n1, x2, n2 int64
+		want           *float64
+	}{
+		{"z of 2", 60, 100, 40, 100, ptr(math.Erfc(2))},
+		{"symmetric", 40, 100, 60, 100, ptr(math.Erfc(2))},
+		{"equal shares", 10, 100, 20, 200, ptr(1.0)},
+		{"no variance", 0, 100, 0, 50, ptr(1.0)},
+		{"all over", 30, 30, 30, 30, ptr(1.0)},
+		{"current too small", 29, 29, 0, 100, nil},
+		{"baseline too small", 50, 100, 0, 29, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := twoProportionTest(tt.x1, tt.n1, tt.x2, tt.n2)
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil:
+				t.Errorf("p = %v, want %v", got, tt.want)
+			case math.Abs(*got-*tt.want) > 1e-9:
+				t.Errorf("p = %v, want %v", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestReleaseMetric(t *testing.T) {
+	tests := []struct {
+		name                    string
+		cur, old                releaseDist
+		significant, regression bool
+	}{
+		{"worse", releaseDist{1000, 300, 150}, releaseDist{1000, 250, 50}, true, true},
+		{"better", releaseDist{1000, 250, 50}, releaseDist{1000, 300, 150}, true, false},
+		{"under the minimum change", releaseDist{1000, 252, 150}, releaseDist{1000, 250, 50}, true, false},
+		{"not significant", releaseDist{100, 300, 6}, releaseDist{100, 250, 5}, false, false},
+		{"from zero", releaseDist{1000, 2, 20}, releaseDist{1000, 0, 0}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := releaseMetric("api_p95", "ms", tt.cur, tt.old)
+			if m.PValue == nil {
+				t.Fatal("no p-value")
+			}
+			if m.Significant != tt.significant || m.Regression != tt.regression {
+				t.Errorf("significant %v, regression %v; want %v, %v (p = %v)", m.Significant, m.Regression, tt.significant, tt.regression, *m.PValue)
+			}
+		})
+	}
+
+	m := releaseMetric("api_p95", "ms", releaseDist{10, 300, 5}, releaseDist{0, 0, 0})
+	if m.Baseline != nil || m.ChangePct != nil || m.PValue != nil || m.Regression {
+		t.Errorf("no baseline: got %+v", m)
+	}
+	if m.Current == nil || *m.Current != 300 {
+		t.Errorf("current = %v, want 300", orZero(m.Current))
+	}
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// resolution is one level of an aggregate hierarchy
+type resolution struct {
+	view   string
+	bucket time.Duration
+}
+
+// minPoints is the fewest buckets a time range should produce; the coarsest
+// resolution meeting it is used
+const minPoints = 24
+
+// Aggregate hierarchies, finest first. All levels share column names.
+var (
+	apiResolutions = []resolution{
+		{"api_performance_v2_1m", time.Minute},
+		{"api_performance_v2_1h", time.Hour},
+		{"api_performance_v2_1d", 24 * time.Hour},
+	}
+	pspResolutions = []resolution{
+		{"psp_success_v2_5m", 5 * time.Minute},
+		{"psp_success_v2_1h", time.Hour},
+		{"psp_success_v2_1d", 24 * time.Hour},
+	}
+	vitalsResolutions = []resolution{
+		{"web_vitals_v3_hourly", time.Hour},
+		{"web_vitals_v3_daily", 24 * time.Hour},
+	}
+	gameResolutions = []resolution{
+		{"game_health_v2_5m", 5 * time.Minute},
+		{"game_health_v2_1h", time.Hour},
+		{"game_health_v2_1d", 24 * time.Hour},
+	}
+	wsResolutions = []resolution{
+		{"websocket_health_v2_1m", time.Minute},
+		{"websocket_health_v2_1h", time.Hour},
+		{"websocket_health_v2_1d", 24 * time.Hour},
+	}
+	customResolutions = []resolution{
+		{"custom_metrics_5m", 5 * time.Minute},
+		{"custom_metrics_1h", time.Hour},
+		{"custom_metrics_1d", 24 * time.Hour},
+	}
+)
+
+// Hierarchies replaced by the ones above, with the column merges that differ.
+// Their views keep the buckets from before the cutover recorded in
+// aggregate_cutovers and stay readable until they are dropped. The PERCENTILE_CONT
+// views of 0001, 0003 and 0004 kept a count, a mean and some percentiles instead
+// of a sketch.
+var (
+	apiLegacy = era{
+		levels: []resolution{
+			{"api_performance_1m", time.Minute},
+			{"api_performance_1h", time.Hour},
+			{"api_performance_1d", 24 * time.Hour},
+		},
+		until: "api_performance_v2",
+		columns: map[string]string{
+			"duration_sketch": legacySketch("request_count", "avg_duration_ms", map[float64]string{0.95: "p95_duration_ms", 0.99: "p99_duration_ms"}),
+		},
+	}
+	pspLegacy = era{
+		levels: []resolution{
+			{"psp_success_5m", 5 * time.Minute},
+			{"psp_success_1h", time.Hour},
+			{"psp_success_1d", 24 * time.Hour},
+		},
+		until: "psp_success_v2",
+		columns: map[string]string{
+			"duration_sketch": legacySketch("total_count", "avg_duration_ms", map[float64]string{0.95: "p95_duration_ms"}),
+		},
+	}
+	vitalsLegacy = era{
+		levels: []resolution{
+			{"web_vitals_hourly", time.Hour},
+			{"web_vitals_daily", 24 * time.Hour},
+		},
+		until:   "web_vitals_v2",
+		columns: legacyVitalsColumns(),
+	}
+	vitalsV2 = era{
+		levels: []resolution{
+			{"web_vitals_v2_hourly", time.Hour},
+			{"web_vitals_v2_daily", 24 * time.Hour},
+		},
+		until:   "web_vitals_v3",
+		columns: v2VitalsColumns(),
+	}
+	gameLegacy = era{
+		levels: []resolution{
+			{"game_health_5m", 5 * time.Minute},
+			{"game_health_1h", time.Hour},
+			{"game_health_1d", 24 * time.Hour},
+		},
+		until: "game_health_v2",
+		columns: map[string]string{
+			"load_time_sketch": legacySketch("launch_count", "avg_load_time_ms", map[float64]string{0.95: "p95_load_time_ms"}),
+		},
+	}
+	wsLegacy = era{
+		levels: []resolution{
+			{"websocket_health_1m", time.Minute},
+			{"websocket_health_1h", time.Hour},
+			{"websocket_health_1d", 24 * time.Hour},
+		},
+		until: "websocket_health_v2",
+		columns: map[string]string{
+			"latency_sketch": legacySketch("latency_count", "avg_latency_ms", map[float64]string{0.5: "p50_latency_ms", 0.95: "p95_latency_ms"}),
+		},
+	}
+)
+
+// legacySketch merges sketches approximated from a count, a mean and
+// percentile columns (quantile → column) with legacy_sketch (migration 0005)
+func legacySketch(count, mean string, percentiles map[float64]string) string {
+	quantiles := make([]float64, 0, len(percentiles))
+	for q := range percentiles {
+		quantiles = append(quantiles, q)
+	}
+	sort.Float64s(quantiles)
+	qs := make([]string, len(quantiles))
+	cols := make([]string, len(quantiles))
+	for i, q := range quantiles {
+		qs[i] = fmt.Sprintf("%g", q)
+		cols[i] = percentiles[q]
+	}
+	return fmt.Sprintf("rollup(legacy_sketch(%s::bigint, %s::float8, ARRAY[%s]::float8[], ARRAY[%s]::float8[]))",
+		count, mean, strings.Join(qs, ", "), strings.Join(cols, ", "))
+}
+
+// pickResolution returns the coarsest level that still yields minPoints
+// buckets over span, or the finest level for short ranges
+func pickResolution(levels []resolution, span time.Duration) resolution {
+	for i := len(levels) - 1; i > 0; i-- {
+		if span/levels[i].bucket >= minPoints {
+			return levels[i]
+		}
+	}
+	return levels[0]
+}
+
+// viewsOf lists the view names of a hierarchy, finest first
+func viewsOf(levels []resolution) []string {
+	views := make([]string, len(levels))
+	for i, l := range levels {
+		views[i] = l.view
+	}
+	return views
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPickResolution(t *testing.T) {
+	tests := []struct {
+		span time.Duration
+		view string
+	}{
+		{time.Minute, "psp_success_v2_5m"},
+		{23 * time.Hour, "psp_success_v2_5m"},
+		{24 * time.Hour, "psp_success_v2_1h"},
+		{23 * 24 * time.Hour, "psp_success_v2_1h"},
+		{24 * 24 * time.Hour, "psp_success_v2_1d"},
+		{365 * 24 * time.Hour, "psp_success_v2_1d"},
+	}
+	for _, tt := range tests {
+		if got := pickResolution(pspResolutions, tt.span).view; got != tt.view {
+			t.Errorf("pickResolution(%s) = %s, want %s", tt.span, got, tt.view)
+		}
+	}
+}
+
+func TestResolutionLevels(t *testing.T) {
+	for _, levels := range [][]resolution{apiResolutions, pspResolutions, vitalsResolutions, gameResolutions, wsResolutions} {
+		for i := 1; i < len(levels); i++ {
+			if levels[i].bucket <= levels[i-1].bucket || levels[i].bucket%levels[i-1].bucket != 0 {
+				t.Errorf("%s (%s) is not a coarser multiple of %s (%s)", levels[i].view, levels[i].bucket, levels[i-1].view, levels[i-1].bucket)
+			}
+		}
+	}
+}
@@ -0,0 +1,527 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// MetricQuery is an ad-hoc query over the metric model: measures of one cube,
+// grouped by dimensions. Filters, range and granularity come from the Query.
+type MetricQuery struct {
+	Measures   []string      // cube.measure, e.g. api.p95_duration_ms; all of one cube
+	Dimensions []string      // dimension names (see Dimensions) to group by
+	Limit      int           // rows; 0 uses DefaultMetricLimit
+	Timeout    time.Duration // statement timeout (Postgres); 0 keeps the reader's
+}
+
+// MetricColumn describes one column of a MetricResult
+type MetricColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // time, dimension or measure
+	Unit string `json:"unit,omitempty"`
+}
+
+// MetricResult is the answer to a MetricQuery: one row per bucket and
+// dimension values, ordered by them, holding the bucket start, the dimension
+// values (null when unset) and the measures
+type MetricResult struct {
+	Columns     []MetricColumn `json:"columns"`
+	Rows        [][]any        `json:"rows"`
+	Granularity string         `json:"granularity"` // bucket width read, or "all"
+	Start       time.Time      `json:"start"`       // range read, widened to whole aggregate buckets
+	End         time.Time      `json:"end"`
+	Truncated   bool           `json:"truncated"` // more rows than the limit
+}
+
+// CubeInfo lists what can be queried on one cube
+type CubeInfo struct {
+	Name       string        `json:"name"`
+	Measures   []MeasureInfo `json:"measures"`
+	Dimensions []string      `json:"dimensions"`
+	Requires   string        `json:"requires,omitempty"` // dimension to filter or group by
+}
+
+// MeasureInfo is one measure of a cube
+type MeasureInfo struct {
+	Name string `json:"name"`
+	Unit string `json:"unit,omitempty"`
+}
+
+const (
+	DefaultMetricLimit = 1000
+	MaxMetricLimit     = 10000
+	// maxMetricMeasures and maxMetricDimensions cap the width of one query
+	maxMetricMeasures   = 20
+	maxMetricDimensions = 4
+)
+
+// measure is one value a cube can compute: an aggregate expression over the
+// columns of the cube's source relation, and its counterpart over raw rows
+type measure struct {
+	name string
+	unit string
+	sql  string
+	eval func(rows []rawRow) float64
+}
+
+// cube declares the measures and dimensions of one metric family. Dimensions
+// are the source's filter dimensions; grouping by one its aggregates do not
+// keep reads raw rows.
+type cube struct {
+	name     string
+	source   *source
+	table    string              // eventTables name the memory backend reads
+	accept   func(r rawRow) bool // memory counterpart of source.rawWhere
+	requires string              // dimension that must be filtered or grouped by
+	measures []measure
+}
+
+// cubes is the metric model in listing order. Every identifier that reaches
+// SQL comes from here or from the source definitions, never from the request.
+var cubes = []*cube{
+	{
+		name: "api", source: apiSource, table: "api",
+		measures: slices.Concat(
+			[]measure{
+				countMeasure("requests", "SUM(request_count)", nil),
+				countMeasure("errors", "SUM(error_count)", func(r rawRow) bool { return statusAtLeast(r, 400) }),
+				countMeasure("server_errors", "SUM(server_error_count)", func(r rawRow) bool { return statusAtLeast(r, 500) }),
+				shareMeasure("error_rate", "SUM(error_count)", "SUM(request_count)", func(r rawRow) bool { return statusAtLeast(r, 400) }),
+			},
+			distMeasures("duration_ms", "duration_sketch", "duration_ms", "ms"),
+		),
+	},
+	{
+		name: "psp", source: pspSource, table: "psp",
+		measures: slices.Concat(
+			[]measure{
+				countMeasure("transactions", "SUM(total_count)", nil),
+				countMeasure("failures", "SUM(total_count - success_count)", func(r rawRow) bool { return !r.flag("success") }),
+				shareMeasure("failure_rate", "SUM(total_count - success_count)", "SUM(total_count)", func(r rawRow) bool { return !r.flag("success") }),
+				sumMeasure("amount", "", "SUM(total_amount)", "amount", func(r rawRow) bool { return r.flag("success") }),
+			},
+			distMeasures("duration_ms", "duration_sketch", "duration_ms", "ms"),
+		),
+	},
+	{
+		name: "game", source: gameSource, table: "game",
+		measures: slices.Concat(
+			[]measure{
+				countMeasure("launches", "SUM(launch_count)", nil),
+				countMeasure("failures", "SUM(launch_count - success_count)", func(r rawRow) bool { return !r.flag("launch_success") }),
+				shareMeasure("failure_rate", "SUM(launch_count - success_count)", "SUM(launch_count)", func(r rawRow) bool { return !r.flag("launch_success") }),
+			},
+			distMeasures("load_time_ms", "load_time_sketch", "load_time_ms", "ms"),
+		),
+	},
+	{
+		name: "vitals", source: vitalsSource, table: "frontend",
+		accept:   func(r rawRow) bool { return r.str("event_type") == "web_vital" },
+		measures: vitalMeasures(),
+	},
+	{
+		name: "ws", source: wsSource, table: "ws",
+		measures: slices.Concat(
+			[]measure{
+				countMeasure("connects", "SUM(connects)", eventIs("connect")),
+				countMeasure("disconnects", "SUM(disconnects)", eventIs("disconnect")),
+				countMeasure("errors", "SUM(errors)", eventIs("error")),
+				countMeasure("reconnects", "SUM(reconnects)", eventIs("reconnect")),
+				countMeasure("abnormal_closes", "SUM(close_abnormal)", func(r rawRow) bool { v, ok := r.num("close_code"); return ok && v == 1006 }),
+				sumMeasure("messages_sent", "", "SUM(messages_sent)", "messages_sent", nil),
+				sumMeasure("messages_received", "", "SUM(messages_received)", "messages_received", nil),
+			},
+			distMeasures("latency_ms", "latency_sketch", "latency_ms", "ms"),
+		),
+	},
+	{
+		name: "custom", source: customSource, table: "frontend",
+		accept: func(r rawRow) bool {
+			_, ok := r.num("metric_value")
+			return ok && r.str("metric_name") != ""
+		},
+		// Values of different metrics do not mix
+		requires: "metric_name",
+		measures: slices.Concat(
+			[]measure{countMeasure("samples", "SUM(sample_count)", nil)},
+			distMeasures("value", "value_sketch", "metric_value", ""),
+		),
+	},
+}
+
+// countMeasure counts rows matching pred (all when nil)
+func countMeasure(name, sql string, pred func(r rawRow) bool) measure {
+	return measure{name: name, sql: sql, eval: func(rows []rawRow) float64 {
+		return float64(countRows(rows, pred))
+	}}
+}
+
+// sumMeasure sums a raw column over the rows matching pred
+func sumMeasure(name, unit, sql, col string, pred func(r rawRow) bool) measure {
+	return measure{name: name, unit: unit, sql: sql, eval: func(rows []rawRow) float64 {
+		var sum float64
+		for _, r := range rows {
+			if v, ok := r.num(col); ok && (pred == nil || pred(r)) {
+				sum += v
+			}
+		}
+		return sum
+	}}
+}
+
+// shareMeasure is the percentage of rows matching part, 0 without rows
+func shareMeasure(name, partSQL, totalSQL string, part func(r rawRow) bool) measure {
+	return measure{
+		name: name, unit: "%",
+		sql: fmt.Sprintf("COALESCE(%s::float8 / NULLIF(%s, 0) * 100, 0)", partSQL, totalSQL),
+		eval: func(rows []rawRow) float64 {
+			return percentOf(countRows(rows, part), int64(len(rows)))
+		},
+	}
+}
+
+// distMeasures are the mean and p50/p95/p99 of a sketch column, named avg_<name>
+// and p<q>_<name>; raw rows read col
+func distMeasures(name, sketch, col, unit string) []measure {
+	measures := []measure{{
+		name: "avg_" + name, unit: unit,
+		sql:  fmt.Sprintf("COALESCE(mean(rollup(%s)), 0)", sketch),
+		eval: func(rows []rawRow) float64 { return mean(columnValues(rows, col)) },
+	}}
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		measures = append(measures, measure{
+			name: fmt.Sprintf("p%.0f_%s", q*100, name), unit: unit,
+			sql:  fmt.Sprintf("COALESCE(approx_percentile(%g, rollup(%s)), 0)", q, sketch),
+			eval: func(rows []rawRow) float64 { return percentileCont(columnValues(rows, col), q) },
+		})
+	}
+	return measures
+}
+
+// vitalMeasures are the sample count, then the vitalQuantiles and the share
+// of good and poor samples of every web vital
+func vitalMeasures() []measure {
+	measures := []measure{countMeasure("samples", "SUM(sample_count)", nil)}
+	for _, v := range webVitals {
+		for _, q := range vitalQuantiles {
+			measures = append(measures, measure{
+				name: fmt.Sprintf("%s_p%.0f", v.name, q*100), unit: v.unit,
+				sql:  fmt.Sprintf("COALESCE(approx_percentile(%g, rollup(%s_sketch)), 0)", q, v.name),
+				eval: func(rows []rawRow) float64 { return percentileCont(columnValues(rows, v.column), q) },
+			})
+		}
+		total := fmt.Sprintf("SUM(%[1]s_good + %[1]s_needs_improvement + %[1]s_poor)", v.name)
+		for _, band := range []VitalRating{"good", "poor"} {
+			measures = append(measures, measure{
+				name: fmt.Sprintf("%s_%s_pct", v.name, band), unit: "%",
+				sql: fmt.Sprintf("COALESCE(SUM(%s_%s)::float8 / NULLIF(%s, 0) * 100, 0)", v.name, band, total),
+				eval: func(rows []rawRow) float64 {
+					values := columnValues(rows, v.column)
+					var n int64
+					for _, x := range values {
+						if v.rate(x) == band {
+							n++
+						}
+					}
+					return percentOf(n, int64(len(values)))
+				},
+			})
+		}
+	}
+	return measures
+}
+
+func countRows(rows []rawRow, pred func(r rawRow) bool) int64 {
+	if pred == nil {
+		return int64(len(rows))
+	}
+	var n int64
+	for _, r := range rows {
+		if pred(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// columnValues returns the non-null numbers of a column
+func columnValues(rows []rawRow, col string) []float64 {
+	values := make([]float64, 0, len(rows))
+	for _, r := range rows {
+		if v, ok := r.num(col); ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func statusAtLeast(r rawRow, code float64) bool {
+	v, ok := r.num("status_code")
+	return ok && v >= code
+}
+
+func eventIs(eventType string) func(r rawRow) bool {
+	return func(r rawRow) bool { return r.str("event_type") == eventType }
+}
+
+// MetricModel lists the cubes with their measures (qualified by cube name) and
+// dimensions
+func MetricModel() []CubeInfo {
+	model := make([]CubeInfo, 0, len(cubes))
+	for _, c := range cubes {
+		info := CubeInfo{Name: c.name, Requires: c.requires}
+		for _, m := range c.measures {
+			info.Measures = append(info.Measures, MeasureInfo{Name: c.name + "." + m.name, Unit: m.unit})
+		}
+		for _, dim := range Dimensions {
+			if _, ok := c.source.dims[dim]; ok {
+				info.Dimensions = append(info.Dimensions, dim)
+			}
+		}
+		model = append(model, info)
+	}
+	return model
+}
+
+// metricPlan is a validated MetricQuery resolved against its cube
+type metricPlan struct {
+	cube     *cube
+	source   *source // the cube's source, grouped by the requested dimensions
+	plan     queryPlan
+	dims     []string // grouped dimension columns
+	measures []measure
+	columns  []MetricColumn
+	limit    int
+}
+
+// planMetrics resolves the measures to one cube and plans q against its
+// source. Grouping by a dimension the aggregates do not keep reads raw rows,
+// as filtering by one does.
+func planMetrics(q Query, mq MetricQuery) (metricPlan, error) {
+	var mp metricPlan
+	if len(mq.Measures) == 0 {
+		return mp, fmt.Errorf("%w: at least one measure is required", ErrInvalidArgument)
+	}
+	if len(mq.Measures) > maxMetricMeasures {
+		return mp, fmt.Errorf("%w: at most %d measures", ErrInvalidArgument, maxMetricMeasures)
+	}
+	if len(mq.Dimensions) > maxMetricDimensions {
+		return mp, fmt.Errorf("%w: at most %d dimensions", ErrInvalidArgument, maxMetricDimensions)
+	}
+	switch {
+	case mq.Limit == 0:
+		mp.limit = DefaultMetricLimit
+	case mq.Limit < 0 || mq.Limit > MaxMetricLimit:
+		return mp, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidArgument, MaxMetricLimit)
+	default:
+		mp.limit = mq.Limit
+	}
+
+	mp.columns = []MetricColumn{{Name: "time", Type: "time"}}
+	for _, name := range mq.Measures {
+		cubeName, measureName, _ := strings.Cut(name, ".")
+		if mp.cube == nil {
+			i := slices.IndexFunc(cubes, func(c *cube) bool { return c.name == cubeName })
+			if i < 0 {
+				return mp, fmt.Errorf("%w: unknown measure %q", ErrInvalidArgument, name)
+			}
+			mp.cube = cubes[i]
+		} else if cubeName != mp.cube.name {
+			return mp, fmt.Errorf("%w: measures %q and %q are of different cubes", ErrInvalidArgument, mq.Measures[0], name)
+		}
+		i := slices.IndexFunc(mp.cube.measures, func(m measure) bool { return m.name == measureName })
+		if i < 0 {
+			return mp, fmt.Errorf("%w: unknown measure %q", ErrInvalidArgument, name)
+		}
+		if slices.ContainsFunc(mp.measures, func(m measure) bool { return m.name == measureName }) {
+			return mp, fmt.Errorf("%w: measure %q is listed twice", ErrInvalidArgument, name)
+		}
+		mp.measures = append(mp.measures, mp.cube.measures[i])
+	}
+
+	c := mp.cube
+	src := *c.source
+	for _, dim := range mq.Dimensions {
+		col, ok := c.source.dims[dim]
+		if !ok {
+			return mp, fmt.Errorf("%w: cannot group %s measures by %q", ErrInvalidArgument, c.name, dim)
+		}
+		if slices.Contains(mp.dims, col) {
+			return mp, fmt.Errorf("%w: dimension %q is listed twice", ErrInvalidArgument, dim)
+		}
+		if !slices.Contains(src.groupBy, col) {
+			src.groupBy = append(slices.Clone(src.groupBy), col)
+			src.rawOnly = true
+		}
+		mp.dims = append(mp.dims, col)
+		mp.columns = append(mp.columns, MetricColumn{Name: dim, Type: "dimension"})
+	}
+	if c.requires != "" && q.Filters[c.requires] == "" && !slices.Contains(mq.Dimensions, c.requires) {
+		return mp, fmt.Errorf("%w: %s measures need a %s filter or dimension", ErrInvalidArgument, c.name, c.requires)
+	}
+	for _, m := range mp.measures {
+		mp.columns = append(mp.columns, MetricColumn{Name: c.name + "." + m.name, Type: "measure", Unit: m.unit})
+	}
+
+	var err error
+	mp.source = &src
+	mp.plan, err = src.plan(q)
+	return mp, err
+}
+
+// result wraps rows already in order, keeping at most the limit
+func (mp metricPlan) result(rows [][]any) *MetricResult {
+	res := &MetricResult{Columns: mp.columns, Rows: rows, Granularity: mp.plan.step.String(), Start: mp.plan.start, End: mp.plan.end}
+	if mp.plan.whole {
+		res.Granularity = "all"
+	}
+	if len(rows) > mp.limit {
+		res.Rows, res.Truncated = rows[:mp.limit], true
+	}
+	if res.Rows == nil {
+		res.Rows = [][]any{}
+	}
+	return res
+}
+
+// ============================================
+// POSTGRES
+// ============================================
+
+// sql returns the statement of the plan and its arguments. Columns and
+// expressions come from the cube definitions, never from the request; one row
+// past the limit is read to detect truncation.
+func (mp metricPlan) sql() (string, []any) {
+	rel, args := mp.source.relation(mp.plan)
+
+	cols := append([]string{"bucket"}, mp.dims...)
+	positions := make([]string, len(cols))
+	for i := range cols {
+		positions[i] = fmt.Sprint(i + 1)
+	}
+	for _, m := range mp.measures {
+		cols = append(cols, "("+m.sql+")::float8")
+	}
+	return fmt.Sprintf(`SELECT %s FROM (%s) v GROUP BY %s ORDER BY %s LIMIT %d`,
+		strings.Join(cols, ", "), rel, strings.Join(positions, ", "), strings.Join(positions, ", "), mp.limit+1), args
+}
+
+// QueryMetrics compiles a MetricQuery to one parameterized statement over the
+// cube's aggregates (or raw rows) and runs it read-only under mq.Timeout
+func (p *Postgres) QueryMetrics(ctx context.Context, q Query, mq MetricQuery) (*MetricResult, error) {
+	mp, err := planMetrics(q, mq)
+	if err != nil {
+		return nil, err
+	}
+	query, args := mp.sql()
+
+	var rows [][]any
+	err = p.readWithTimeout(ctx, mq.Timeout, func(tx pgx.Tx) error {
+		res, err := tx.Query(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("query %s measures: %w", mp.cube.name, err)
+		}
+		defer res.Close()
+		for res.Next() {
+			values, err := res.Values()
+			if err != nil {
+				return fmt.Errorf("scan row: %w", err)
+			}
+			rows = append(rows, values)
+		}
+		return res.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mp.result(rows), nil
+}
+
+// ============================================
+// MEMORY
+// ============================================
+
+func (m *Memory) QueryMetrics(ctx context.Context, q Query, mq MetricQuery) (*MetricResult, error) {
+	mp, err := planMetrics(q, mq)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := EventColumns(mp.cube.table)
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		key  []any
+		rows []rawRow
+	}
+	groups := make(map[string]*group)
+	err = m.ScanEvents(ctx, mp.cube.table, Query{Start: mp.plan.start, End: mp.plan.end}, func(values []any) error {
+		row := make(rawRow, len(columns))
+		for i, col := range columns {
+			row[col] = values[i]
+		}
+		if mp.cube.accept != nil && !mp.cube.accept(row) {
+			return nil
+		}
+		for i, col := range mp.plan.filters {
+			if row[col] != mp.plan.values[i] {
+				return nil
+			}
+		}
+		t, _ := row["time"].(time.Time)
+		key := []any{mp.plan.bucket(t)}
+		for _, col := range mp.dims {
+			key = append(key, row[col])
+		}
+		id := fmt.Sprintf("%q", key)
+		g, ok := groups[id]
+		if !ok {
+			g = &group{key: key}
+			groups[id] = g
+		}
+		g.rows = append(g.rows, row)
+		return nil
+	})
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w: narrow the range or filters", ErrTimeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]any, 0, len(groups))
+	for _, g := range groups {
+		row := g.key
+		for _, ms := range mp.measures {
+			row = append(row, ms.eval(g.rows))
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if ta, tb := a[0].(time.Time), b[0].(time.Time); !ta.Equal(tb) {
+			return ta.Before(tb)
+		}
+		// Dimension values ascending, nulls last as in Postgres
+		for k := 1; k <= len(mp.dims); k++ {
+			sa, aok := a[k].(string)
+			sb, bok := b[k].(string)
+			if aok != bok {
+				return aok
+			}
+			if sa != sb {
+				return sa < sb
+			}
+		}
+		return false
+	})
+	return mp.result(rows), nil
+}
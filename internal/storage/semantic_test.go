@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanMetricsInvalid(t *testing.T) {
+	q := Query{Start: base, End: base.Add(time.Hour)}
+	tests := []struct {
+		name string
+		q    Query
+		mq   MetricQuery
+	}{
+		{"no measures", q, MetricQuery{}},
+		{"unknown cube", q, MetricQuery{Measures: []string{"wallet.requests"}}},
+		{"unknown measure", q, MetricQuery{Measures: []string{"api.nope"}}},
+		{"measure without cube", q, MetricQuery{Measures: []string{"requests"}}},
+		{"measure of another cube", q, MetricQuery{Measures: []string{"api.transactions"}}},
+		{"measures of two cubes", q, MetricQuery{Measures: []string{"api.requests", "psp.transactions"}}},
+		{"measure twice", q, MetricQuery{Measures: []string{"api.requests", "api.requests"}}},
+		{"too many measures", q, MetricQuery{Measures: make([]string, maxMetricMeasures+1)}},
+		{"unknown dimension", q, MetricQuery{Measures: []string{"api.requests"}, Dimensions: []string{"password"}}},
+		{"dimension of another cube", q, MetricQuery{Measures: []string{"api.requests"}, Dimensions: []string{"psp"}}},
+		{"column name as dimension", q, MetricQuery{Measures: []string{"api.requests"}, Dimensions: []string{"service_name"}}},
+		{"dimension twice", q, MetricQuery{Measures: []string{"api.requests"}, Dimensions: []string{"service", "service"}}},
+		{"too many dimensions", q, MetricQuery{Measures: []string{"ws.connects"}, Dimensions: []string{"endpoint", "device_type", "release", "endpoint", "device_type"}}},
+		{"injected dimension", q, MetricQuery{Measures: []string{"api.requests"}, Dimensions: []string{"service_name; DROP TABLE api_metrics; --"}}},
+		{"injected measure", q, MetricQuery{Measures: []string{"api.requests) FROM api_metrics; DROP TABLE api_metrics; --"}}},
+		{"injected filter name", Query{Start: base, End: base.Add(time.Hour), Filters: map[string]string{"service_name = '' OR 1=1 --": "x"}}, MetricQuery{Measures: []string{"api.requests"}}},
+		{"custom without a metric", q, MetricQuery{Measures: []string{"custom.samples"}}},
+		{"negative limit", q, MetricQuery{Measures: []string{"api.requests"}, Limit: -1}},
+		{"limit too high", q, MetricQuery{Measures: []string{"api.requests"}, Limit: MaxMetricLimit + 1}},
+		{"empty range", Query{Start: base, End: base}, MetricQuery{Measures: []string{"api.requests"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := planMetrics(tt.q, tt.mq); !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("err = %v, want ErrInvalidArgument", err)
+			}
+		})
+	}
+}
+
+func TestPlanMetrics(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		name        string
+		q           Query
+		mq          MetricQuery
+		granularity string
+		view        string // empty for raw rows
+		columns     string
+	}{
+		{
+			name: "minutes of an hour",
+			q:    Query{Start: base, End: base.Add(time.Hour)},
+			mq:   MetricQuery{Measures: []string{"api.requests", "api.p95_duration_ms"}},
+			view: "api_performance_v2_1m", granularity: "1m0s",
+			columns: "time:time api.requests:measure api.p95_duration_ms:measure:ms",
+		},
+		{
+			name: "hours of a week",
+			q:    Query{Start: base, End: base.Add(7 * day)},
+			mq:   MetricQuery{Measures: []string{"api.requests"}, Dimensions: []string{"service"}},
+			view: "api_performance_v2_1h", granularity: "1h0m0s",
+			columns: "time:time service:dimension api.requests:measure",
+		},
+		{
+			name: "explicit step",
+			q:    Query{Start: base, End: base.Add(2 * day), Step: 6 * time.Hour},
+			mq:   MetricQuery{Measures: []string{"api.requests"}},
+			view: "api_performance_v2_1h", granularity: "6h0m0s",
+			columns: "time:time api.requests:measure",
+		},
+		{
+			name: "whole range",
+			q:    Query{Start: base, End: base.Add(30 * day), Whole: true},
+			mq:   MetricQuery{Measures: []string{"psp.failure_rate"}, Dimensions: []string{"psp"}},
+			view: "psp_success_v2_1d", granularity: "all",
+			columns: "time:time psp:dimension psp.failure_rate:measure:%",
+		},
+		{
+			name:        "grouping by a raw dimension reads rows",
+			q:           Query{Start: base, End: base.Add(time.Hour), Step: 90 * time.Second},
+			mq:          MetricQuery{Measures: []string{"api.errors"}, Dimensions: []string{"method"}},
+			granularity: "1m30s",
+			columns:     "time:time method:dimension api.errors:measure",
+		},
+		{
+			name: "custom metric filtered",
+			q:    Query{Start: base, End: base.Add(time.Hour), Filters: map[string]string{"metric_name": "spin_ms"}},
+			mq:   MetricQuery{Measures: []string{"custom.p50_value"}},
+			view: "custom_metrics_5m", granularity: "5m0s",
+			columns: "time:time custom.p50_value:measure",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mp, err := planMetrics(tt.q, tt.mq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mp.plan.view != tt.view {
+				t.Errorf("view = %q, want %q", mp.plan.view, tt.view)
+			}
+			if got := mp.result(nil).Granularity; got != tt.granularity {
+				t.Errorf("granularity = %q, want %q", got, tt.granularity)
+			}
+			var columns []string
+			for _, c := range mp.columns {
+				col := c.Name + ":" + c.Type
+				if c.Unit != "" {
+					col += ":" + c.Unit
+				}
+				columns = append(columns, col)
+			}
+			if got := strings.Join(columns, " "); got != tt.columns {
+				t.Errorf("columns = %s, want %s", got, tt.columns)
+			}
+		})
+	}
+}
+
+func TestMetricsSQL(t *testing.T) {
+	const hostile = "wallet'; DROP TABLE api_metrics; --"
+	q := Query{Start: base, End: base.Add(time.Hour), Step: 5 * time.Minute, Filters: map[string]string{"service": hostile, "method": "GET"}}
+	mp, err := planMetrics(q, MetricQuery{Measures: []string{"api.requests", "api.error_rate"}, Dimensions: []string{"endpoint"}, Limit: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args := mp.sql()
+
+	// Filter values are bound, in name order after step, start and end
+	if strings.Contains(sql, "DROP") || strings.Contains(sql, "wallet") {
+		t.Errorf("filter value reached the SQL:\n%s", sql)
+	}
+	want := []any{5 * time.Minute, base, base.Add(time.Hour), "GET", hostile}
+	if fmt.Sprint(args) != fmt.Sprint(want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+	for _, s := range []string{
+		"SELECT bucket, endpoint, (SUM(request_count))::float8, ",
+		"FROM api_metrics WHERE time >= $2 AND time < $3 AND method = $4 AND service_name = $5",
+		") v GROUP BY 1, 2 ORDER BY 1, 2 LIMIT 51",
+	} {
+		if !strings.Contains(sql, s) {
+			t.Errorf("SQL lacks %q:\n%s", s, sql)
+		}
+	}
+}
+
+func TestMemoryQueryMetrics(t *testing.T) {
+	m := fixtureMemory(t)
+	ctx := context.Background()
+	q := Query{Start: base, End: base.Add(2 * time.Hour), Step: 30 * time.Minute}
+
+	res, err := m.QueryMetrics(ctx, q, MetricQuery{Measures: []string{"api.requests", "api.errors"}, Dimensions: []string{"service"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Requests at 0, 10 and 20 minutes fall in the first bucket, the one at 65
+	// in the third; games sorts before wallet
+	want := [][]any{
+		{base, "games", 1.0, 1.0},
+		{base, "wallet", 2.0, 1.0},
+		{base.Add(time.Hour), "wallet", 1.0, 0.0},
+	}
+	if fmt.Sprint(res.Rows) != fmt.Sprint(want) || res.Granularity != "30m0s" || res.Truncated {
+		t.Errorf("rows = %v (granularity %s, truncated %v), want %v", res.Rows, res.Granularity, res.Truncated, want)
+	}
+
+	res, err = m.QueryMetrics(ctx, q, MetricQuery{Measures: []string{"api.requests"}, Dimensions: []string{"service"}, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 2 || !res.Truncated {
+		t.Errorf("limit 2: %d rows, truncated %v; want 2 and truncated", len(res.Rows), res.Truncated)
+	}
+
+	res, err = m.QueryMetrics(ctx, Query{Start: base, End: base.Add(2 * time.Hour), Whole: true, Filters: map[string]string{"psp": "PIX"}},
+		MetricQuery{Measures: []string{"psp.transactions", "psp.failure_rate"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(res.Rows) != fmt.Sprint([][]any{{base, 2.0, 50.0}}) || res.Granularity != "all" {
+		t.Errorf("whole range rows = %v (granularity %s), want one bucket of 2 with 50%% failures", res.Rows, res.Granularity)
+	}
+}
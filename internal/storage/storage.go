@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+var (
+	// ErrInvalidArgument wraps errors caused by bad caller input (HTTP 400)
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrNotFound wraps errors for unknown resources (HTTP 404)
+	ErrNotFound = errors.New("not found")
+	// ErrTimeout wraps queries cancelled by their time limit (HTTP 504)
+	ErrTimeout = errors.New("query timed out")
+)
+
+// Writer persists raw metrics from the collect paths
+type Writer interface {
+	InsertFrontendMetrics(ctx context.Context, events []model.EnrichedEvent) error
+	CopyFrontendMetrics(ctx context.Context, events []model.EnrichedEvent) error
+	InsertAPIMetrics(ctx context.Context, metrics []model.APIMetric) error
+	CopyAPIMetrics(ctx context.Context, metrics []model.APIMetric) error
+	InsertPSPMetrics(ctx context.Context, metrics []model.PSPMetric) error
+	CopyPSPMetrics(ctx context.Context, metrics []model.PSPMetric) error
+	InsertGameMetrics(ctx context.Context, metrics []model.GameMetric) error
+	CopyGameMetrics(ctx context.Context, metrics []model.GameMetric) error
+	InsertWebSocketMetrics(ctx context.Context, metrics []model.WebSocketMetric) error
+	CopyWebSocketMetrics(ctx context.Context, metrics []model.WebSocketMetric) error
+}
+
+// Dashboard serves the dashboard read paths
+type Dashboard interface {
+	GetOverviewMetrics(ctx context.Context, q Query) (*OverviewMetrics, error)
+	GetAPIPerformance(ctx context.Context, q Query) ([]APIPerformanceRow, error)
+	GetAPITimeSeries(ctx context.Context, q Query) ([]TimeSeriesPoint, error)
+	GetPSPHealth(ctx context.Context, q Query) ([]PSPHealthRow, error)
+	GetPSPTimeSeries(ctx context.Context, q Query) ([]TimeSeriesPoint, error)
+	GetWebVitals(ctx context.Context, q Query) ([]WebVitalsRow, error)
+	GetWebVitalsTimeSeries(ctx context.Context, metric, stat string, q Query) ([]TimeSeriesPoint, error)
+	GetGameHealth(ctx context.Context, q Query) ([]GameHealthRow, error)
+	GetGameTimeSeries(ctx context.Context, q Query) ([]TimeSeriesPoint, error)
+	GetWebSocketHealth(ctx context.Context, q Query) ([]WebSocketHealthRow, error)
+	GetWebSocketTimeSeries(ctx context.Context, metric string, q Query) ([]TimeSeriesPoint, error)
+	GetPercentiles(ctx context.Context, source string, q Query) (*PercentileSummary, error)
+	GetCustomMetrics(ctx context.Context, q Query, opts CustomMetricOptions) ([]CustomMetricRow, error)
+	GetCustomMetricsTimeSeries(ctx context.Context, stat string, q Query, opts CustomMetricOptions) ([]TimeSeriesPoint, error)
+	GetCustomMetricCatalog(ctx context.Context, q Query) ([]CustomMetricInfo, error)
+	GetAlerts(ctx context.Context, q Query, resolved *bool) ([]AlertRow, error)
+	AcknowledgeAlert(ctx context.Context, alertTime time.Time) error
+	ScanEvents(ctx context.Context, table string, q Query, fn func(values []any) error) error
+	GetTopEndpoints(ctx context.Context, q Query, opts TopOptions) ([]TopEndpointRow, error)
+	GetTopPSPs(ctx context.Context, q Query, opts TopOptions) ([]TopPSPRow, error)
+	GetTopGames(ctx context.Context, by string, q Query, opts TopOptions) ([]TopGameRow, error)
+	GetErrorGroups(ctx context.Context, q Query, opts ErrorOptions) ([]ErrorGroup, error)
+	GetEvents(ctx context.Context, table string, q Query, eq EventQuery) (*EventPage, error)
+	GetPlayerTimeline(ctx context.Context, playerID string, q Query, opts TimelineOptions) (*Timeline, error)
+	ListFunnels(ctx context.Context) ([]Funnel, error)
+	GetFunnel(ctx context.Context, id int64) (*Funnel, error)
+	SaveFunnel(ctx context.Context, f *Funnel) error
+	DeleteFunnel(ctx context.Context, id int64) error
+	GetFunnelReport(ctx context.Context, f Funnel, q Query, opts FunnelOptions) (*FunnelReport, error)
+	GetCohorts(ctx context.Context, q Query, opts CohortOptions) (*CohortReport, error)
+	RecordDeployment(ctx context.Context, d *Deployment) error
+	ListDeployments(ctx context.Context, q Query, opts DeploymentOptions) ([]Deployment, error)
+	CompareReleases(ctx context.Context, release string, q Query, opts ReleaseOptions) (*ReleaseComparison, error)
+	QueryMetrics(ctx context.Context, q Query, mq MetricQuery) (*MetricResult, error)
+}
+
+// ExportAudit records who exported which data
+type ExportAudit interface {
+	RecordExport(ctx context.Context, row ExportAuditRow) error
+	GetExportAudit(ctx context.Context, actor string, limit int) ([]ExportAuditRow, error)
+}
+
+// Store is a complete storage backend (Postgres or Memory)
+type Store interface {
+	Writer
+	Dashboard
+	ExportAudit
+	Ping(ctx context.Context) error
+	Close()
+}
+
+// Policies manages hypertable retention and compression (Postgres only)
+type Policies interface {
+	ListHypertables(ctx context.Context) ([]HypertableInfo, error)
+	GetHypertableChunks(ctx context.Context, hypertable string) ([]ChunkInfo, error)
+	SetRetentionPolicy(ctx context.Context, hypertable string, dropAfter *string, actor string) error
+	SetCompressionPolicy(ctx context.Context, hypertable string, compressAfter *string, actor string) error
+	GetPolicyAudit(ctx context.Context, limit int) ([]PolicyAuditRow, error)
+}
+
+// AlertListener reports alerts being raised, acknowledged or resolved as it happens
+type AlertListener interface {
+	// ListenAlerts calls fn after every alert change until ctx is done
+	ListenAlerts(ctx context.Context, fn func()) error
+}
+
+// ActivityRollup builds player_daily_activity, the per-player daily summary
+// retention cohorts are computed from
+type ActivityRollup interface {
+	// RefreshPlayerActivity rebuilds one UTC day and returns its active players
+	RefreshPlayerActivity(ctx context.Context, day time.Time) (int64, error)
+	// LatestActivityDay returns the last day built, zero when none is
+	LatestActivityDay(ctx context.Context) (time.Time, error)
+}
+
+var (
+	_ Store          = (*Postgres)(nil)
+	_ Policies       = (*Postgres)(nil)
+	_ AlertListener  = (*Postgres)(nil)
+	_ ActivityRollup = (*Postgres)(nil)
+	_ Store          = (*Memory)(nil)
+	_ AlertListener  = (*Memory)(nil)
+	_ ActivityRollup = (*Memory)(nil)
+)
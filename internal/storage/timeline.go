@@ -0,0 +1,429 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// TimelineOptions bounds a player timeline
+type TimelineOptions struct {
+	Limit   int           // entries; each table is read up to this many rows
+	Cursor  string        // NextCursor of the previous page
+	Timeout time.Duration // statement timeout per table read (Postgres)
+}
+
+// Timeline is everything one player did over a range, oldest first
+type Timeline struct {
+	PlayerID   string            `json:"player_id"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Entries    []TimelineEntry   `json:"entries"`
+	Sessions   []TimelineSession `json:"sessions"`
+	Failures   int               `json:"failures"`
+	Truncated  bool              `json:"truncated"`
+	NextCursor string            `json:"next_cursor,omitempty"` // when truncated, continues after the last entry
+}
+
+// TimelineEntry is one event of a player
+type TimelineEntry struct {
+	Time      time.Time      `json:"time"`
+	Source    string         `json:"source"` // frontend, api, psp, game, ws or session
+	Kind      string         `json:"kind"`   // e.g. page_load, web_vital, api_call, deposit, game_launch, ws_connect, session_start
+	Summary   string         `json:"summary"`
+	Failed    bool           `json:"failed"`
+	SessionID string         `json:"session_id,omitempty"`
+	Details   map[string]any `json:"details,omitempty"` // the non-null columns of the row
+}
+
+// TimelineSession is one frontend session within the timeline
+type TimelineSession struct {
+	SessionID  string    `json:"session_id"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Events     int       `json:"events"`
+	Failures   int       `json:"failures"`
+	DeviceType string    `json:"device_type,omitempty"`
+	Country    string    `json:"country,omitempty"`
+}
+
+// timelineSources turn the raw rows of each table into entries
+var timelineSources = map[string]func(r rawRow) TimelineEntry{
+	"frontend": frontendEntry,
+	"api":      apiEntry,
+	"psp":      pspEntry,
+	"game":     gameEntry,
+	"ws":       wsEntry,
+}
+
+// timelineCursor is the position in every table after the entries returned so
+// far; tables without one are read from the start of the range
+type timelineCursor map[string]*eventCursor
+
+func (c timelineCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeTimelineCursor(s string) (timelineCursor, error) {
+	c := timelineCursor{}
+	if s == "" {
+		return c, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidArgument)
+	}
+	for table, pos := range c {
+		if _, ok := timelineSources[table]; !ok || pos == nil || pos.Time.IsZero() || pos.Skip < 1 {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidArgument)
+		}
+	}
+	return c, nil
+}
+
+// playerTimeline reads the player's rows of every table through get and
+// merges them. When a table has more rows than the limit, the timeline ends
+// where that table's page ended so no table has gaps; the next cursor holds
+// each table's own position, so rows sharing a time are neither repeated nor
+// skipped across pages.
+func playerTimeline(ctx context.Context, get func(ctx context.Context, table string, q Query, eq EventQuery) (*EventPage, error), playerID string, q Query, opts TimelineOptions) (*Timeline, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultEventLimit
+	}
+	q = Query{Start: q.Start, End: q.end()}
+	cursor, err := decodeTimelineCursor(opts.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]string, 0, len(timelineSources))
+	for table := range timelineSources {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	pages := make([]*EventPage, len(tables))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, table := range tables {
+		eq := EventQuery{
+			Lookups:   map[string]string{"player_id": playerID},
+			Limit:     opts.Limit,
+			Ascending: true,
+			Timeout:   opts.Timeout,
+		}
+		if pos := cursor[table]; pos != nil {
+			eq.Cursor = pos.encode()
+		}
+		g.Go(func() error {
+			page, err := get(gctx, table, q, eq)
+			pages[i] = page
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	tl := &Timeline{PlayerID: strings.ToLower(playerID), Start: q.Start, End: q.End}
+	var cutoff *time.Time
+	for i, page := range pages {
+		build := timelineSources[tables[i]]
+		for _, values := range page.Rows {
+			row := make(rawRow, len(page.Columns))
+			for j, col := range page.Columns {
+				row[col] = values[j]
+			}
+			entry := build(row)
+			t, ok := row["time"].(time.Time)
+			if !ok {
+				return nil, fmt.Errorf("%s row has no time: %T", tables[i], row["time"])
+			}
+			entry.Time = t
+			entry.Source = tables[i]
+			entry.Details = row.details()
+			tl.Entries = append(tl.Entries, entry)
+		}
+		if page.NextCursor != "" && len(page.Rows) > 0 {
+			last := tl.Entries[len(tl.Entries)-1].Time
+			if cutoff == nil || last.Before(*cutoff) {
+				cutoff = &last
+			}
+		}
+	}
+	// Stable, so each table's entries keep the order of its page
+	sort.SliceStable(tl.Entries, func(i, j int) bool { return tl.Entries[i].Time.Before(tl.Entries[j].Time) })
+
+	keep := len(tl.Entries)
+	if cutoff != nil {
+		keep = sort.Search(len(tl.Entries), func(i int) bool { return tl.Entries[i].Time.After(*cutoff) })
+	}
+	if keep > opts.Limit {
+		keep = opts.Limit
+	}
+	if keep < len(tl.Entries) || cutoff != nil {
+		tl.Entries, tl.Truncated = tl.Entries[:keep], true
+		tl.NextCursor = timelineNext(cursor, tl.Entries).encode()
+	}
+
+	tl.Sessions = timelineSessions(tl.Entries)
+	tl.Entries = withSessionBoundaries(tl.Entries, tl.Sessions)
+	for _, e := range tl.Entries {
+		if e.Failed {
+			tl.Failures++
+		}
+	}
+	if tl.Entries == nil {
+		tl.Entries = []TimelineEntry{}
+	}
+	return tl, nil
+}
+
+// timelineNext advances each table's position past its entries in kept, a
+// prefix of every table's page
+func timelineNext(from timelineCursor, kept []TimelineEntry) timelineCursor {
+	times := make(map[string][]time.Time)
+	for _, e := range kept {
+		times[e.Source] = append(times[e.Source], e.Time)
+	}
+	next := make(timelineCursor, len(timelineSources))
+	for table := range timelineSources {
+		if pos := from[table].advance(times[table]); pos != nil {
+			next[table] = pos
+		}
+	}
+	return next
+}
+
+// timelineSessions summarizes the frontend sessions seen in entries
+func timelineSessions(entries []TimelineEntry) []TimelineSession {
+	sessions := []TimelineSession{}
+	index := make(map[string]int)
+	for _, e := range entries {
+		if e.Source != "frontend" || e.SessionID == "" {
+			continue
+		}
+		i, ok := index[e.SessionID]
+		if !ok {
+			i = len(sessions)
+			index[e.SessionID] = i
+			sessions = append(sessions, TimelineSession{SessionID: e.SessionID, Start: e.Time})
+		}
+		s := &sessions[i]
+		s.End = e.Time
+		s.Events++
+		if e.Failed {
+			s.Failures++
+		}
+		if v, ok := e.Details["device_type"].(string); ok && s.DeviceType == "" {
+			s.DeviceType = v
+		}
+		if v, ok := e.Details["country"].(string); ok && s.Country == "" {
+			s.Country = v
+		}
+	}
+	return sessions
+}
+
+// withSessionBoundaries inserts session_start and session_end entries
+func withSessionBoundaries(entries []TimelineEntry, sessions []TimelineSession) []TimelineEntry {
+	for _, s := range sessions {
+		device := ""
+		if s.DeviceType != "" {
+			device = " on " + s.DeviceType
+		}
+		entries = append(entries,
+			TimelineEntry{Time: s.Start, Source: "session", Kind: "session_start", SessionID: s.SessionID,
+				Summary: "Session started" + device},
+			TimelineEntry{Time: s.End, Source: "session", Kind: "session_end", SessionID: s.SessionID,
+				Summary: fmt.Sprintf("Session ended after %s, %d events", s.End.Sub(s.Start).Round(time.Second), s.Events)},
+		)
+	}
+	// Starts go before and ends after the session's own events at the same instant
+	rank := func(e TimelineEntry) int {
+		switch e.Kind {
+		case "session_start":
+			return 0
+		case "session_end":
+			return 2
+		}
+		return 1
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Time.Equal(entries[j].Time) {
+			return entries[i].Time.Before(entries[j].Time)
+		}
+		return rank(entries[i]) < rank(entries[j])
+	})
+	return entries
+}
+
+// rawRow is a raw row by column name, as GetEvents and ScanEvents return it
+type rawRow map[string]any
+
+func (r rawRow) str(col string) string {
+	s, _ := r[col].(string)
+	return s
+}
+
+func (r rawRow) num(col string) (float64, bool) {
+	switch v := r[col].(type) {
+	case float64:
+		return v, true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func (r rawRow) flag(col string) bool {
+	b, _ := r[col].(bool)
+	return b
+}
+
+func (r rawRow) ms(col string) string {
+	if v, ok := r.num(col); ok {
+		return fmt.Sprintf(" in %.0f ms", v)
+	}
+	return ""
+}
+
+// details drops the columns every entry repeats and the nulls
+func (r rawRow) details() map[string]any {
+	d := make(map[string]any)
+	for col, v := range r {
+		if v == nil || col == "time" || col == "player_id" {
+			continue
+		}
+		d[col] = v
+	}
+	return d
+}
+
+func frontendEntry(r rawRow) TimelineEntry {
+	e := TimelineEntry{Kind: r.str("event_type"), SessionID: r.str("session_id")}
+	page := r.str("page_path")
+	switch e.Kind {
+	case "page_load":
+		e.Summary = "Loaded " + page
+	case "web_vital":
+		var parts []string
+		for _, v := range webVitals {
+			x, ok := r.num(v.column)
+			if !ok {
+				continue
+			}
+			if v.unit == "" {
+				parts = append(parts, fmt.Sprintf("%s %.2f", v.label, x))
+			} else {
+				parts = append(parts, fmt.Sprintf("%s %.0f %s", v.label, x, v.unit))
+			}
+			if x > v.poor {
+				e.Failed = true
+			}
+		}
+		e.Summary = strings.Join(parts, ", ") + " on " + page
+	case "error":
+		e.Failed = true
+		e.Summary = "Error on " + page
+		if name := r.str("metric_name"); name != "" {
+			e.Summary += ": " + name
+		}
+	default:
+		e.Summary = strings.TrimSpace(e.Kind + " " + r.str("metric_name") + " on " + page)
+	}
+	return e
+}
+
+func apiEntry(r rawRow) TimelineEntry {
+	e := TimelineEntry{Kind: "api_call"}
+	status, _ := r.num("status_code")
+	e.Summary = fmt.Sprintf("%s %s → %.0f%s (%s)", r.str("method"), r.str("endpoint"), status, r.ms("duration_ms"), r.str("service_name"))
+	if status >= 400 || r.str("error_type") != "" {
+		e.Failed = true
+		e.Summary += failure(r.str("error_type"), r.str("error_message"))
+	}
+	return e
+}
+
+func pspEntry(r rawRow) TimelineEntry {
+	e := TimelineEntry{Kind: r.str("operation")}
+	e.Summary = fmt.Sprintf("%s %s", r.str("psp_name"), e.Kind)
+	if amount, ok := r.num("amount"); ok {
+		e.Summary += fmt.Sprintf(" of %.2f %s", amount, r.str("currency"))
+	}
+	if ok, _ := r["success"].(bool); ok {
+		e.Summary += " succeeded" + r.ms("duration_ms")
+	} else {
+		e.Failed = true
+		e.Summary += " failed" + r.ms("duration_ms") + failure(r.str("error_code"), r.str("error_message"))
+	}
+	return e
+}
+
+func gameEntry(r rawRow) TimelineEntry {
+	e := TimelineEntry{Kind: "game_launch"}
+	e.Summary = strings.TrimSpace(r.str("provider") + " " + r.str("game_id"))
+	if ok, _ := r["launch_success"].(bool); ok {
+		e.Summary += " launched" + r.ms("load_time_ms")
+	} else {
+		e.Failed = true
+		e.Summary += " failed to launch" + failure(r.str("error_type"), r.str("error_message"))
+	}
+	return e
+}
+
+func wsEntry(r rawRow) TimelineEntry {
+	event := r.str("event_type")
+	e := TimelineEntry{Kind: "ws_" + event}
+	e.Summary = strings.TrimSpace("WebSocket " + event + " " + r.str("endpoint"))
+	if code, ok := r.num("close_code"); ok {
+		e.Summary += fmt.Sprintf(" (close %.0f", code)
+		if reason := r.str("close_reason"); reason != "" {
+			e.Summary += " " + reason
+		}
+		e.Summary += ")"
+		e.Failed = code != 1000 && code != 1001
+	}
+	if event == "error" {
+		e.Failed = true
+	}
+	return e
+}
+
+// failure formats an error code and message for a summary
+func failure(code, message string) string {
+	s := strings.TrimSpace(strings.TrimSpace(code) + " " + strings.TrimSpace(message))
+	if s == "" {
+		return ""
+	}
+	return ": " + s
+}
+
+// ============================================
+// POSTGRES
+// ============================================
+
+// GetPlayerTimeline merges a player's frontend, API, PSP, game and WebSocket
+// rows, each read through the player_id indexes
+func (p *Postgres) GetPlayerTimeline(ctx context.Context, playerID string, q Query, opts TimelineOptions) (*Timeline, error) {
+	return playerTimeline(ctx, p.GetEvents, playerID, q, opts)
+}
+
+// ============================================
+// MEMORY
+// ============================================
+
+func (m *Memory) GetPlayerTimeline(ctx context.Context, playerID string, q Query, opts TimelineOptions) (*Timeline, error) {
+	return playerTimeline(ctx, m.GetEvents, playerID, q, opts)
+}
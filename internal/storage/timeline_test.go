@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+const timelinePlayer = "6f1c2b3a-0000-4000-8000-000000000001"
+
+// timelineMemory holds one player's API calls, several at the same instant
+// and two identical, plus a payment and a page load in between
+func timelineMemory(t *testing.T) *Memory {
+	t.Helper()
+	ctx := context.Background()
+	m := NewMemory(0)
+	player := ptr(timelinePlayer)
+	call := func(offset time.Duration, endpoint string) model.APIMetric {
+		return model.APIMetric{Time: base.Add(offset), ServiceName: "wallet", Endpoint: endpoint, Method: "GET", DurationMS: 10, StatusCode: 200, PlayerID: player}
+	}
+	for _, err := range []error{
+		m.InsertAPIMetrics(ctx, []model.APIMetric{
+			call(0, "/a"), call(0, "/b"),
+			call(time.Minute, "/c"), call(time.Minute, "/c"),
+			call(2*time.Minute, "/d"),
+			{Time: base, ServiceName: "wallet", Endpoint: "/other", Method: "GET", StatusCode: 200, PlayerID: ptr("6f1c2b3a-0000-4000-8000-000000000002")},
+		}),
+		m.InsertPSPMetrics(ctx, []model.PSPMetric{
+			{Time: base.Add(time.Minute), PSPName: "PIX", Operation: "deposit", Success: true, PlayerID: player},
+			{Time: base.Add(3 * time.Minute), PSPName: "PIX", Operation: "withdrawal", Success: true, PlayerID: player},
+		}),
+		m.CopyFrontendMetrics(ctx, []model.EnrichedEvent{
+			{FrontendEvent: model.FrontendEvent{Time: base.Add(30 * time.Second), SessionID: "s1", PlayerID: player, EventType: "page_load", PagePath: "/"}},
+		}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+// timelineEvents are the entries of a timeline that come from rows
+func timelineEvents(tl *Timeline) []TimelineEntry {
+	var entries []TimelineEntry
+	for _, e := range tl.Entries {
+		if e.Source != "session" {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func TestPlayerTimelineTruncation(t *testing.T) {
+	m := timelineMemory(t)
+	q := Query{Start: base, End: base.Add(time.Hour)}
+
+	tl, err := m.GetPlayerTimeline(context.Background(), timelinePlayer, q, TimelineOptions{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The API page ends at base, so nothing later is returned even though the
+	// other tables fit
+	got := timelineEvents(tl)
+	if len(got) != 2 || !got[0].Time.Equal(base) || !got[1].Time.Equal(base) {
+		t.Errorf("first page = %+v, want the two calls at %s", got, base)
+	}
+	if !tl.Truncated || tl.NextCursor == "" {
+		t.Errorf("truncated = %v, next cursor %q; want a next page", tl.Truncated, tl.NextCursor)
+	}
+
+	tl, err = m.GetPlayerTimeline(context.Background(), timelinePlayer, q, TimelineOptions{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tl.Truncated || tl.NextCursor != "" || len(timelineEvents(tl)) != 8 {
+		t.Errorf("whole timeline: truncated %v, cursor %q, %d entries; want 8 in one page", tl.Truncated, tl.NextCursor, len(timelineEvents(tl)))
+	}
+	if len(tl.Sessions) != 1 || tl.Sessions[0].SessionID != "s1" {
+		t.Errorf("sessions = %+v, want s1", tl.Sessions)
+	}
+}
+
+func TestPlayerTimelinePages(t *testing.T) {
+	m := timelineMemory(t)
+	ctx := context.Background()
+	q := Query{Start: base, End: base.Add(time.Hour)}
+	key := func(e TimelineEntry) string { return fmt.Sprint(e.Time.Unix(), e.Source, e.Summary) }
+
+	whole, err := m.GetPlayerTimeline(ctx, timelinePlayer, q, TimelineOptions{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, e := range timelineEvents(whole) {
+		want = append(want, key(e))
+	}
+
+	for _, limit := range []int{1, 2, 3} {
+		t.Run(fmt.Sprintf("limit=%d", limit), func(t *testing.T) {
+			var seen []string
+			var last time.Time
+			opts := TimelineOptions{Limit: limit}
+			for pages := 0; ; pages++ {
+				if pages > len(want) {
+					t.Fatal("cursor does not advance")
+				}
+				tl, err := m.GetPlayerTimeline(ctx, timelinePlayer, q, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				entries := timelineEvents(tl)
+				if len(entries) == 0 || len(entries) > limit {
+					t.Fatalf("page %d has %d entries, limit %d", pages, len(entries), limit)
+				}
+				for _, e := range entries {
+					if e.Time.Before(last) {
+						t.Errorf("%s went back in time after %s", key(e), last)
+					}
+					last = e.Time
+					seen = append(seen, key(e))
+				}
+				if !tl.Truncated {
+					break
+				}
+				opts.Cursor = tl.NextCursor
+			}
+			got, wantSorted := slices.Clone(seen), slices.Clone(want)
+			slices.Sort(got)
+			slices.Sort(wantSorted)
+			if !slices.Equal(got, wantSorted) {
+				t.Errorf("paged through %v, want every entry once: %v", seen, want)
+			}
+		})
+	}
+}
+
+func TestTimelineCursor(t *testing.T) {
+	c := timelineCursor{"api": {Time: base, Skip: 2}, "psp": {Time: base.Add(time.Minute), Skip: 1}}
+	got, err := decodeTimelineCursor(c.encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !got["api"].Time.Equal(base) || got["api"].Skip != 2 || got["psp"].Skip != 1 {
+		t.Errorf("round trip = %v, want %v", got, c)
+	}
+	for _, s := range []string{
+		"not base64!",
+		timelineCursor{"alerts": {Time: base, Skip: 1}}.encode(),
+		timelineCursor{"api": {Time: base}}.encode(),
+		timelineCursor{"api": nil}.encode(),
+	} {
+		if _, err := decodeTimelineCursor(s); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("decodeTimelineCursor(%q): err = %v, want ErrInvalidArgument", s, err)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+// TopOptions selects how a leaderboard is ranked
+type TopOptions struct {
+	OrderBy   string // board-specific metric; empty uses the board default
+	Limit     int
+	MinVolume int64 // groups with fewer requests, transactions or launches are left out
+}
+
+// Trend compares a row's order_by metric with the previous period of equal length
+type Trend struct {
+	Previous     *float64 `json:"previous"`      // null when the group was absent or under min_volume
+	Change       *float64 `json:"change"`        // current − previous
+	PreviousRank *int     `json:"previous_rank"` // rank on the previous period's board
+	Direction    string   `json:"direction"`     // up, down, flat or new
+}
+
+// flatTrend is the relative change below which a trend counts as flat
+const flatTrend = 0.01
+
+// TopEndpointRow ranks one service endpoint over the range
+type TopEndpointRow struct {
+	Rank          int     `json:"rank"`
+	ServiceName   string  `json:"service_name"`
+	Endpoint      string  `json:"endpoint"`
+	RequestCount  int64   `json:"request_count"`
+	ErrorCount    int64   `json:"error_count"`
+	ErrorRate     float64 `json:"error_rate"` // % of requests with status >= 400
+	AvgDurationMS float64 `json:"avg_duration_ms"`
+	P95DurationMS float64 `json:"p95_duration_ms"`
+	TotalTimeMS   float64 `json:"total_time_ms"` // time consumed: requests × mean duration
+	Trend         Trend   `json:"trend"`
+}
+
+// TopPSPRow ranks one PSP and operation over the range
+type TopPSPRow struct {
+	Rank          int     `json:"rank"`
+	PSPName       string  `json:"psp_name"`
+	Operation     string  `json:"operation"`
+	TotalCount    int64   `json:"total_count"`
+	FailureCount  int64   `json:"failure_count"`
+	FailureRate   float64 `json:"failure_rate"` // % of transactions
+	P95DurationMS float64 `json:"p95_duration_ms"`
+	TotalAmount   float64 `json:"total_amount"`
+	Trend         Trend   `json:"trend"`
+}
+
+// TopGameRow ranks one game provider, or one game when ranking by game
+type TopGameRow struct {
+	Rank          int     `json:"rank"`
+	Provider      string  `json:"provider"`
+	GameID        string  `json:"game_id,omitempty"`
+	LaunchCount   int64   `json:"launch_count"`
+	FailureCount  int64   `json:"failure_count"`
+	FailureRate   float64 `json:"failure_rate"` // % of launches
+	P95LoadTimeMS float64 `json:"p95_load_time_ms"`
+	Trend         Trend   `json:"trend"`
+}
+
+// Orderings per board, by order_by name
+var (
+	endpointOrders = map[string]func(*TopEndpointRow) float64{
+		"p95":        func(r *TopEndpointRow) float64 { return r.P95DurationMS },
+		"error_rate": func(r *TopEndpointRow) float64 { return r.ErrorRate },
+		"requests":   func(r *TopEndpointRow) float64 { return float64(r.RequestCount) },
+		"total_time": func(r *TopEndpointRow) float64 { return r.TotalTimeMS },
+	}
+	pspOrders = map[string]func(*TopPSPRow) float64{
+		"failure_rate": func(r *TopPSPRow) float64 { return r.FailureRate },
+		"failures":     func(r *TopPSPRow) float64 { return float64(r.FailureCount) },
+		"volume":       func(r *TopPSPRow) float64 { return float64(r.TotalCount) },
+		"p95":          func(r *TopPSPRow) float64 { return r.P95DurationMS },
+	}
+	gameOrders = map[string]func(*TopGameRow) float64{
+		"failure_rate": func(r *TopGameRow) float64 { return r.FailureRate },
+		"failures":     func(r *TopGameRow) float64 { return float64(r.FailureCount) },
+		"launches":     func(r *TopGameRow) float64 { return float64(r.LaunchCount) },
+		"p95_load":     func(r *TopGameRow) float64 { return r.P95LoadTimeMS },
+	}
+)
+
+var (
+	// gameProviderSource merges the game aggregates per provider
+	gameProviderSource = &source{
+		levels:  gameResolutions,
+		history: gameSource.history,
+		raw:     gameSource.raw,
+		groupBy: []string{"provider"},
+		columns: gameSource.columns,
+		dims:    gameSource.dims,
+	}
+	// gameIDSource ranks single games; the aggregates do not keep game_id, so
+	// it reads raw rows and only covers raw retention
+	gameIDSource = &source{
+		levels:   gameResolutions,
+		raw:      gameSource.raw,
+		rawWhere: "game_id IS NOT NULL",
+		groupBy:  []string{"provider", "game_id"},
+		columns:  gameSource.columns,
+		dims:     gameSource.dims,
+		rawOnly:  true,
+	}
+)
+
+// periods returns q and the period of equal length just before it, both as
+// period totals
+func periods(q Query) (Query, Query) {
+	q.End, q.Whole = q.end(), true
+	prev := q
+	prev.Start, prev.End = q.Start.Add(-q.End.Sub(q.Start)), q.Start
+	return q, prev
+}
+
+// resolveOrder returns the ordering for name, or the default when empty
+func resolveOrder[T any](orders map[string]func(*T) float64, name, def string) (func(*T) float64, error) {
+	if name == "" {
+		name = def
+	}
+	value, ok := orders[name]
+	if !ok {
+		names := make([]string, 0, len(orders))
+		for n := range orders {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%w: order_by must be one of %s", ErrInvalidArgument, strings.Join(names, ", "))
+	}
+	return value, nil
+}
+
+// rankTop drops rows under the minimum volume, sorts the rest by value
+// (highest first, then volume), keeps the first limit and attaches the trend
+// against the previous period's board
+func rankTop[T any](current, previous []T, opts TopOptions, value func(*T) float64, volume func(*T) int64, key func(*T) string, set func(*T, int, Trend)) []T {
+	rank := func(rows []T) []T {
+		kept := make([]T, 0, len(rows))
+		for _, r := range rows {
+			if volume(&r) >= opts.MinVolume {
+				kept = append(kept, r)
+			}
+		}
+		sort.SliceStable(kept, func(i, j int) bool {
+			a, b := &kept[i], &kept[j]
+			if va, vb := value(a), value(b); va != vb {
+				return va > vb
+			}
+			if va, vb := volume(a), volume(b); va != vb {
+				return va > vb
+			}
+			return key(a) < key(b)
+		})
+		return kept
+	}
+
+	type prior struct {
+		value float64
+		rank  int
+	}
+	before := make(map[string]prior)
+	for i, r := range rank(previous) {
+		before[key(&r)] = prior{value(&r), i + 1}
+	}
+
+	board := rank(current)
+	if opts.Limit > 0 && len(board) > opts.Limit {
+		board = board[:opts.Limit]
+	}
+	for i := range board {
+		r := &board[i]
+		trend := Trend{Direction: "new"}
+		if p, ok := before[key(r)]; ok {
+			v := value(r)
+			change := v - p.value
+			trend.Previous, trend.Change, trend.PreviousRank = &p.value, &change, &p.rank
+			switch {
+			case math.Abs(change) <= flatTrend*math.Abs(p.value):
+				trend.Direction = "flat"
+			case change > 0:
+				trend.Direction = "up"
+			default:
+				trend.Direction = "down"
+			}
+		}
+		set(r, i+1, trend)
+	}
+	return board
+}
+
+// percentOf returns part/total as a percentage, 0 for an empty total (unlike
+// rate, which treats no traffic as full success)
+func percentOf(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
+
+// topEndpoints ranks endpoints from API performance period totals
+func topEndpoints(ctx context.Context, q Query, opts TopOptions, get func(context.Context, Query) ([]APIPerformanceRow, error)) ([]TopEndpointRow, error) {
+	value, err := resolveOrder(endpointOrders, opts.OrderBy, "p95")
+	if err != nil {
+		return nil, err
+	}
+	cur, prev := periods(q)
+	convert := func(q Query) ([]TopEndpointRow, error) {
+		rows, err := get(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		result := make([]TopEndpointRow, len(rows))
+		for i, r := range rows {
+			result[i] = TopEndpointRow{
+				ServiceName:   r.ServiceName,
+				Endpoint:      r.Endpoint,
+				RequestCount:  r.RequestCount,
+				ErrorCount:    r.ErrorCount,
+				ErrorRate:     percentOf(r.ErrorCount, r.RequestCount),
+				AvgDurationMS: r.AvgDurationMS,
+				P95DurationMS: r.P95DurationMS,
+				TotalTimeMS:   r.AvgDurationMS * float64(r.RequestCount),
+			}
+		}
+		return result, nil
+	}
+	current, err := convert(cur)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := convert(prev)
+	if err != nil {
+		return nil, err
+	}
+	return rankTop(current, previous, opts, value,
+		func(r *TopEndpointRow) int64 { return r.RequestCount },
+		func(r *TopEndpointRow) string { return r.ServiceName + "\x00" + r.Endpoint },
+		func(r *TopEndpointRow, rank int, t Trend) { r.Rank, r.Trend = rank, t },
+	), nil
+}
+
+// topPSPs ranks PSP operations from PSP health period totals
+func topPSPs(ctx context.Context, q Query, opts TopOptions, get func(context.Context, Query) ([]PSPHealthRow, error)) ([]TopPSPRow, error) {
+	value, err := resolveOrder(pspOrders, opts.OrderBy, "failure_rate")
+	if err != nil {
+		return nil, err
+	}
+	cur, prev := periods(q)
+	convert := func(q Query) ([]TopPSPRow, error) {
+		rows, err := get(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		result := make([]TopPSPRow, len(rows))
+		for i, r := range rows {
+			failures := r.TotalCount - r.SuccessCount
+			result[i] = TopPSPRow{
+				PSPName:       r.PSPName,
+				Operation:     r.Operation,
+				TotalCount:    r.TotalCount,
+				FailureCount:  failures,
+				FailureRate:   percentOf(failures, r.TotalCount),
+				P95DurationMS: r.P95DurationMS,
+				TotalAmount:   r.TotalAmount,
+			}
+		}
+		return result, nil
+	}
+	current, err := convert(cur)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := convert(prev)
+	if err != nil {
+		return nil, err
+	}
+	return rankTop(current, previous, opts, value,
+		func(r *TopPSPRow) int64 { return r.TotalCount },
+		func(r *TopPSPRow) string { return r.PSPName + "\x00" + r.Operation },
+		func(r *TopPSPRow, rank int, t Trend) { r.Rank, r.Trend = rank, t },
+	), nil
+}
+
+// topGames ranks providers (by = "provider") or single games (by = "game")
+// from launch period totals
+func topGames(ctx context.Context, by string, q Query, opts TopOptions, get func(context.Context, bool, Query) ([]TopGameRow, error)) ([]TopGameRow, error) {
+	if by != "provider" && by != "game" {
+		return nil, fmt.Errorf("%w: by must be provider or game", ErrInvalidArgument)
+	}
+	value, err := resolveOrder(gameOrders, opts.OrderBy, "failure_rate")
+	if err != nil {
+		return nil, err
+	}
+	cur, prev := periods(q)
+	current, err := get(ctx, by == "game", cur)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := get(ctx, by == "game", prev)
+	if err != nil {
+		return nil, err
+	}
+	return rankTop(current, previous, opts, value,
+		func(r *TopGameRow) int64 { return r.LaunchCount },
+		func(r *TopGameRow) string { return r.Provider + "\x00" + r.GameID },
+		func(r *TopGameRow, rank int, t Trend) { r.Rank, r.Trend = rank, t },
+	), nil
+}
+
+// ============================================
+// POSTGRES
+// ============================================
+
+// GetTopEndpoints ranks endpoints by p95, error_rate, requests or total_time
+func (p *Postgres) GetTopEndpoints(ctx context.Context, q Query, opts TopOptions) ([]TopEndpointRow, error) {
+	return topEndpoints(ctx, q, opts, p.GetAPIPerformance)
+}
+
+// GetTopPSPs ranks PSP operations by failure_rate, failures, volume or p95
+func (p *Postgres) GetTopPSPs(ctx context.Context, q Query, opts TopOptions) ([]TopPSPRow, error) {
+	return topPSPs(ctx, q, opts, p.GetPSPHealth)
+}
+
+// GetTopGames ranks game providers or games by failure_rate, failures, launches or p95_load
+func (p *Postgres) GetTopGames(ctx context.Context, by string, q Query, opts TopOptions) ([]TopGameRow, error) {
+	return topGames(ctx, by, q, opts, p.gameTotals)
+}
+
+// gameTotals returns launch totals per provider, or per provider and game
+func (p *Postgres) gameTotals(ctx context.Context, byGame bool, q Query) ([]TopGameRow, error) {
+	src, gameID := gameProviderSource, "''"
+	if byGame {
+		src, gameID = gameIDSource, "game_id"
+	}
+	plan, err := src.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	rel, args := src.relation(plan)
+	query := fmt.Sprintf(`
+		SELECT provider, %s, launch_count, launch_count - success_count,
+		       COALESCE(approx_percentile(0.95, load_time_sketch), 0)
+		FROM (%s) v
+	`, gameID, rel)
+
+	rows, err := p.reader.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query game totals: %w", err)
+	}
+	defer rows.Close()
+
+	var result []TopGameRow
+	for rows.Next() {
+		var r TopGameRow
+		if err := rows.Scan(&r.Provider, &r.GameID, &r.LaunchCount, &r.FailureCount, &r.P95LoadTimeMS); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		r.FailureRate = percentOf(r.FailureCount, r.LaunchCount)
+		result = append(result, r)
+	}
+
+	return result, rows.Err()
+}
+
+// ============================================
+// MEMORY
+// ============================================
+
+func (m *Memory) GetTopEndpoints(ctx context.Context, q Query, opts TopOptions) ([]TopEndpointRow, error) {
+	return topEndpoints(ctx, q, opts, m.GetAPIPerformance)
+}
+
+func (m *Memory) GetTopPSPs(ctx context.Context, q Query, opts TopOptions) ([]TopPSPRow, error) {
+	return topPSPs(ctx, q, opts, m.GetPSPHealth)
+}
+
+func (m *Memory) GetTopGames(ctx context.Context, by string, q Query, opts TopOptions) ([]TopGameRow, error) {
+	return topGames(ctx, by, q, opts, m.gameTotals)
+}
+
+// gameTotals groups raw launches like the Postgres backend
+func (m *Memory) gameTotals(ctx context.Context, byGame bool, q Query) ([]TopGameRow, error) {
+	src := gameProviderSource
+	if byGame {
+		src = gameIDSource
+	}
+	p, err := src.plan(q)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	type key struct{ provider, gameID string }
+	groups := make(map[key][]model.GameMetric)
+	for _, r := range m.game {
+		if !p.contains(r.Time) || !matches(q.Filters, func(dim string) string { return gameDim(r, dim) }) {
+			continue
+		}
+		k := key{provider: r.Provider}
+		if byGame {
+			if r.GameID == nil {
+				continue
+			}
+			k.gameID = *r.GameID
+		}
+		groups[k] = append(groups[k], r)
+	}
+
+	result := make([]TopGameRow, 0, len(groups))
+	for k, rows := range groups {
+		var loads []float64
+		row := TopGameRow{Provider: k.provider, GameID: k.gameID, LaunchCount: int64(len(rows))}
+		for _, r := range rows {
+			if !r.LaunchSuccess {
+				row.FailureCount++
+			}
+			loads = appendNonNil(loads, r.LoadTimeMS)
+		}
+		row.FailureRate = percentOf(row.FailureCount, row.LaunchCount)
+		row.P95LoadTimeMS = percentileCont(loads, 0.95)
+		result = append(result, row)
+	}
+	return result, nil
+}
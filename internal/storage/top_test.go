@@ -0,0 +1,103 @@
+package storage
+
+import "testing"
+
+func TestRankTop(t *testing.T) {
+	type row struct {
+		key    string
+		value  float64
+		volume int64
+		rank   int
+		trend  Trend
+	}
+	value := func(r *row) float64 { return r.value }
+	volume := func(r *row) int64 { return r.volume }
+	key := func(r *row) string { return r.key }
+	set := func(r *row, rank int, trend Trend) { r.rank, r.trend = rank, trend }
+
+	current := []row{
+		{key: "flat", value: 100.5, volume: 50},
+		{key: "up", value: 300, volume: 50},
+		{key: "down", value: 50, volume: 50},
+		{key: "new", value: 200, volume: 50},
+		{key: "tie-b", value: 10, volume: 80},
+		{key: "tie-a", value: 10, volume: 80},
+		{key: "busier", value: 10, volume: 90},
+		{key: "quiet", value: 1000, volume: 5},
+		{key: "was-quiet", value: 20, volume: 50},
+	}
+	previous := []row{
+		{key: "up", value: 100, volume: 50},
+		{key: "flat", value: 100, volume: 50},
+		{key: "down", value: 80, volume: 50},
+		{key: "was-quiet", value: 500, volume: 5},
+	}
+
+	tests := []struct {
+		name string
+		opts TopOptions
+		want []string
+	}{
+		{"all", TopOptions{MinVolume: 10}, []string{"up", "new", "flat", "down", "was-quiet", "busier", "tie-a", "tie-b"}},
+		{"limit", TopOptions{MinVolume: 10, Limit: 3}, []string{"up", "new", "flat"}},
+		{"no minimum", TopOptions{}, []string{"quiet", "up", "new", "flat", "down", "was-quiet", "busier", "tie-a", "tie-b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board := rankTop(append([]row(nil), current...), previous, tt.opts, value, volume, key, set)
+			if len(board) != len(tt.want) {
+				t.Fatalf("board has %d rows, want %d", len(board), len(tt.want))
+			}
+			for i, r := range board {
+				if r.key != tt.want[i] || r.rank != i+1 {
+					t.Errorf("rank %d = %s (rank %d), want %s", i+1, r.key, r.rank, tt.want[i])
+				}
+			}
+		})
+	}
+
+	trends := map[string]struct {
+		direction    string
+		previous     float64
+		previousRank int
+	}{
+		"up":        {"up", 100, 2},
+		"flat":      {"flat", 100, 1}, // ties on value and volume break by key
+		"down":      {"down", 80, 3},
+		"new":       {"new", 0, 0},
+		"was-quiet": {"new", 0, 0}, // under min_volume in the previous period
+	}
+	for _, r := range rankTop(append([]row(nil), current...), previous, TopOptions{MinVolume: 10}, value, volume, key, set) {
+		want, ok := trends[r.key]
+		if !ok {
+			continue
+		}
+		if r.trend.Direction != want.direction {
+			t.Errorf("%s: direction %q, want %q", r.key, r.trend.Direction, want.direction)
+		}
+		if want.direction == "new" {
+			if r.trend.Previous != nil || r.trend.Change != nil || r.trend.PreviousRank != nil {
+				t.Errorf("%s: new row has a previous value", r.key)
+			}
+			continue
+		}
+		if r.trend.Previous == nil || *r.trend.Previous != want.previous {
+			t.Errorf("%s: previous %v, want %v", r.key, orZero(r.trend.Previous), want.previous)
+		}
+		if r.trend.Change == nil || *r.trend.Change != r.value-want.previous {
+			t.Errorf("%s: change %v, want %v", r.key, orZero(r.trend.Change), r.value-want.previous)
+		}
+		if r.trend.PreviousRank == nil || *r.trend.PreviousRank != want.previousRank {
+			t.Errorf("%s: previous rank %d, want %d", r.key, orZero(r.trend.PreviousRank), want.previousRank)
+		}
+	}
+}
+
+// orZero dereferences p, or returns the zero value for nil
+func orZero[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
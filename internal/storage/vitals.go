@@ -0,0 +1,416 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mcbile/product-pulse/internal/model"
+)
+
+// webVital is one metric of web_vital events with Google's rating thresholds:
+// good up to good, poor above poor, needs improvement in between
+type webVital struct {
+	name, column, label, unit string
+	good, poor                float64
+}
+
+// webVitals are the metrics kept by web_vitals_v3_hourly, in column order
+var webVitals = []webVital{
+	{"lcp", "lcp_ms", "LCP", "ms", 2500, 4000},
+	{"fid", "fid_ms", "FID", "ms", 100, 300},
+	{"cls", "cls", "CLS", "", 0.1, 0.25},
+	{"inp", "inp_ms", "INP", "ms", 200, 500},
+	{"ttfb", "ttfb_ms", "TTFB", "ms", 800, 1800},
+	{"fcp", "fcp_ms", "FCP", "ms", 1800, 3000},
+}
+
+// coreWebVitals are the metrics the Core Web Vitals assessment judges by
+var coreWebVitals = []string{"lcp", "inp", "cls"}
+
+// vitalQuantiles are the percentiles reported per metric
+var vitalQuantiles = []float64{0.5, 0.75, 0.9, 0.99}
+
+// VitalRating is a rating band: good, needs_improvement or poor. It is not a
+// plain string so period comparisons do not take it for a dimension.
+type VitalRating string
+
+// rate returns the band of a value
+func (v webVital) rate(x float64) VitalRating {
+	switch {
+	case x <= v.good:
+		return "good"
+	case x <= v.poor:
+		return "needs_improvement"
+	}
+	return "poor"
+}
+
+// vitalsColumns are the web_vitals aggregate columns: the sample count, then a
+// sketch and the band counts per metric
+func vitalsColumns() []aggColumn {
+	columns := []aggColumn{{"sample_count", "SUM(sample_count)::bigint", "COUNT(*)"}}
+	for _, v := range webVitals {
+		bands := []struct{ name, cond string }{
+			{"good", fmt.Sprintf("%s <= %g", v.column, v.good)},
+			{"needs_improvement", fmt.Sprintf("%s > %g AND %s <= %g", v.column, v.good, v.column, v.poor)},
+			{"poor", fmt.Sprintf("%s > %g", v.column, v.poor)},
+		}
+		columns = append(columns, aggColumn{v.name + "_sketch", fmt.Sprintf("rollup(%s_sketch)", v.name), fmt.Sprintf("percentile_agg(%s)", v.column)})
+		for _, b := range bands {
+			name := v.name + "_" + b.name
+			columns = append(columns, aggColumn{name, fmt.Sprintf("SUM(%s)::bigint", name), fmt.Sprintf("SUM(CASE WHEN %s THEN 1 ELSE 0 END)", b.cond)})
+		}
+	}
+	return columns
+}
+
+// legacyVitalsColumns read the vitals columns from the PERCENTILE_CONT views,
+// which kept the mean and p75 of LCP, FID, CLS and INP
+func legacyVitalsColumns() map[string]string {
+	sketches := make(map[string]string)
+	for _, name := range []string{"lcp", "fid", "cls", "inp"} {
+		v, _ := findVital(name)
+		sketches[name] = legacySketch("sample_count", "avg_"+v.column, map[float64]string{0.75: "p75_" + v.column})
+	}
+	return eraVitalsColumns(sketches, func(string) string { return "SUM(sample_count)" })
+}
+
+// v2VitalsColumns read the vitals columns from the 0005 aggregates, which kept
+// sketches of LCP, FID, CLS and INP
+func v2VitalsColumns() map[string]string {
+	sketches := make(map[string]string)
+	for _, name := range []string{"lcp", "fid", "cls", "inp"} {
+		sketches[name] = fmt.Sprintf("rollup(%s_sketch)", name)
+	}
+	return eraVitalsColumns(sketches, func(sketch string) string { return "num_vals(" + sketch + ")" })
+}
+
+// eraVitalsColumns read the vitals columns from aggregates without band
+// counts, given the merged sketch of each metric they kept: bands are
+// estimated from the sketches and the sample counts, other metrics are empty
+func eraVitalsColumns(sketches map[string]string, count func(sketch string) string) map[string]string {
+	columns := make(map[string]string)
+	for _, v := range webVitals {
+		sketch, ok := sketches[v.name]
+		if !ok {
+			sketch = "NULL::uddsketch"
+		}
+		columns[v.name+"_sketch"] = sketch
+		for name, expr := range sketchBands(v, sketch, count(sketch)) {
+			columns[name] = expr
+		}
+	}
+	return columns
+}
+
+// sketchBands estimates the band counts of a metric from its merged sketch and
+// sample count, for aggregates without band columns
+func sketchBands(v webVital, sketch, count string) map[string]string {
+	good := fmt.Sprintf("approx_percentile_rank(%g, %s)", v.good, sketch)
+	poor := fmt.Sprintf("approx_percentile_rank(%g, %s)", v.poor, sketch)
+	share := func(expr string) string {
+		return fmt.Sprintf("COALESCE(ROUND((%s) * %s), 0)::bigint", expr, count)
+	}
+	return map[string]string{
+		v.name + "_good":              share(good),
+		v.name + "_needs_improvement": share(poor + " - " + good),
+		v.name + "_poor":              share("1 - " + poor),
+	}
+}
+
+// findVital looks a metric up by name
+func findVital(name string) (webVital, bool) {
+	for _, v := range webVitals {
+		if v.name == name {
+			return v, true
+		}
+	}
+	return webVital{}, false
+}
+
+// VitalSummary is the distribution of one Web Vital and its split into rating bands
+type VitalSummary struct {
+	Samples          int64       `json:"samples"`
+	P50              float64     `json:"p50"`
+	P75              float64     `json:"p75"`
+	P90              float64     `json:"p90"`
+	P99              float64     `json:"p99"`
+	Good             int64       `json:"good"`
+	NeedsImprovement int64       `json:"needs_improvement"`
+	Poor             int64       `json:"poor"`
+	GoodPct          float64     `json:"good_pct"` // % of samples rated good
+	Rating           VitalRating `json:"rating"`   // band of the p75; empty without samples
+}
+
+// vitals returns the per-metric fields of a row in webVitals order
+func (r *WebVitalsRow) vitals() []struct {
+	summary  *VitalSummary
+	avg, p75 *float64
+} {
+	return []struct {
+		summary  *VitalSummary
+		avg, p75 *float64
+	}{
+		{&r.LCP, &r.AvgLCPMS, &r.P75LCPMS},
+		{&r.FID, &r.AvgFIDMS, &r.P75FIDMS},
+		{&r.CLS, &r.AvgCLS, &r.P75CLS},
+		{&r.INP, &r.AvgINPMS, &r.P75INPMS},
+		{&r.TTFB, &r.AvgTTFBMS, &r.P75TTFBMS},
+		{&r.FCP, &r.AvgFCPMS, &r.P75FCPMS},
+	}
+}
+
+// rate fills in what follows from the band counts and percentiles: samples,
+// % good, ratings and the Core Web Vitals assessment
+func (r *WebVitalsRow) rate() {
+	fields := r.vitals()
+	assessed := false
+	pass := true
+	for i, v := range webVitals {
+		s := fields[i].summary
+		s.Samples = s.Good + s.NeedsImprovement + s.Poor
+		*fields[i].p75 = s.P75
+		if s.Samples == 0 {
+			continue
+		}
+		s.GoodPct = percentOf(s.Good, s.Samples)
+		s.Rating = v.rate(s.P75)
+		for _, core := range coreWebVitals {
+			if v.name == core {
+				assessed = true
+				pass = pass && s.Rating == "good"
+			}
+		}
+	}
+	if assessed {
+		r.CWVPass = &pass
+	}
+}
+
+// vitalsTimeSeriesExpr returns the per-bucket expression of a Web Vitals time
+// series: mean, p50, p75, p90, p99 or good (% of samples rated good)
+func vitalsTimeSeriesExpr(metric, stat string) (string, error) {
+	v, ok := findVital(metric)
+	if !ok {
+		return "", fmt.Errorf("%w: unknown web vitals metric %q", ErrInvalidArgument, metric)
+	}
+	sketch := v.name + "_sketch"
+	switch stat {
+	case "", "mean":
+		return fmt.Sprintf("COALESCE(mean(rollup(%s)), 0)", sketch), nil
+	case "good":
+		return fmt.Sprintf("COALESCE(SUM(%[1]s_good)::float / NULLIF(SUM(%[1]s_good + %[1]s_needs_improvement + %[1]s_poor), 0) * 100, 0)", v.name), nil
+	}
+	if q, ok := vitalQuantile(stat); ok {
+		return fmt.Sprintf("COALESCE(approx_percentile(%g, rollup(%s)), 0)", q, sketch), nil
+	}
+	return "", fmt.Errorf("%w: stat must be mean, p50, p75, p90, p99 or good", ErrInvalidArgument)
+}
+
+// vitalQuantile parses p50, p75, p90 and p99
+func vitalQuantile(stat string) (float64, bool) {
+	for _, q := range vitalQuantiles {
+		if stat == fmt.Sprintf("p%.0f", q*100) {
+			return q, true
+		}
+	}
+	return 0, false
+}
+
+// ============================================
+// POSTGRES
+// ============================================
+
+// GetWebVitals returns per bucket, device and page the percentiles and rating
+// bands of every Web Vital
+func (p *Postgres) GetWebVitals(ctx context.Context, q Query) ([]WebVitalsRow, error) {
+	plan, err := vitalsSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	rel, args := vitalsSource.relation(plan)
+
+	var exprs []string
+	for _, v := range webVitals {
+		sketch := v.name + "_sketch"
+		exprs = append(exprs, fmt.Sprintf("COALESCE(mean(%s), 0)", sketch))
+		for _, q := range vitalQuantiles {
+			exprs = append(exprs, fmt.Sprintf("COALESCE(approx_percentile(%g, %s), 0)", q, sketch))
+		}
+		exprs = append(exprs, v.name+"_good", v.name+"_needs_improvement", v.name+"_poor")
+	}
+	query := fmt.Sprintf(`
+		SELECT bucket, COALESCE(device_type, 'unknown'), COALESCE(page_path, '/'),
+		       sample_count, %s
+		FROM (%s) v
+		ORDER BY bucket DESC, device_type, page_path
+	`, strings.Join(exprs, ", "), rel)
+
+	rows, err := p.reader.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query web vitals: %w", err)
+	}
+	defer rows.Close()
+
+	var result []WebVitalsRow
+	for rows.Next() {
+		var r WebVitalsRow
+		dest := []any{&r.Bucket, &r.DeviceType, &r.PagePath, &r.SampleCount}
+		for _, f := range r.vitals() {
+			s := f.summary
+			dest = append(dest, f.avg, &s.P50, &s.P75, &s.P90, &s.P99, &s.Good, &s.NeedsImprovement, &s.Poor)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scan row: %w", err)
+		}
+		r.rate()
+		result = append(result, r)
+	}
+
+	return result, rows.Err()
+}
+
+// GetWebVitalsTimeSeries retrieves time series for a specific metric and statistic
+func (p *Postgres) GetWebVitalsTimeSeries(ctx context.Context, metric, stat string, q Query) ([]TimeSeriesPoint, error) {
+	expr, err := vitalsTimeSeriesExpr(metric, stat)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := vitalsSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	rel, args := vitalsSource.relation(plan)
+	query := fmt.Sprintf(`
+		SELECT bucket, %s
+		FROM (%s) v
+		GROUP BY bucket
+		ORDER BY bucket ASC
+	`, expr, rel)
+
+	return p.queryTimeSeries(ctx, "query vitals timeseries", query, args...)
+}
+
+// ============================================
+// MEMORY
+// ============================================
+
+// vitalsAggregate computes web_vitals rows for the plan's range and step
+func (m *Memory) vitalsAggregate(p queryPlan, filters map[string]string) []WebVitalsRow {
+	type key struct {
+		bucket           time.Time
+		device, pagePath string
+	}
+	groups := make(map[key][]model.EnrichedEvent)
+	for _, e := range m.frontend {
+		if e.EventType != "web_vital" || !p.contains(e.Time) || !matches(filters, func(dim string) string { return frontendDim(e, dim) }) {
+			continue
+		}
+		k := key{p.bucket(e.Time), e.DeviceType, e.PagePath}
+		groups[k] = append(groups[k], e)
+	}
+
+	result := make([]WebVitalsRow, 0, len(groups))
+	for k, rows := range groups {
+		r := WebVitalsRow{
+			Bucket:      k.bucket,
+			DeviceType:  orDefault(k.device, "unknown"),
+			PagePath:    orDefault(k.pagePath, "/"),
+			SampleCount: int64(len(rows)),
+		}
+		for i, f := range r.vitals() {
+			summarizeVital(webVitals[i], vitalValues(rows, webVitals[i].name), f.summary, f.avg)
+		}
+		r.rate()
+		result = append(result, r)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if !a.Bucket.Equal(b.Bucket) {
+			return a.Bucket.After(b.Bucket)
+		}
+		if a.DeviceType != b.DeviceType {
+			return a.DeviceType < b.DeviceType
+		}
+		return a.PagePath < b.PagePath
+	})
+	return result
+}
+
+func (m *Memory) GetWebVitalsTimeSeries(ctx context.Context, metric, stat string, q Query) ([]TimeSeriesPoint, error) {
+	if _, err := vitalsTimeSeriesExpr(metric, stat); err != nil {
+		return nil, err
+	}
+	p, err := vitalsSource.plan(q)
+	if err != nil {
+		return nil, err
+	}
+	v, _ := findVital(metric)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	buckets := make(map[time.Time][]float64)
+	for _, e := range m.frontend {
+		if e.EventType != "web_vital" || !p.contains(e.Time) || !matches(q.Filters, func(dim string) string { return frontendDim(e, dim) }) {
+			continue
+		}
+		b := p.bucket(e.Time)
+		buckets[b] = appendNonNil(buckets[b], vitalValue(e, metric))
+	}
+
+	result := make([]TimeSeriesPoint, 0, len(buckets))
+	for b, values := range buckets {
+		var s VitalSummary
+		var avg float64
+		summarizeVital(v, values, &s, &avg)
+		value := avg
+		switch stat {
+		case "good":
+			value = percentOf(s.Good, int64(len(values)))
+		case "p50":
+			value = s.P50
+		case "p75":
+			value = s.P75
+		case "p90":
+			value = s.P90
+		case "p99":
+			value = s.P99
+		}
+		result = append(result, TimeSeriesPoint{Time: b, Value: value})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	return result, nil
+}
+
+// vitalValues collects the non-null values of one metric
+func vitalValues(rows []model.EnrichedEvent, metric string) []float64 {
+	var values []float64
+	for _, e := range rows {
+		values = appendNonNil(values, vitalValue(e, metric))
+	}
+	return values
+}
+
+// summarizeVital computes the percentiles, mean and band counts of values
+func summarizeVital(v webVital, values []float64, s *VitalSummary, avg *float64) {
+	*avg = mean(values)
+	s.P50 = percentileCont(values, 0.5)
+	s.P75 = percentileCont(values, 0.75)
+	s.P90 = percentileCont(values, 0.9)
+	s.P99 = percentileCont(values, 0.99)
+	for _, x := range values {
+		switch v.rate(x) {
+		case "good":
+			s.Good++
+		case "needs_improvement":
+			s.NeedsImprovement++
+		default:
+			s.Poor++
+		}
+	}
+}
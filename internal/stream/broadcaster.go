@@ -0,0 +1,343 @@
+// Package stream computes live dashboard topics once per interval and fans the
+// changes out to Server-Sent Events subscribers.
+//
+// The first event a subscriber gets for a topic is a full snapshot; after that
+// only JSON merge patches (RFC 7386) against the previous value are sent.
+// Merge patches only descend into objects: a changed array, such as the
+// alerts topic, is sent whole, and a member that becomes null is removed.
+// Recent events are kept so a reconnecting client can resume from its
+// Last-Event-ID; if it fell too far behind it gets fresh snapshots instead.
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// historySize is how many events are kept for Last-Event-ID replay
+	historySize = 512
+	// subscriberBuffer is how many events may queue for one client before it
+	// is dropped (it reconnects and replays from history)
+	subscriberBuffer = 64
+	// fetchTimeout bounds one topic computation
+	fetchTimeout = 10 * time.Second
+)
+
+// Event is one SSE message. Patch events carry a merge patch for Topic.
+type Event struct {
+	ID    uint64
+	Topic string
+	Patch bool
+	Data  []byte
+}
+
+// FetchFunc computes the current value of a topic
+type FetchFunc func(ctx context.Context) (any, error)
+
+type topic struct {
+	fetch   FetchFunc
+	refresh chan struct{}
+	subs    int
+	value   any    // decoded latest value, the base for the next patch
+	latest  []byte // encoded latest value
+}
+
+// Broadcaster owns the topics and their subscribers
+type Broadcaster struct {
+	interval time.Duration
+	epoch    string // distinguishes event ids across restarts
+
+	mu      sync.Mutex
+	topics  map[string]*topic
+	order   []string
+	subs    map[*Subscriber]struct{}
+	history []Event
+	seq     uint64
+	closed  bool
+}
+
+// Subscriber receives events for a set of topics on C. C is closed when the
+// subscriber falls behind or the broadcaster shuts down.
+type Subscriber struct {
+	C      chan Event
+	topics map[string]bool
+}
+
+// NewBroadcaster creates a broadcaster that recomputes topics every interval
+func NewBroadcaster(interval time.Duration) *Broadcaster {
+	return &Broadcaster{
+		interval: interval,
+		epoch:    strconv.FormatInt(time.Now().UnixNano(), 36),
+		topics:   make(map[string]*topic),
+		subs:     make(map[*Subscriber]struct{}),
+	}
+}
+
+// Register adds a topic; call before Run
+func (b *Broadcaster) Register(name string, fetch FetchFunc) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.topics[name] = &topic{fetch: fetch, refresh: make(chan struct{}, 1)}
+	b.order = append(b.order, name)
+}
+
+// Topics returns the registered topic names in registration order
+func (b *Broadcaster) Topics() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.order...)
+}
+
+// Run recomputes every topic that has subscribers each interval until ctx is done
+func (b *Broadcaster) Run(ctx context.Context) {
+	b.mu.Lock()
+	var wg sync.WaitGroup
+	for name, t := range b.topics {
+		wg.Add(1)
+		go func(name string, t *topic) {
+			defer wg.Done()
+			b.poll(ctx, name, t)
+		}(name, t)
+	}
+	b.mu.Unlock()
+	wg.Wait()
+}
+
+// Refresh recomputes a topic now instead of waiting for the next tick
+func (b *Broadcaster) Refresh(name string) {
+	b.mu.Lock()
+	t, ok := b.topics[name]
+	b.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case t.refresh <- struct{}{}:
+	default:
+	}
+}
+
+func (b *Broadcaster) poll(ctx context.Context, name string, t *topic) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-t.refresh:
+		}
+
+		b.mu.Lock()
+		idle := t.subs == 0
+		b.mu.Unlock()
+		if idle {
+			continue
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+		v, err := t.fetch(fetchCtx)
+		cancel()
+		if err != nil {
+			slog.Error("failed to compute stream topic", "topic", name, "error", err)
+			continue
+		}
+		if err := b.publish(name, t, v); err != nil {
+			slog.Error("failed to encode stream topic", "topic", name, "error", err)
+		}
+	}
+}
+
+// publish records a new value for the topic and sends a patch to its
+// subscribers if it changed
+func (b *Broadcaster) publish(name string, t *topic, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// Work on the decoded form so patches are computed over plain JSON values
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || bytes.Equal(data, t.latest) {
+		return nil
+	}
+
+	ev := Event{Topic: name, Data: data}
+	if t.latest != nil {
+		patch, err := json.Marshal(mergePatch(t.value, value))
+		if err != nil {
+			return err
+		}
+		ev.Patch, ev.Data = true, patch
+	}
+	b.seq++
+	ev.ID = b.seq
+	t.value, t.latest = value, data
+
+	b.history = append(b.history, ev)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+
+	for s := range b.subs {
+		if !s.topics[name] {
+			continue
+		}
+		select {
+		case s.C <- ev:
+		default:
+			// Too slow: drop it, the client resumes from Last-Event-ID
+			b.removeLocked(s)
+		}
+	}
+	return nil
+}
+
+// EventID formats an event id for the SSE id field
+func (b *Broadcaster) EventID(ev Event) string {
+	return fmt.Sprintf("%s-%d", b.epoch, ev.ID)
+}
+
+// parseEventID returns the sequence number of an id issued by this process, or 0
+func (b *Broadcaster) parseEventID(id string) uint64 {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != b.epoch {
+		return 0
+	}
+	n, _ := strconv.ParseUint(seq, 10, 64)
+	return n
+}
+
+// Subscribe registers a subscriber for topics. With a Last-Event-ID from this
+// process the events after it are replayed if still in history; otherwise the
+// current snapshot of each topic is queued first.
+func (b *Broadcaster) Subscribe(topics []string, lastEventID string) *Subscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &Subscriber{C: make(chan Event, subscriberBuffer+len(b.order)), topics: make(map[string]bool)}
+	if b.closed {
+		close(s.C)
+		return s
+	}
+	for _, name := range topics {
+		if t, ok := b.topics[name]; ok && !s.topics[name] {
+			s.topics[name] = true
+			t.subs++
+			// Compute soon rather than a full interval after the first subscriber
+			if t.subs == 1 {
+				select {
+				case t.refresh <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+
+	var replay []Event
+	lastID := b.parseEventID(lastEventID)
+	resumable := lastID > 0 && lastID <= b.seq && len(b.history) > 0 && b.history[0].ID <= lastID+1
+	if resumable {
+		for _, ev := range b.history {
+			if ev.ID > lastID && s.topics[ev.Topic] {
+				replay = append(replay, ev)
+			}
+		}
+	}
+	if resumable && len(replay) <= subscriberBuffer {
+		for _, ev := range replay {
+			s.C <- ev
+		}
+	} else {
+		// Snapshots reflect every event so far, so resuming from any of them
+		// must replay only what comes after the current sequence
+		for _, name := range b.order {
+			if t := b.topics[name]; s.topics[name] && t.latest != nil {
+				s.C <- Event{ID: b.seq, Topic: name, Data: t.latest}
+			}
+		}
+	}
+
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe removes a subscriber; safe to call after it was dropped
+func (b *Broadcaster) Unsubscribe(s *Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.removeLocked(s)
+}
+
+func (b *Broadcaster) removeLocked(s *Subscriber) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	for name := range s.topics {
+		b.topics[name].subs--
+	}
+	close(s.C)
+}
+
+// Close disconnects all subscribers; used on shutdown so open streams end
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for s := range b.subs {
+		b.removeLocked(s)
+	}
+}
+
+// Subscribers returns the number of connected subscribers
+func (b *Broadcaster) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// mergePatch returns an RFC 7386 merge patch turning old into new. Arrays and
+// scalars are replaced whole. A merge patch cannot set null, so a member that
+// becomes null is removed instead.
+func mergePatch(old, new any) any {
+	o, ok1 := old.(map[string]any)
+	n, ok2 := new.(map[string]any)
+	if !ok1 || !ok2 {
+		return new
+	}
+	patch := make(map[string]any)
+	for k, nv := range n {
+		ov, ok := o[k]
+		if !ok {
+			patch[k] = nv
+			continue
+		}
+		ob, _ := json.Marshal(ov)
+		nb, _ := json.Marshal(nv)
+		if !bytes.Equal(ob, nb) {
+			patch[k] = mergePatch(ov, nv)
+		}
+	}
+	for k := range o {
+		if _, ok := n[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
@@ -0,0 +1,217 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// applyPatch applies an RFC 7386 merge patch the way a client does
+func applyPatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	out := make(map[string]any, len(t))
+	for k, v := range t {
+		out[k] = v
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(out, k)
+		} else {
+			out[k] = applyPatch(out[k], v)
+		}
+	}
+	return out
+}
+
+func decode(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("decode %s: %v", s, err)
+	}
+	return v
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name, old, new, patch string
+	}{
+		{"unchanged", `{"a":1,"b":{"c":2}}`, `{"a":1,"b":{"c":2}}`, `{}`},
+		{"changed member", `{"a":1,"b":2}`, `{"a":1,"b":3}`, `{"b":3}`},
+		{"nested member", `{"api":{"p95":120,"rps":4}}`, `{"api":{"p95":130,"rps":4}}`, `{"api":{"p95":130}}`},
+		{"added and removed", `{"a":1,"b":2}`, `{"a":1,"c":3}`, `{"b":null,"c":3}`},
+		{"array replaced whole", `{"list":[1,2,3],"n":3}`, `{"list":[1,2,4],"n":3}`, `{"list":[1,2,4]}`},
+		{"array topic", `[{"id":1},{"id":2}]`, `[{"id":2}]`, `[{"id":2}]`},
+		{"object to scalar", `{"a":{"b":1}}`, `{"a":5}`, `{"a":5}`},
+		{"scalar to object", `{"a":5}`, `{"a":{"b":1}}`, `{"a":{"b":1}}`},
+		{"member turns null", `{"a":1,"b":2}`, `{"a":1,"b":null}`, `{"b":null}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, new := decode(t, tt.old), decode(t, tt.new)
+			patch := mergePatch(old, new)
+			if !reflect.DeepEqual(patch, decode(t, tt.patch)) {
+				got, _ := json.Marshal(patch)
+				t.Errorf("mergePatch = %s, want %s", got, tt.patch)
+			}
+			// Applying the patch gives the new value, without null members
+			want := applyPatch(map[string]any{}, new)
+			if _, ok := new.(map[string]any); !ok {
+				want = new
+			}
+			if got := applyPatch(old, patch); !reflect.DeepEqual(got, want) {
+				t.Errorf("old + patch = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// testBroadcaster has two topics with values published but no poll loop
+func testBroadcaster(t *testing.T) *Broadcaster {
+	t.Helper()
+	b := NewBroadcaster(0)
+	b.Register("overview", nil)
+	b.Register("alerts", nil)
+	publish(t, b, "overview", map[string]int{"rps": 1})
+	publish(t, b, "alerts", []string{})
+	return b
+}
+
+func publish(t *testing.T, b *Broadcaster, name string, v any) {
+	t.Helper()
+	if err := b.publish(name, b.topics[name], v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// queued drains the events already queued for s
+func queued(s *Subscriber) []Event {
+	var events []Event
+	for {
+		select {
+		case ev, ok := <-s.C:
+			if !ok {
+				return events
+			}
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+}
+
+func describe(events []Event) []string {
+	var out []string
+	for _, ev := range events {
+		kind := "snapshot"
+		if ev.Patch {
+			kind = "patch"
+		}
+		out = append(out, fmt.Sprintf("%d %s %s %s", ev.ID, ev.Topic, kind, ev.Data))
+	}
+	return out
+}
+
+func checkEvents(t *testing.T, got []Event, want ...string) {
+	t.Helper()
+	if d := describe(got); !reflect.DeepEqual(d, want) {
+		t.Errorf("events =\n%q\nwant\n%q", d, want)
+	}
+}
+
+func TestSubscribeSnapshots(t *testing.T) {
+	b := testBroadcaster(t)
+	s := b.Subscribe([]string{"alerts", "overview", "unknown"}, "")
+	// Snapshots come in registration order, at the current sequence
+	checkEvents(t, queued(s), `2 overview snapshot {"rps":1}`, `2 alerts snapshot []`)
+
+	publish(t, b, "overview", map[string]int{"rps": 1})
+	publish(t, b, "overview", map[string]int{"rps": 2})
+	publish(t, b, "alerts", []string{"psp down"})
+	checkEvents(t, queued(s), `3 overview patch {"rps":2}`, `4 alerts patch ["psp down"]`)
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	b := testBroadcaster(t)
+	last := b.EventID(Event{ID: 2})
+	publish(t, b, "overview", map[string]int{"rps": 2})
+	publish(t, b, "alerts", []string{"psp down"})
+	publish(t, b, "overview", map[string]int{"rps": 3})
+
+	s := b.Subscribe([]string{"overview"}, last)
+	checkEvents(t, queued(s), `3 overview patch {"rps":2}`, `5 overview patch {"rps":3}`)
+
+	// Up to date: nothing to replay
+	s = b.Subscribe([]string{"overview", "alerts"}, b.EventID(Event{ID: 5}))
+	checkEvents(t, queued(s))
+}
+
+func TestSubscribeAcrossRestart(t *testing.T) {
+	before := testBroadcaster(t)
+	publish(t, before, "overview", map[string]int{"rps": 2})
+	last := before.EventID(Event{ID: 3})
+
+	b := testBroadcaster(t)
+	b.epoch = before.epoch + "x"
+	publish(t, b, "overview", map[string]int{"rps": 5})
+	// The sequence numbers overlap, but the id is of another process
+	s := b.Subscribe([]string{"overview"}, last)
+	checkEvents(t, queued(s), `3 overview snapshot {"rps":5}`)
+
+	for _, id := range []string{"garbage", "", b.epoch + "-x", b.epoch + "-99"} {
+		s := b.Subscribe([]string{"overview"}, id)
+		checkEvents(t, queued(s), `3 overview snapshot {"rps":5}`)
+	}
+}
+
+func TestSubscribeHistoryOverflow(t *testing.T) {
+	b := testBroadcaster(t)
+	last := b.EventID(Event{ID: 2})
+	for i := 0; i < historySize; i++ {
+		publish(t, b, "overview", map[string]int{"rps": 10 + i})
+	}
+	if len(b.history) != historySize || b.history[0].ID != 3 {
+		t.Fatalf("history holds %d events from %d", len(b.history), b.history[0].ID)
+	}
+
+	// Event 3 is still kept, but more events were missed than a subscriber
+	// can queue, so it resyncs from snapshots
+	s := b.Subscribe([]string{"overview"}, last)
+	checkEvents(t, queued(s), fmt.Sprintf(`%d overview snapshot {"rps":%d}`, historySize+2, historySize+9))
+
+	// Once event 3 is gone, a resync is the only way as well
+	publish(t, b, "overview", map[string]int{"rps": 0})
+	s = b.Subscribe([]string{"alerts"}, last)
+	checkEvents(t, queued(s), fmt.Sprintf(`%d alerts snapshot []`, historySize+3))
+
+	// A recent id still replays only what it missed
+	s = b.Subscribe([]string{"overview"}, b.EventID(Event{ID: uint64(historySize + 2)}))
+	checkEvents(t, queued(s), fmt.Sprintf(`%d overview patch {"rps":0}`, historySize+3))
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	b := testBroadcaster(t)
+	s := b.Subscribe([]string{"overview"}, "")
+	for i := 0; i < cap(s.C)+1; i++ {
+		publish(t, b, "overview", map[string]int{"rps": 100 + i})
+	}
+	events := queued(s)
+	if len(events) != cap(s.C) {
+		t.Errorf("slow subscriber got %d events, want %d", len(events), cap(s.C))
+	}
+	if _, ok := <-s.C; ok {
+		t.Error("slow subscriber is still connected")
+	}
+	if b.Subscribers() != 0 || b.topics["overview"].subs != 0 {
+		t.Errorf("subscribers = %d, overview subs = %d; want 0", b.Subscribers(), b.topics["overview"].subs)
+	}
+	b.Unsubscribe(s)
+}
@@ -15,6 +15,7 @@ type Client struct {
 	endpoint   string
 	httpClient *http.Client
 	siteID     string
+	release    string
 
 	// Batching
 	mu            sync.Mutex
@@ -33,6 +34,7 @@ type Client struct {
 type ClientConfig struct {
 	Endpoint      string
 	SiteID        string
+	Release       string // build or version tag stamped on metrics that do not set their own
 	FlushInterval time.Duration
 	BatchSize     int
 	Timeout       time.Duration
@@ -52,6 +54,7 @@ type APIMetric struct {
 	ErrorMessage *string                `json:"error_message,omitempty"`
 	RequestSize  *int                   `json:"request_size,omitempty"`
 	ResponseSize *int                   `json:"response_size,omitempty"`
+	Release      *string                `json:"release,omitempty"`
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
 }
 
@@ -68,6 +71,7 @@ type PSPMetric struct {
 	ErrorCode       *string                `json:"error_code,omitempty"`
 	ErrorMessage    *string                `json:"error_message,omitempty"`
 	PSPResponseCode *string                `json:"psp_response_code,omitempty"`
+	Release         *string                `json:"release,omitempty"`
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`
 }
 
@@ -83,6 +87,7 @@ type GameMetric struct {
 	DeviceType    *string                `json:"device_type,omitempty"`
 	ErrorType     *string                `json:"error_type,omitempty"`
 	ErrorMessage  *string                `json:"error_message,omitempty"`
+	Release       *string                `json:"release,omitempty"`
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
 }
 
@@ -98,6 +103,7 @@ type WebSocketMetric struct {
 	CloseReason      *string                `json:"close_reason,omitempty"`
 	Endpoint         *string                `json:"endpoint,omitempty"`
 	DeviceType       *string                `json:"device_type,omitempty"`
+	Release          *string                `json:"release,omitempty"`
 	Metadata         map[string]interface{} `json:"metadata,omitempty"`
 }
 
@@ -115,6 +121,7 @@ func NewClient(cfg ClientConfig) *Client {
 	c := &Client{
 		endpoint: cfg.Endpoint,
 		siteID:   cfg.SiteID,
+		release:  cfg.Release,
 		httpClient: &http.Client{
 			Timeout: cfg.Timeout,
 		},
@@ -151,6 +158,9 @@ func (c *Client) TrackAPI(m APIMetric) {
 	if m.Time.IsZero() {
 		m.Time = time.Now().UTC()
 	}
+	if m.Release == nil {
+		m.Release = c.releaseTag()
+	}
 
 	c.mu.Lock()
 	c.apiMetrics = append(c.apiMetrics, m)
@@ -167,6 +177,9 @@ func (c *Client) TrackPSP(m PSPMetric) {
 	if m.Time.IsZero() {
 		m.Time = time.Now().UTC()
 	}
+	if m.Release == nil {
+		m.Release = c.releaseTag()
+	}
 
 	c.mu.Lock()
 	c.pspMetrics = append(c.pspMetrics, m)
@@ -183,6 +196,9 @@ func (c *Client) TrackGame(m GameMetric) {
 	if m.Time.IsZero() {
 		m.Time = time.Now().UTC()
 	}
+	if m.Release == nil {
+		m.Release = c.releaseTag()
+	}
 
 	c.mu.Lock()
 	c.gameMetrics = append(c.gameMetrics, m)
@@ -199,6 +215,9 @@ func (c *Client) TrackWebSocket(m WebSocketMetric) {
 	if m.Time.IsZero() {
 		m.Time = time.Now().UTC()
 	}
+	if m.Release == nil {
+		m.Release = c.releaseTag()
+	}
 
 	c.mu.Lock()
 	c.wsMetrics = append(c.wsMetrics, m)
@@ -210,6 +229,14 @@ func (c *Client) TrackWebSocket(m WebSocketMetric) {
 	}
 }
 
+// releaseTag returns the configured release, or nil when none is set
+func (c *Client) releaseTag() *string {
+	if c.release == "" {
+		return nil
+	}
+	return &c.release
+}
+
 // Flush sends all buffered metrics
 func (c *Client) Flush(ctx context.Context) error {
 	c.mu.Lock()
@@ -19,10 +19,11 @@ echo ""
 # 1. Enable TimescaleDB extension
 echo "[1/3] Enabling TimescaleDB extension..."
 psql "$DATABASE_URL" -c "CREATE EXTENSION IF NOT EXISTS timescaledb;"
+psql "$DATABASE_URL" -c "CREATE EXTENSION IF NOT EXISTS timescaledb_toolkit;"
 
-# 2. Apply schema
-echo "[2/3] Applying schema..."
-psql "$DATABASE_URL" -f kaasino_pulse_schema.sql
+# 2. Apply schema migrations
+echo "[2/3] Applying migrations..."
+DATABASE_URL="$DATABASE_URL" go run ./cmd/collector migrate up
 
 # 3. Verify
 echo "[3/3] Verifying installation..."